@@ -8,10 +8,12 @@ import (
 
 // LightData represents a single brightness measurement point
 type LightData struct {
-	Time       time.Time `json:"-"`
-	Longitude  float64   `json:"-"`
-	Latitude   float64   `json:"-"`
-	Brightness float64   `json:"-"`
+	Time         time.Time `json:"-"`
+	Longitude    float64   `json:"-"`
+	Latitude     float64   `json:"-"`
+	Brightness   float64   `json:"-"`
+	Quality      *int      `json:"-"` // VIIRS quality flag, nil when not provided
+	CloudFreeObs *int      `json:"-"` // cloud-free observation count, nil when not provided
 }
 
 // AggregatedLightData represents aggregated brightness data for a grid cell and time bucket
@@ -41,11 +43,15 @@ type TimeRange struct {
 
 // AggregationConfig defines parameters for data aggregation
 type AggregationConfig struct {
-	SpatialResolutionKm float64       `json:"spatial_resolution_km"`
-	TemporalInterval    time.Duration `json:"temporal_interval"`
-	AggregationMethod   string        `json:"aggregation_method"` // "average", "sum", "max", "min"
-	FilterBounds        *BoundingBox  `json:"filter_bounds,omitempty"`
-	TimeRange           *TimeRange    `json:"time_range,omitempty"`
+	SpatialResolutionKm float64        `json:"spatial_resolution_km"`
+	TemporalInterval    time.Duration  `json:"temporal_interval"`
+	CalendarUnit        CalendarUnit   `json:"calendar_unit,omitempty"` // overrides TemporalInterval when set
+	Location            *time.Location `json:"-"`                       // bucket alignment time zone, UTC when nil
+	Origin              time.Time      `json:"origin,omitempty"`        // custom bucket origin, see TemporalAggregator
+	AggregationMethod   string         `json:"aggregation_method"`      // "average", "sum", "max", "min"
+	FilterBounds        *BoundingBox   `json:"filter_bounds,omitempty"`
+	TimeRange           *TimeRange     `json:"time_range,omitempty"`
+	Quality             *QualityFilter `json:"quality,omitempty"`
 }
 
 // GridCoordinate represents a snapped grid coordinate
@@ -81,11 +87,12 @@ func (sa *SpatialAggregator) calculateGridSize(latitude float64) (lonGridSize, l
 
 // snapToGrid snaps coordinates to the nearest grid point
 func (sa *SpatialAggregator) snapToGrid(longitude, latitude float64) GridCoordinate {
-	lonGridSize, latGridSize := sa.calculateGridSize(latitude)
+	_, latGridSize := sa.calculateGridSize(latitude)
+	gridLat := math.Round(latitude/latGridSize) * latGridSize
 	
-	// Snap to grid center
+	// Size the longitude step at the snapped row, so every point of a cell lands on the same center
+	lonGridSize, _ := sa.calculateGridSize(gridLat)
 	gridLon := math.Round(longitude/lonGridSize) * lonGridSize
-	gridLat := math.Round(latitude/latGridSize) * latGridSize
 	
 	return GridCoordinate{
 		Longitude: math.Round(gridLon*1000000) / 1000000, // 6 decimal places
@@ -93,30 +100,66 @@ func (sa *SpatialAggregator) snapToGrid(longitude, latitude float64) GridCoordin
 	}
 }
 
-// TemporalAggregator handles time bucketing
+// TemporalAggregator handles time bucketing.
+// Fixed intervals count from Origin, or from 1970-01-01 midnight in Location when Origin is zero.
+// Calendar units are described in calendar.go.
 type TemporalAggregator struct {
-	config *AggregationConfig
+	config   *AggregationConfig
+	location *time.Location
+	origin   time.Time
 }
 
 // NewTemporalAggregator creates a new temporal aggregator
 func NewTemporalAggregator(config *AggregationConfig) *TemporalAggregator {
+	location := config.Location
+	if location == nil {
+		location = time.UTC
+	}
+
+	origin := config.Origin
+	if origin.IsZero() {
+		origin = defaultCalendarOrigin(config.CalendarUnit, location)
+	}
+
 	return &TemporalAggregator{
-		config: config,
+		config:   config,
+		location: location,
+		origin:   origin,
 	}
 }
 
 // snapToBucket snaps a timestamp to the appropriate time bucket
 func (ta *TemporalAggregator) snapToBucket(timestamp time.Time) time.Time {
+	return ta.bucketStart(ta.bucketIndex(timestamp))
+}
+
+// bucketIndex returns the sequential number of the bucket containing timestamp
+func (ta *TemporalAggregator) bucketIndex(timestamp time.Time) int64 {
+	if ta.config.CalendarUnit.valid() {
+		return ta.calendarBucketIndex(timestamp)
+	}
+
 	// Get the duration in nanoseconds
 	intervalNanos := ta.config.TemporalInterval.Nanoseconds()
 	
-	// Convert timestamp to nanoseconds since Unix epoch
-	timestampNanos := timestamp.UnixNano()
-	
-	// Calculate the bucket start
-	bucketStartNanos := (timestampNanos / intervalNanos) * intervalNanos
+	// Nanoseconds since the bucket origin
+	timestampNanos := timestamp.UnixNano() - ta.origin.UnixNano()
 	
-	return time.Unix(0, bucketStartNanos).UTC()
+	// Floor division so timestamps before the origin land in the bucket that contains them
+	return floorDiv(timestampNanos, intervalNanos)
+}
+
+// bucketStart returns the start time of the bucket with the given index
+func (ta *TemporalAggregator) bucketStart(index int64) time.Time {
+	if ta.config.CalendarUnit.valid() {
+		return ta.calendarBucketStart(index)
+	}
+
+	start := time.Unix(0, ta.origin.UnixNano()+index*ta.config.TemporalInterval.Nanoseconds())
+	if ta.config.Location == nil {
+		return start.UTC()
+	}
+	return start.In(ta.location)
 }
 
 // DataAggregator combines spatial and temporal aggregation
@@ -124,15 +167,30 @@ type DataAggregator struct {
 	spatialAgg  *SpatialAggregator
 	temporalAgg *TemporalAggregator
 	config      *AggregationConfig
+	exclusions  *ExclusionCounts
 }
 
-// NewDataAggregator creates a new data aggregator
-func NewDataAggregator(config *AggregationConfig) *DataAggregator {
+// NewDataAggregator creates a new data aggregator. It rejects an unknown calendar unit and, without a
+// calendar unit, a temporal interval that is not positive.
+func NewDataAggregator(config *AggregationConfig) (*DataAggregator, error) {
+	if config.CalendarUnit != "" && !config.CalendarUnit.valid() {
+		return nil, fmt.Errorf("unknown calendar unit %q", config.CalendarUnit)
+	}
+	if config.CalendarUnit == "" && config.TemporalInterval <= 0 {
+		return nil, fmt.Errorf("temporal interval must be positive without a calendar unit, got %v", config.TemporalInterval)
+	}
+
 	return &DataAggregator{
 		spatialAgg:  NewSpatialAggregator(config),
 		temporalAgg: NewTemporalAggregator(config),
 		config:      config,
-	}
+		exclusions:  NewExclusionCounts(),
+	}, nil
+}
+
+// Exclusions returns the number of points filtered out per reason so far
+func (da *DataAggregator) Exclusions() map[ExclusionReason]int64 {
+	return da.exclusions.Snapshot()
 }
 
 // aggregationKey represents a unique key for spatial-temporal aggregation
@@ -169,6 +227,25 @@ func (acc *AggregationAccumulator) Add(brightness float64) {
 	}
 }
 
+// Merge combines another accumulator into this one
+func (acc *AggregationAccumulator) Merge(other *AggregationAccumulator) {
+	if other.Count == 0 {
+		return
+	}
+	if acc.Count == 0 {
+		*acc = *other
+		return
+	}
+	acc.Sum += other.Sum
+	acc.Count += other.Count
+	if other.Min < acc.Min {
+		acc.Min = other.Min
+	}
+	if other.Max > acc.Max {
+		acc.Max = other.Max
+	}
+}
+
 // Average calculates the average brightness
 func (acc *AggregationAccumulator) Average() float64 {
 	if acc.Count == 0 {
@@ -177,14 +254,24 @@ func (acc *AggregationAccumulator) Average() float64 {
 	return acc.Sum / float64(acc.Count)
 }
 
-// shouldIncludePoint checks if a point should be included based on filters
+// shouldIncludePoint checks if a point should be included based on filters and counts the reason if not
 func (da *DataAggregator) shouldIncludePoint(data LightData) bool {
+	reason := da.exclusionReason(data)
+	if reason != "" {
+		da.exclusions.Add(reason, 1)
+		return false
+	}
+	return true
+}
+
+// exclusionReason returns why a point is filtered out, or "" if it is included
+func (da *DataAggregator) exclusionReason(data LightData) ExclusionReason {
 	// Check spatial bounds
 	if da.config.FilterBounds != nil {
 		bounds := da.config.FilterBounds
 		if data.Longitude < bounds.MinLongitude || data.Longitude > bounds.MaxLongitude ||
 			data.Latitude < bounds.MinLatitude || data.Latitude > bounds.MaxLatitude {
-			return false
+			return ExcludeOutOfBounds
 		}
 	}
 	
@@ -192,11 +279,40 @@ func (da *DataAggregator) shouldIncludePoint(data LightData) bool {
 	if da.config.TimeRange != nil {
 		timeRange := da.config.TimeRange
 		if data.Time.Before(timeRange.Start) || data.Time.After(timeRange.End) {
-			return false
+			return ExcludeOutOfTimeRange
 		}
 	}
 	
-	return true
+	// Check quality and cloud cover layers
+	return da.config.Quality.exclusion(data.Quality, data.CloudFreeObs)
+}
+
+// keyFor snaps a point to its grid cell and time bucket
+func (da *DataAggregator) keyFor(point LightData) aggregationKey {
+	// Snap to spatial grid
+	gridCoord := da.spatialAgg.snapToGrid(point.Longitude, point.Latitude)
+	
+	// Snap to temporal bucket
+	timeBucket := da.temporalAgg.snapToBucket(point.Time)
+	
+	return aggregationKey{
+		GridLongitude: gridCoord.Longitude,
+		GridLatitude:  gridCoord.Latitude,
+		TimeBucket:    timeBucket.Unix(),
+	}
+}
+
+// resultFor converts an accumulator into the result format
+func (da *DataAggregator) resultFor(key aggregationKey, acc *AggregationAccumulator) AggregatedLightData {
+	return AggregatedLightData{
+		GridLongitude: key.GridLongitude,
+		GridLatitude:  key.GridLatitude,
+		TimeBucket:    time.Unix(key.TimeBucket, 0).In(da.temporalAgg.location),
+		AvgBrightness: acc.Average(),
+		MinBrightness: acc.Min,
+		MaxBrightness: acc.Max,
+		Count:         acc.Count,
+	}
 }
 
 // AggregateData performs spatial-temporal aggregation on a slice of LightData
@@ -209,18 +325,7 @@ func (da *DataAggregator) AggregateData(data []LightData) []AggregatedLightData
 			continue
 		}
 		
-		// Snap to spatial grid
-		gridCoord := da.spatialAgg.snapToGrid(point.Longitude, point.Latitude)
-		
-		// Snap to temporal bucket
-		timeBucket := da.temporalAgg.snapToBucket(point.Time)
-		
-		// Create aggregation key
-		key := aggregationKey{
-			GridLongitude: gridCoord.Longitude,
-			GridLatitude:  gridCoord.Latitude,
-			TimeBucket:    timeBucket.Unix(),
-		}
+		key := da.keyFor(point)
 		
 		// Add to accumulator
 		if _, exists := aggregates[key]; !exists {
@@ -232,91 +337,12 @@ func (da *DataAggregator) AggregateData(data []LightData) []AggregatedLightData
 	// Convert to result format
 	results := make([]AggregatedLightData, 0, len(aggregates))
 	for key, acc := range aggregates {
-		result := AggregatedLightData{
-			GridLongitude: key.GridLongitude,
-			GridLatitude:  key.GridLatitude,
-			TimeBucket:    time.Unix(key.TimeBucket, 0).UTC(),
-			AvgBrightness: acc.Average(),
-			MinBrightness: acc.Min,
-			MaxBrightness: acc.Max,
-			Count:         acc.Count,
-		}
-		
-		results = append(results, result)
+		results = append(results, da.resultFor(key, acc))
 	}
 	
 	return results
 }
 
-// StreamingAggregator handles real-time data aggregation with memory efficiency
-type StreamingAggregator struct {
-	aggregator  *DataAggregator
-	buffer      []LightData
-	bufferSize  int
-	outputChan  chan []AggregatedLightData
-	windowSize  time.Duration
-	lastFlush   time.Time
-}
-
-// NewStreamingAggregator creates a streaming aggregator for real-time processing
-func NewStreamingAggregator(config *AggregationConfig, bufferSize int, windowSize time.Duration) *StreamingAggregator {
-	return &StreamingAggregator{
-		aggregator:  NewDataAggregator(config),
-		buffer:      make([]LightData, 0, bufferSize),
-		bufferSize:  bufferSize,
-		outputChan:  make(chan []AggregatedLightData, 10),
-		windowSize:  windowSize,
-		lastFlush:   time.Now(),
-	}
-}
-
-// AddPoint adds a new data point to the streaming aggregator
-func (sa *StreamingAggregator) AddPoint(data LightData) {
-	sa.buffer = append(sa.buffer, data)
-	
-	// Check if we should flush based on buffer size or time window
-	now := time.Now()
-	shouldFlush := len(sa.buffer) >= sa.bufferSize || 
-		now.Sub(sa.lastFlush) >= sa.windowSize
-	
-	if shouldFlush {
-		sa.flush()
-	}
-}
-
-// flush processes the current buffer and sends results to output channel
-func (sa *StreamingAggregator) flush() {
-	if len(sa.buffer) == 0 {
-		return
-	}
-	
-	// Process buffer
-	results := sa.aggregator.AggregateData(sa.buffer)
-	
-	// Send results (non-blocking)
-	select {
-	case sa.outputChan <- results:
-	default:
-		// Channel is full, skip this batch
-		fmt.Printf("Warning: Output channel full, dropping %d aggregated points\n", len(results))
-	}
-	
-	// Clear buffer
-	sa.buffer = sa.buffer[:0]
-	sa.lastFlush = time.Now()
-}
-
-// GetOutputChannel returns the channel for receiving aggregated results
-func (sa *StreamingAggregator) GetOutputChannel() <-chan []AggregatedLightData {
-	return sa.outputChan
-}
-
-// Close finalizes the streaming aggregator
-func (sa *StreamingAggregator) Close() {
-	sa.flush()
-	close(sa.outputChan)
-}
-
 // DefaultConfigurations provides common aggregation configurations
 var (
 	// HighResolutionConfig: 500m grid, 15-minute intervals
@@ -339,4 +365,20 @@ var (
 		TemporalInterval:    24 * time.Hour,
 		AggregationMethod:   "average",
 	}
+	
+	// MonthlyConfig: 1km grid, calendar months in Taiwan time, matching animal_aggregated_data
+	MonthlyConfig = &AggregationConfig{
+		SpatialResolutionKm: 1.0,
+		CalendarUnit:        CalendarMonth,
+		Location:            TaiwanLocation,
+		AggregationMethod:   "average",
+	}
+	
+	// SeasonalConfig: 5km grid, meteorological seasons in Taiwan time, matching getSeasonFromMonth
+	SeasonalConfig = &AggregationConfig{
+		SpatialResolutionKm: 5.0,
+		CalendarUnit:        CalendarSeason,
+		Location:            TaiwanLocation,
+		AggregationMethod:   "average",
+	}
 )
\ No newline at end of file
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestSnapToGridSharesCells(t *testing.T) {
+	sa := NewSpatialAggregator(&AggregationConfig{SpatialResolutionKm: 5})
+	lonSize, latSize := sa.calculateGridSize(23.5)
+
+	// Points scattered inside one cell around Taiwan all snap to its centre
+	center := sa.snapToGrid(121, 23.5)
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 1000; i++ {
+		lon := center.Longitude + (rng.Float64()-0.5)*0.98*lonSize
+		lat := center.Latitude + (rng.Float64()-0.5)*0.98*latSize
+		if got := sa.snapToGrid(lon, lat); got != center {
+			t.Fatalf("(%f, %f) snapped to %+v, want the cell centre %+v", lon, lat, got, center)
+		}
+	}
+
+	// Snapping is idempotent
+	if got := sa.snapToGrid(center.Longitude, center.Latitude); got != center {
+		t.Errorf("cell centre %+v snapped to %+v", center, got)
+	}
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"sort"
+)
+
+// madScale turns a median absolute deviation into a consistent estimate of the standard deviation
+const madScale = 1.4826
+
+// meanADScale does the same for the mean absolute deviation, the fallback when more than half the
+// baseline values are equal
+const meanADScale = 1.2533
+
+// AnomalyConfig controls analyze-anomalies
+type AnomalyConfig struct {
+	GridKm     float64 // SpatialAggregator resolution of the grid cell series, 0 for counties only
+	MinYears   int     // fewest other years of the same calendar month forming a baseline
+	ZThreshold float64 // robust z-score beyond which a month is flagged
+	ReportPath string  // optional CSV report of the flagged months
+}
+
+// AnomalyResult is a month whose brightness departs from the same calendar month of the other years,
+// a row of light_brightness_anomaly
+type AnomalyResult struct {
+	Scope          string   `json:"scope"` // county or grid
+	County         *string  `json:"county"`
+	GridLongitude  *float64 `json:"grid_longitude"`
+	GridLatitude   *float64 `json:"grid_latitude"`
+	ResolutionKm   *float64 `json:"resolution_km"`
+	Year           int      `json:"year"`
+	Month          int      `json:"month"`
+	Brightness     float64  `json:"brightness"`
+	Baseline       float64  `json:"baseline"`        // median of the same calendar month in the other years
+	Deviation      float64  `json:"deviation"`       // brightness - baseline
+	RelativeChange *float64 `json:"relative_change"` // deviation / baseline, nil for a zero baseline
+	RobustZ        float64  `json:"robust_z"`
+	BaselineYears  int      `json:"baseline_years"`
+	Direction      string   `json:"direction"` // jump or drop
+}
+
+// anomalyColumns are the light_brightness_anomaly columns in AnomalyResult field order
+var anomalyColumns = []string{
+	"scope", "county", "grid_longitude", "grid_latitude", "resolution_km", "year", "month",
+	"brightness", "baseline", "deviation", "relative_change", "robust_z", "baseline_years", "direction",
+}
+
+func (a *AnomalyResult) values() []interface{} {
+	return []interface{}{
+		a.Scope, a.County, a.GridLongitude, a.GridLatitude, a.ResolutionKm, a.Year, a.Month,
+		a.Brightness, a.Baseline, a.Deviation, a.RelativeChange, a.RobustZ, a.BaselineYears, a.Direction,
+	}
+}
+
+// robustSpread is the MAD scaled to a standard deviation, falling back to the scaled mean absolute
+// deviation when the MAD is zero
+func robustSpread(v []float64, center float64) float64 {
+	deviations := make([]float64, len(v))
+	var sum float64
+	for i, x := range v {
+		deviations[i] = math.Abs(x - center)
+		sum += deviations[i]
+	}
+	if mad := median(deviations); mad > 0 {
+		return madScale * mad
+	}
+	return meanADScale * sum / float64(len(v))
+}
+
+// detectAnomalies flags the months of series whose robust z-score against the same calendar month of
+// the other years exceeds threshold. Leaving the month out of its own baseline keeps a single jump
+// from hiding itself.
+func detectAnomalies(series monthlySeries, minYears int, threshold float64) []AnomalyResult {
+	byMonth := make([][]int, 12)
+	for index := range series {
+		byMonth[index%12] = append(byMonth[index%12], index)
+	}
+
+	var anomalies []AnomalyResult
+	baseline := make([]float64, 0, 16)
+	for _, indices := range byMonth {
+		if len(indices)-1 < minYears {
+			continue
+		}
+		sort.Ints(indices)
+		for _, index := range indices {
+			baseline = baseline[:0]
+			for _, other := range indices {
+				if other != index {
+					baseline = append(baseline, series[other])
+				}
+			}
+			center := median(baseline)
+			spread := robustSpread(baseline, center)
+			if spread == 0 {
+				continue
+			}
+
+			value := series[index]
+			z := (value - center) / spread
+			if math.Abs(z) < threshold {
+				continue
+			}
+			anomaly := AnomalyResult{
+				Year:          index / 12,
+				Month:         index%12 + 1,
+				Brightness:    value,
+				Baseline:      center,
+				Deviation:     value - center,
+				RobustZ:       z,
+				BaselineYears: len(baseline),
+				Direction:     "jump",
+			}
+			if center != 0 {
+				anomaly.RelativeChange = floatPtr((value - center) / center)
+			}
+			if z < 0 {
+				anomaly.Direction = "drop"
+			}
+			anomalies = append(anomalies, anomaly)
+		}
+	}
+	return anomalies
+}
+
+// runAnomalyDetection rebuilds light_brightness_anomaly from the monthly brightness of every county and,
+// unless config.GridKm is 0, every grid cell, and writes the optional CSV report
+func runAnomalyDetection(ctx context.Context, db *sql.DB, config AnomalyConfig) (int, error) {
+	var results []AnomalyResult
+
+	counties, err := loadCountyTrendSeries(ctx, db)
+	if err != nil {
+		return 0, err
+	}
+	for county, series := range counties {
+		for _, anomaly := range detectAnomalies(series, config.MinYears, config.ZThreshold) {
+			anomaly.Scope, anomaly.County = "county", &county
+			results = append(results, anomaly)
+		}
+	}
+	slog.Info("County brightness anomalies detected", "counties", len(counties), "anomalies", len(results))
+
+	if config.GridKm > 0 {
+		cells, aggregator, err := loadGridTrendSeries(ctx, db, config.GridKm)
+		if err != nil {
+			return 0, err
+		}
+		countyAnomalies := len(results)
+		for cell, series := range cells {
+			for _, anomaly := range detectAnomalies(series, config.MinYears, config.ZThreshold) {
+				anomaly.Scope = "grid"
+				anomaly.GridLongitude, anomaly.GridLatitude = floatPtr(cell.Longitude), floatPtr(cell.Latitude)
+				anomaly.ResolutionKm = floatPtr(config.GridKm)
+				results = append(results, anomaly)
+			}
+		}
+		slog.Info("Grid brightness anomalies detected", "cells", len(cells), "resolution_km", config.GridKm,
+			"anomalies", len(results)-countyAnomalies)
+		aggregator.exclusions.LogSummary("Light pixels skipped by the anomaly grid")
+	}
+
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	// Largest departures first, so the report opens with the most striking changes
+	sort.Slice(results, func(i, j int) bool { return math.Abs(results[i].RobustZ) > math.Abs(results[j].RobustZ) })
+
+	if err := replaceTable(ctx, db, "light_brightness_anomaly", anomalyColumns, results); err != nil {
+		return 0, err
+	}
+	if config.ReportPath != "" {
+		if err := writeAnomalyReport(config.ReportPath, results); err != nil {
+			return 0, err
+		}
+	}
+
+	directions := make(map[string]int)
+	for _, result := range results {
+		directions[result.Direction]++
+	}
+	logProgress("Anomaly detection written", "table", "light_brightness_anomaly", "rows", len(results),
+		"jumps", directions["jump"], "drops", directions["drop"], "z_threshold", config.ZThreshold, "report", config.ReportPath)
+	return len(results), nil
+}
+
+// writeAnomalyReport writes the anomalies as CSV with the columns of light_brightness_anomaly
+func writeAnomalyReport(path string, results []AnomalyResult) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("error creating %s: %v", path, err)
+	}
+	defer file.Close()
+
+	columns := make([]ParquetColumn, len(anomalyColumns))
+	for i, name := range anomalyColumns {
+		columns[i] = ParquetColumn{Name: name}
+	}
+	writer, err := newCSVExportWriter(file, columns)
+	if err != nil {
+		return fmt.Errorf("error writing %s: %v", path, err)
+	}
+
+	for _, result := range results {
+		values := result.values()
+		for i, value := range values {
+			switch v := value.(type) {
+			case *string:
+				values[i] = nil
+				if v != nil {
+					values[i] = *v
+				}
+			case *float64:
+				values[i] = nil
+				if v != nil {
+					values[i] = *v
+				}
+			case int:
+				values[i] = int64(v)
+			}
+		}
+		if err := writer.WriteRow(values, nil, nil); err != nil {
+			return fmt.Errorf("error writing %s: %v", path, err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("error writing %s: %v", path, err)
+	}
+	return file.Close()
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"testing"
+)
+
+// januaries returns a series with one January value per year from 2018
+func januaries(values ...float64) monthlySeries {
+	series := make(monthlySeries)
+	for i, v := range values {
+		series[(2018+i)*12] = v
+	}
+	return series
+}
+
+func TestDetectAnomaliesJumpAndDrop(t *testing.T) {
+	tests := []struct {
+		name      string
+		series    monthlySeries
+		year      int
+		direction string
+		z         float64
+	}{
+		// Baseline 10, 11, 10, 12, 11: median 11, MAD 1
+		{"jump", januaries(10, 11, 10, 12, 11, 30), 2023, "jump", 19 / madScale},
+		// Baseline 10, 11, 10, 11: median 10.5, MAD 0.5
+		{"drop", januaries(10, 11, 10, 11, 2), 2022, "drop", -8.5 / (madScale * 0.5)},
+		// Baseline 10, 10, 10, 13 has a zero MAD, so the mean absolute deviation 0.75 is the spread
+		{"mean deviation fallback", januaries(10, 10, 10, 13, 20), 2022, "jump", 10 / (meanADScale * 0.75)},
+	}
+	for _, tt := range tests {
+		anomalies := detectAnomalies(tt.series, 3, 3.5)
+		if len(anomalies) != 1 {
+			t.Errorf("%s: flagged %d months, want 1: %+v", tt.name, len(anomalies), anomalies)
+			continue
+		}
+		got := anomalies[0]
+		if got.Year != tt.year || got.Month != 1 || got.Direction != tt.direction || !closeTo(got.RobustZ, tt.z, 1e-9) {
+			t.Errorf("%s: flagged %d-%02d %s z=%g, want %d-01 %s z=%g", tt.name, got.Year, got.Month, got.Direction, got.RobustZ,
+				tt.year, tt.direction, tt.z)
+		}
+		if got.Deviation != got.Brightness-got.Baseline || got.RelativeChange == nil ||
+			!closeTo(*got.RelativeChange, got.Deviation/got.Baseline, 1e-12) {
+			t.Errorf("%s: inconsistent deviation %+v", tt.name, got)
+		}
+	}
+}
+
+func TestDetectAnomaliesSkips(t *testing.T) {
+	// Too few other years for a baseline
+	if anomalies := detectAnomalies(januaries(10, 11, 10, 30), 4, 3.5); len(anomalies) != 0 {
+		t.Errorf("flagged %+v with 3 of 4 baseline years", anomalies)
+	}
+
+	// A constant baseline has no spread, so nothing can be scored against it
+	if anomalies := detectAnomalies(januaries(10, 10, 10, 10, 30), 3, 3.5); len(anomalies) != 0 {
+		t.Errorf("flagged %+v against a constant baseline", anomalies)
+	}
+
+	// Months are only compared with the same calendar month
+	series := januaries(10, 11, 10, 12, 11)
+	for year := 2018; year <= 2022; year++ {
+		series[year*12+6] = 100
+	}
+	if anomalies := detectAnomalies(series, 3, 3.5); len(anomalies) != 0 {
+		t.Errorf("flagged %+v although every month matches its own baseline", anomalies)
+	}
+
+	// A zero baseline has no relative change
+	anomalies := detectAnomalies(januaries(0, 1, 0, 0, 1, 0, 50), 3, 3.5)
+	if len(anomalies) != 1 || anomalies[0].RelativeChange != nil {
+		t.Errorf("flagged %+v, want one jump without a relative change", anomalies)
+	}
+}
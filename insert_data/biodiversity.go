@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+)
+
+// BiodiversityAggregatedData holds the diversity indices of one county and month or season, a row of
+// biodiversity_aggregated_data. Indices that are undefined for the sample are nil.
+type BiodiversityAggregatedData struct {
+	County          string   `json:"county"`
+	Period          string   `json:"period"`
+	Year            int      `json:"year"`
+	Month           *int     `json:"month"`
+	Season          int      `json:"season"`
+	SpeciesRichness int      `json:"species_richness"`
+	TotalAmount     int64    `json:"total_amount"`
+	EventCount      int64    `json:"event_count"`
+	Shannon         *float64 `json:"shannon"`
+	Simpson         *float64 `json:"simpson"`
+	Evenness        *float64 `json:"evenness"`
+}
+
+// biodiversityColumns are the biodiversity_aggregated_data columns in BiodiversityAggregatedData field order
+var biodiversityColumns = []string{
+	"county", "period", "year", "month", "season",
+	"species_richness", "total_amount", "event_count", "shannon", "simpson", "evenness",
+}
+
+func (b *BiodiversityAggregatedData) values() []interface{} {
+	return []interface{}{
+		b.County, b.Period, b.Year, b.Month, b.Season,
+		b.SpeciesRichness, b.TotalAmount, b.EventCount, b.Shannon, b.Simpson, b.Evenness,
+	}
+}
+
+// biodiversityKey identifies one sample: a county and month, or a county and season when month is 0
+type biodiversityKey struct {
+	county string
+	year   int
+	month  int
+	season int
+}
+
+// speciesSample accumulates the abundance per scientific name of one sample
+type speciesSample struct {
+	abundance map[string]int64
+	events    int64
+}
+
+func (s *speciesSample) add(species string, amount, events int64) {
+	s.abundance[species] += amount
+	s.events += events
+}
+
+// loadSpeciesSamples reads the abundance per county, month and species and also folds the months into
+// seasons of the same calendar year, as animal_aggregated_data assigns its season column
+func loadSpeciesSamples(ctx context.Context, db *sql.DB) (map[biodiversityKey]*speciesSample, error) {
+	query, err := store.AnalysisQuery("county_monthly_species_abundance")
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("error querying species abundance: %v", err)
+	}
+	defer rows.Close()
+
+	samples := make(map[biodiversityKey]*speciesSample)
+	sample := func(key biodiversityKey) *speciesSample {
+		s := samples[key]
+		if s == nil {
+			s = &speciesSample{abundance: make(map[string]int64)}
+			samples[key] = s
+		}
+		return s
+	}
+
+	for rows.Next() {
+		var county, species string
+		var year, month int
+		var amount, events int64
+		if err := rows.Scan(&county, &year, &month, &species, &amount, &events); err != nil {
+			return nil, fmt.Errorf("error scanning species abundance: %v", err)
+		}
+		species = strings.TrimSpace(species)
+		season := getSeasonFromMonth(month)
+		sample(biodiversityKey{county: county, year: year, month: month, season: season}).add(species, amount, events)
+		sample(biodiversityKey{county: county, year: year, season: season}).add(species, amount, events)
+	}
+	return samples, rows.Err()
+}
+
+// diversity computes the indices of one sample
+func diversity(key biodiversityKey, s *speciesSample) BiodiversityAggregatedData {
+	row := BiodiversityAggregatedData{
+		County:          key.county,
+		Period:          "season",
+		Year:            key.year,
+		Season:          key.season,
+		SpeciesRichness: len(s.abundance),
+		EventCount:      s.events,
+	}
+	if key.month != 0 {
+		month := key.month
+		row.Period, row.Month = "month", &month
+	}
+
+	abundances := make([]float64, 0, len(s.abundance))
+	for _, amount := range s.abundance {
+		abundances = append(abundances, float64(amount))
+		row.TotalAmount += amount
+	}
+	shannon := shannonIndex(abundances)
+	row.Shannon = finitePtr(shannon)
+	row.Simpson = finitePtr(simpsonIndex(abundances))
+	row.Evenness = finitePtr(pielouEvenness(shannon, row.SpeciesRichness))
+	return row
+}
+
+// migrateToBiodiversityAggregated computes species richness, Shannon and Gini-Simpson diversity and Pielou
+// evenness per county and month and per county and season from the scientific names in biological_data
+func migrateToBiodiversityAggregated(ctx context.Context, db *sql.DB) error {
+	slog.Info("Starting migration to biodiversity_aggregated_data table...", "table", "biodiversity_aggregated_data")
+
+	if err := createBiodiversityTable(ctx, db); err != nil {
+		return fmt.Errorf("error creating biodiversity_aggregated_data table: %v", err)
+	}
+
+	samples, err := loadSpeciesSamples(ctx, db)
+	if err != nil {
+		return err
+	}
+	rows := make([]BiodiversityAggregatedData, 0, len(samples))
+	for key, s := range samples {
+		rows = append(rows, diversity(key, s))
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		a, b := rows[i], rows[j]
+		if a.Year != b.Year {
+			return a.Year < b.Year
+		}
+		if a.Season != b.Season {
+			return a.Season < b.Season
+		}
+		if a.Period != b.Period {
+			return a.Period < b.Period
+		}
+		if a.Month != nil && b.Month != nil && *a.Month != *b.Month {
+			return *a.Month < *b.Month
+		}
+		return a.County < b.County
+	})
+
+	if err := replaceTable(ctx, db, "biodiversity_aggregated_data", biodiversityColumns, rows); err != nil {
+		return err
+	}
+	slog.Info("Successfully migrated biodiversity indices", "table", "biodiversity_aggregated_data", "rows", len(rows))
+	return nil
+}
+
+// Abundance per county, calendar month and accepted name, falling back to the delivered scientific name,
+// counted like total_amount of animal_aggregated_data; see sqliteSpeciesAbundanceQuery for SQLite
+const postgresSpeciesAbundanceQuery = `
+	SELECT
+		COALESCE(county, 'Unknown') as county,
+		EXTRACT(YEAR FROM event_date AT TIME ZONE 'Asia/Taipei')::INTEGER as year,
+		EXTRACT(MONTH FROM event_date AT TIME ZONE 'Asia/Taipei')::INTEGER as month,
+		COALESCE(accepted_name, scientific_name) as scientific_name,
+		COALESCE(SUM(
+			CASE
+				WHEN organism_quantity ~ '^[0-9]+$' THEN organism_quantity::BIGINT
+				ELSE 1
+			END
+		), 0) as total_amount,
+		COUNT(*) as event_count
+	FROM biological_data
+	WHERE event_date IS NOT NULL
+		AND TRIM(COALESCE(accepted_name, scientific_name)) <> ''
+		AND EXTRACT(MONTH FROM event_date AT TIME ZONE 'Asia/Taipei') BETWEEN 1 AND 12
+	GROUP BY
+		COALESCE(county, 'Unknown'),
+		EXTRACT(YEAR FROM event_date AT TIME ZONE 'Asia/Taipei'),
+		EXTRACT(MONTH FROM event_date AT TIME ZONE 'Asia/Taipei'),
+		COALESCE(accepted_name, scientific_name)
+	ORDER BY county, year, month
+`
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"time"
+)
+
+// CalendarUnit is a variable-length temporal bucket unit
+type CalendarUnit string
+
+const (
+	CalendarDay    CalendarUnit = "day"
+	CalendarWeek   CalendarUnit = "week" // ISO weeks starting Monday
+	CalendarMonth  CalendarUnit = "month"
+	CalendarSeason CalendarUnit = "season" // Mar-May, Jun-Aug, Sep-Nov, Dec-Feb as in getSeasonFromMonth
+	CalendarYear   CalendarUnit = "year"
+)
+
+// TaiwanLocation is Taiwan time (UTC+8, no daylight saving), fixed so no tzdata is needed
+var TaiwanLocation = time.FixedZone("Asia/Taipei", 8*60*60)
+
+// valid reports whether the unit is a known calendar unit
+func (u CalendarUnit) valid() bool {
+	switch u {
+	case CalendarDay, CalendarWeek, CalendarMonth, CalendarSeason, CalendarYear:
+		return true
+	}
+	return false
+}
+
+// daysPerBucket returns the bucket length for day-based units, 0 otherwise
+func (u CalendarUnit) daysPerBucket() int64 {
+	switch u {
+	case CalendarDay:
+		return 1
+	case CalendarWeek:
+		return 7
+	}
+	return 0
+}
+
+// monthsPerBucket returns the bucket length for month-based units, 0 otherwise
+func (u CalendarUnit) monthsPerBucket() int64 {
+	switch u {
+	case CalendarMonth:
+		return 1
+	case CalendarSeason:
+		return 3
+	case CalendarYear:
+		return 12
+	}
+	return 0
+}
+
+// defaultCalendarOrigin returns the origin used when the configuration does not set one.
+// Weeks start on Monday 1970-01-05 and seasons on 1970-03-01, all at local midnight.
+func defaultCalendarOrigin(unit CalendarUnit, location *time.Location) time.Time {
+	switch unit {
+	case CalendarWeek:
+		return time.Date(1970, time.January, 5, 0, 0, 0, 0, location)
+	case CalendarSeason:
+		return time.Date(1970, time.March, 1, 0, 0, 0, 0, location)
+	}
+	return time.Date(1970, time.January, 1, 0, 0, 0, 0, location)
+}
+
+// calendarBucketIndex returns the bucket number of timestamp counted from the origin.
+// Day and week buckets start at the origin's wall-clock time, so an 18:00 origin gives night-long days.
+// Month, season and year buckets start at local midnight on the 1st; the origin only sets their phase,
+// e.g. an April origin gives fiscal years running April to March.
+func (ta *TemporalAggregator) calendarBucketIndex(timestamp time.Time) int64 {
+	unit := ta.config.CalendarUnit
+	local := timestamp.In(ta.location)
+	origin := ta.origin.In(ta.location)
+
+	if days := unit.daysPerBucket(); days > 0 {
+		day := civilDay(local) - civilDay(origin)
+		if ta.dayStart(day).After(timestamp) {
+			day--
+		}
+		return floorDiv(day, days)
+	}
+
+	months := unit.monthsPerBucket()
+	return floorDiv(civilMonth(local)-civilMonth(origin), months)
+}
+
+// calendarBucketStart returns the start of the bucket with the given index in the configured location
+func (ta *TemporalAggregator) calendarBucketStart(index int64) time.Time {
+	unit := ta.config.CalendarUnit
+
+	if days := unit.daysPerBucket(); days > 0 {
+		return ta.dayStart(index * days)
+	}
+
+	origin := ta.origin.In(ta.location)
+	months := index * unit.monthsPerBucket()
+	return time.Date(origin.Year(), origin.Month()+time.Month(months), 1, 0, 0, 0, 0, ta.location)
+}
+
+// dayStart returns the start of the n-th day after the origin at the origin's wall-clock time
+func (ta *TemporalAggregator) dayStart(n int64) time.Time {
+	origin := ta.origin.In(ta.location)
+	return time.Date(origin.Year(), origin.Month(), origin.Day()+int(n),
+		origin.Hour(), origin.Minute(), origin.Second(), origin.Nanosecond(), ta.location)
+}
+
+// civilDay returns the number of calendar days between 1970-01-01 and the wall-clock date of t
+func civilDay(t time.Time) int64 {
+	date := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	return floorDiv(date.Unix(), 24*60*60)
+}
+
+// civilMonth returns a sequential month number for the wall-clock date of t
+func civilMonth(t time.Time) int64 {
+	return int64(t.Year())*12 + int64(t.Month()) - 1
+}
+
+// floorDiv divides rounding towards negative infinity
+func floorDiv(a, b int64) int64 {
+	q := a / b
+	if a%b != 0 && (a < 0) != (b < 0) {
+		q--
+	}
+	return q
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFloorDiv(t *testing.T) {
+	tests := []struct {
+		a, b, want int64
+	}{
+		{7, 2, 3},
+		{-7, 2, -4},
+		{7, -2, -4},
+		{-7, -2, 3},
+		{-6, 2, -3},
+		{0, 5, 0},
+		{-1, 12, -1},
+	}
+	for _, tt := range tests {
+		if got := floorDiv(tt.a, tt.b); got != tt.want {
+			t.Errorf("floorDiv(%d, %d) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestCalendarBucketBoundaries(t *testing.T) {
+	utc := func(s string) time.Time {
+		tm, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tm
+	}
+
+	tests := []struct {
+		name   string
+		config AggregationConfig
+		at     string
+		start  string
+	}{
+		{"month ends at Taiwan midnight", AggregationConfig{CalendarUnit: CalendarMonth, Location: TaiwanLocation},
+			"2024-01-31T15:59:59Z", "2024-01-01T00:00:00+08:00"},
+		{"month starts at Taiwan midnight", AggregationConfig{CalendarUnit: CalendarMonth, Location: TaiwanLocation},
+			"2024-01-31T16:00:00Z", "2024-02-01T00:00:00+08:00"},
+		{"UTC month by default", AggregationConfig{CalendarUnit: CalendarMonth},
+			"2024-01-31T16:00:00Z", "2024-01-01T00:00:00Z"},
+		{"ISO week starts on Monday", AggregationConfig{CalendarUnit: CalendarWeek, Location: TaiwanLocation},
+			"2024-01-07T23:59:59+08:00", "2024-01-01T00:00:00+08:00"},
+		{"next ISO week", AggregationConfig{CalendarUnit: CalendarWeek, Location: TaiwanLocation},
+			"2024-01-08T00:00:00+08:00", "2024-01-08T00:00:00+08:00"},
+		{"winter spans the new year", AggregationConfig{CalendarUnit: CalendarSeason, Location: TaiwanLocation},
+			"2024-02-29T12:00:00+08:00", "2023-12-01T00:00:00+08:00"},
+		{"spring starts in March", AggregationConfig{CalendarUnit: CalendarSeason, Location: TaiwanLocation},
+			"2024-03-01T00:00:00+08:00", "2024-03-01T00:00:00+08:00"},
+		{"fiscal year from an April origin", AggregationConfig{CalendarUnit: CalendarYear, Location: TaiwanLocation,
+			Origin: time.Date(2000, time.April, 1, 0, 0, 0, 0, TaiwanLocation)},
+			"2024-03-31T23:00:00+08:00", "2023-04-01T00:00:00+08:00"},
+		{"night-long day from an 18:00 origin", AggregationConfig{CalendarUnit: CalendarDay, Location: TaiwanLocation,
+			Origin: time.Date(2000, time.January, 1, 18, 0, 0, 0, TaiwanLocation)},
+			"2024-01-02T05:00:00+08:00", "2024-01-01T18:00:00+08:00"},
+		{"before the origin", AggregationConfig{CalendarUnit: CalendarMonth, Location: TaiwanLocation},
+			"1969-12-31T15:00:00Z", "1969-12-01T00:00:00+08:00"},
+		{"fixed interval before the origin", AggregationConfig{TemporalInterval: 6 * time.Hour},
+			"1969-12-31T23:00:00Z", "1969-12-31T18:00:00Z"},
+	}
+	for _, tt := range tests {
+		ta := NewTemporalAggregator(&tt.config)
+		at := utc(tt.at)
+		start := ta.snapToBucket(at)
+		if want := utc(tt.start); !start.Equal(want) {
+			t.Errorf("%s: bucket of %s starts at %s, want %s", tt.name, tt.at, start, want)
+			continue
+		}
+
+		// The bucket covers at and ends where the next bucket starts
+		index := ta.bucketIndex(at)
+		if next := ta.bucketStart(index + 1); !next.After(at) || ta.bucketIndex(next) != index+1 {
+			t.Errorf("%s: next bucket starts at %s", tt.name, next)
+		}
+		if ta.bucketIndex(start) != index {
+			t.Errorf("%s: bucket start %s falls into bucket %d, want %d", tt.name, start, ta.bucketIndex(start), index)
+		}
+	}
+}
+
+func TestNewDataAggregatorRejectsInvalidBuckets(t *testing.T) {
+	for _, config := range []AggregationConfig{
+		{SpatialResolutionKm: 1, CalendarUnit: "fortnight"},
+		{SpatialResolutionKm: 1},
+		{SpatialResolutionKm: 1, TemporalInterval: -time.Hour},
+	} {
+		if _, err := NewDataAggregator(&config); err == nil {
+			t.Errorf("NewDataAggregator(%+v) returned no error", config)
+		}
+	}
+}
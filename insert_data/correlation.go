@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"math"
+	"sort"
+	"strings"
+)
+
+// correlationConfidence is the level of every interval in light_occurrence_correlation
+const correlationConfidence = 0.95
+
+// CorrelationResult relates monthly mean brightness to monthly event counts for one county and animal type,
+// a row of light_occurrence_correlation. Statistics that are undefined for the data are nil.
+type CorrelationResult struct {
+	County         string   `json:"county"`
+	AnimalType     string   `json:"animal_type"`
+	Months         int      `json:"months"`
+	MeanBrightness *float64 `json:"mean_brightness"`
+	MeanEventCount *float64 `json:"mean_event_count"`
+	PearsonR       *float64 `json:"pearson_r"`
+	PearsonCILow   *float64 `json:"pearson_ci_low"`
+	PearsonCIHigh  *float64 `json:"pearson_ci_high"`
+	PearsonP       *float64 `json:"pearson_p"`
+	SpearmanRho    *float64 `json:"spearman_rho"`
+	SpearmanCILow  *float64 `json:"spearman_ci_low"`
+	SpearmanCIHigh *float64 `json:"spearman_ci_high"`
+	SpearmanP      *float64 `json:"spearman_p"`
+	Slope          *float64 `json:"slope"`
+	SlopeCILow     *float64 `json:"slope_ci_low"`
+	SlopeCIHigh    *float64 `json:"slope_ci_high"`
+	Intercept      *float64 `json:"intercept"`
+}
+
+// correlationColumns are the light_occurrence_correlation columns in CorrelationResult field order
+var correlationColumns = []string{
+	"county", "animal_type", "months", "mean_brightness", "mean_event_count",
+	"pearson_r", "pearson_ci_low", "pearson_ci_high", "pearson_p",
+	"spearman_rho", "spearman_ci_low", "spearman_ci_high", "spearman_p",
+	"slope", "slope_ci_low", "slope_ci_high", "intercept",
+}
+
+func (c *CorrelationResult) values() []interface{} {
+	return []interface{}{
+		c.County, c.AnimalType, c.Months, c.MeanBrightness, c.MeanEventCount,
+		c.PearsonR, c.PearsonCILow, c.PearsonCIHigh, c.PearsonP,
+		c.SpearmanRho, c.SpearmanCILow, c.SpearmanCIHigh, c.SpearmanP,
+		c.Slope, c.SlopeCILow, c.SlopeCIHigh, c.Intercept,
+	}
+}
+
+func (c *CorrelationResult) scanTargets() []interface{} {
+	return []interface{}{
+		&c.County, &c.AnimalType, &c.Months, &c.MeanBrightness, &c.MeanEventCount,
+		&c.PearsonR, &c.PearsonCILow, &c.PearsonCIHigh, &c.PearsonP,
+		&c.SpearmanRho, &c.SpearmanCILow, &c.SpearmanCIHigh, &c.SpearmanP,
+		&c.Slope, &c.SlopeCILow, &c.SlopeCIHigh, &c.Intercept,
+	}
+}
+
+// countyMonth identifies one calendar month in one county
+type countyMonth struct {
+	county string
+	year   int
+	month  int
+}
+
+// normalizeCounty lets the light and occurrence tables agree on county names written with 台 or 臺
+func normalizeCounty(county string) string {
+	return strings.ReplaceAll(strings.TrimSpace(county), "台", "臺")
+}
+
+// trustedLightCTE defines trusted_light, the pixels of light_data_with_county passing lightQualityFilter,
+// which the county monthly brightness queries read so county means skip the pixels ingest would drop
+func trustedLightCTE() string {
+	return "WITH trusted_light AS (SELECT * FROM light_data_with_county WHERE " + lightQualityFilter.sqlCondition() + ")"
+}
+
+// loadCountyMonthlyBrightness returns the mean brightness per county and month
+func loadCountyMonthlyBrightness(ctx context.Context, db *sql.DB) (map[countyMonth]float64, error) {
+	query, err := store.AnalysisQuery("county_monthly_brightness")
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.QueryContext(ctx, trustedLightCTE()+query)
+	if err != nil {
+		return nil, fmt.Errorf("error querying monthly brightness: %v", err)
+	}
+	defer rows.Close()
+
+	brightness := make(map[countyMonth]float64)
+	for rows.Next() {
+		var key countyMonth
+		var value float64
+		var pixels int64
+		if err := rows.Scan(&key.county, &key.year, &key.month, &value, &pixels); err != nil {
+			return nil, fmt.Errorf("error scanning monthly brightness: %v", err)
+		}
+		key.county = normalizeCounty(key.county)
+		brightness[key] = value
+	}
+	return brightness, rows.Err()
+}
+
+// correlationSeries holds the paired monthly values of one county and animal type
+type correlationSeries struct {
+	county     string
+	animalType string
+	brightness []float64
+	events     []float64
+}
+
+// loadCorrelationSeries pairs the monthly event counts of animal_aggregated_data with the brightness of
+// the same county and month. Months without light data are left out.
+func loadCorrelationSeries(ctx context.Context, db *sql.DB, brightness map[countyMonth]float64) ([]*correlationSeries, error) {
+	// animal_aggregated_data holds one row per activity period, summed here to the monthly total
+	rows, err := db.QueryContext(ctx, `
+		SELECT county, animal_type, year, month, SUM(event_count)
+		FROM animal_aggregated_data
+		GROUP BY county, animal_type, year, month
+		ORDER BY county, animal_type, year, month`)
+	if err != nil {
+		return nil, fmt.Errorf("error querying event counts: %v", err)
+	}
+	defer rows.Close()
+
+	var series []*correlationSeries
+	index := make(map[[2]string]*correlationSeries)
+	for rows.Next() {
+		var row AnimalAggregatedData
+		if err := rows.Scan(&row.County, &row.AnimalType, &row.Year, &row.Month, &row.EventCount); err != nil {
+			return nil, fmt.Errorf("error scanning event counts: %v", err)
+		}
+		value, ok := brightness[countyMonth{county: normalizeCounty(row.County), year: row.Year, month: row.Month}]
+		if !ok {
+			continue
+		}
+
+		key := [2]string{row.County, row.AnimalType}
+		s := index[key]
+		if s == nil {
+			s = &correlationSeries{county: row.County, animalType: row.AnimalType}
+			index[key] = s
+			series = append(series, s)
+		}
+		s.brightness = append(s.brightness, value)
+		s.events = append(s.events, float64(row.EventCount))
+	}
+	return series, rows.Err()
+}
+
+// correlate computes the statistics of one series
+func correlate(s *correlationSeries) CorrelationResult {
+	n := len(s.brightness)
+	result := CorrelationResult{
+		County:         s.county,
+		AnimalType:     s.animalType,
+		Months:         n,
+		MeanBrightness: finitePtr(mean(s.brightness)),
+		MeanEventCount: finitePtr(mean(s.events)),
+	}
+
+	r := pearson(s.brightness, s.events)
+	low, high := fisherInterval(r, 1/math.Sqrt(float64(n-3)), correlationConfidence)
+	result.PearsonR, result.PearsonCILow, result.PearsonCIHigh = finitePtr(r), finitePtr(low), finitePtr(high)
+	result.PearsonP = finitePtr(correlationPValue(r, n))
+
+	// Fieller, Hartley and Pearson's standard error for the z-transformed Spearman coefficient
+	rho := spearman(s.brightness, s.events)
+	low, high = fisherInterval(rho, math.Sqrt(1.06/float64(n-3)), correlationConfidence)
+	result.SpearmanRho, result.SpearmanCILow, result.SpearmanCIHigh = finitePtr(rho), finitePtr(low), finitePtr(high)
+	result.SpearmanP = finitePtr(correlationPValue(rho, n))
+
+	fit := fitLine(s.brightness, s.events)
+	result.Slope, result.Intercept = finitePtr(fit.Slope), finitePtr(fit.Intercept)
+	if n > 2 {
+		half := studentTQuantile(0.5+correlationConfidence/2, float64(n-2)) * fit.SlopeSE
+		result.SlopeCILow, result.SlopeCIHigh = finitePtr(fit.Slope-half), finitePtr(fit.Slope+half)
+	}
+	return result
+}
+
+// runCorrelationAnalysis rebuilds light_occurrence_correlation from light_data_with_county and
+// animal_aggregated_data, skipping series with fewer than minMonths paired months
+func runCorrelationAnalysis(ctx context.Context, db *sql.DB, minMonths int) (int, error) {
+	brightness, err := loadCountyMonthlyBrightness(ctx, db)
+	if err != nil {
+		return 0, err
+	}
+	series, err := loadCorrelationSeries(ctx, db, brightness)
+	if err != nil {
+		return 0, err
+	}
+	slog.Info("Loaded correlation series", "county_months_with_light", len(brightness), "series", len(series))
+
+	results := make([]CorrelationResult, 0, len(series))
+	skipped := 0
+	for _, s := range series {
+		if len(s.brightness) < minMonths {
+			skipped++
+			continue
+		}
+		results = append(results, correlate(s))
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].County != results[j].County {
+			return results[i].County < results[j].County
+		}
+		return results[i].AnimalType < results[j].AnimalType
+	})
+
+	if err := replaceTable(ctx, db, "light_occurrence_correlation", correlationColumns, results); err != nil {
+		return 0, err
+	}
+	logProgress("Correlation analysis written", "table", "light_occurrence_correlation", "rows", len(results),
+		"skipped_short_series", skipped, "min_months", minMonths)
+	return len(results), nil
+}
+
+// queryCorrelationResults reads light_occurrence_correlation, optionally filtered by county and animal type
+func queryCorrelationResults(ctx context.Context, db *sql.DB, county, animalType string) ([]CorrelationResult, error) {
+	var conditions []string
+	var args []interface{}
+	if county != "" {
+		args = append(args, county)
+		conditions = append(conditions, fmt.Sprintf("county = $%d", len(args)))
+	}
+	if animalType != "" {
+		args = append(args, animalType)
+		conditions = append(conditions, fmt.Sprintf("animal_type = $%d", len(args)))
+	}
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	rows, err := db.QueryContext(ctx, fmt.Sprintf("SELECT %s FROM light_occurrence_correlation %s ORDER BY county, animal_type",
+		strings.Join(correlationColumns, ", "), where), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []CorrelationResult{}
+	for rows.Next() {
+		var result CorrelationResult
+		if err := rows.Scan(result.scanTargets()...); err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+	return results, rows.Err()
+}
+
+// Mean brightness per county and calendar month of the trusted_light pixels defined by trustedLightCTE,
+// see sqliteCountyMonthlyBrightnessQuery for SQLite
+const postgresCountyMonthlyBrightnessQuery = `
+	SELECT
+		county,
+		EXTRACT(YEAR FROM time AT TIME ZONE 'Asia/Taipei')::INTEGER as year,
+		EXTRACT(MONTH FROM time AT TIME ZONE 'Asia/Taipei')::INTEGER as month,
+		AVG(brightness) as mean_brightness,
+		COUNT(*) as pixel_count
+	FROM trusted_light
+	WHERE county IS NOT NULL AND brightness IS NOT NULL
+	GROUP BY county, EXTRACT(YEAR FROM time AT TIME ZONE 'Asia/Taipei'), EXTRACT(MONTH FROM time AT TIME ZONE 'Asia/Taipei')
+`
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"time"
 )
@@ -9,15 +10,31 @@ type AnimalAggregatedData struct {
 	ID          int       `json:"-"`
 	County      string    `json:"county"`
 	AnimalType  string    `json:"animal_type"`
+	Activity    string    `json:"activity_period"` // nocturnal, diurnal, crepuscular or unknown, see taxon_activity
 	Year        int       `json:"year"`
 	Month       int       `json:"month"`
 	Season      int       `json:"season"`
 	TotalAmount int       `json:"total_amount"`
 	EventCount  int       `json:"event_count"`
+	EffortDays  *int      `json:"effort_days"` // observation days of all groups in the county and month
+	EventRate   *float64  `json:"event_rate"`  // event_count per effort day
+	AmountRate  *float64  `json:"amount_rate"` // total_amount per effort day
 	CreatedAt   time.Time `json:"-"`
 	UpdatedAt   time.Time `json:"-"`
 }
 
+// SamplingEffortAggregated holds the survey effort proxies of one county and month over all groups
+type SamplingEffortAggregated struct {
+	County          string `json:"county"`
+	Year            int    `json:"year"`
+	Month           int    `json:"month"`
+	Season          int    `json:"season"`
+	DatasetCount    int    `json:"dataset_count"`
+	ObservationDays int    `json:"observation_days"`
+	LocalityCount   int    `json:"locality_count"`
+	EventCount      int    `json:"event_count"`
+}
+
 type DatasetStatsAggregated struct {
 	ID        int       `json:"-"`
 	Dataset   string    `json:"dataset"`
@@ -30,33 +47,72 @@ type DatasetStatsAggregated struct {
 }
 
 
-func createAnimalAggregatedTable(db *sql.DB) error {
+func createAnimalAggregatedTable(ctx context.Context, db *sql.DB) error {
 	query := `
 	CREATE TABLE IF NOT EXISTS animal_aggregated_data (
 		id SERIAL PRIMARY KEY,
 		county TEXT NOT NULL,
 		animal_type TEXT NOT NULL,
+		activity_period TEXT NOT NULL DEFAULT 'unknown',
 		year INTEGER NOT NULL,
 		month INTEGER NOT NULL CHECK (month >= 1 AND month <= 12),
 		season INTEGER NOT NULL CHECK (season >= 1 AND season <= 4),
 		total_amount INTEGER NOT NULL DEFAULT 0,
 		event_count INTEGER NOT NULL DEFAULT 0,
+		effort_days INTEGER,
+		event_rate DOUBLE PRECISION,
+		amount_rate DOUBLE PRECISION,
 		created_at TIMESTAMPTZ DEFAULT NOW(),
 		updated_at TIMESTAMPTZ DEFAULT NOW()
 	);
 
+	-- Tables created before the sampling effort normalization
+	ALTER TABLE animal_aggregated_data ADD COLUMN IF NOT EXISTS effort_days INTEGER;
+	ALTER TABLE animal_aggregated_data ADD COLUMN IF NOT EXISTS event_rate DOUBLE PRECISION;
+	ALTER TABLE animal_aggregated_data ADD COLUMN IF NOT EXISTS amount_rate DOUBLE PRECISION;
+
+	-- Tables created before the split by activity period, whose unique index lacked it
+	ALTER TABLE animal_aggregated_data ADD COLUMN IF NOT EXISTS activity_period TEXT NOT NULL DEFAULT 'unknown';
+	DROP INDEX IF EXISTS idx_animal_agg_unique;
+
 	CREATE INDEX IF NOT EXISTS idx_animal_agg_county ON animal_aggregated_data (county);
 	CREATE INDEX IF NOT EXISTS idx_animal_agg_animal_type ON animal_aggregated_data (animal_type);
 	CREATE INDEX IF NOT EXISTS idx_animal_agg_year_month ON animal_aggregated_data (year, month);
 	CREATE INDEX IF NOT EXISTS idx_animal_agg_season ON animal_aggregated_data (season);
-	CREATE UNIQUE INDEX IF NOT EXISTS idx_animal_agg_unique ON animal_aggregated_data (county, animal_type, year, month);
+	CREATE INDEX IF NOT EXISTS idx_animal_agg_activity ON animal_aggregated_data (activity_period);
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_animal_agg_activity_unique ON animal_aggregated_data (county, animal_type, activity_period, year, month);
+	`
+
+	_, err := db.ExecContext(ctx, store.SchemaDDL(query))
+	return err
+}
+
+// createSamplingEffortTable creates the survey effort proxies per county and month filled by the migration
+func createSamplingEffortTable(ctx context.Context, db *sql.DB) error {
+	query := `
+	CREATE TABLE IF NOT EXISTS sampling_effort_aggregated (
+		id SERIAL PRIMARY KEY,
+		county TEXT NOT NULL,
+		year INTEGER NOT NULL,
+		month INTEGER NOT NULL CHECK (month >= 1 AND month <= 12),
+		season INTEGER NOT NULL CHECK (season >= 1 AND season <= 4),
+		dataset_count INTEGER NOT NULL DEFAULT 0,
+		observation_days INTEGER NOT NULL DEFAULT 0,
+		locality_count INTEGER NOT NULL DEFAULT 0,
+		event_count INTEGER NOT NULL DEFAULT 0,
+		created_at TIMESTAMPTZ DEFAULT NOW(),
+		updated_at TIMESTAMPTZ DEFAULT NOW()
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_sampling_effort_year_month ON sampling_effort_aggregated (year, month);
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_sampling_effort_unique ON sampling_effort_aggregated (county, year, month);
 	`
 
-	_, err := db.Exec(query)
+	_, err := db.ExecContext(ctx, store.SchemaDDL(query))
 	return err
 }
 
-func createDatasetStatsTable(db *sql.DB) error {
+func createDatasetStatsTable(ctx context.Context, db *sql.DB) error {
 	query := `
 	CREATE TABLE IF NOT EXISTS dataset_stats_aggregated (
 		id SERIAL PRIMARY KEY,
@@ -75,11 +131,11 @@ func createDatasetStatsTable(db *sql.DB) error {
 	CREATE UNIQUE INDEX IF NOT EXISTS idx_dataset_stats_unique ON dataset_stats_aggregated (dataset, county, year, month);
 	`
 
-	_, err := db.Exec(query)
+	_, err := db.ExecContext(ctx, store.SchemaDDL(query))
 	return err
 }
 
-func createLightDataWithCountyTable(db *sql.DB) error {
+func createLightDataWithCountyTable(ctx context.Context, db *sql.DB) error {
 	query := `
 	CREATE TABLE IF NOT EXISTS light_data_with_county (
 		id SERIAL PRIMARY KEY,
@@ -87,9 +143,15 @@ func createLightDataWithCountyTable(db *sql.DB) error {
 		longitude DOUBLE PRECISION NOT NULL,
 		latitude DOUBLE PRECISION NOT NULL,
 		brightness DOUBLE PRECISION,
-		county TEXT
+		county TEXT,
+		quality_flag INTEGER,
+		cloud_free_obs INTEGER
 	);
 
+	-- Tables created before the quality layers were ingested
+	ALTER TABLE light_data_with_county ADD COLUMN IF NOT EXISTS quality_flag INTEGER;
+	ALTER TABLE light_data_with_county ADD COLUMN IF NOT EXISTS cloud_free_obs INTEGER;
+
 	CREATE INDEX IF NOT EXISTS idx_light_data_with_county_time ON light_data_with_county (time);
 	CREATE INDEX IF NOT EXISTS idx_light_data_with_county_location ON light_data_with_county (longitude, latitude);
 	CREATE INDEX IF NOT EXISTS idx_light_data_with_county_county ON light_data_with_county (county);
@@ -97,6 +159,297 @@ func createLightDataWithCountyTable(db *sql.DB) error {
 	CREATE INDEX IF NOT EXISTS idx_light_data_with_county_time_county ON light_data_with_county (time, county);
 	`
 
-	_, err := db.Exec(query)
+	_, err := db.ExecContext(ctx, store.SchemaDDL(query))
 	return err
-}
\ No newline at end of file
+}
+// createLightGridAggregatedTable creates the monthly brightness totals per grid cell that light imports with
+// --aggregate-km merge pixels into. Sums and counts are stored instead of averages so batches add up.
+func createLightGridAggregatedTable(ctx context.Context, db *sql.DB) error {
+	query := `
+	CREATE TABLE IF NOT EXISTS light_grid_aggregated (
+		id SERIAL PRIMARY KEY,
+		resolution_km DOUBLE PRECISION NOT NULL,
+		grid_longitude DOUBLE PRECISION NOT NULL,
+		grid_latitude DOUBLE PRECISION NOT NULL,
+		time_bucket TIMESTAMPTZ NOT NULL,
+		brightness_sum DOUBLE PRECISION NOT NULL,
+		point_count INTEGER NOT NULL,
+		min_brightness DOUBLE PRECISION NOT NULL,
+		max_brightness DOUBLE PRECISION NOT NULL,
+		updated_at TIMESTAMPTZ DEFAULT NOW()
+	);
+
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_light_grid_unique ON light_grid_aggregated (resolution_km, grid_longitude, grid_latitude, time_bucket);
+	CREATE INDEX IF NOT EXISTS idx_light_grid_bucket ON light_grid_aggregated (resolution_km, time_bucket);
+	`
+
+	_, err := db.ExecContext(ctx, store.SchemaDDL(query))
+	return err
+}
+
+// createLightWindowedTable creates the event-time window aggregates per grid cell written by aggregate-windows.
+// Corrections of late data replace the row of their window and raise its revision.
+func createLightWindowedTable(ctx context.Context, db *sql.DB) error {
+	query := `
+	CREATE TABLE IF NOT EXISTS light_windowed_aggregated (
+		id SERIAL PRIMARY KEY,
+		resolution_km DOUBLE PRECISION NOT NULL,
+		grid_longitude DOUBLE PRECISION NOT NULL,
+		grid_latitude DOUBLE PRECISION NOT NULL,
+		window_start TIMESTAMPTZ NOT NULL,
+		window_end TIMESTAMPTZ NOT NULL,
+		avg_brightness DOUBLE PRECISION NOT NULL,
+		min_brightness DOUBLE PRECISION NOT NULL,
+		max_brightness DOUBLE PRECISION NOT NULL,
+		point_count INTEGER NOT NULL,
+		revision INTEGER NOT NULL,
+		updated_at TIMESTAMPTZ DEFAULT NOW()
+	);
+
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_light_windowed_unique ON light_windowed_aggregated (resolution_km, grid_longitude, grid_latitude, window_start, window_end);
+	CREATE INDEX IF NOT EXISTS idx_light_windowed_start ON light_windowed_aggregated (window_start);
+	`
+
+	_, err := db.ExecContext(ctx, store.SchemaDDL(query))
+	return err
+}
+
+// createOccurrenceLightExposureTable creates the per-occurrence light exposure written by join-exposure
+func createOccurrenceLightExposureTable(ctx context.Context, db *sql.DB) error {
+	query := `
+	CREATE TABLE IF NOT EXISTS occurrence_light_exposure (
+		id SERIAL PRIMARY KEY,
+		occurrence_id INTEGER NOT NULL UNIQUE REFERENCES biological_data (id) ON DELETE CASCADE,
+		light_month TIMESTAMPTZ NOT NULL,
+		brightness DOUBLE PRECISION,
+		mean_brightness DOUBLE PRECISION,
+		pixel_count INTEGER NOT NULL DEFAULT 0,
+		distance_km DOUBLE PRECISION,
+		nearest_longitude DOUBLE PRECISION,
+		nearest_latitude DOUBLE PRECISION,
+		radius_km DOUBLE PRECISION NOT NULL,
+		created_at TIMESTAMPTZ DEFAULT NOW(),
+		updated_at TIMESTAMPTZ DEFAULT NOW()
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_occurrence_light_exposure_month ON occurrence_light_exposure (light_month);
+	CREATE INDEX IF NOT EXISTS idx_occurrence_light_exposure_brightness ON occurrence_light_exposure (brightness);
+	`
+
+	_, err := db.ExecContext(ctx, store.SchemaDDL(query))
+	return err
+}
+
+// createLightCorrelationTable creates the light-vs-occurrence statistics written by analyze-correlation
+func createLightCorrelationTable(ctx context.Context, db *sql.DB) error {
+	query := `
+	CREATE TABLE IF NOT EXISTS light_occurrence_correlation (
+		id SERIAL PRIMARY KEY,
+		county TEXT NOT NULL,
+		animal_type TEXT NOT NULL,
+		months INTEGER NOT NULL,
+		mean_brightness DOUBLE PRECISION,
+		mean_event_count DOUBLE PRECISION,
+		pearson_r DOUBLE PRECISION,
+		pearson_ci_low DOUBLE PRECISION,
+		pearson_ci_high DOUBLE PRECISION,
+		pearson_p DOUBLE PRECISION,
+		spearman_rho DOUBLE PRECISION,
+		spearman_ci_low DOUBLE PRECISION,
+		spearman_ci_high DOUBLE PRECISION,
+		spearman_p DOUBLE PRECISION,
+		slope DOUBLE PRECISION,
+		slope_ci_low DOUBLE PRECISION,
+		slope_ci_high DOUBLE PRECISION,
+		intercept DOUBLE PRECISION,
+		created_at TIMESTAMPTZ DEFAULT NOW()
+	);
+
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_light_correlation_unique ON light_occurrence_correlation (county, animal_type);
+	CREATE INDEX IF NOT EXISTS idx_light_correlation_animal_type ON light_occurrence_correlation (animal_type);
+	`
+
+	_, err := db.ExecContext(ctx, store.SchemaDDL(query))
+	return err
+}
+
+// createBiodiversityTable creates the per county diversity indices filled by the migration. Rows with
+// period 'month' have the time keys of animal_aggregated_data; rows with period 'season' cover a whole
+// season of a calendar year and leave month NULL.
+func createBiodiversityTable(ctx context.Context, db *sql.DB) error {
+	query := `
+	CREATE TABLE IF NOT EXISTS biodiversity_aggregated_data (
+		id SERIAL PRIMARY KEY,
+		county TEXT NOT NULL,
+		period TEXT NOT NULL CHECK (period IN ('month', 'season')),
+		year INTEGER NOT NULL,
+		month INTEGER CHECK (month >= 1 AND month <= 12),
+		season INTEGER NOT NULL CHECK (season >= 1 AND season <= 4),
+		species_richness INTEGER NOT NULL DEFAULT 0,
+		total_amount INTEGER NOT NULL DEFAULT 0,
+		event_count INTEGER NOT NULL DEFAULT 0,
+		shannon DOUBLE PRECISION,
+		simpson DOUBLE PRECISION,
+		evenness DOUBLE PRECISION,
+		created_at TIMESTAMPTZ DEFAULT NOW(),
+		updated_at TIMESTAMPTZ DEFAULT NOW()
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_biodiversity_agg_county ON biodiversity_aggregated_data (county);
+	CREATE INDEX IF NOT EXISTS idx_biodiversity_agg_year_month ON biodiversity_aggregated_data (year, month);
+	CREATE INDEX IF NOT EXISTS idx_biodiversity_agg_season ON biodiversity_aggregated_data (period, year, season);
+	`
+
+	_, err := db.ExecContext(ctx, store.SchemaDDL(query))
+	return err
+}
+
+// createLightTrendTable creates the brightness trends per county and grid cell written by analyze-trend
+func createLightTrendTable(ctx context.Context, db *sql.DB) error {
+	query := `
+	CREATE TABLE IF NOT EXISTS light_brightness_trend (
+		id SERIAL PRIMARY KEY,
+		scope TEXT NOT NULL CHECK (scope IN ('county', 'grid')),
+		county TEXT,
+		grid_longitude DOUBLE PRECISION,
+		grid_latitude DOUBLE PRECISION,
+		resolution_km DOUBLE PRECISION,
+		months INTEGER NOT NULL,
+		years INTEGER NOT NULL,
+		first_year INTEGER NOT NULL,
+		last_year INTEGER NOT NULL,
+		mean_brightness DOUBLE PRECISION,
+		mann_kendall_s DOUBLE PRECISION NOT NULL,
+		variance DOUBLE PRECISION,
+		z DOUBLE PRECISION,
+		p_value DOUBLE PRECISION,
+		sen_slope DOUBLE PRECISION,
+		trend TEXT NOT NULL CHECK (trend IN ('increasing', 'decreasing', 'none')),
+		created_at TIMESTAMPTZ DEFAULT NOW()
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_light_trend_scope_trend ON light_brightness_trend (scope, trend);
+	CREATE INDEX IF NOT EXISTS idx_light_trend_county ON light_brightness_trend (county);
+	CREATE INDEX IF NOT EXISTS idx_light_trend_grid ON light_brightness_trend (grid_longitude, grid_latitude);
+	`
+
+	_, err := db.ExecContext(ctx, store.SchemaDDL(query))
+	return err
+}
+
+// createGridHotspotsTable creates the Gi* hot and cold spots per grid cell and period written by analyze-hotspots
+func createGridHotspotsTable(ctx context.Context, db *sql.DB) error {
+	query := `
+	CREATE TABLE IF NOT EXISTS grid_hotspots (
+		id SERIAL PRIMARY KEY,
+		variable TEXT NOT NULL CHECK (variable IN ('brightness', 'occurrence_density')),
+		period_unit TEXT NOT NULL,
+		period_start TIMESTAMPTZ NOT NULL,
+		grid_longitude DOUBLE PRECISION NOT NULL,
+		grid_latitude DOUBLE PRECISION NOT NULL,
+		resolution_km DOUBLE PRECISION NOT NULL,
+		neighbour_km DOUBLE PRECISION NOT NULL,
+		value DOUBLE PRECISION NOT NULL,
+		neighbours INTEGER NOT NULL,
+		z_score DOUBLE PRECISION,
+		p_value DOUBLE PRECISION,
+		classification TEXT NOT NULL CHECK (classification IN ('hot', 'cold', 'not_significant')),
+		confidence INTEGER,
+		created_at TIMESTAMPTZ DEFAULT NOW()
+	);
+
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_grid_hotspots_unique ON grid_hotspots (variable, period_start, grid_longitude, grid_latitude);
+	CREATE INDEX IF NOT EXISTS idx_grid_hotspots_classification ON grid_hotspots (variable, classification);
+	`
+
+	_, err := db.ExecContext(ctx, store.SchemaDDL(query))
+	return err
+}
+
+// createOccurrenceKDETable creates the occurrence density rasters written by analyze-kde, one row per non-zero cell
+func createOccurrenceKDETable(ctx context.Context, db *sql.DB) error {
+	query := `
+	CREATE TABLE IF NOT EXISTS occurrence_kde_raster (
+		id SERIAL PRIMARY KEY,
+		raster TEXT NOT NULL,
+		bio_group TEXT,
+		kernel TEXT NOT NULL,
+		bandwidth_km DOUBLE PRECISION NOT NULL,
+		cell_km DOUBLE PRECISION NOT NULL,
+		start_time TIMESTAMPTZ,
+		end_time TIMESTAMPTZ,
+		row_index INTEGER NOT NULL,
+		col_index INTEGER NOT NULL,
+		longitude DOUBLE PRECISION NOT NULL,
+		latitude DOUBLE PRECISION NOT NULL,
+		density DOUBLE PRECISION NOT NULL,
+		created_at TIMESTAMPTZ DEFAULT NOW()
+	);
+
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_occurrence_kde_unique ON occurrence_kde_raster (raster, row_index, col_index);
+	CREATE INDEX IF NOT EXISTS idx_occurrence_kde_location ON occurrence_kde_raster (longitude, latitude);
+	`
+
+	_, err := db.ExecContext(ctx, store.SchemaDDL(query))
+	return err
+}
+
+// createLightAnomalyTable creates the flagged brightness months per county and grid cell written by analyze-anomalies
+func createLightAnomalyTable(ctx context.Context, db *sql.DB) error {
+	query := `
+	CREATE TABLE IF NOT EXISTS light_brightness_anomaly (
+		id SERIAL PRIMARY KEY,
+		scope TEXT NOT NULL CHECK (scope IN ('county', 'grid')),
+		county TEXT,
+		grid_longitude DOUBLE PRECISION,
+		grid_latitude DOUBLE PRECISION,
+		resolution_km DOUBLE PRECISION,
+		year INTEGER NOT NULL,
+		month INTEGER NOT NULL CHECK (month >= 1 AND month <= 12),
+		brightness DOUBLE PRECISION NOT NULL,
+		baseline DOUBLE PRECISION NOT NULL,
+		deviation DOUBLE PRECISION NOT NULL,
+		relative_change DOUBLE PRECISION,
+		robust_z DOUBLE PRECISION NOT NULL,
+		baseline_years INTEGER NOT NULL,
+		direction TEXT NOT NULL CHECK (direction IN ('jump', 'drop')),
+		created_at TIMESTAMPTZ DEFAULT NOW()
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_light_anomaly_period ON light_brightness_anomaly (year, month);
+	CREATE INDEX IF NOT EXISTS idx_light_anomaly_county ON light_brightness_anomaly (county);
+	CREATE INDEX IF NOT EXISTS idx_light_anomaly_grid ON light_brightness_anomaly (grid_longitude, grid_latitude);
+	`
+
+	_, err := db.ExecContext(ctx, store.SchemaDDL(query))
+	return err
+}
+
+// createTaxonTraitTables creates taxon_traits, the activity periods imported by import-traits, and
+// taxon_activity, the period resolved per scientific name during migration
+func createTaxonTraitTables(ctx context.Context, db *sql.DB) error {
+	query := `
+	CREATE TABLE IF NOT EXISTS taxon_traits (
+		id SERIAL PRIMARY KEY,
+		scientific_name TEXT NOT NULL UNIQUE,
+		activity_period TEXT NOT NULL CHECK (activity_period IN ('nocturnal', 'diurnal', 'crepuscular')),
+		source TEXT,
+		created_at TIMESTAMPTZ DEFAULT NOW(),
+		updated_at TIMESTAMPTZ DEFAULT NOW()
+	);
+
+	CREATE TABLE IF NOT EXISTS taxon_activity (
+		scientific_name TEXT PRIMARY KEY,
+		activity_period TEXT NOT NULL CHECK (activity_period IN ('nocturnal', 'diurnal', 'crepuscular', 'unknown')),
+		basis TEXT NOT NULL CHECK (basis IN ('species', 'genus', 'time_of_day', 'none')),
+		timed_records INTEGER NOT NULL DEFAULT 0,
+		night_share DOUBLE PRECISION,
+		created_at TIMESTAMPTZ DEFAULT NOW()
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_taxon_activity_period ON taxon_activity (activity_period);
+	`
+
+	_, err := db.ExecContext(ctx, store.SchemaDDL(query))
+	return err
+}
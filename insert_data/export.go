@@ -0,0 +1,442 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ExportFormat is an output file format of the export command
+type ExportFormat string
+
+const (
+	ExportGeoJSON    ExportFormat = "geojson"
+	ExportNDGeoJSON  ExportFormat = "ndgeojson"
+	ExportCSV        ExportFormat = "csv"
+	ExportGeoParquet ExportFormat = "geoparquet"
+)
+
+// ExportFilter selects the table and rows to export
+type ExportFilter struct {
+	Table     string       `json:"table"` // "biological" or "light"
+	Bounds    *BoundingBox `json:"bounds,omitempty"`
+	TimeRange *TimeRange   `json:"time_range,omitempty"`
+	County    string       `json:"county,omitempty"`
+	BioGroup  string       `json:"bio_group,omitempty"` // biological_data only
+}
+
+// exportTable describes how rows of an exportable table are selected
+type exportTable struct {
+	name         string
+	columns      []ParquetColumn
+	longitudeCol string
+	latitudeCol  string
+	timeCol      string
+}
+
+var exportTables = map[string]exportTable{
+	"biological": {
+		name: "biological_data",
+		columns: []ParquetColumn{
+			{"id", ParquetInt},
+			{"source_scientific_name", ParquetString},
+			{"scientific_name", ParquetString},
+			{"common_name_c", ParquetString},
+			{"bio_group", ParquetString},
+			{"event_date", ParquetTimestamp},
+			{"created", ParquetTimestamp},
+			{"dataset_name", ParquetString},
+			{"basis_of_record", ParquetString},
+			{"standard_latitude", ParquetFloat},
+			{"standard_longitude", ParquetFloat},
+			{"county", ParquetString},
+			{"municipality", ParquetString},
+			{"locality", ParquetString},
+			{"organism_quantity", ParquetString},
+			{"taxon_id", ParquetString},
+			{"catalog_number", ParquetString},
+			{"record_number", ParquetString},
+			{"name_match", ParquetString},
+			{"accepted_name", ParquetString},
+			{"accepted_taxon_id", ParquetString},
+			{"accepted_common_name_c", ParquetString},
+			{"taxon_rank", ParquetString},
+			{"taxon_kingdom", ParquetString},
+			{"taxon_phylum", ParquetString},
+			{"taxon_class", ParquetString},
+			{"taxon_order", ParquetString},
+			{"taxon_family", ParquetString},
+			{"taxon_genus", ParquetString},
+			{"taxon_species", ParquetString},
+		},
+		longitudeCol: "standard_longitude",
+		latitudeCol:  "standard_latitude",
+		timeCol:      "event_date",
+	},
+	"light": {
+		name: "light_data_with_county",
+		columns: []ParquetColumn{
+			{"id", ParquetInt},
+			{"time", ParquetTimestamp},
+			{"longitude", ParquetFloat},
+			{"latitude", ParquetFloat},
+			{"brightness", ParquetFloat},
+			{"county", ParquetString},
+			{"quality_flag", ParquetInt},
+			{"cloud_free_obs", ParquetInt},
+		},
+		longitudeCol: "longitude",
+		latitudeCol:  "latitude",
+		timeCol:      "time",
+	},
+}
+
+// exportRowWriter writes exported rows in one output format
+type exportRowWriter interface {
+	WriteRow(values []interface{}, longitude, latitude *float64) error
+	Close() error
+}
+
+// exportFormatFromPath infers the format from the output file extension
+func exportFormatFromPath(path string) (ExportFormat, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".geojson", ".json":
+		return ExportGeoJSON, nil
+	case ".ndjson", ".geojsonl", ".geojsonseq":
+		return ExportNDGeoJSON, nil
+	case ".csv":
+		return ExportCSV, nil
+	case ".parquet", ".geoparquet":
+		return ExportGeoParquet, nil
+	}
+	return "", fmt.Errorf("cannot infer export format from %s, use --format", path)
+}
+
+// parseBoundingBox parses "minLon,minLat,maxLon,maxLat"
+func parseBoundingBox(value string) (*BoundingBox, error) {
+	parts := strings.Split(value, ",")
+	if len(parts) != 4 {
+		return nil, fmt.Errorf("bounding box must be minLon,minLat,maxLon,maxLat")
+	}
+	var coords [4]float64
+	for i, part := range parts {
+		f, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bounding box value %q: %v", part, err)
+		}
+		coords[i] = f
+	}
+	return &BoundingBox{
+		MinLongitude: coords[0],
+		MinLatitude:  coords[1],
+		MaxLongitude: coords[2],
+		MaxLatitude:  coords[3],
+	}, nil
+}
+
+// parseExportTimeRange parses --start/--end, either may be empty for an open range
+func parseExportTimeRange(start, end string) (*TimeRange, error) {
+	if start == "" && end == "" {
+		return nil, nil
+	}
+	timeRange := &TimeRange{End: time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC)}
+	var err error
+	if start != "" {
+		if timeRange.Start, err = parseAPITime(start); err != nil {
+			return nil, fmt.Errorf("invalid start time %q: %v", start, err)
+		}
+	}
+	if end != "" {
+		if timeRange.End, err = parseAPITime(end); err != nil {
+			return nil, fmt.Errorf("invalid end time %q: %v", end, err)
+		}
+	}
+	if timeRange.End.Before(timeRange.Start) {
+		return nil, fmt.Errorf("end time is before start time")
+	}
+	return timeRange, nil
+}
+
+// buildExportQuery returns the SELECT for the filtered table
+func buildExportQuery(table exportTable, filter ExportFilter) (string, []interface{}, error) {
+	names := make([]string, len(table.columns))
+	for i, column := range table.columns {
+		names[i] = column.Name
+	}
+
+	var conditions []string
+	var args []interface{}
+	if filter.Bounds != nil {
+		conditions = append(conditions, fmt.Sprintf("%s BETWEEN $%d AND $%d AND %s BETWEEN $%d AND $%d",
+			table.longitudeCol, len(args)+1, len(args)+2, table.latitudeCol, len(args)+3, len(args)+4))
+		args = append(args, filter.Bounds.MinLongitude, filter.Bounds.MaxLongitude, filter.Bounds.MinLatitude, filter.Bounds.MaxLatitude)
+	}
+	if filter.TimeRange != nil {
+		conditions = append(conditions, fmt.Sprintf("%s BETWEEN $%d AND $%d", table.timeCol, len(args)+1, len(args)+2))
+		args = append(args, filter.TimeRange.Start, filter.TimeRange.End)
+	}
+	if filter.County != "" {
+		conditions = append(conditions, fmt.Sprintf("county = $%d", len(args)+1))
+		args = append(args, filter.County)
+	}
+	if filter.BioGroup != "" {
+		if table.name != "biological_data" {
+			return "", nil, fmt.Errorf("bio_group filter only applies to biological data")
+		}
+		conditions = append(conditions, fmt.Sprintf("bio_group = $%d", len(args)+1))
+		args = append(args, filter.BioGroup)
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM %s", strings.Join(names, ", "), table.name)
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	return query + " ORDER BY id", args, nil
+}
+
+// runExport streams the filtered rows from a database cursor into the output file
+func runExport(ctx context.Context, db *sql.DB, filter ExportFilter, format ExportFormat, outPath string) (int64, error) {
+	table, ok := exportTables[filter.Table]
+	if !ok {
+		return 0, fmt.Errorf("unknown export table %q, expected biological or light", filter.Table)
+	}
+
+	query, args, err := buildExportQuery(table, filter)
+	if err != nil {
+		return 0, err
+	}
+
+	file, err := os.Create(outPath)
+	if err != nil {
+		return 0, fmt.Errorf("error creating %s: %v", outPath, err)
+	}
+	defer file.Close()
+
+	var writer exportRowWriter
+	switch format {
+	case ExportGeoJSON:
+		writer, err = newGeoJSONWriter(file, table.columns, false)
+	case ExportNDGeoJSON:
+		writer, err = newGeoJSONWriter(file, table.columns, true)
+	case ExportCSV:
+		writer, err = newCSVExportWriter(file, table.columns)
+	case ExportGeoParquet:
+		writer, err = NewGeoParquetWriter(file, table.columns)
+	default:
+		err = fmt.Errorf("unknown export format %q", format)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("error querying %s: %v", table.name, err)
+	}
+	defer rows.Close()
+
+	lonIndex, latIndex := -1, -1
+	for i, column := range table.columns {
+		switch column.Name {
+		case table.longitudeCol:
+			lonIndex = i
+		case table.latitudeCol:
+			latIndex = i
+		}
+	}
+
+	holders := make([]interface{}, len(table.columns))
+	for i, column := range table.columns {
+		switch column.Kind {
+		case ParquetString:
+			holders[i] = &sql.NullString{}
+		case ParquetFloat:
+			holders[i] = &sql.NullFloat64{}
+		case ParquetInt:
+			holders[i] = &sql.NullInt64{}
+		case ParquetTimestamp:
+			holders[i] = &sql.NullTime{}
+		}
+	}
+
+	var count int64
+	values := make([]interface{}, len(table.columns))
+	for rows.Next() {
+		if err := rows.Scan(holders...); err != nil {
+			return count, fmt.Errorf("error scanning %s: %v", table.name, err)
+		}
+		for i, holder := range holders {
+			values[i] = nullableValue(holder)
+		}
+
+		var longitude, latitude *float64
+		if lon, ok := values[lonIndex].(float64); ok {
+			if lat, ok := values[latIndex].(float64); ok {
+				longitude, latitude = &lon, &lat
+			}
+		}
+
+		if err := writer.WriteRow(values, longitude, latitude); err != nil {
+			return count, fmt.Errorf("error writing row %d: %v", count, err)
+		}
+
+		count++
+		if count%100000 == 0 {
+			slog.Info("Exported rows", "table", table.name, "rows", count)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return count, fmt.Errorf("error reading %s: %v", table.name, err)
+	}
+
+	if err := writer.Close(); err != nil {
+		return count, fmt.Errorf("error finishing %s: %v", outPath, err)
+	}
+	return count, file.Close()
+}
+
+// nullableValue unwraps a scanned sql.Null* holder, returning nil for NULL
+func nullableValue(holder interface{}) interface{} {
+	switch v := holder.(type) {
+	case *sql.NullString:
+		if v.Valid {
+			return v.String
+		}
+	case *sql.NullFloat64:
+		if v.Valid {
+			return v.Float64
+		}
+	case *sql.NullInt64:
+		if v.Valid {
+			return v.Int64
+		}
+	case *sql.NullTime:
+		if v.Valid {
+			return v.Time.UTC()
+		}
+	}
+	return nil
+}
+
+// geoJSONWriter streams features as a FeatureCollection or as newline-delimited GeoJSON
+type geoJSONWriter struct {
+	out       *bufio.Writer
+	columns   []ParquetColumn
+	delimited bool
+	first     bool
+}
+
+func newGeoJSONWriter(w io.Writer, columns []ParquetColumn, delimited bool) (*geoJSONWriter, error) {
+	gw := &geoJSONWriter{out: bufio.NewWriterSize(w, 1<<20), columns: columns, delimited: delimited, first: true}
+	if !delimited {
+		if _, err := gw.out.WriteString(`{"type":"FeatureCollection","features":[` + "\n"); err != nil {
+			return nil, err
+		}
+	}
+	return gw, nil
+}
+
+type geoJSONGeometry struct {
+	Type        string     `json:"type"`
+	Coordinates [2]float64 `json:"coordinates"`
+}
+
+type geoJSONFeature struct {
+	Type       string                 `json:"type"`
+	Geometry   *geoJSONGeometry       `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+func (gw *geoJSONWriter) WriteRow(values []interface{}, longitude, latitude *float64) error {
+	feature := geoJSONFeature{Type: "Feature", Properties: make(map[string]interface{}, len(values))}
+	for i, value := range values {
+		if t, ok := value.(time.Time); ok {
+			value = t.Format(time.RFC3339)
+		}
+		feature.Properties[gw.columns[i].Name] = value
+	}
+	if longitude != nil && latitude != nil {
+		feature.Geometry = &geoJSONGeometry{Type: "Point", Coordinates: [2]float64{*longitude, *latitude}}
+	}
+
+	data, err := json.Marshal(feature)
+	if err != nil {
+		return err
+	}
+
+	if !gw.delimited && !gw.first {
+		if _, err := gw.out.WriteString(",\n"); err != nil {
+			return err
+		}
+	}
+	gw.first = false
+	if _, err := gw.out.Write(data); err != nil {
+		return err
+	}
+	if gw.delimited {
+		return gw.out.WriteByte('\n')
+	}
+	return nil
+}
+
+func (gw *geoJSONWriter) Close() error {
+	if !gw.delimited {
+		if _, err := gw.out.WriteString("\n]}\n"); err != nil {
+			return err
+		}
+	}
+	return gw.out.Flush()
+}
+
+// csvExportWriter writes one row per record with empty cells for NULL
+type csvExportWriter struct {
+	out    *csv.Writer
+	record []string
+}
+
+func newCSVExportWriter(w io.Writer, columns []ParquetColumn) (*csvExportWriter, error) {
+	cw := &csvExportWriter{out: csv.NewWriter(w), record: make([]string, len(columns))}
+	header := make([]string, len(columns))
+	for i, column := range columns {
+		header[i] = column.Name
+	}
+	if err := cw.out.Write(header); err != nil {
+		return nil, err
+	}
+	return cw, nil
+}
+
+func (cw *csvExportWriter) WriteRow(values []interface{}, longitude, latitude *float64) error {
+	for i, value := range values {
+		switch v := value.(type) {
+		case nil:
+			cw.record[i] = ""
+		case string:
+			cw.record[i] = v
+		case float64:
+			cw.record[i] = strconv.FormatFloat(v, 'f', -1, 64)
+		case int64:
+			cw.record[i] = strconv.FormatInt(v, 10)
+		case time.Time:
+			cw.record[i] = v.Format(time.RFC3339)
+		default:
+			cw.record[i] = fmt.Sprint(v)
+		}
+	}
+	return cw.out.Write(cw.record)
+}
+
+func (cw *csvExportWriter) Close() error {
+	cw.out.Flush()
+	return cw.out.Error()
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+const earthRadiusKm = 6371.0
+
+// ExposureConfig controls how light pixels are attributed to occurrences
+type ExposureConfig struct {
+	RadiusKm      float64 // mean brightness is taken over the pixels within this radius
+	MaxDistanceKm float64 // the nearest pixel is searched up to this distance
+}
+
+// OccurrenceExposure is the light exposure of one occurrence, a row of occurrence_light_exposure.
+// The nearest-pixel fields are nil when no pixel lies within MaxDistanceKm, MeanBrightness when
+// none lies within RadiusKm.
+type OccurrenceExposure struct {
+	OccurrenceID     int64
+	LightMonth       time.Time
+	Brightness       *float64 // brightness of the nearest pixel
+	MeanBrightness   *float64
+	PixelCount       int
+	DistanceKm       *float64
+	NearestLongitude *float64
+	NearestLatitude  *float64
+	RadiusKm         float64
+}
+
+// exposureOccurrence is a biological_data record with coordinates and an event date
+type exposureOccurrence struct {
+	id        int64
+	longitude float64
+	latitude  float64
+}
+
+// exposurePixel is a light pixel with a brightness
+type exposurePixel struct {
+	longitude  float64
+	latitude   float64
+	brightness float64
+}
+
+// pixelIndex buckets the pixels of one month into square cells of cellDeg degrees
+type pixelIndex struct {
+	cellDeg float64
+	cells   map[[2]int32][]exposurePixel
+}
+
+func newPixelIndex(cellKm float64) *pixelIndex {
+	return &pixelIndex{
+		cellDeg: cellKm / (earthRadiusKm * math.Pi / 180),
+		cells:   make(map[[2]int32][]exposurePixel),
+	}
+}
+
+func (idx *pixelIndex) cell(longitude, latitude float64) [2]int32 {
+	return [2]int32{int32(math.Floor(longitude / idx.cellDeg)), int32(math.Floor(latitude / idx.cellDeg))}
+}
+
+func (idx *pixelIndex) add(p exposurePixel) {
+	key := idx.cell(p.longitude, p.latitude)
+	idx.cells[key] = append(idx.cells[key], p)
+}
+
+// exposure finds the nearest pixel within config.MaxDistanceKm and the mean brightness within config.RadiusKm
+func (idx *pixelIndex) exposure(o exposureOccurrence, month time.Time, config ExposureConfig) OccurrenceExposure {
+	result := OccurrenceExposure{OccurrenceID: o.id, LightMonth: month, RadiusKm: config.RadiusKm}
+
+	// Cells are square in degrees, so a longitude degree covers fewer kilometres away from the equator
+	reachLat := int32(math.Ceil(config.MaxDistanceKm / (idx.cellDeg * earthRadiusKm * math.Pi / 180)))
+	reachLon := reachLat
+	if cos := math.Cos(o.latitude * math.Pi / 180); cos > 0.01 {
+		reachLon = int32(math.Ceil(float64(reachLat) / cos))
+	}
+
+	center := idx.cell(o.longitude, o.latitude)
+	nearest := math.Inf(1)
+	var sum float64
+	for dx := -reachLon; dx <= reachLon; dx++ {
+		for dy := -reachLat; dy <= reachLat; dy++ {
+			for _, p := range idx.cells[[2]int32{center[0] + dx, center[1] + dy}] {
+				d := haversineKm(o.longitude, o.latitude, p.longitude, p.latitude)
+				if d <= config.RadiusKm {
+					sum += p.brightness
+					result.PixelCount++
+				}
+				if d <= config.MaxDistanceKm && d < nearest {
+					nearest = d
+					result.Brightness = floatPtr(p.brightness)
+					result.NearestLongitude = floatPtr(p.longitude)
+					result.NearestLatitude = floatPtr(p.latitude)
+				}
+			}
+		}
+	}
+
+	if result.Brightness != nil {
+		result.DistanceKm = floatPtr(nearest)
+	}
+	if result.PixelCount > 0 {
+		result.MeanBrightness = floatPtr(sum / float64(result.PixelCount))
+	}
+	return result
+}
+
+func floatPtr(v float64) *float64 {
+	return &v
+}
+
+// haversineKm returns the great-circle distance between two points
+func haversineKm(lon1, lat1, lon2, lat2 float64) float64 {
+	const rad = math.Pi / 180
+	dLat := (lat2 - lat1) * rad
+	dLon := (lon2 - lon1) * rad
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1*rad)*math.Cos(lat2*rad)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+// loadExposureOccurrences reads the occurrences with coordinates and an event date, grouped by UTC month
+func loadExposureOccurrences(ctx context.Context, db *sql.DB) (map[time.Time][]exposureOccurrence, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT id, standard_longitude, standard_latitude, event_date
+		FROM biological_data
+		WHERE standard_longitude IS NOT NULL AND standard_latitude IS NOT NULL AND event_date IS NOT NULL`)
+	if err != nil {
+		return nil, fmt.Errorf("error querying occurrences: %v", err)
+	}
+	defer rows.Close()
+
+	months := make(map[time.Time][]exposureOccurrence)
+	for rows.Next() {
+		var o exposureOccurrence
+		var eventDate time.Time
+		if err := rows.Scan(&o.id, &o.longitude, &o.latitude, &eventDate); err != nil {
+			return nil, fmt.Errorf("error scanning occurrence: %v", err)
+		}
+		eventDate = eventDate.UTC()
+		month := time.Date(eventDate.Year(), eventDate.Month(), 1, 0, 0, 0, 0, time.UTC)
+		months[month] = append(months[month], o)
+	}
+	return months, rows.Err()
+}
+
+// loadMonthPixels indexes the light pixels of month around the occurrences, applying lightQualityFilter
+func loadMonthPixels(ctx context.Context, db *sql.DB, month time.Time, occurrences []exposureOccurrence, config ExposureConfig) (*pixelIndex, int, error) {
+	bounds := BoundingBox{
+		MinLongitude: math.Inf(1), MaxLongitude: math.Inf(-1),
+		MinLatitude: math.Inf(1), MaxLatitude: math.Inf(-1),
+	}
+	for _, o := range occurrences {
+		bounds.MinLongitude = math.Min(bounds.MinLongitude, o.longitude)
+		bounds.MaxLongitude = math.Max(bounds.MaxLongitude, o.longitude)
+		bounds.MinLatitude = math.Min(bounds.MinLatitude, o.latitude)
+		bounds.MaxLatitude = math.Max(bounds.MaxLatitude, o.latitude)
+	}
+	marginLat := config.MaxDistanceKm / (earthRadiusKm * math.Pi / 180)
+	marginLon := marginLat / math.Max(0.01, math.Cos(math.Max(math.Abs(bounds.MinLatitude), math.Abs(bounds.MaxLatitude))*math.Pi/180))
+	bounds.MinLongitude -= marginLon
+	bounds.MaxLongitude += marginLon
+	bounds.MinLatitude -= marginLat
+	bounds.MaxLatitude += marginLat
+
+	// time BETWEEN is inclusive; light timestamps have at most microsecond precision
+	timeRange := TimeRange{Start: month, End: month.AddDate(0, 1, 0).Add(-time.Microsecond)}
+	source, err := NewDBLightSource(ctx, db, &bounds, &timeRange)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer source.Close()
+
+	index := newPixelIndex(config.RadiusKm)
+	count := 0
+	batch := make([]LightData, 10000)
+	for {
+		n, err := source.Read(batch)
+		for _, point := range batch[:n] {
+			if lightQualityFilter.exclusion(point.Quality, point.CloudFreeObs) != "" {
+				continue
+			}
+			index.add(exposurePixel{longitude: point.Longitude, latitude: point.Latitude, brightness: point.Brightness})
+			count++
+		}
+		if err == io.EOF {
+			return index, count, nil
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+}
+
+// runJoinExposure attributes light exposure to every occurrence in a month with light data and upserts
+// it into occurrence_light_exposure. Cancelling ctx stops before the next month.
+func runJoinExposure(ctx context.Context, db *sql.DB, config ExposureConfig) (int64, error) {
+	months, err := loadExposureOccurrences(ctx, db)
+	if err != nil {
+		return 0, err
+	}
+
+	ordered := make([]time.Time, 0, len(months))
+	for month := range months {
+		ordered = append(ordered, month)
+	}
+	sort.Slice(ordered, func(i, j int) bool { return ordered[i].Before(ordered[j]) })
+	slog.Info("Joining light exposure", "months", len(ordered), "radius_km", config.RadiusKm, "max_distance_km", config.MaxDistanceKm)
+
+	retries := NewRetryStats()
+	defer retries.LogSummary()
+
+	var written, withoutLight, withoutPixel int64
+	for _, month := range ordered {
+		if err := ctx.Err(); err != nil {
+			return written, fmt.Errorf("interrupted before %s: %w", month.Format("2006-01"), err)
+		}
+
+		occurrences := months[month]
+		logger := slog.With("month", month.Format("2006-01"), "table", "occurrence_light_exposure")
+		index, pixels, err := loadMonthPixels(ctx, db, month, occurrences, config)
+		if err != nil {
+			return written, fmt.Errorf("error loading light data for %s: %v", month.Format("2006-01"), err)
+		}
+		if pixels == 0 {
+			logger.Debug("No light data for month", "occurrences", len(occurrences))
+			withoutLight += int64(len(occurrences))
+			continue
+		}
+
+		exposures := make([]OccurrenceExposure, 0, len(occurrences))
+		for _, o := range occurrences {
+			exposure := index.exposure(o, month, config)
+			if exposure.Brightness == nil {
+				withoutPixel++
+			}
+			exposures = append(exposures, exposure)
+		}
+
+		batchSize := maxBatchRows(1000, 9)
+		for i := 0; i < len(exposures); i += batchSize {
+			end := min(i+batchSize, len(exposures))
+			batch := exposures[i:end]
+			err := withRetry(ctx, DefaultRetryPolicy, retries, "exposure batch", func() error {
+				return upsertExposureBatch(ctx, db, batch)
+			})
+			if err != nil {
+				return written, fmt.Errorf("error writing exposure for %s at offset %d: %v", month.Format("2006-01"), i, err)
+			}
+			written += int64(len(batch))
+		}
+		logger.Info("Joined month", "occurrences", len(occurrences), "pixels", pixels)
+	}
+
+	logProgress("Light exposure joined", "written", written, "no_light_data", withoutLight, "no_pixel_within_max_distance", withoutPixel)
+	return written, nil
+}
+
+// upsertExposureBatch writes exposures in one multi-row INSERT, replacing earlier results per occurrence
+func upsertExposureBatch(ctx context.Context, db *sql.DB, batch []OccurrenceExposure) error {
+	if len(batch) == 0 {
+		return nil
+	}
+
+	valueStrings := make([]string, 0, len(batch))
+	valueArgs := make([]interface{}, 0, len(batch)*9)
+	for i, e := range batch {
+		n := i * 9
+		valueStrings = append(valueStrings, fmt.Sprintf("($%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d)",
+			n+1, n+2, n+3, n+4, n+5, n+6, n+7, n+8, n+9))
+		valueArgs = append(valueArgs, e.OccurrenceID, e.LightMonth, e.Brightness, e.MeanBrightness, e.PixelCount,
+			e.DistanceKm, e.NearestLongitude, e.NearestLatitude, e.RadiusKm)
+	}
+
+	query := fmt.Sprintf(`
+		INSERT INTO occurrence_light_exposure
+			(occurrence_id, light_month, brightness, mean_brightness, pixel_count, distance_km, nearest_longitude, nearest_latitude, radius_km)
+		VALUES %s
+		ON CONFLICT (occurrence_id) DO UPDATE SET
+			light_month = EXCLUDED.light_month,
+			brightness = EXCLUDED.brightness,
+			mean_brightness = EXCLUDED.mean_brightness,
+			pixel_count = EXCLUDED.pixel_count,
+			distance_km = EXCLUDED.distance_km,
+			nearest_longitude = EXCLUDED.nearest_longitude,
+			nearest_latitude = EXCLUDED.nearest_latitude,
+			radius_km = EXCLUDED.radius_km,
+			updated_at = CURRENT_TIMESTAMP`, strings.Join(valueStrings, ","))
+
+	if _, err := db.ExecContext(ctx, query, valueArgs...); err != nil {
+		return fmt.Errorf("error upserting exposure batch: %w", err)
+	}
+	return nil
+}
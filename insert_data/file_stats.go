@@ -0,0 +1,85 @@
+package main
+
+import (
+	"log/slog"
+	"sort"
+	"sync/atomic"
+)
+
+// FileStats counts what happened to the records of one input file
+type FileStats struct {
+	Path       string
+	Records    int64 // records read from the file
+	Written    int64 // records handed to the sink
+	Exclusions *ExclusionCounts
+	Flagged    *ExclusionCounts // records written with NULL or unexpected fields, per reason
+	Err        error            // set when the file could not be processed
+}
+
+// NewFileStats creates empty statistics for path
+func NewFileStats(path string) *FileStats {
+	return &FileStats{Path: path, Exclusions: NewExclusionCounts(), Flagged: NewExclusionCounts()}
+}
+
+// addFile merges the statistics of a processed file into the run totals
+func (s *ProcessingStats) addFile(file *FileStats) {
+	s.Exclusions.Merge(file.Exclusions.Snapshot())
+	s.Flagged.Merge(file.Flagged.Snapshot())
+	atomic.AddInt64(&s.RecordsRead, file.Records)
+	atomic.AddInt64(&s.RecordsInserted, file.Written)
+
+	s.filesMu.Lock()
+	s.Files = append(s.Files, file)
+	s.filesMu.Unlock()
+}
+
+// addPending records a file that was never started because the import was interrupted
+func (s *ProcessingStats) addPending(path string) {
+	s.filesMu.Lock()
+	s.Pending = append(s.Pending, path)
+	s.filesMu.Unlock()
+}
+
+// logFileStats logs one record per file, sorted by path, with its exclusions per reason
+func logFileStats(files []*FileStats) {
+	sorted := append([]*FileStats(nil), files...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Path < sorted[j].Path })
+
+	for _, file := range sorted {
+		if file.Err != nil && !isInterrupted(file.Err) {
+			logProgress("File failed", "file", file.Path, "error", file.Err)
+			continue
+		}
+
+		snapshot := file.Exclusions.Snapshot()
+		reasons := make([]string, 0, len(snapshot))
+		for reason := range snapshot {
+			reasons = append(reasons, string(reason))
+		}
+		sort.Strings(reasons)
+
+		skipped := make([]any, 0, len(reasons))
+		for _, reason := range reasons {
+			skipped = append(skipped, slog.Int64(reason, snapshot[ExclusionReason(reason)]))
+		}
+		logProgress("File", "file", file.Path, "read", file.Records, "accepted", file.Written,
+			"flagged", file.Flagged.Total(), "interrupted", file.Err != nil, slog.Group("skipped", skipped...))
+	}
+}
+
+// logDryRunReport logs what an import would have written
+func logDryRunReport(stats *ProcessingStats) {
+	read := atomic.LoadInt64(&stats.RecordsRead)
+	accepted := atomic.LoadInt64(&stats.RecordsInserted)
+	logProgress("Dry run", "would_insert", accepted, "read", read, "skipped", stats.Exclusions.Total(),
+		"failed_files", atomic.LoadInt64(&stats.ErrorCount))
+
+	stats.filesMu.Lock()
+	logFileStats(stats.Files)
+	stats.filesMu.Unlock()
+
+	stats.Exclusions.LogSummary("Skipped records per reason")
+	if stats.Flagged.Total() > 0 {
+		stats.Flagged.LogSummary("Records that would be inserted with NULL or unexpected fields per reason")
+	}
+}
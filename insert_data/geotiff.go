@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+)
+
+// DensityRaster is a north-up grid of float values on regular longitude and latitude steps.
+// Values are stored row by row from the northern edge.
+type DensityRaster struct {
+	MinLongitude float64 // western edge of the first column
+	MaxLatitude  float64 // northern edge of the first row
+	CellLon      float64 // column width in degrees
+	CellLat      float64 // row height in degrees
+	Width        int
+	Height       int
+	Values       []float64
+}
+
+// cellCenter returns the centre of the cell in row and column
+func (r *DensityRaster) cellCenter(row, col int) (float64, float64) {
+	return r.MinLongitude + (float64(col)+0.5)*r.CellLon, r.MaxLatitude - (float64(row)+0.5)*r.CellLat
+}
+
+// TIFF field types
+const (
+	tiffShort  = 3
+	tiffLong   = 4
+	tiffDouble = 12
+)
+
+// tiffEntry is one IFD entry; values longer than four bytes are written after the IFD
+type tiffEntry struct {
+	tag   uint16
+	kind  uint16
+	count uint32
+	data  []byte
+}
+
+func tiffShorts(tag uint16, values ...uint16) tiffEntry {
+	data := make([]byte, 2*len(values))
+	for i, v := range values {
+		binary.LittleEndian.PutUint16(data[2*i:], v)
+	}
+	return tiffEntry{tag: tag, kind: tiffShort, count: uint32(len(values)), data: data}
+}
+
+func tiffLongs(tag uint16, values ...uint32) tiffEntry {
+	data := make([]byte, 4*len(values))
+	for i, v := range values {
+		binary.LittleEndian.PutUint32(data[4*i:], v)
+	}
+	return tiffEntry{tag: tag, kind: tiffLong, count: uint32(len(values)), data: data}
+}
+
+func tiffDoubles(tag uint16, values ...float64) tiffEntry {
+	data := make([]byte, 8*len(values))
+	for i, v := range values {
+		binary.LittleEndian.PutUint64(data[8*i:], math.Float64bits(v))
+	}
+	return tiffEntry{tag: tag, kind: tiffDouble, count: uint32(len(values)), data: data}
+}
+
+// WriteGeoTIFF writes the raster as an uncompressed single-band float32 GeoTIFF in WGS 84 (EPSG:4326)
+func WriteGeoTIFF(w io.Writer, raster *DensityRaster) error {
+	imageBytes := uint64(raster.Width) * uint64(raster.Height) * 4
+	if imageBytes > math.MaxUint32/2 {
+		return fmt.Errorf("raster of %dx%d cells is too large for a classic TIFF", raster.Width, raster.Height)
+	}
+
+	entries := []tiffEntry{
+		tiffLongs(256, uint32(raster.Width)),                  // ImageWidth
+		tiffLongs(257, uint32(raster.Height)),                 // ImageLength
+		tiffShorts(258, 32),                                   // BitsPerSample
+		tiffShorts(259, 1),                                    // Compression: none
+		tiffShorts(262, 1),                                    // PhotometricInterpretation: BlackIsZero
+		tiffLongs(273, 0),                                     // StripOffsets, set below
+		tiffShorts(277, 1),                                    // SamplesPerPixel
+		tiffLongs(278, uint32(raster.Height)),                 // RowsPerStrip: a single strip
+		tiffLongs(279, uint32(imageBytes)),                    // StripByteCounts
+		tiffShorts(284, 1),                                    // PlanarConfiguration: chunky
+		tiffShorts(339, 3),                                    // SampleFormat: IEEE float
+		tiffDoubles(33550, raster.CellLon, raster.CellLat, 0), // ModelPixelScale
+		tiffDoubles(33922, 0, 0, 0, raster.MinLongitude, raster.MaxLatitude, 0), // ModelTiepoint
+		tiffShorts(34735, // GeoKeyDirectory
+			1, 1, 0, 3,
+			1024, 0, 1, 2, // GTModelTypeGeoKey: geographic
+			1025, 0, 1, 1, // GTRasterTypeGeoKey: pixel is area
+			2048, 0, 1, 4326, // GeographicTypeGeoKey: WGS 84
+		),
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].tag < entries[j].tag })
+
+	// Header, IFD, out-of-line values, then the image strip
+	const headerSize = 8
+	ifdSize := 2 + 12*len(entries) + 4
+	extraOffset := uint32(headerSize + ifdSize)
+	extraSize := uint32(0)
+	for _, entry := range entries {
+		if len(entry.data) > 4 {
+			extraSize += uint32(len(entry.data)+1) &^ 1 // values start on a word boundary
+		}
+	}
+	for i := range entries {
+		if entries[i].tag == 273 {
+			entries[i] = tiffLongs(273, extraOffset+extraSize)
+		}
+	}
+
+	out := bufio.NewWriter(w)
+	header := []byte{'I', 'I', 42, 0, 0, 0, 0, 0}
+	binary.LittleEndian.PutUint32(header[4:], headerSize)
+	out.Write(header)
+
+	ifd := binary.LittleEndian.AppendUint16(nil, uint16(len(entries)))
+	var extra []byte
+	for _, entry := range entries {
+		ifd = binary.LittleEndian.AppendUint16(ifd, entry.tag)
+		ifd = binary.LittleEndian.AppendUint16(ifd, entry.kind)
+		ifd = binary.LittleEndian.AppendUint32(ifd, entry.count)
+		if len(entry.data) <= 4 {
+			value := make([]byte, 4)
+			copy(value, entry.data)
+			ifd = append(ifd, value...)
+			continue
+		}
+		ifd = binary.LittleEndian.AppendUint32(ifd, extraOffset+uint32(len(extra)))
+		extra = append(extra, entry.data...)
+		if len(extra)%2 == 1 {
+			extra = append(extra, 0)
+		}
+	}
+	ifd = binary.LittleEndian.AppendUint32(ifd, 0) // no further IFDs
+	out.Write(ifd)
+	out.Write(extra)
+
+	row := make([]byte, 4*raster.Width)
+	for r := 0; r < raster.Height; r++ {
+		for c := 0; c < raster.Width; c++ {
+			binary.LittleEndian.PutUint32(row[4*c:], math.Float32bits(float32(raster.Values[r*raster.Width+c])))
+		}
+		if _, err := out.Write(row); err != nil {
+			return err
+		}
+	}
+	return out.Flush()
+}
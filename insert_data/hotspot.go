@@ -0,0 +1,340 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// HotspotConfig controls analyze-hotspots
+type HotspotConfig struct {
+	GridKm      float64      // SpatialAggregator resolution of the cells
+	NeighbourKm float64      // cells whose centres lie within this distance are neighbours
+	Period      CalendarUnit // time bucket of each hotspot map
+}
+
+// Hotspot variables
+const (
+	HotspotBrightness        = "brightness"         // mean brightness of the cell
+	HotspotOccurrenceDensity = "occurrence_density" // occurrences per km² of the cell
+)
+
+// hotspotBins are the Gi* z-score thresholds of the 99, 95 and 90 percent confidence classes
+var hotspotBins = []struct {
+	confidence int
+	z          float64
+}{
+	{99, 2.5758},
+	{95, 1.9600},
+	{90, 1.6449},
+}
+
+// HotspotResult is the Getis-Ord Gi* statistic of one grid cell, variable and period, a row of grid_hotspots
+type HotspotResult struct {
+	Variable       string    `json:"variable"`
+	PeriodUnit     string    `json:"period_unit"`
+	PeriodStart    time.Time `json:"period_start"`
+	GridLongitude  float64   `json:"grid_longitude"`
+	GridLatitude   float64   `json:"grid_latitude"`
+	ResolutionKm   float64   `json:"resolution_km"`
+	NeighbourKm    float64   `json:"neighbour_km"`
+	Value          float64   `json:"value"`
+	Neighbours     int       `json:"neighbours"` // cells within NeighbourKm with data, the cell itself included
+	ZScore         *float64  `json:"z_score"`
+	PValue         *float64  `json:"p_value"`
+	Classification string    `json:"classification"` // hot, cold or not_significant
+	Confidence     *int      `json:"confidence"`     // 90, 95 or 99 for hot and cold spots
+}
+
+// hotspotColumns are the grid_hotspots columns in HotspotResult field order
+var hotspotColumns = []string{
+	"variable", "period_unit", "period_start", "grid_longitude", "grid_latitude", "resolution_km", "neighbour_km",
+	"value", "neighbours", "z_score", "p_value", "classification", "confidence",
+}
+
+func (h *HotspotResult) values() []interface{} {
+	return []interface{}{
+		h.Variable, h.PeriodUnit, h.PeriodStart, h.GridLongitude, h.GridLatitude, h.ResolutionKm, h.NeighbourKm,
+		h.Value, h.Neighbours, h.ZScore, h.PValue, h.Classification, h.Confidence,
+	}
+}
+
+func (h *HotspotResult) scanTargets() []interface{} {
+	return []interface{}{
+		&h.Variable, &h.PeriodUnit, &h.PeriodStart, &h.GridLongitude, &h.GridLatitude, &h.ResolutionKm, &h.NeighbourKm,
+		&h.Value, &h.Neighbours, &h.ZScore, &h.PValue, &h.Classification, &h.Confidence,
+	}
+}
+
+// hotspotNeighbours lists, for every cell, the cells whose centres lie within distanceKm, itself included
+func hotspotNeighbours(cells []GridCoordinate, distanceKm float64) [][]int {
+	order := make([]int, len(cells))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(a, b int) bool { return cells[order[a]].Latitude < cells[order[b]].Latitude })
+
+	// Cells are sorted by latitude so each search only scans the band that can be within reach
+	band := distanceKm / (earthRadiusKm * math.Pi / 180)
+	neighbours := make([][]int, len(cells))
+	for a, i := range order {
+		for b := a; b < len(order); b++ {
+			j := order[b]
+			if cells[j].Latitude-cells[i].Latitude > band {
+				break
+			}
+			if haversineKm(cells[i].Longitude, cells[i].Latitude, cells[j].Longitude, cells[j].Latitude) <= distanceKm {
+				neighbours[i] = append(neighbours[i], j)
+				if j != i {
+					neighbours[j] = append(neighbours[j], i)
+				}
+			}
+		}
+	}
+	return neighbours
+}
+
+// getisOrdGiStar computes the Gi* z-score of every cell present in values with binary weights over
+// neighbours; cells missing from values are outside the study area of this map
+func getisOrdGiStar(values map[int]float64, neighbours [][]int) map[int]float64 {
+	n := float64(len(values))
+	var sum, sumSquares float64
+	for _, x := range values {
+		sum += x
+		sumSquares += x * x
+	}
+	xBar := sum / n
+	s := math.Sqrt(sumSquares/n - xBar*xBar)
+
+	scores := make(map[int]float64, len(values))
+	for i := range values {
+		var weights, weighted float64
+		for _, j := range neighbours[i] {
+			if x, ok := values[j]; ok {
+				weights++
+				weighted += x
+			}
+		}
+		if n < 2 || s == 0 || weights == n {
+			scores[i] = math.NaN()
+			continue
+		}
+		scores[i] = (weighted - xBar*weights) / (s * math.Sqrt((n*weights-weights*weights)/(n-1)))
+	}
+	return scores
+}
+
+// classifyHotspot bins a Gi* z-score into hot and cold spots at 90, 95 or 99 percent confidence
+func classifyHotspot(z float64) (string, *int) {
+	for _, bin := range hotspotBins {
+		confidence := bin.confidence
+		switch {
+		case z >= bin.z:
+			return "hot", &confidence
+		case z <= -bin.z:
+			return "cold", &confidence
+		}
+	}
+	return "not_significant", nil
+}
+
+// hotspotGrid holds the cells of all maps and their values per variable and period
+type hotspotGrid struct {
+	cells   []GridCoordinate
+	index   map[GridCoordinate]int
+	periods map[int64]map[string]map[int]float64 // period start unix -> variable -> cell -> value
+}
+
+func (g *hotspotGrid) cell(coord GridCoordinate) int {
+	i, ok := g.index[coord]
+	if !ok {
+		i = len(g.cells)
+		g.index[coord] = i
+		g.cells = append(g.cells, coord)
+	}
+	return i
+}
+
+func (g *hotspotGrid) values(period int64, variable string) map[int]float64 {
+	if g.periods[period] == nil {
+		g.periods[period] = make(map[string]map[int]float64)
+	}
+	if g.periods[period][variable] == nil {
+		g.periods[period][variable] = make(map[int]float64)
+	}
+	return g.periods[period][variable]
+}
+
+// loadOccurrenceCounts adds the occurrence count of every cell and period to the occurrence_density map
+func loadOccurrenceCounts(ctx context.Context, db *sql.DB, aggregator *DataAggregator, grid *hotspotGrid) error {
+	rows, err := db.QueryContext(ctx, `
+		SELECT standard_longitude, standard_latitude, event_date
+		FROM biological_data
+		WHERE standard_longitude IS NOT NULL AND standard_latitude IS NOT NULL AND event_date IS NOT NULL`)
+	if err != nil {
+		return fmt.Errorf("error querying occurrences: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var longitude, latitude float64
+		var eventDate time.Time
+		if err := rows.Scan(&longitude, &latitude, &eventDate); err != nil {
+			return fmt.Errorf("error scanning occurrence: %v", err)
+		}
+		cell := grid.cell(aggregator.spatialAgg.snapToGrid(longitude, latitude))
+		period := aggregator.temporalAgg.snapToBucket(eventDate).Unix()
+		grid.values(period, HotspotOccurrenceDensity)[cell]++
+	}
+	return rows.Err()
+}
+
+// runHotspotAnalysis rebuilds grid_hotspots with the Gi* hot and cold spots of brightness and occurrence
+// density per grid cell and period. Occurrence density is mapped over every cell with light data or
+// occurrences in the period, so cells without occurrences count as zero.
+func runHotspotAnalysis(ctx context.Context, db *sql.DB, config HotspotConfig) (int, error) {
+	aggregator, err := NewDataAggregator(&AggregationConfig{
+		SpatialResolutionKm: config.GridKm,
+		CalendarUnit:        config.Period,
+		AggregationMethod:   "average",
+		Quality:             lightQualityFilter,
+	})
+	if err != nil {
+		return 0, err
+	}
+	grid := &hotspotGrid{index: make(map[GridCoordinate]int), periods: make(map[int64]map[string]map[int]float64)}
+
+	accumulators, err := aggregateLightGrid(ctx, db, aggregator)
+	if err != nil {
+		return 0, err
+	}
+	for key, acc := range accumulators {
+		cell := grid.cell(GridCoordinate{Longitude: key.GridLongitude, Latitude: key.GridLatitude})
+		grid.values(key.TimeBucket, HotspotBrightness)[cell] = acc.Average()
+	}
+	aggregator.exclusions.LogSummary("Light pixels skipped by the hotspot grid")
+
+	if err := loadOccurrenceCounts(ctx, db, aggregator, grid); err != nil {
+		return 0, err
+	}
+
+	// Counts become densities, and cells with light data but no occurrences join the map as zero
+	cellAreaKm2 := config.GridKm * config.GridKm
+	for _, variables := range grid.periods {
+		density := variables[HotspotOccurrenceDensity]
+		if density == nil {
+			density = make(map[int]float64)
+			variables[HotspotOccurrenceDensity] = density
+		}
+		for cell, count := range density {
+			density[cell] = count / cellAreaKm2
+		}
+		for cell := range variables[HotspotBrightness] {
+			if _, ok := density[cell]; !ok {
+				density[cell] = 0
+			}
+		}
+	}
+
+	neighbours := hotspotNeighbours(grid.cells, config.NeighbourKm)
+	periods := make([]int64, 0, len(grid.periods))
+	for period := range grid.periods {
+		periods = append(periods, period)
+	}
+	sort.Slice(periods, func(i, j int) bool { return periods[i] < periods[j] })
+	slog.Info("Computing hotspots", "cells", len(grid.cells), "periods", len(periods),
+		"period_unit", config.Period, "resolution_km", config.GridKm, "neighbour_km", config.NeighbourKm)
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM grid_hotspots"); err != nil {
+		return 0, fmt.Errorf("error clearing grid_hotspots: %v", err)
+	}
+
+	written := 0
+	classes := make(map[string]int)
+	for _, period := range periods {
+		var results []HotspotResult
+		for _, variable := range []string{HotspotBrightness, HotspotOccurrenceDensity} {
+			values := grid.periods[period][variable]
+			scores := getisOrdGiStar(values, neighbours)
+
+			for cell, value := range values {
+				result := HotspotResult{
+					Variable:      variable,
+					PeriodUnit:    string(config.Period),
+					PeriodStart:   time.Unix(period, 0).UTC(),
+					GridLongitude: grid.cells[cell].Longitude,
+					GridLatitude:  grid.cells[cell].Latitude,
+					ResolutionKm:  config.GridKm,
+					NeighbourKm:   config.NeighbourKm,
+					Value:         value,
+				}
+				for _, j := range neighbours[cell] {
+					if _, ok := values[j]; ok {
+						result.Neighbours++
+					}
+				}
+				z := scores[cell]
+				result.ZScore = finitePtr(z)
+				result.PValue = finitePtr(2 * (1 - normalCDF(math.Abs(z))))
+				result.Classification, result.Confidence = classifyHotspot(z)
+				classes[variable+"_"+result.Classification]++
+				results = append(results, result)
+			}
+		}
+
+		if err := insertRows(ctx, tx, "grid_hotspots", hotspotColumns, results); err != nil {
+			return 0, err
+		}
+		written += len(results)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	logProgress("Hotspot analysis written", "table", "grid_hotspots", "rows", written,
+		"brightness_hot", classes["brightness_hot"], "brightness_cold", classes["brightness_cold"],
+		"occurrence_density_hot", classes["occurrence_density_hot"], "occurrence_density_cold", classes["occurrence_density_cold"])
+	return written, nil
+}
+
+// queryHotspotResults reads grid_hotspots for one variable, optionally filtered by period start and classification
+func queryHotspotResults(ctx context.Context, db *sql.DB, variable string, periodStart *time.Time, classification string) ([]HotspotResult, error) {
+	conditions := []string{"variable = $1"}
+	args := []interface{}{variable}
+	if periodStart != nil {
+		args = append(args, *periodStart)
+		conditions = append(conditions, fmt.Sprintf("period_start = $%d", len(args)))
+	}
+	if classification != "" {
+		args = append(args, classification)
+		conditions = append(conditions, fmt.Sprintf("classification = $%d", len(args)))
+	}
+
+	rows, err := db.QueryContext(ctx, fmt.Sprintf("SELECT %s FROM grid_hotspots WHERE %s ORDER BY period_start, grid_latitude, grid_longitude",
+		strings.Join(hotspotColumns, ", "), strings.Join(conditions, " AND ")), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []HotspotResult{}
+	for rows.Next() {
+		var result HotspotResult
+		if err := rows.Scan(result.scanTargets()...); err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+	return results, rows.Err()
+}
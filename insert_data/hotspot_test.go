@@ -0,0 +1,114 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"testing"
+)
+
+// lineCells returns n cells 0.05° (about 5.6 km) apart along a meridian
+func lineCells(n int) []GridCoordinate {
+	cells := make([]GridCoordinate, n)
+	for i := range cells {
+		cells[i] = GridCoordinate{Longitude: 121, Latitude: 23 + 0.05*float64(i)}
+	}
+	return cells
+}
+
+func TestHotspotNeighbours(t *testing.T) {
+	neighbours := hotspotNeighbours(lineCells(5), 6)
+	want := [][]int{{0, 1}, {0, 1, 2}, {1, 2, 3}, {2, 3, 4}, {3, 4}}
+	for i := range want {
+		got := append([]int(nil), neighbours[i]...)
+		sort.Ints(got)
+		if len(got) != len(want[i]) {
+			t.Errorf("cell %d has neighbours %v, want %v", i, got, want[i])
+			continue
+		}
+		for k := range got {
+			if got[k] != want[i][k] {
+				t.Errorf("cell %d has neighbours %v, want %v", i, got, want[i])
+				break
+			}
+		}
+	}
+}
+
+func TestGetisOrdGiStar(t *testing.T) {
+	neighbours := hotspotNeighbours(lineCells(5), 6)
+	values := map[int]float64{0: 1, 1: 2, 2: 3, 3: 4, 4: 10}
+
+	// n = 5, mean 4, s = √10; z = (Σ_neighbours x - 4w) / (√10 √((5w - w²) / 4))
+	want := map[int]float64{
+		0: -5 / math.Sqrt(15),
+		1: -6 / math.Sqrt(15),
+		2: -3 / math.Sqrt(15),
+		3: 5 / math.Sqrt(15),
+		4: 6 / math.Sqrt(15),
+	}
+	scores := getisOrdGiStar(values, neighbours)
+	for i, z := range want {
+		if !closeTo(scores[i], z, 1e-12) {
+			t.Errorf("Gi* of cell %d = %g, want %g", i, scores[i], z)
+		}
+	}
+
+	// Negating the values mirrors hot and cold spots
+	negated := make(map[int]float64, len(values))
+	for i, x := range values {
+		negated[i] = -x
+	}
+	for i, z := range getisOrdGiStar(negated, neighbours) {
+		if !closeTo(z, -scores[i], 1e-12) {
+			t.Errorf("Gi* of negated cell %d = %g, want %g", i, z, -scores[i])
+		}
+	}
+}
+
+func TestGetisOrdGiStarUndefined(t *testing.T) {
+	neighbours := hotspotNeighbours(lineCells(3), 6)
+
+	// A constant map has no spread
+	for i, z := range getisOrdGiStar(map[int]float64{0: 2, 1: 2, 2: 2}, neighbours) {
+		if !math.IsNaN(z) {
+			t.Errorf("Gi* of cell %d in a constant map = %g, want NaN", i, z)
+		}
+	}
+
+	// Cell 1 neighbours the whole map, and cells missing from the map do not count as neighbours
+	scores := getisOrdGiStar(map[int]float64{0: 1, 1: 5, 2: 3}, neighbours)
+	if !math.IsNaN(scores[1]) {
+		t.Errorf("Gi* of a cell neighbouring every cell = %g, want NaN", scores[1])
+	}
+	partial := getisOrdGiStar(map[int]float64{0: 1, 2: 3}, neighbours)
+	if _, ok := partial[1]; ok {
+		t.Error("Gi* computed for a cell outside the map")
+	}
+	if z := partial[0]; !closeTo(z, -1, 1e-12) {
+		t.Errorf("Gi* of cell 0 without its missing neighbour = %g, want -1", z)
+	}
+}
+
+func TestClassifyHotspot(t *testing.T) {
+	tests := []struct {
+		z          float64
+		class      string
+		confidence int
+	}{
+		{2.6, "hot", 99},
+		{-2.0, "cold", 95},
+		{1.7, "hot", 90},
+		{1.6, "not_significant", 0},
+		{math.NaN(), "not_significant", 0},
+	}
+	for _, tt := range tests {
+		class, confidence := classifyHotspot(tt.z)
+		got := 0
+		if confidence != nil {
+			got = *confidence
+		}
+		if class != tt.class || got != tt.confidence {
+			t.Errorf("classifyHotspot(%g) = %s at %d%%, want %s at %d%%", tt.z, class, got, tt.class, tt.confidence)
+		}
+	}
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+)
+
+// maxKDECells bounds the raster size so a small --grid-km over a wide area fails fast
+const maxKDECells = 50_000_000
+
+// Kernel is the smoothing kernel of a density estimate
+type Kernel string
+
+const (
+	KernelGaussian     Kernel = "gaussian"     // truncated at three bandwidths
+	KernelEpanechnikov Kernel = "epanechnikov" // support of one bandwidth
+	KernelQuartic      Kernel = "quartic"      // biweight, support of one bandwidth
+)
+
+// weight returns the two-dimensional kernel density at distance d for bandwidth h, per km²
+func (k Kernel) weight(d, h float64) float64 {
+	u := d / h
+	switch k {
+	case KernelGaussian:
+		return math.Exp(-u*u/2) / (2 * math.Pi * h * h)
+	case KernelEpanechnikov:
+		if u < 1 {
+			return 2 / (math.Pi * h * h) * (1 - u*u)
+		}
+	case KernelQuartic:
+		if u < 1 {
+			return 3 / (math.Pi * h * h) * (1 - u*u) * (1 - u*u)
+		}
+	}
+	return 0
+}
+
+// support returns the distance beyond which the kernel is zero
+func (k Kernel) support(h float64) float64 {
+	if k == KernelGaussian {
+		return 3 * h
+	}
+	return h
+}
+
+func (k Kernel) valid() bool {
+	switch k {
+	case KernelGaussian, KernelEpanechnikov, KernelQuartic:
+		return true
+	}
+	return false
+}
+
+// KDEConfig controls analyze-kde
+type KDEConfig struct {
+	Filter      ExportFilter // occurrences to include; Table is ignored
+	Kernel      Kernel
+	BandwidthKm float64 // 0 selects Silverman's rule of thumb
+	CellKm      float64
+	Raster      string // name of the raster in occurrence_kde_raster
+	OutPath     string // write a GeoTIFF instead of the table when set
+}
+
+// kdePoint is an occurrence location
+type kdePoint struct {
+	longitude float64
+	latitude  float64
+}
+
+// loadKDEPoints reads the occurrence locations selected by filter
+func loadKDEPoints(ctx context.Context, db *sql.DB, filter ExportFilter) ([]kdePoint, error) {
+	table := exportTables["biological"]
+	table.columns = []ParquetColumn{{"standard_longitude", ParquetFloat}, {"standard_latitude", ParquetFloat}}
+	query, args, err := buildExportQuery(table, filter)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying occurrences: %v", err)
+	}
+	defer rows.Close()
+
+	var points []kdePoint
+	for rows.Next() {
+		var longitude, latitude sql.NullFloat64
+		if err := rows.Scan(&longitude, &latitude); err != nil {
+			return nil, fmt.Errorf("error scanning occurrence: %v", err)
+		}
+		if longitude.Valid && latitude.Valid {
+			points = append(points, kdePoint{longitude: longitude.Float64, latitude: latitude.Float64})
+		}
+	}
+	return points, rows.Err()
+}
+
+// silvermanBandwidth is Silverman's rule of thumb for two dimensions, σ n^(-1/6), with σ the quadratic mean of
+// the standard deviations along both axes in km
+func silvermanBandwidth(points []kdePoint) float64 {
+	longitudes := make([]float64, len(points))
+	latitudes := make([]float64, len(points))
+	for i, p := range points {
+		longitudes[i], latitudes[i] = p.longitude, p.latitude
+	}
+	kmPerDegree := earthRadiusKm * math.Pi / 180
+	sx := standardDeviation(longitudes) * kmPerDegree * math.Cos(mean(latitudes)*math.Pi/180)
+	sy := standardDeviation(latitudes) * kmPerDegree
+	return math.Sqrt((sx*sx+sy*sy)/2) * math.Pow(float64(len(points)), -1.0/6)
+}
+
+// newDensityRaster lays out a grid of cellKm cells over bounds, or over the points widened by margin km
+func newDensityRaster(points []kdePoint, bounds *BoundingBox, cellKm, marginKm float64) (*DensityRaster, error) {
+	kmPerDegree := earthRadiusKm * math.Pi / 180
+	if bounds == nil {
+		bounds = &BoundingBox{
+			MinLongitude: math.Inf(1), MaxLongitude: math.Inf(-1),
+			MinLatitude: math.Inf(1), MaxLatitude: math.Inf(-1),
+		}
+		for _, p := range points {
+			bounds.MinLongitude = math.Min(bounds.MinLongitude, p.longitude)
+			bounds.MaxLongitude = math.Max(bounds.MaxLongitude, p.longitude)
+			bounds.MinLatitude = math.Min(bounds.MinLatitude, p.latitude)
+			bounds.MaxLatitude = math.Max(bounds.MaxLatitude, p.latitude)
+		}
+		marginLat := marginKm / kmPerDegree
+		marginLon := marginLat / math.Cos((bounds.MinLatitude+bounds.MaxLatitude)/2*math.Pi/180)
+		bounds.MinLongitude -= marginLon
+		bounds.MaxLongitude += marginLon
+		bounds.MinLatitude -= marginLat
+		bounds.MaxLatitude += marginLat
+	}
+
+	// A regular longitude step, sized at the centre latitude, keeps the grid aligned with the light rasters
+	raster := &DensityRaster{
+		MinLongitude: bounds.MinLongitude,
+		MaxLatitude:  bounds.MaxLatitude,
+		CellLat:      cellKm / kmPerDegree,
+	}
+	raster.CellLon = raster.CellLat / math.Cos((bounds.MinLatitude+bounds.MaxLatitude)/2*math.Pi/180)
+	raster.Width = max(1, int(math.Ceil((bounds.MaxLongitude-bounds.MinLongitude)/raster.CellLon)))
+	raster.Height = max(1, int(math.Ceil((bounds.MaxLatitude-bounds.MinLatitude)/raster.CellLat)))
+	if cells := raster.Width * raster.Height; cells > maxKDECells {
+		return nil, fmt.Errorf("raster of %dx%d cells exceeds %d, use a larger --grid-km or a smaller --bbox",
+			raster.Width, raster.Height, maxKDECells)
+	}
+	raster.Values = make([]float64, raster.Width*raster.Height)
+	return raster, nil
+}
+
+// estimateDensity adds the kernel of every point to the raster; values are occurrences per km²
+func estimateDensity(raster *DensityRaster, points []kdePoint, kernel Kernel, bandwidthKm float64) {
+	kmPerDegree := earthRadiusKm * math.Pi / 180
+	reach := kernel.support(bandwidthKm)
+	for _, p := range points {
+		kmPerLon := kmPerDegree * math.Cos(p.latitude*math.Pi/180)
+		colMin := int(math.Floor((p.longitude - reach/kmPerLon - raster.MinLongitude) / raster.CellLon))
+		colMax := int(math.Floor((p.longitude + reach/kmPerLon - raster.MinLongitude) / raster.CellLon))
+		rowMin := int(math.Floor((raster.MaxLatitude - p.latitude - reach/kmPerDegree) / raster.CellLat))
+		rowMax := int(math.Floor((raster.MaxLatitude - p.latitude + reach/kmPerDegree) / raster.CellLat))
+
+		for row := max(0, rowMin); row <= min(raster.Height-1, rowMax); row++ {
+			for col := max(0, colMin); col <= min(raster.Width-1, colMax); col++ {
+				longitude, latitude := raster.cellCenter(row, col)
+				dx := (longitude - p.longitude) * kmPerLon
+				dy := (latitude - p.latitude) * kmPerDegree
+				d := math.Sqrt(dx*dx + dy*dy)
+				if d < reach {
+					raster.Values[row*raster.Width+col] += kernel.weight(d, bandwidthKm)
+				}
+			}
+		}
+	}
+}
+
+// runKDE estimates the occurrence density and writes it to config.OutPath as a GeoTIFF, or otherwise
+// replaces config.Raster in occurrence_kde_raster. It returns the number of cells written.
+func runKDE(ctx context.Context, db *sql.DB, config KDEConfig) (int, error) {
+	points, err := loadKDEPoints(ctx, db, config.Filter)
+	if err != nil {
+		return 0, err
+	}
+	if len(points) == 0 {
+		return 0, fmt.Errorf("no occurrences match the filter")
+	}
+
+	bandwidth := config.BandwidthKm
+	if bandwidth <= 0 {
+		bandwidth = silvermanBandwidth(points)
+		if !(bandwidth > 0) {
+			bandwidth = config.CellKm
+		}
+	}
+	raster, err := newDensityRaster(points, config.Filter.Bounds, config.CellKm, config.Kernel.support(bandwidth))
+	if err != nil {
+		return 0, err
+	}
+	slog.Info("Estimating occurrence density", "points", len(points), "kernel", config.Kernel,
+		"bandwidth_km", bandwidth, "cell_km", config.CellKm, "width", raster.Width, "height", raster.Height)
+	estimateDensity(raster, points, config.Kernel, bandwidth)
+
+	if config.OutPath != "" {
+		file, err := os.Create(config.OutPath)
+		if err != nil {
+			return 0, fmt.Errorf("error creating %s: %v", config.OutPath, err)
+		}
+		defer file.Close()
+		if err := WriteGeoTIFF(file, raster); err != nil {
+			return 0, fmt.Errorf("error writing %s: %v", config.OutPath, err)
+		}
+		return raster.Width * raster.Height, file.Close()
+	}
+	return writeKDERaster(ctx, db, config, bandwidth, raster)
+}
+
+// kdeColumns are the occurrence_kde_raster columns written per cell
+var kdeColumns = []string{
+	"raster", "bio_group", "kernel", "bandwidth_km", "cell_km", "start_time", "end_time",
+	"row_index", "col_index", "longitude", "latitude", "density",
+}
+
+// kdeCell is a non-zero raster cell, a row of occurrence_kde_raster
+type kdeCell struct {
+	raster                       []interface{} // the raster columns shared by every cell, up to end_time
+	row, col                     int
+	longitude, latitude, density float64
+}
+
+func (c *kdeCell) values() []interface{} {
+	return append(append(make([]interface{}, 0, len(kdeColumns)), c.raster...), c.row, c.col, c.longitude, c.latitude, c.density)
+}
+
+// writeKDERaster replaces the non-zero cells of config.Raster in occurrence_kde_raster in one transaction
+func writeKDERaster(ctx context.Context, db *sql.DB, config KDEConfig, bandwidth float64, raster *DensityRaster) (int, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM occurrence_kde_raster WHERE raster = $1", config.Raster); err != nil {
+		return 0, fmt.Errorf("error clearing raster %s: %v", config.Raster, err)
+	}
+
+	var bioGroup, start, end interface{}
+	if config.Filter.BioGroup != "" {
+		bioGroup = config.Filter.BioGroup
+	}
+	if config.Filter.TimeRange != nil {
+		start, end = config.Filter.TimeRange.Start, config.Filter.TimeRange.End
+	}
+	shared := []interface{}{config.Raster, bioGroup, string(config.Kernel), bandwidth, config.CellKm, start, end}
+
+	var cells []kdeCell
+	for row := 0; row < raster.Height; row++ {
+		for col := 0; col < raster.Width; col++ {
+			density := raster.Values[row*raster.Width+col]
+			if density == 0 {
+				continue
+			}
+			longitude, latitude := raster.cellCenter(row, col)
+			cells = append(cells, kdeCell{raster: shared, row: row, col: col, longitude: longitude, latitude: latitude, density: density})
+		}
+	}
+	if err := insertRows(ctx, tx, "occurrence_kde_raster", kdeColumns, cells); err != nil {
+		return 0, err
+	}
+	return len(cells), tx.Commit()
+}
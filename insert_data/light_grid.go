@@ -0,0 +1,307 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// lightGridColumns are the light_grid_aggregated columns written per cell, in the order of lightGridCell.values
+var lightGridColumns = []string{
+	"resolution_km", "grid_longitude", "grid_latitude", "time_bucket",
+	"brightness_sum", "point_count", "min_brightness", "max_brightness",
+}
+
+// lightGridMerge adds a batch to the stored totals of its cells instead of replacing them
+const lightGridMerge = `ON CONFLICT (resolution_km, grid_longitude, grid_latitude, time_bucket) DO UPDATE SET
+	brightness_sum = light_grid_aggregated.brightness_sum + excluded.brightness_sum,
+	point_count = light_grid_aggregated.point_count + excluded.point_count,
+	min_brightness = CASE WHEN excluded.min_brightness < light_grid_aggregated.min_brightness
+		THEN excluded.min_brightness ELSE light_grid_aggregated.min_brightness END,
+	max_brightness = CASE WHEN excluded.max_brightness > light_grid_aggregated.max_brightness
+		THEN excluded.max_brightness ELSE light_grid_aggregated.max_brightness END,
+	updated_at = CURRENT_TIMESTAMP`
+
+// lightGridCell is one aggregated cell and month at a grid resolution
+type lightGridCell struct {
+	ResolutionKm float64
+	AggregatedLightData
+}
+
+func (c *lightGridCell) values() []interface{} {
+	return []interface{}{
+		c.ResolutionKm, c.GridLongitude, c.GridLatitude, c.TimeBucket.UTC(),
+		c.AvgBrightness * float64(c.Count), c.Count, c.MinBrightness, c.MaxBrightness,
+	}
+}
+
+// lightGridConfig groups pixels by grid cell and calendar month in Taiwan time, like MonthlyConfig
+func lightGridConfig(resolutionKm float64) *AggregationConfig {
+	return &AggregationConfig{
+		SpatialResolutionKm: resolutionKm,
+		CalendarUnit:        CalendarMonth,
+		Location:            TaiwanLocation,
+		AggregationMethod:   "average",
+	}
+}
+
+// lightDataFromRecord converts a parsed light record with a brightness into an aggregator point
+func lightDataFromRecord(record LightRecord) LightData {
+	return LightData{
+		Time:         record.Time,
+		Longitude:    record.Longitude,
+		Latitude:     record.Latitude,
+		Brightness:   *record.Brightness,
+		Quality:      record.Quality,
+		CloudFreeObs: record.CloudFreeObs,
+	}
+}
+
+// parseResolutions parses a comma-separated list of grid sizes in km
+func parseResolutions(value string) ([]float64, error) {
+	var resolutions []float64
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		km, err := strconv.ParseFloat(part, 64)
+		if err != nil || km <= 0 {
+			return nil, fmt.Errorf("invalid grid size %q, expected a positive number of km", part)
+		}
+		resolutions = append(resolutions, km)
+	}
+	return resolutions, nil
+}
+
+// AggregatingSink passes records on to the wrapped sink and merges the light pixels into light_grid_aggregated.
+// Concurrent WriteLight calls share one StreamingAggregator per resolution; a writer per resolution adds every
+// flushed batch to the stored totals, so partial batches of the same cell and month sum up correctly.
+// Importing the same files twice counts them twice.
+type AggregatingSink struct {
+	Sink
+	db          *sql.DB
+	aggregators []*StreamingAggregator
+	writers     sync.WaitGroup
+
+	errMu sync.Mutex
+	err   error // first writer error, returned by the following writes and Close
+}
+
+// NewAggregatingSink wraps sink; the light_grid_aggregated table must already exist. Without spillDir a
+// writer falling behind blocks the import workers, with it batches wait on disk in spillDir.
+func NewAggregatingSink(sink Sink, db *sql.DB, resolutionsKm []float64, spillDir string) (*AggregatingSink, error) {
+	policy := OverflowBlock
+	if spillDir != "" {
+		policy = OverflowSpill
+	}
+
+	s := &AggregatingSink{Sink: sink, db: db}
+	for _, resolution := range resolutionsKm {
+		aggregator, err := NewStreamingAggregator(lightGridConfig(resolution), 50000, 0, policy, spillDir)
+		if err != nil {
+			s.closeAggregators(context.Background())
+			return nil, err
+		}
+		s.aggregators = append(s.aggregators, aggregator)
+
+		s.writers.Add(1)
+		go s.writeCells(resolution, aggregator.GetOutputChannel())
+	}
+	return s, nil
+}
+
+// writeCells merges every batch of one resolution into light_grid_aggregated. After an error it keeps
+// draining the channel so the aggregator never blocks on a writer that gave up.
+func (s *AggregatingSink) writeCells(resolution float64, batches <-chan []AggregatedLightData) {
+	defer s.writers.Done()
+
+	for batch := range batches {
+		if s.writeErr() != nil {
+			continue
+		}
+		cells := make([]lightGridCell, len(batch))
+		for i, cell := range batch {
+			cells[i] = lightGridCell{ResolutionKm: resolution, AggregatedLightData: cell}
+		}
+		if err := mergeLightGridCells(context.Background(), s.db, cells); err != nil {
+			s.setErr(fmt.Errorf("error merging %g km cells into light_grid_aggregated: %w", resolution, err))
+		}
+	}
+}
+
+// mergeLightGridCells adds cells to light_grid_aggregated in one transaction
+func mergeLightGridCells(ctx context.Context, db *sql.DB, cells []lightGridCell) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := upsertRows(ctx, tx, "light_grid_aggregated", lightGridColumns, cells, lightGridMerge); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *AggregatingSink) writeErr() error {
+	s.errMu.Lock()
+	defer s.errMu.Unlock()
+	return s.err
+}
+
+func (s *AggregatingSink) setErr(err error) {
+	s.errMu.Lock()
+	defer s.errMu.Unlock()
+	if s.err == nil {
+		s.err = err
+	}
+}
+
+// WriteLight writes the records to the wrapped sink, then adds the pixels with a brightness to every grid
+func (s *AggregatingSink) WriteLight(ctx context.Context, records []LightRecord) error {
+	if err := s.writeErr(); err != nil {
+		return err
+	}
+	if err := s.Sink.WriteLight(ctx, records); err != nil {
+		return err
+	}
+
+	for _, record := range records {
+		if record.Brightness == nil {
+			continue
+		}
+		point := lightDataFromRecord(record)
+		for _, aggregator := range s.aggregators {
+			if err := aggregator.AddPoint(ctx, point); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Flush hands the buffered pixels to the writers and flushes the wrapped sink
+func (s *AggregatingSink) Flush() error {
+	for _, aggregator := range s.aggregators {
+		if err := aggregator.Flush(context.Background()); err != nil {
+			return err
+		}
+	}
+	return s.Sink.Flush()
+}
+
+// Close flushes the buffered pixels, waits until the writers have merged them and closes the wrapped sink
+func (s *AggregatingSink) Close() error {
+	s.closeAggregators(context.Background())
+	s.writers.Wait()
+
+	if err := s.Sink.Close(); err != nil {
+		s.setErr(err)
+	}
+	return s.writeErr()
+}
+
+func (s *AggregatingSink) closeAggregators(ctx context.Context) {
+	for _, aggregator := range s.aggregators {
+		if err := aggregator.Close(ctx); err != nil {
+			s.setErr(err)
+		}
+	}
+}
+
+// migrateLightTileGrids rebuilds the light_grid_aggregated cells of every light tile zoom served from the
+// table, see lightTileResolutions, from light_data_with_county in a single pass. Cells at other
+// resolutions, merged by imports with --aggregate-km, are left alone.
+func migrateLightTileGrids(ctx context.Context, db *sql.DB) error {
+	slog.Info("Starting migration of light tile grids...", "table", "light_grid_aggregated")
+
+	if err := createLightDataWithCountyTable(ctx, db); err != nil {
+		return fmt.Errorf("error creating light_data_with_county table: %v", err)
+	}
+	if err := createLightGridAggregatedTable(ctx, db); err != nil {
+		return fmt.Errorf("error creating light_grid_aggregated table: %v", err)
+	}
+
+	resolutions := lightTileResolutions()
+	aggregators := make([]*DataAggregator, len(resolutions))
+	accumulators := make([]map[aggregationKey]*AggregationAccumulator, len(resolutions))
+	for i, resolution := range resolutions {
+		config := lightGridConfig(resolution)
+		config.Quality = lightQualityFilter
+		aggregator, err := NewDataAggregator(config)
+		if err != nil {
+			return err
+		}
+		aggregators[i] = aggregator
+		accumulators[i] = make(map[aggregationKey]*AggregationAccumulator)
+	}
+
+	source, err := NewDBLightSource(ctx, db, nil, nil)
+	if err != nil {
+		return err
+	}
+	batch := make([]LightData, 10000)
+	for {
+		n, err := source.Read(batch)
+		for _, point := range batch[:n] {
+			for i, aggregator := range aggregators {
+				if !aggregator.shouldIncludePoint(point) {
+					continue
+				}
+				key := aggregator.keyFor(point)
+				if accumulators[i][key] == nil {
+					accumulators[i][key] = &AggregationAccumulator{}
+				}
+				accumulators[i][key].Add(point.Brightness)
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			source.Close()
+			return err
+		}
+	}
+	// The source holds the only connection of a SQLite database until it is closed
+	if err := source.Close(); err != nil {
+		return err
+	}
+
+	var cells []lightGridCell
+	for i, aggregator := range aggregators {
+		for key, acc := range accumulators[i] {
+			cells = append(cells, lightGridCell{ResolutionKm: resolutions[i], AggregatedLightData: aggregator.resultFor(key, acc)})
+		}
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	placeholders := make([]string, len(resolutions))
+	args := make([]interface{}, len(resolutions))
+	for i, resolution := range resolutions {
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
+		args[i] = resolution
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM light_grid_aggregated WHERE resolution_km IN ("+strings.Join(placeholders, ", ")+")", args...); err != nil {
+		return fmt.Errorf("error clearing light tile grids: %v", err)
+	}
+	if err := insertRows(ctx, tx, "light_grid_aggregated", lightGridColumns, cells); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	slog.Info("Successfully migrated light tile grids", "table", "light_grid_aggregated", "rows", len(cells), "zooms", len(resolutions))
+	return nil
+}
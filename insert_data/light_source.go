@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// LightDataSource streams light points without holding the full dataset in memory
+type LightDataSource interface {
+	// Read fills batch with up to len(batch) points and returns io.EOF once exhausted
+	Read(batch []LightData) (int, error)
+	Close() error
+}
+
+// sliceLightSource serves points from an in-memory slice
+type sliceLightSource struct {
+	data []LightData
+}
+
+// NewSliceLightSource wraps an in-memory slice as a LightDataSource
+func NewSliceLightSource(data []LightData) LightDataSource {
+	return &sliceLightSource{data: data}
+}
+
+func (s *sliceLightSource) Read(batch []LightData) (int, error) {
+	if len(s.data) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(batch, s.data)
+	s.data = s.data[n:]
+	return n, nil
+}
+
+func (s *sliceLightSource) Close() error {
+	return nil
+}
+
+// dbLightSource reads light_data_with_county through a database cursor
+type dbLightSource struct {
+	rows *sql.Rows
+}
+
+// NewDBLightSource opens a cursor over light_data_with_county restricted to the optional bounds and time range.
+// Rows with NULL brightness are skipped.
+func NewDBLightSource(ctx context.Context, db *sql.DB, bounds *BoundingBox, timeRange *TimeRange) (LightDataSource, error) {
+	conditions := []string{"brightness IS NOT NULL"}
+	var args []interface{}
+
+	if bounds != nil {
+		conditions = append(conditions, fmt.Sprintf("longitude BETWEEN $%d AND $%d AND latitude BETWEEN $%d AND $%d",
+			len(args)+1, len(args)+2, len(args)+3, len(args)+4))
+		args = append(args, bounds.MinLongitude, bounds.MaxLongitude, bounds.MinLatitude, bounds.MaxLatitude)
+	}
+	if timeRange != nil {
+		conditions = append(conditions, fmt.Sprintf("time BETWEEN $%d AND $%d", len(args)+1, len(args)+2))
+		args = append(args, timeRange.Start, timeRange.End)
+	}
+
+	query := fmt.Sprintf("SELECT time, longitude, latitude, brightness, quality_flag, cloud_free_obs FROM light_data_with_county WHERE %s",
+		strings.Join(conditions, " AND "))
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying light data: %v", err)
+	}
+	return &dbLightSource{rows: rows}, nil
+}
+
+func (s *dbLightSource) Read(batch []LightData) (int, error) {
+	n := 0
+	for n < len(batch) && s.rows.Next() {
+		point := &batch[n]
+		var quality, cloudFreeObs sql.NullInt64
+		if err := s.rows.Scan(&point.Time, &point.Longitude, &point.Latitude, &point.Brightness, &quality, &cloudFreeObs); err != nil {
+			return n, fmt.Errorf("error scanning light data: %v", err)
+		}
+		point.Quality = nullIntPtr(quality)
+		point.CloudFreeObs = nullIntPtr(cloudFreeObs)
+		n++
+	}
+	if n == 0 {
+		if err := s.rows.Err(); err != nil {
+			return 0, fmt.Errorf("error reading light data: %v", err)
+		}
+		return 0, io.EOF
+	}
+	return n, nil
+}
+
+func (s *dbLightSource) Close() error {
+	return s.rows.Close()
+}
+
+// nullIntPtr converts a nullable integer column into an optional int
+func nullIntPtr(v sql.NullInt64) *int {
+	if !v.Valid {
+		return nil
+	}
+	i := int(v.Int64)
+	return &i
+}
+
+// jsonFileLightSource decodes a taiwan_light_*_full.json array one record at a time
+type jsonFileLightSource struct {
+	file       *os.File
+	decoder    *json.Decoder
+	exclusions *ExclusionCounts
+}
+
+// NewJSONFileLightSource streams a full light data file in the LightDataWithCounty format.
+// Records with invalid time or NaN brightness are skipped and counted in exclusions, which may be nil.
+func NewJSONFileLightSource(filePath string, exclusions *ExclusionCounts) (LightDataSource, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("error opening file %s: %v", filePath, err)
+	}
+
+	// The files contain bare NaN tokens, which are not valid JSON
+	decoder := json.NewDecoder(newNaNReplacingReader(file))
+	if _, err := decoder.Token(); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("error reading JSON array from %s: %v", filePath, err)
+	}
+
+	return &jsonFileLightSource{file: file, decoder: decoder, exclusions: exclusions}, nil
+}
+
+func (s *jsonFileLightSource) Read(batch []LightData) (int, error) {
+	n := 0
+	for n < len(batch) && s.decoder.More() {
+		var record LightDataWithCounty
+		if err := s.decoder.Decode(&record); err != nil {
+			return n, fmt.Errorf("error decoding light record: %v", err)
+		}
+
+		parsedTime, err := time.Parse(time.RFC3339, record.Time)
+		if err != nil {
+			s.exclusions.Add(ExcludeInvalidTime, 1)
+			continue
+		}
+		brightness, ok := record.Brightness.(float64)
+		if !ok {
+			s.exclusions.Add(ExcludeNaNBrightness, 1)
+			continue
+		}
+
+		batch[n] = LightData{
+			Time:         parsedTime,
+			Longitude:    record.Longitude,
+			Latitude:     record.Latitude,
+			Brightness:   brightness,
+			Quality:      optionalInt(record.Quality),
+			CloudFreeObs: optionalInt(record.CloudFreeObs),
+		}
+		n++
+	}
+	if n == 0 {
+		return 0, io.EOF
+	}
+	return n, nil
+}
+
+func (s *jsonFileLightSource) Close() error {
+	return s.file.Close()
+}
+
+// nanReplacingReader rewrites NaN tokens to null while streaming, like the
+// strings.ReplaceAll preprocessing in processFull2025LightData
+type nanReplacingReader struct {
+	src     *bufio.Reader
+	pending []byte
+}
+
+func newNaNReplacingReader(r io.Reader) io.Reader {
+	return &nanReplacingReader{src: bufio.NewReaderSize(r, 64*1024)}
+}
+
+func (r *nanReplacingReader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		if len(r.pending) > 0 {
+			c := copy(p[n:], r.pending)
+			r.pending = r.pending[c:]
+			n += c
+			continue
+		}
+
+		b, err := r.src.ReadByte()
+		if err != nil {
+			if n > 0 {
+				return n, nil
+			}
+			return 0, err
+		}
+
+		if b == 'N' {
+			if next, err := r.src.Peek(2); err == nil && string(next) == "aN" {
+				r.src.Discard(2)
+				r.pending = []byte("null")
+				continue
+			}
+		}
+		p[n] = b
+		n++
+	}
+	return n, nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LevelProgress sits between info and warn: progress reports and run summaries, still shown in quiet mode
+const LevelProgress = slog.LevelInfo + 2
+
+// runID identifies the current run in every log line, the run summary and the import state
+var runID = newRunID()
+
+// newRunID returns a time-ordered, practically unique run identifier
+func newRunID() string {
+	var suffix [4]byte
+	rand.Read(suffix[:])
+	return time.Now().UTC().Format("20060102T150405") + "-" + hex.EncodeToString(suffix[:])
+}
+
+// setupLogging installs the default slog logger. format is text or json, level one of debug, info,
+// progress, warn or error; quiet raises the level to progress. Plain log.Printf output is routed
+// through the same handler at info level.
+func setupLogging(format, level string, quiet bool) error {
+	var minLevel slog.Level
+	switch strings.ToLower(level) {
+	case "progress":
+		minLevel = LevelProgress
+	default:
+		if err := minLevel.UnmarshalText([]byte(level)); err != nil {
+			return fmt.Errorf("invalid log level %q", level)
+		}
+	}
+	if quiet && minLevel < LevelProgress {
+		minLevel = LevelProgress
+	}
+
+	options := &slog.HandlerOptions{
+		Level: minLevel,
+		ReplaceAttr: func(groups []string, attr slog.Attr) slog.Attr {
+			if attr.Key == slog.LevelKey && len(groups) == 0 {
+				if lvl, ok := attr.Value.Any().(slog.Level); ok && lvl == LevelProgress {
+					attr.Value = slog.StringValue("PROGRESS")
+				}
+			}
+			return attr
+		},
+	}
+
+	var handler slog.Handler
+	switch format {
+	case "text":
+		handler = slog.NewTextHandler(os.Stderr, options)
+	case "json":
+		handler = slog.NewJSONHandler(os.Stderr, options)
+	default:
+		return fmt.Errorf("invalid log format %q, expected text or json", format)
+	}
+
+	slog.SetDefault(slog.New(handler).With("run_id", runID))
+	return nil
+}
+
+// logProgress logs at LevelProgress
+func logProgress(msg string, args ...any) {
+	slog.Log(context.Background(), LevelProgress, msg, args...)
+}
+
+var (
+	fatalMu       sync.Mutex
+	fatalCleanups []func()
+)
+
+// onFatal registers a cleanup for fatal to run before exiting, since os.Exit skips deferred calls.
+// Cleanups run last registered first, like defers.
+func onFatal(cleanup func()) {
+	fatalMu.Lock()
+	fatalCleanups = append(fatalCleanups, cleanup)
+	fatalMu.Unlock()
+}
+
+// fatal logs an error, runs the cleanups registered with onFatal and exits, like log.Fatal
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+
+	fatalMu.Lock()
+	cleanups := fatalCleanups
+	fatalCleanups = nil
+	fatalMu.Unlock()
+	for i := len(cleanups) - 1; i >= 0; i-- {
+		cleanups[i]()
+	}
+	os.Exit(1)
+}
+
+type loggerKey struct{}
+
+// withLogger attaches a logger carrying per-worker and per-file fields to ctx
+func withLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// loggerFrom returns the logger attached to ctx, or the default logger
+func loggerFrom(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
@@ -1,10 +1,13 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"flag"
 	"fmt"
-	"log"
+	"log/slog"
+	"math"
 	"os"
 	"path/filepath"
 	"strconv"
@@ -16,20 +19,14 @@ import (
 	_ "github.com/lib/pq" // Postgres driver, imported for side-effects
 )
 
-type LightData struct {
-	Time       time.Time `json:"-"`
-	Longitude  float64   `json:"-"`
-	Latitude   float64   `json:"-"`
-	Brightness *float64  `json:"-"`  // Pointer to handle NaN values
-	County     *string   `json:"-"`  // Pointer to handle null values
-}
-
 type LightDataWithCounty struct {
-	Time       string      `json:"time"`
-	Longitude  float64     `json:"longitude"`
-	Latitude   float64     `json:"latitude"`
-	Brightness interface{} `json:"brightness"` // Can be float64 or NaN
-	County     interface{} `json:"county"`     // Can be string or NaN
+	Time         string      `json:"time"`
+	Longitude    float64     `json:"longitude"`
+	Latitude     float64     `json:"latitude"`
+	Brightness   interface{} `json:"brightness"` // Can be float64 or NaN
+	County       interface{} `json:"county"`     // Can be string or NaN
+	Quality      interface{} `json:"quality"`    // Optional VIIRS quality flag, can be NaN
+	CloudFreeObs interface{} `json:"cf_cvg"`     // Optional VIIRS cloud-free observation count, can be NaN
 }
 
 type BiologicalData struct {
@@ -59,19 +56,29 @@ type FileJob struct {
 
 type ProcessingStats struct {
 	FilesProcessed int64
+	RecordsRead int64
 	RecordsInserted int64
 	ErrorCount int64
+	Exclusions *ExclusionCounts
+	Flagged *ExclusionCounts // records written with NULL or unexpected fields, per reason
+
+	filesMu sync.Mutex
+	Files   []*FileStats
+	Pending []string // files not started before an interruption
 }
 
 var pgsql_url = ""
 var dbPool *sql.DB
 
-func createTable(db *sql.DB) error {
+// lightQualityFilter is applied to light pixels at ingest time, nil keeps every pixel
+var lightQualityFilter *QualityFilter
+
+func createTable(ctx context.Context, db *sql.DB) error {
 	// Use the new schema function instead
-	return createLightDataWithCountyTable(db)
+	return createLightDataWithCountyTable(ctx, db)
 }
 
-func createBiologicalTable(db *sql.DB) error {
+func createBiologicalTable(ctx context.Context, db *sql.DB) error {
 	query := `
 	CREATE TABLE IF NOT EXISTS biological_data (
 		id SERIAL PRIMARY KEY,
@@ -91,16 +98,44 @@ func createBiologicalTable(db *sql.DB) error {
 		organism_quantity TEXT,
 		taxon_id TEXT,
 		catalog_number TEXT,
-		record_number TEXT
+		record_number TEXT,
+		name_match TEXT,
+		accepted_name TEXT,
+		accepted_taxon_id TEXT,
+		accepted_common_name_c TEXT,
+		taxon_rank TEXT,
+		taxon_kingdom TEXT,
+		taxon_phylum TEXT,
+		taxon_class TEXT,
+		taxon_order TEXT,
+		taxon_family TEXT,
+		taxon_genus TEXT,
+		taxon_species TEXT
 	);
 
+	-- Tables created before the taxonomy backbone
+	ALTER TABLE biological_data ADD COLUMN IF NOT EXISTS name_match TEXT;
+	ALTER TABLE biological_data ADD COLUMN IF NOT EXISTS accepted_name TEXT;
+	ALTER TABLE biological_data ADD COLUMN IF NOT EXISTS accepted_taxon_id TEXT;
+	ALTER TABLE biological_data ADD COLUMN IF NOT EXISTS accepted_common_name_c TEXT;
+	ALTER TABLE biological_data ADD COLUMN IF NOT EXISTS taxon_rank TEXT;
+	ALTER TABLE biological_data ADD COLUMN IF NOT EXISTS taxon_kingdom TEXT;
+	ALTER TABLE biological_data ADD COLUMN IF NOT EXISTS taxon_phylum TEXT;
+	ALTER TABLE biological_data ADD COLUMN IF NOT EXISTS taxon_class TEXT;
+	ALTER TABLE biological_data ADD COLUMN IF NOT EXISTS taxon_order TEXT;
+	ALTER TABLE biological_data ADD COLUMN IF NOT EXISTS taxon_family TEXT;
+	ALTER TABLE biological_data ADD COLUMN IF NOT EXISTS taxon_genus TEXT;
+	ALTER TABLE biological_data ADD COLUMN IF NOT EXISTS taxon_species TEXT;
+
 	CREATE INDEX IF NOT EXISTS idx_biological_data_location ON biological_data (standard_longitude, standard_latitude);
 	CREATE INDEX IF NOT EXISTS idx_biological_data_scientific_name ON biological_data (scientific_name);
 	CREATE INDEX IF NOT EXISTS idx_biological_data_bio_group ON biological_data (bio_group);
 	CREATE INDEX IF NOT EXISTS idx_biological_data_event_date ON biological_data (event_date);
+	CREATE INDEX IF NOT EXISTS idx_biological_data_taxon_family ON biological_data (taxon_family);
+	CREATE INDEX IF NOT EXISTS idx_biological_data_accepted_name ON biological_data (accepted_name);
 	`
 
-	_, err := db.Exec(query)
+	_, err := db.ExecContext(ctx, store.SchemaDDL(query))
 	return err
 }
 
@@ -116,8 +151,8 @@ func parseTimeFromFilename(filename string) (time.Time, error) {
 	return time.Parse("200601", timeStr)
 }
 
-func processJSONFile(filepath string, timestamp time.Time, db *sql.DB) error {
-	log.Printf("Processing file: %s", filepath)
+func processJSONFile(ctx context.Context, filepath string, timestamp time.Time, sink Sink, stats *FileStats) error {
+	loggerFrom(ctx).Info("Processing file")
 
 	file, err := os.Open(filepath)
 	if err != nil {
@@ -126,16 +161,16 @@ func processJSONFile(filepath string, timestamp time.Time, db *sql.DB) error {
 	defer file.Close()
 
 	var data [][]float64
-	decoder := json.NewDecoder(file)
+	decoder := json.NewDecoder(ingestMetrics.countReads(file))
 	if err := decoder.Decode(&data); err != nil {
 		return fmt.Errorf("error decoding JSON from %s: %v", filepath, err)
 	}
 
-	return insertLightData(db, data, timestamp)
+	return writeLightData(ctx, sink, data, timestamp, stats)
 }
 
-func processBiologicalJSONFile(filepath string, db *sql.DB) error {
-	log.Printf("Processing biological file: %s", filepath)
+func processBiologicalJSONFile(ctx context.Context, filepath string, sink Sink, stats *FileStats) error {
+	loggerFrom(ctx).Info("Processing biological file")
 
 	file, err := os.Open(filepath)
 	if err != nil {
@@ -144,191 +179,326 @@ func processBiologicalJSONFile(filepath string, db *sql.DB) error {
 	defer file.Close()
 
 	var data []BiologicalData
-	decoder := json.NewDecoder(file)
+	decoder := json.NewDecoder(ingestMetrics.countReads(file))
 	if err := decoder.Decode(&data); err != nil {
 		return fmt.Errorf("error decoding biological JSON from %s: %v", filepath, err)
 	}
 
-	return insertBiologicalData(db, data)
+	return writeBiologicalData(ctx, sink, data, stats)
 }
 
-func insertLightData(db *sql.DB, data [][]float64, timestamp time.Time) error {
+// writeLightData parses and writes the records in batches. Cancelling ctx stops before the next batch;
+// the batch being written is completed.
+func writeLightData(ctx context.Context, sink Sink, data [][]float64, timestamp time.Time, stats *FileStats) error {
 	const batchSize = 5000
 	totalRecords := len(data)
+	logger := loggerFrom(ctx).With("table", "light_data_with_county")
 	
 	for i := 0; i < totalRecords; i += batchSize {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("interrupted after %d of %d records: %w", i, totalRecords, err)
+		}
+		
 		end := i + batchSize
 		if end > totalRecords {
 			end = totalRecords
 		}
 		
-		batch := data[i:end]
-		if err := insertBatch(db, batch, timestamp); err != nil {
+		batch := parseLightBatch(data[i:end], timestamp, stats.Exclusions)
+		if err := sink.WriteLight(context.WithoutCancel(ctx), batch); err != nil {
 			return fmt.Errorf("error inserting batch starting at %d: %v", i, err)
 		}
-		
-		if (i+batchSize)%10000 == 0 || end == totalRecords {
-			log.Printf("Inserted %d records from current file", end)
-		}
+		stats.Records += int64(end - i)
+		stats.Written += int64(len(batch))
+		logger.Debug("Wrote batch", "offset", i, "records", len(batch), "skipped", end-i-len(batch))
 	}
 
-	log.Printf("Successfully inserted %d records", totalRecords)
+	logger.Info("Inserted file", "written", stats.Written, "records", totalRecords)
 	return nil
 }
 
-func insertBatch(db *sql.DB, batch [][]float64, timestamp time.Time) error {
+// parseLightBatch converts [longitude, latitude, brightness] records, optionally followed by
+// [cloud-free observation count, quality flag] layers, counting skipped records per reason
+func parseLightBatch(batch [][]float64, timestamp time.Time, exclusions *ExclusionCounts) []LightRecord {
+	records := make([]LightRecord, 0, len(batch))
+	for _, record := range batch {
+		if len(record) != 3 && len(record) != 5 {
+			exclusions.Add(ExcludeMalformedRecord, 1)
+			continue
+		}
+		
+		// Handle NaN values for brightness
+		var brightness *float64
+		if record[2] == record[2] { // NaN check (NaN != NaN is true)
+			b := record[2]
+			brightness = &b
+		}
+		
+		// Optional quality layers
+		var cloudFreeObs, quality *int
+		if len(record) == 5 {
+			cloudFreeObs = optionalFloatInt(record[3])
+			quality = optionalFloatInt(record[4])
+		}
+		if reason := lightQualityFilter.exclusion(quality, cloudFreeObs); reason != "" {
+			exclusions.Add(reason, 1)
+			continue
+		}
+		
+		records = append(records, LightRecord{
+			Time:         timestamp,
+			Longitude:    record[0],
+			Latitude:     record[1],
+			Brightness:   brightness,
+			Quality:      quality,
+			CloudFreeObs: cloudFreeObs,
+		})
+	}
+	return records
+}
+
+// insertLightBatch inserts light records in a single multi-row INSERT
+func insertLightBatch(ctx context.Context, db *sql.DB, batch []LightRecord) error {
 	if len(batch) == 0 {
 		return nil
 	}
 
-	tx, err := db.Begin()
+	tx, err := db.BeginTx(ctx, nil)
 	if err != nil {
-		return fmt.Errorf("error starting transaction: %v", err)
+		return fmt.Errorf("error starting transaction: %w", err)
 	}
 	defer tx.Rollback()
 
 	// Build bulk insert query
 	valueStrings := make([]string, 0, len(batch))
-	valueArgs := make([]interface{}, 0, len(batch)*4)
+	valueArgs := make([]interface{}, 0, len(batch)*7)
 	
 	argIndex := 1
 	for _, record := range batch {
-		if len(record) != 3 {
-			continue
-		}
-		
-		// Handle NaN values for brightness
-		var brightness interface{}
-		if record[2] != record[2] { // NaN check (NaN != NaN is true)
-			brightness = nil
-		} else {
-			brightness = record[2]
-		}
-		
-		valueStrings = append(valueStrings, fmt.Sprintf("($%d, $%d, $%d, $%d, NULL)", argIndex, argIndex+1, argIndex+2, argIndex+3))
-		valueArgs = append(valueArgs, timestamp, record[0], record[1], brightness)
-		argIndex += 4
-	}
-	
-	if len(valueStrings) == 0 {
-		return nil
+		valueStrings = append(valueStrings, fmt.Sprintf("($%d, $%d, $%d, $%d, $%d, $%d, $%d)", argIndex, argIndex+1, argIndex+2, argIndex+3, argIndex+4, argIndex+5, argIndex+6))
+		valueArgs = append(valueArgs, record.Time, record.Longitude, record.Latitude, record.Brightness, record.County, record.Quality, record.CloudFreeObs)
+		argIndex += 7
 	}
 
-	query := fmt.Sprintf("INSERT INTO light_data_with_county (time, longitude, latitude, brightness, county) VALUES %s", strings.Join(valueStrings, ","))
+	query := fmt.Sprintf("INSERT INTO light_data_with_county (time, longitude, latitude, brightness, county, quality_flag, cloud_free_obs) VALUES %s", strings.Join(valueStrings, ","))
 	
-	_, err = tx.Exec(query, valueArgs...)
+	_, err = tx.ExecContext(ctx, query, valueArgs...)
 	if err != nil {
-		return fmt.Errorf("error executing batch insert: %v", err)
+		return fmt.Errorf("error executing batch insert: %w", err)
 	}
 
-	return tx.Commit()
+	return commitTx(tx)
 }
 
-func insertBiologicalData(db *sql.DB, data []BiologicalData) error {
+// writeBiologicalData parses and writes the records in batches. Cancelling ctx stops before the next batch;
+// the batch being written is completed.
+func writeBiologicalData(ctx context.Context, sink Sink, data []BiologicalData, stats *FileStats) error {
 	const batchSize = 1000
 	totalRecords := len(data)
+	logger := loggerFrom(ctx).With("table", "biological_data")
 	
 	for i := 0; i < totalRecords; i += batchSize {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("interrupted after %d of %d biological records: %w", i, totalRecords, err)
+		}
+		
 		end := i + batchSize
 		if end > totalRecords {
 			end = totalRecords
 		}
 		
-		batch := data[i:end]
-		if err := insertBiologicalBatch(db, batch); err != nil {
+		batch := make([]BiologicalRecord, 0, end-i)
+		for _, record := range data[i:end] {
+			parsed, reason := parseBiologicalRecord(record)
+			if reason != "" {
+				if skipInvalidBiological {
+					stats.Exclusions.Add(reason, 1)
+					continue
+				}
+				stats.Flagged.Add(reason, 1)
+			}
+			batch = append(batch, parsed)
+		}
+		if err := sink.WriteBiological(context.WithoutCancel(ctx), batch); err != nil {
 			return fmt.Errorf("error inserting biological batch starting at %d: %v", i, err)
 		}
+		stats.Records += int64(end - i)
+		stats.Written += int64(len(batch))
 		
-		if (i+batchSize)%5000 == 0 || end == totalRecords {
-			log.Printf("Inserted %d biological records from current file", end)
-		}
+		logger.Debug("Wrote batch", "offset", i, "records", len(batch), "skipped", end-i-len(batch))
 	}
 
-	log.Printf("Successfully inserted %d biological records", totalRecords)
+	logger.Info("Inserted file", "written", stats.Written, "records", totalRecords)
 	return nil
 }
 
-func insertBiologicalBatch(db *sql.DB, batch []BiologicalData) error {
+// knownBioGroups are the bio groups the dashboard charts, see BIO_GROUPS in src/lib/types/api.ts
+var knownBioGroups = map[string]bool{
+	"鳥類": true, "兩棲類": true, "哺乳類": true, "爬蟲類": true, "魚類": true, "昆蟲": true, "蜘蛛": true,
+}
+
+// skipInvalidBiological drops biological records with a problem instead of inserting them with NULL fields
+var skipInvalidBiological = false
+
+// parseBiologicalRecord parses the timestamps and coordinates of a TBIA record; unparseable values become
+// NULL. The returned reason classifies the first problem found: a missing or unparseable event date,
+// missing, unparseable or out of range coordinates, or a bio group the dashboard does not chart. With a
+// checklist loaded, names are resolved by taxonomy.
+func parseBiologicalRecord(record BiologicalData) (BiologicalRecord, ExclusionReason) {
+	var reason ExclusionReason
+	flag := func(r ExclusionReason) {
+		if reason == "" {
+			reason = r
+		}
+	}
+
+	// Parse eventDate and created timestamps
+	var eventDate, created *time.Time
+	if t, err := time.Parse(time.RFC3339, record.EventDate); err == nil {
+		eventDate = &t
+	} else {
+		flag(ExcludeBadDate)
+	}
+	if record.Created != "" {
+		if t, err := time.Parse(time.RFC3339, record.Created); err == nil {
+			created = &t
+		}
+	}
+
+	// Parse coordinates
+	var lat, lng *float64
+	if f, err := strconv.ParseFloat(strings.TrimSpace(record.StandardLatitude), 64); err == nil {
+		lat = &f
+		if f < -90 || f > 90 {
+			flag(ExcludeBadCoordinates)
+		}
+	} else {
+		flag(ExcludeBadCoordinates)
+	}
+	if f, err := strconv.ParseFloat(strings.TrimSpace(record.StandardLongitude), 64); err == nil {
+		lng = &f
+		if f < -180 || f > 180 {
+			flag(ExcludeBadCoordinates)
+		}
+	} else {
+		flag(ExcludeBadCoordinates)
+	}
+
+	if !knownBioGroups[record.BioGroup] {
+		flag(ExcludeUnknownBioGroup)
+	}
+
+	parsed := BiologicalRecord{
+		SourceScientificName: record.SourceScientificName,
+		ScientificName:       record.ScientificName,
+		CommonNameC:          record.CommonNameC,
+		BioGroup:             record.BioGroup,
+		EventDate:            eventDate,
+		Created:              created,
+		DatasetName:          record.DatasetName,
+		BasisOfRecord:        record.BasisOfRecord,
+		StandardLatitude:     lat,
+		StandardLongitude:    lng,
+		County:               record.County,
+		Municipality:         record.Municipality,
+		Locality:             record.Locality,
+		OrganismQuantity:     record.OrganismQuantity,
+		TaxonID:              record.TaxonID,
+		CatalogNumber:        record.CatalogNumber,
+		RecordNumber:         record.RecordNumber,
+	}
+	taxonomy.Resolve(&parsed)
+	return parsed, reason
+}
+
+// biologicalColumns are the biological_data columns written per record, in the order insertBiologicalBatch appends them
+var biologicalColumns = []string{
+	"source_scientific_name", "scientific_name", "common_name_c", "bio_group", "event_date", "created",
+	"dataset_name", "basis_of_record", "standard_latitude", "standard_longitude", "county", "municipality",
+	"locality", "organism_quantity", "taxon_id", "catalog_number", "record_number",
+	"name_match", "accepted_name", "accepted_taxon_id", "accepted_common_name_c",
+	"taxon_rank", "taxon_kingdom", "taxon_phylum", "taxon_class", "taxon_order",
+	"taxon_family", "taxon_genus", "taxon_species",
+}
+
+// insertBiologicalBatch inserts biological records in a single multi-row INSERT
+func insertBiologicalBatch(ctx context.Context, db *sql.DB, batch []BiologicalRecord) error {
 	if len(batch) == 0 {
 		return nil
 	}
 
-	tx, err := db.Begin()
+	tx, err := db.BeginTx(ctx, nil)
 	if err != nil {
-		return fmt.Errorf("error starting transaction: %v", err)
+		return fmt.Errorf("error starting transaction: %w", err)
 	}
 	defer tx.Rollback()
 
+	columns := len(biologicalColumns)
 	valueStrings := make([]string, 0, len(batch))
-	valueArgs := make([]interface{}, 0, len(batch)*17)
+	valueArgs := make([]interface{}, 0, len(batch)*columns)
 	
-	argIndex := 1
 	for _, record := range batch {
-		// Parse eventDate and created timestamps
-		var eventDate, created *time.Time
-		if record.EventDate != "" {
-			if t, err := time.Parse(time.RFC3339, record.EventDate); err == nil {
-				eventDate = &t
-			}
-		}
-		if record.Created != "" {
-			if t, err := time.Parse(time.RFC3339, record.Created); err == nil {
-				created = &t
-			}
-		}
-
-		// Parse coordinates
-		var lat, lng *float64
-		if record.StandardLatitude != "" && record.StandardLatitude != " " {
-			if f, err := strconv.ParseFloat(record.StandardLatitude, 64); err == nil {
-				lat = &f
-			}
-		}
-		if record.StandardLongitude != "" && record.StandardLongitude != " " {
-			if f, err := strconv.ParseFloat(record.StandardLongitude, 64); err == nil {
-				lng = &f
-			}
+		placeholders := make([]string, columns)
+		for k := range placeholders {
+			placeholders[k] = fmt.Sprintf("$%d", len(valueArgs)+k+1)
 		}
-		
-		valueStrings = append(valueStrings, fmt.Sprintf("($%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d)", 
-			argIndex, argIndex+1, argIndex+2, argIndex+3, argIndex+4, argIndex+5, argIndex+6, argIndex+7, 
-			argIndex+8, argIndex+9, argIndex+10, argIndex+11, argIndex+12, argIndex+13, argIndex+14, argIndex+15, argIndex+16))
+		valueStrings = append(valueStrings, "("+strings.Join(placeholders, ", ")+")")
 		
 		valueArgs = append(valueArgs, 
 			record.SourceScientificName, record.ScientificName, record.CommonNameC, record.BioGroup,
-			eventDate, created, record.DatasetName, record.BasisOfRecord,
-			lat, lng, record.County, record.Municipality, record.Locality,
-			record.OrganismQuantity, record.TaxonID, record.CatalogNumber, record.RecordNumber)
-		argIndex += 17
-	}
-	
-	if len(valueStrings) == 0 {
-		return nil
+			record.EventDate, record.Created, record.DatasetName, record.BasisOfRecord,
+			record.StandardLatitude, record.StandardLongitude, record.County, record.Municipality, record.Locality,
+			record.OrganismQuantity, record.TaxonID, record.CatalogNumber, record.RecordNumber,
+			nullIfEmpty(record.NameMatch), nullIfEmpty(record.AcceptedName), nullIfEmpty(record.AcceptedTaxonID),
+			nullIfEmpty(record.AcceptedCommonNameC), nullIfEmpty(record.TaxonRank), nullIfEmpty(record.TaxonKingdom),
+			nullIfEmpty(record.TaxonPhylum), nullIfEmpty(record.TaxonClass), nullIfEmpty(record.TaxonOrder),
+			nullIfEmpty(record.TaxonFamily), nullIfEmpty(record.TaxonGenus), nullIfEmpty(record.TaxonSpecies))
 	}
 
-	query := fmt.Sprintf(`INSERT INTO biological_data 
-		(source_scientific_name, scientific_name, common_name_c, bio_group, event_date, created, 
-		 dataset_name, basis_of_record, standard_latitude, standard_longitude, county, municipality, 
-		 locality, organism_quantity, taxon_id, catalog_number, record_number) 
-		VALUES %s`, strings.Join(valueStrings, ","))
+	query := fmt.Sprintf("INSERT INTO biological_data (%s) VALUES %s",
+		strings.Join(biologicalColumns, ", "), strings.Join(valueStrings, ","))
 	
-	_, err = tx.Exec(query, valueArgs...)
+	_, err = tx.ExecContext(ctx, query, valueArgs...)
 	if err != nil {
-		return fmt.Errorf("error executing biological batch insert: %v", err)
+		return fmt.Errorf("error executing biological batch insert: %w", err)
 	}
 
-	return tx.Commit()
+	return commitTx(tx)
+}
+
+// nullIfEmpty stores an empty taxonomy field as NULL, so records without a checklist match stay distinguishable
+func nullIfEmpty(value string) interface{} {
+	if value == "" {
+		return nil
+	}
+	return value
 }
 
-func worker(id int, jobs <-chan FileJob, results chan<- error, stats *ProcessingStats, wg *sync.WaitGroup) {
+func worker(ctx context.Context, id int, jobs <-chan FileJob, results chan<- error, sink Sink, stats *ProcessingStats, wg *sync.WaitGroup) {
 	defer wg.Done()
 
 	for job := range jobs {
-		log.Printf("Worker %d: Processing %s", id, job.FilePath)
+		// Drain the remaining jobs without starting them once the import is interrupted
+		if ctx.Err() != nil {
+			stats.addPending(job.FilePath)
+			results <- nil
+			continue
+		}
 		
-		err := processJSONFile(job.FilePath, job.Timestamp, dbPool)
-		if err != nil {
-			log.Printf("Worker %d: Error processing %s: %v", id, job.FilePath, err)
+		logger := slog.With("worker", id, "file", job.FilePath)
+		logger.Debug("Worker picked up file")
+		
+		fileStats := NewFileStats(job.FilePath)
+		started := time.Now()
+		err := processJSONFile(withLogger(ctx, logger), job.FilePath, job.Timestamp, sink, fileStats)
+		ingestMetrics.observeWorker(id, time.Since(started))
+		fileStats.Err = err
+		stats.addFile(fileStats)
+		if isInterrupted(err) {
+			logger.Warn("Stopped file", "error", err)
+			results <- nil
+		} else if err != nil {
+			logger.Error("Error processing file", "error", err)
 			atomic.AddInt64(&stats.ErrorCount, 1)
 			results <- err
 		} else {
@@ -338,15 +508,31 @@ func worker(id int, jobs <-chan FileJob, results chan<- error, stats *Processing
 	}
 }
 
-func biologicalWorker(id int, jobs <-chan string, results chan<- error, stats *ProcessingStats, wg *sync.WaitGroup) {
+func biologicalWorker(ctx context.Context, id int, jobs <-chan string, results chan<- error, sink Sink, stats *ProcessingStats, wg *sync.WaitGroup) {
 	defer wg.Done()
 
 	for jobPath := range jobs {
-		log.Printf("Biological Worker %d: Processing %s", id, jobPath)
+		// Drain the remaining jobs without starting them once the import is interrupted
+		if ctx.Err() != nil {
+			stats.addPending(jobPath)
+			results <- nil
+			continue
+		}
 		
-		err := processBiologicalJSONFile(jobPath, dbPool)
-		if err != nil {
-			log.Printf("Biological Worker %d: Error processing %s: %v", id, jobPath, err)
+		logger := slog.With("worker", id, "file", jobPath)
+		logger.Debug("Worker picked up file")
+		
+		fileStats := NewFileStats(jobPath)
+		started := time.Now()
+		err := processBiologicalJSONFile(withLogger(ctx, logger), jobPath, sink, fileStats)
+		ingestMetrics.observeWorker(id, time.Since(started))
+		fileStats.Err = err
+		stats.addFile(fileStats)
+		if isInterrupted(err) {
+			logger.Warn("Stopped file", "error", err)
+			results <- nil
+		} else if err != nil {
+			logger.Error("Error processing file", "error", err)
 			atomic.AddInt64(&stats.ErrorCount, 1)
 			results <- err
 		} else {
@@ -356,13 +542,16 @@ func biologicalWorker(id int, jobs <-chan string, results chan<- error, stats *P
 	}
 }
 
-func collectJobs(dataDir string) ([]FileJob, error) {
+func collectJobs(ctx context.Context, dataDir string) ([]FileJob, error) {
 	var jobs []FileJob
 	
 	err := filepath.Walk(dataDir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 
 		if !strings.HasSuffix(info.Name(), ".json") {
 			return nil
@@ -370,7 +559,7 @@ func collectJobs(dataDir string) ([]FileJob, error) {
 
 		timestamp, err := parseTimeFromFilename(info.Name())
 		if err != nil {
-			log.Printf("Skipping file with invalid timestamp: %s (%v)", info.Name(), err)
+			slog.Warn("Skipping file with invalid timestamp", "file", path, "error", err)
 			return nil
 		}
 
@@ -384,13 +573,16 @@ func collectJobs(dataDir string) ([]FileJob, error) {
 	return jobs, err
 }
 
-func collectBiologicalJobs(dataDir string) ([]string, error) {
+func collectBiologicalJobs(ctx context.Context, dataDir string) ([]string, error) {
 	var jobs []string
 	
 	err := filepath.Walk(dataDir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 
 		if !strings.HasSuffix(info.Name(), ".json") {
 			return nil
@@ -403,32 +595,33 @@ func collectBiologicalJobs(dataDir string) ([]string, error) {
 	return jobs, err
 }
 
-func processBiologicalFilesConcurrently(dataDir string, numWorkers int) error {
+func processBiologicalFilesConcurrently(ctx context.Context, dataDir string, numWorkers int, sink Sink) (*ProcessingStats, error) {
 	// Collect all jobs first
-	jobs, err := collectBiologicalJobs(dataDir)
+	jobs, err := collectBiologicalJobs(ctx, dataDir)
 	if err != nil {
-		return fmt.Errorf("error collecting biological jobs: %v", err)
+		return nil, fmt.Errorf("error collecting biological jobs: %w", err)
 	}
 	
 	if len(jobs) == 0 {
-		log.Println("No biological JSON files found to process")
-		return nil
+		slog.Warn("No biological JSON files found to process", "dir", dataDir)
+		return &ProcessingStats{Exclusions: NewExclusionCounts(), Flagged: NewExclusionCounts()}, nil
 	}
 	
-	log.Printf("Found %d biological files to process with %d workers", len(jobs), numWorkers)
+	slog.Info("Found biological files to process", "files", len(jobs), "workers", numWorkers)
 	
 	// Create channels
 	jobChan := make(chan string, len(jobs))
 	resultChan := make(chan error, len(jobs))
 	
 	// Initialize stats
-	stats := &ProcessingStats{}
+	stats := &ProcessingStats{Exclusions: NewExclusionCounts(), Flagged: NewExclusionCounts()}
+	ingestMetrics.Track(stats, numWorkers)
 	
 	// Start workers
 	var wg sync.WaitGroup
 	for i := 0; i < numWorkers; i++ {
 		wg.Add(1)
-		go biologicalWorker(i, jobChan, resultChan, stats, &wg)
+		go biologicalWorker(ctx, i, jobChan, resultChan, sink, stats, &wg)
 	}
 	
 	// Send jobs
@@ -439,17 +632,20 @@ func processBiologicalFilesConcurrently(dataDir string, numWorkers int) error {
 		close(jobChan)
 	}()
 	
-	// Start progress reporter
+	// Start progress reporter, stopped once the workers are done
+	done := make(chan struct{})
 	go func() {
 		ticker := time.NewTicker(5 * time.Second)
 		defer ticker.Stop()
 		
 		for {
 			select {
+			case <-done:
+				return
 			case <-ticker.C:
 				processed := atomic.LoadInt64(&stats.FilesProcessed)
 				errors := atomic.LoadInt64(&stats.ErrorCount)
-				log.Printf("Progress: %d/%d biological files processed, %d errors", processed, len(jobs), errors)
+				logProgress("Progress", "table", "biological_data", "processed", processed, "files", len(jobs), "errors", errors)
 				if processed+errors >= int64(len(jobs)) {
 					return
 				}
@@ -459,6 +655,7 @@ func processBiologicalFilesConcurrently(dataDir string, numWorkers int) error {
 	
 	// Wait for workers to complete
 	wg.Wait()
+	close(done)
 	
 	// Collect results
 	close(resultChan)
@@ -472,47 +669,48 @@ func processBiologicalFilesConcurrently(dataDir string, numWorkers int) error {
 	processed := atomic.LoadInt64(&stats.FilesProcessed)
 	errorCount := atomic.LoadInt64(&stats.ErrorCount)
 	
-	log.Printf("Biological processing completed: %d files processed successfully, %d errors", processed, errorCount)
+	logProgress("Biological processing completed", "processed", processed, "errors", errorCount)
+	stats.Exclusions.LogSummary("Excluded biological records")
 	
 	if len(errors) > 0 {
-		log.Printf("First few errors:")
 		for i, err := range errors {
 			if i >= 5 { // Show only first 5 errors
 				break
 			}
-			log.Printf("  %d: %v", i+1, err)
+			slog.Error("File failed", "n", i+1, "error", err)
 		}
 	}
 	
-	return nil
+	return stats, nil
 }
 
-func processAllFilesConcurrently(dataDir string, numWorkers int) error {
+func processAllFilesConcurrently(ctx context.Context, dataDir string, numWorkers int, sink Sink) (*ProcessingStats, error) {
 	// Collect all jobs first
-	jobs, err := collectJobs(dataDir)
+	jobs, err := collectJobs(ctx, dataDir)
 	if err != nil {
-		return fmt.Errorf("error collecting jobs: %v", err)
+		return nil, fmt.Errorf("error collecting jobs: %w", err)
 	}
 	
 	if len(jobs) == 0 {
-		log.Println("No JSON files found to process")
-		return nil
+		slog.Warn("No JSON files found to process", "dir", dataDir)
+		return &ProcessingStats{Exclusions: NewExclusionCounts()}, nil
 	}
 	
-	log.Printf("Found %d files to process with %d workers", len(jobs), numWorkers)
+	slog.Info("Found files to process", "files", len(jobs), "workers", numWorkers)
 	
 	// Create channels
 	jobChan := make(chan FileJob, len(jobs))
 	resultChan := make(chan error, len(jobs))
 	
 	// Initialize stats
-	stats := &ProcessingStats{}
+	stats := &ProcessingStats{Exclusions: NewExclusionCounts()}
+	ingestMetrics.Track(stats, numWorkers)
 	
 	// Start workers
 	var wg sync.WaitGroup
 	for i := 0; i < numWorkers; i++ {
 		wg.Add(1)
-		go worker(i, jobChan, resultChan, stats, &wg)
+		go worker(ctx, i, jobChan, resultChan, sink, stats, &wg)
 	}
 	
 	// Send jobs
@@ -523,17 +721,20 @@ func processAllFilesConcurrently(dataDir string, numWorkers int) error {
 		close(jobChan)
 	}()
 	
-	// Start progress reporter
+	// Start progress reporter, stopped once the workers are done
+	done := make(chan struct{})
 	go func() {
 		ticker := time.NewTicker(5 * time.Second)
 		defer ticker.Stop()
 		
 		for {
 			select {
+			case <-done:
+				return
 			case <-ticker.C:
 				processed := atomic.LoadInt64(&stats.FilesProcessed)
 				errors := atomic.LoadInt64(&stats.ErrorCount)
-				log.Printf("Progress: %d/%d files processed, %d errors", processed, len(jobs), errors)
+				logProgress("Progress", "table", "light_data_with_county", "processed", processed, "files", len(jobs), "errors", errors)
 				if processed+errors >= int64(len(jobs)) {
 					return
 				}
@@ -543,6 +744,7 @@ func processAllFilesConcurrently(dataDir string, numWorkers int) error {
 	
 	// Wait for workers to complete
 	wg.Wait()
+	close(done)
 	
 	// Collect results
 	close(resultChan)
@@ -556,146 +758,644 @@ func processAllFilesConcurrently(dataDir string, numWorkers int) error {
 	processed := atomic.LoadInt64(&stats.FilesProcessed)
 	errorCount := atomic.LoadInt64(&stats.ErrorCount)
 	
-	log.Printf("Processing completed: %d files processed successfully, %d errors", processed, errorCount)
+	logProgress("Processing completed", "processed", processed, "errors", errorCount)
+	stats.Exclusions.LogSummary("Excluded light pixels")
 	
 	if len(errors) > 0 {
-		log.Printf("First few errors:")
 		for i, err := range errors {
 			if i >= 5 { // Show only first 5 errors
 				break
 			}
-			log.Printf("  %d: %v", i+1, err)
+			slog.Error("File failed", "n", i+1, "error", err)
 		}
 	}
 	
-	return nil
+	return stats, nil
+}
+
+// modeSpec describes what a command line mode may do
+type modeSpec struct {
+	description string
+	imports     bool // parses source files through a Sink, so --dry-run and --metrics-addr apply
+	needsDB     bool // opens the database even without writing imported records
+}
+
+// modes maps each command line mode to its capabilities; light is the default without a mode argument
+var modes = map[string]modeSpec{
+	"light":               {description: "Processing light pollution data (default)", imports: true},
+	"final_dataset":       {description: "Processing biological data from TBIA_final_dataset", imports: true},
+	"2025_full":           {description: "Processing 2025 full light data from taiwan_light_2025_full.json", imports: true},
+	"migrate":             {description: "Migrating existing data to aggregated tables", needsDB: true},
+	"serve":               {description: "Serving dashboard chart API", needsDB: true},
+	"export":              {description: "Exporting data to file", needsDB: true},
+	"join-exposure":       {description: "Attributing light exposure to occurrences", needsDB: true},
+	"analyze-correlation": {description: "Correlating brightness with occurrences per county and animal type", needsDB: true},
+	"analyze-trend":       {description: "Detecting brightness trends per county and grid cell", needsDB: true},
+	"analyze-hotspots":    {description: "Detecting brightness and occurrence density hotspots per grid cell", needsDB: true},
+	"analyze-kde":         {description: "Estimating occurrence kernel density", needsDB: true},
+	"analyze-anomalies":   {description: "Detecting monthly brightness anomalies per county and grid cell", needsDB: true},
+	"import-traits":       {description: "Importing taxon activity traits", needsDB: true},
+	"aggregate-windows":   {description: "Aggregating replayed light pixels into event-time windows", needsDB: true},
 }
 
 func main() {
-	// Parse command line arguments
-	processBiological := false
-	runMigrationMode := false
-	process2025Full := false
-	
-	if len(os.Args) > 1 {
-		switch os.Args[1] {
-		case "final_dataset":
-			processBiological = true
-			log.Println("Mode: Processing biological data from TBIA_final_dataset")
-		case "migrate":
-			runMigrationMode = true
-			log.Println("Mode: Migrating existing data to aggregated tables")
-		case "2025_full":
-			process2025Full = true
-			log.Println("Mode: Processing 2025 full light data from taiwan_light_2025_full.json")
-		default:
-			log.Println("Unknown argument:", os.Args[1])
-			log.Println("Usage: go run main.go [final_dataset|migrate|2025_full]")
-			log.Println("  - No arguments: Process light pollution data")
-			log.Println("  - final_dataset: Process TBIA biological data")
-			log.Println("  - migrate: Migrate existing biological data to aggregated tables")
-			log.Println("  - 2025_full: Process taiwan_light_2025_full.json file")
-			return
-		}
-	} else {
-		log.Println("Mode: Processing light pollution data (default)")
-		log.Println("Usage: go run main.go [final_dataset|migrate|2025_full]")
-		log.Println("  - No arguments: Process light pollution data")
-		log.Println("  - final_dataset: Process TBIA biological data")
-		log.Println("  - migrate: Migrate existing biological data to aggregated tables")
-		log.Println("  - 2025_full: Process taiwan_light_2025_full.json file")
+	// The first argument selects the mode, any remaining arguments are flags
+	mode := ""
+	flagArgs := os.Args[1:]
+	if len(flagArgs) > 0 && !strings.HasPrefix(flagArgs[0], "-") {
+		mode = flagArgs[0]
+		flagArgs = flagArgs[1:]
+	}
+
+	flags := flag.NewFlagSet("insertdata", flag.ExitOnError)
+	minCloudFree := flags.Int("min-cloud-free", 0, "exclude light pixels with fewer cloud-free observations")
+	qualityFlags := flags.String("quality-flags", "", "comma-separated VIIRS quality flags to keep, e.g. 0,1")
+	requireQuality := flags.Bool("require-quality", false, "exclude light pixels without quality layers")
+	addr := flags.String("addr", ":8080", "listen address for serve mode")
+	dsn := flags.String("db", pgsql_url, "database DSN: postgres://... or sqlite://path/to/file.db for an embedded database")
+	exportTable := flags.String("table", "biological", "table to export: biological or light")
+	exportFormat := flags.String("format", "", "export format: geojson, ndgeojson, csv or geoparquet (default from --out extension)")
+	exportOut := flags.String("out", "", "export output file, analyze-kde GeoTIFF or analyze-anomalies CSV report")
+	exportBBox := flags.String("bbox", "", "export bounding box minLon,minLat,maxLon,maxLat")
+	exportStart := flags.String("start", "", "export start time, RFC3339 or YYYY-MM-DD")
+	exportEnd := flags.String("end", "", "export end time, RFC3339 or YYYY-MM-DD")
+	exportCounty := flags.String("county", "", "export only this county")
+	exportBioGroup := flags.String("bio-group", "", "export only this bio_group (biological table)")
+	ndjsonDir := flags.String("ndjson-dir", "", "write parsed records as NDJSON files to this directory instead of the database")
+	dryRun := flags.Bool("dry-run", false, "parse and validate the import files and report per-file and per-reason statistics without touching the database")
+	skipInvalid := flags.Bool("skip-invalid", false, "final_dataset: skip records with a bad event date, bad coordinates or an unknown bio group instead of inserting them with NULL fields")
+	retryAttempts := flags.Int("retry-attempts", DefaultRetryPolicy.MaxAttempts, "attempts per batch before a transient database error fails the file")
+	metricsAddr := flags.String("metrics-addr", "", "serve Prometheus metrics of import runs on this address, e.g. :9100")
+	summaryFile := flags.String("summary-file", "", "write a JSON summary of the import run to this file")
+	stateFile := flags.String("state-file", "import_state.json", "where an interrupted import records its completed, partial and pending files")
+	logFormat := flags.String("log-format", "text", "log format: text or json")
+	logLevel := flags.String("log-level", "info", "minimum log level: debug, info, progress, warn or error")
+	radiusKm := flags.Float64("radius-km", 1, "join-exposure: radius of the mean brightness around each occurrence")
+	maxDistanceKm := flags.Float64("max-distance-km", 5, "join-exposure: farthest nearest pixel attributed to an occurrence")
+	minMonths := flags.Int("min-months", 6, "analyze-correlation: fewest paired months for a county and animal type")
+	gridKm := flags.Float64("grid-km", 5, "analyze-trend, analyze-hotspots, analyze-kde, analyze-anomalies, aggregate-windows: grid cell size in km; trends and anomalies skip cells when 0")
+	minYears := flags.Int("min-years", 3, "analyze-trend: fewest distinct years of a series; analyze-anomalies: fewest other years in a monthly baseline")
+	alpha := flags.Float64("alpha", 0.05, "analyze-trend: significance level for flagging increasing and decreasing brightness")
+	neighbourKm := flags.Float64("neighbour-km", 10, "analyze-hotspots: cells within this distance are neighbours in Gi*")
+	hotspotPeriod := flags.String("period", "month", "analyze-hotspots: period of each hotspot map; aggregate-windows: bucket of --window-size and --window-slide: day, week, month, season or year")
+	kernel := flags.String("kernel", "gaussian", "analyze-kde: kernel: gaussian, epanechnikov or quartic")
+	bandwidthKm := flags.Float64("bandwidth-km", 0, "analyze-kde: kernel bandwidth in km, 0 for Silverman's rule of thumb")
+	zThreshold := flags.Float64("z-threshold", 3.5, "analyze-anomalies: robust z-score beyond which a month is flagged")
+	checklistFile := flags.String("checklist", "", "final_dataset: taxonomic checklist CSV, e.g. a TaiCOL export, resolving records to accepted names at ingest")
+	unmatchedReport := flags.String("unmatched-report", "", "final_dataset: write the names not found in --checklist to this CSV file")
+	traitsFile := flags.String("traits", "", "import-traits: CSV with scientific_name, activity_period (nocturnal, diurnal or crepuscular) and optional source columns")
+	rasterName := flags.String("raster", "occurrences", "analyze-kde: raster name in occurrence_kde_raster, replaced on each run")
+	aggregateKm := flags.String("aggregate-km", "", "light, 2025_full: also merge the imported pixels per grid cell and month into light_grid_aggregated at these comma-separated grid sizes in km, e.g. 1,5")
+	spillDir := flags.String("spill-dir", "", "with --aggregate-km: spill aggregated batches to this directory instead of blocking the import while the database catches up")
+	lightNDJSON := flags.String("light-ndjson", "", "aggregate-windows: light.ndjson written by an import with --ndjson-dir, replayed in file order")
+	windowSize := flags.Int64("window-size", 1, "aggregate-windows: window length in --period buckets")
+	windowSlide := flags.Int64("window-slide", 0, "aggregate-windows: distance between sliding window starts in --period buckets, 0 for tumbling windows")
+	watermarkDelay := flags.Duration("watermark-delay", 0, "aggregate-windows: how far the watermark trails the newest pixel time, e.g. 72h")
+	allowedLateness := flags.Duration("allowed-lateness", 0, "aggregate-windows: how long after the watermark passes a window late pixels still correct it")
+	quiet := flags.Bool("quiet", false, "only log progress, summaries, warnings and errors")
+	flags.Parse(flagArgs)
+
+	if err := setupLogging(*logFormat, *logLevel, *quiet); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
 	}
 
+	// SIGINT/SIGTERM cancel ctx; imports finish their current batch and record their progress
+	ctx, stop := withShutdownSignals(context.Background())
+	defer stop()
+
 	var err error
-	dbPool, err = sql.Open("postgres", pgsql_url)
+	lightQualityFilter, err = newQualityFilter(*minCloudFree, *qualityFlags, *requireQuality)
 	if err != nil {
-		log.Fatal(err)
-	} else {
-		log.Println("Connected to PostgreSQL")
+		fatal("Invalid quality filter", "error", err)
 	}
-	defer dbPool.Close()
 
-	// Configure connection pool for better performance
-	dbPool.SetMaxOpenConns(25)
-	dbPool.SetMaxIdleConns(10)
-	dbPool.SetConnMaxLifetime(5 * time.Minute)
+	defaultMode := mode == ""
+	if defaultMode {
+		mode = "light"
+	}
+	spec, ok := modes[mode]
+	if !ok {
+		slog.Error("Unknown mode", "mode", mode)
+		printUsage(flags)
+		return
+	}
+	slog.Info("Mode: "+spec.description, "mode", mode)
+	if defaultMode {
+		printUsage(flags)
+	}
+
+	if *dryRun && !spec.imports {
+		fatal("--dry-run only applies to the light, 2025_full and final_dataset import modes")
+	}
+	skipInvalidBiological = *skipInvalid
+	if *dryRun && *ndjsonDir != "" {
+		fatal("--dry-run and --ndjson-dir cannot be combined")
+	}
+	if *retryAttempts < 1 {
+		fatal("--retry-attempts must be at least 1")
+	}
+
+	// Imports only open the database when they write to it; a dry run never touches it
+	if spec.needsDB || (!*dryRun && *ndjsonDir == "") {
+		dbPool, store, err = openStorage(ctx, *dsn)
+		if err != nil {
+			fatal("Error opening database", "error", err)
+		} else {
+			slog.Info("Connected to database", "backend", store.Name())
+		}
+		defer dbPool.Close()
+	}
 
 	var dataDir string
 	numWorkers := 16
 
-	if runMigrationMode {
+	// Parsed records go to the database unless a dry run or a file sink is requested
+	var sink Sink
+	var dbSink *DBSink
+	writeToDB := false
+	switch {
+	case *dryRun:
+		sink = NewCountingSink()
+		slog.Info("Dry run: records are parsed and validated but not written")
+	case *ndjsonDir != "":
+		fileSink, err := NewFileSink(*ndjsonDir)
+		if err != nil {
+			fatal("Error creating file sink", "error", err)
+		}
+		sink = fileSink
+		slog.Info("Writing parsed records to files", "dir", *ndjsonDir)
+	default:
+		dbSink = NewDBSink(dbPool)
+		dbSink.Retry.MaxAttempts = *retryAttempts
+		sink = dbSink
+		writeToDB = true
+	}
+	if dbSink != nil {
+		ingestMetrics.SetDatabase(dbPool, dbSink.RetryStats())
+	}
+	if *aggregateKm != "" {
+		if !writeToDB || (mode != "light" && mode != "2025_full") {
+			fatal("--aggregate-km only applies to the light and 2025_full imports into the database")
+		}
+		resolutions, err := parseResolutions(*aggregateKm)
+		if err != nil {
+			fatal("Invalid --aggregate-km", "error", err)
+		}
+		if err := createLightGridAggregatedTable(ctx, dbPool); err != nil {
+			fatal("Error creating light grid table", "error", err)
+		}
+		aggregatingSink, err := NewAggregatingSink(sink, dbPool, resolutions, *spillDir)
+		if err != nil {
+			fatal("Error starting grid aggregation", "error", err)
+		}
+		sink = aggregatingSink
+		slog.Info("Merging imported pixels into grid cells", "table", "light_grid_aggregated", "resolutions_km", resolutions)
+	}
+	sink = NewMetricsSink(sink, ingestMetrics)
+	// Close flushes a file sink's buffered records, so it also has to run when fatal exits
+	closeSink := sync.OnceFunc(func() {
+		if err := sink.Close(); err != nil {
+			slog.Error("Error closing sink", "error", err)
+		}
+	})
+	defer closeSink()
+	onFatal(closeSink)
+
+	if *metricsAddr != "" && spec.imports {
+		serveMetrics(ctx, *metricsAddr, ingestMetrics)
+	}
+
+	switch mode {
+	case "export":
+		filter := ExportFilter{Table: *exportTable, County: *exportCounty, BioGroup: *exportBioGroup}
+		if *exportBBox != "" {
+			if filter.Bounds, err = parseBoundingBox(*exportBBox); err != nil {
+				fatal("Invalid --bbox", "error", err)
+			}
+		}
+		if filter.TimeRange, err = parseExportTimeRange(*exportStart, *exportEnd); err != nil {
+			fatal("Invalid time range", "error", err)
+		}
+		if *exportOut == "" {
+			fatal("Export requires --out")
+		}
+		format := ExportFormat(*exportFormat)
+		if format == "" {
+			if format, err = exportFormatFromPath(*exportOut); err != nil {
+				fatal("Unknown export format", "error", err)
+			}
+		}
+
+		startTime := time.Now()
+		count, err := runExport(ctx, dbPool, filter, format, *exportOut)
+		if err != nil {
+			if ctx.Err() != nil {
+				slog.Warn("Export interrupted, output is incomplete", "rows", count, "out", *exportOut)
+				return
+			}
+			fatal("Export failed", "rows", count, "error", err)
+		}
+		logProgress("Export completed", "rows", count, "out", *exportOut, "duration", time.Since(startTime))
+		return
+	case "serve":
+		if err := runServer(ctx, dbPool, *addr); err != nil {
+			fatal("API server failed", "error", err)
+		}
+		return
+	case "join-exposure":
+		config := ExposureConfig{RadiusKm: *radiusKm, MaxDistanceKm: math.Max(*maxDistanceKm, *radiusKm)}
+		if config.RadiusKm <= 0 {
+			fatal("--radius-km must be positive")
+		}
+		if err := createOccurrenceLightExposureTable(ctx, dbPool); err != nil {
+			fatal("Error creating light exposure table", "error", err)
+		}
+
+		startTime := time.Now()
+		count, err := runJoinExposure(ctx, dbPool, config)
+		if err != nil {
+			if ctx.Err() != nil {
+				slog.Warn("Light exposure join interrupted, rerun to complete it", "written", count)
+				return
+			}
+			fatal("Light exposure join failed", "written", count, "error", err)
+		}
+		logProgress("Light exposure join completed", "written", count, "duration", time.Since(startTime))
+		return
+	case "analyze-correlation":
+		if *minMonths < 4 {
+			fatal("--min-months must be at least 4 for the confidence intervals")
+		}
+		if err := createLightCorrelationTable(ctx, dbPool); err != nil {
+			fatal("Error creating correlation table", "error", err)
+		}
+
+		startTime := time.Now()
+		count, err := runCorrelationAnalysis(ctx, dbPool, *minMonths)
+		if err != nil {
+			fatal("Correlation analysis failed", "error", err)
+		}
+		logProgress("Correlation analysis completed", "rows", count, "duration", time.Since(startTime))
+		return
+	case "analyze-trend":
+		config := TrendConfig{GridKm: *gridKm, MinYears: *minYears, Alpha: *alpha}
+		if config.GridKm < 0 || config.MinYears < 2 || config.Alpha <= 0 || config.Alpha >= 1 {
+			fatal("analyze-trend needs --grid-km >= 0, --min-years >= 2 and 0 < --alpha < 1")
+		}
+		if err := createLightTrendTable(ctx, dbPool); err != nil {
+			fatal("Error creating trend table", "error", err)
+		}
+
+		startTime := time.Now()
+		count, err := runTrendAnalysis(ctx, dbPool, config)
+		if err != nil {
+			if ctx.Err() != nil {
+				slog.Warn("Trend analysis interrupted, light_brightness_trend is unchanged")
+				return
+			}
+			fatal("Trend analysis failed", "error", err)
+		}
+		logProgress("Trend analysis completed", "rows", count, "duration", time.Since(startTime))
+		return
+	case "analyze-hotspots":
+		config := HotspotConfig{GridKm: *gridKm, NeighbourKm: *neighbourKm, Period: CalendarUnit(*hotspotPeriod)}
+		if !config.Period.valid() {
+			fatal("Invalid --period", "period", *hotspotPeriod)
+		}
+		if config.GridKm <= 0 || config.NeighbourKm < config.GridKm {
+			fatal("analyze-hotspots needs --grid-km > 0 and --neighbour-km of at least --grid-km")
+		}
+		if err := createGridHotspotsTable(ctx, dbPool); err != nil {
+			fatal("Error creating hotspot table", "error", err)
+		}
+
+		startTime := time.Now()
+		count, err := runHotspotAnalysis(ctx, dbPool, config)
+		if err != nil {
+			if ctx.Err() != nil {
+				slog.Warn("Hotspot analysis interrupted, grid_hotspots is unchanged")
+				return
+			}
+			fatal("Hotspot analysis failed", "error", err)
+		}
+		logProgress("Hotspot analysis completed", "rows", count, "duration", time.Since(startTime))
+		return
+	case "analyze-kde":
+		config := KDEConfig{
+			Filter:      ExportFilter{County: *exportCounty, BioGroup: *exportBioGroup},
+			Kernel:      Kernel(*kernel),
+			BandwidthKm: *bandwidthKm,
+			CellKm:      *gridKm,
+			Raster:      *rasterName,
+			OutPath:     *exportOut,
+		}
+		if !config.Kernel.valid() {
+			fatal("Invalid --kernel", "kernel", *kernel)
+		}
+		if config.CellKm <= 0 || config.BandwidthKm < 0 {
+			fatal("analyze-kde needs --grid-km > 0 and --bandwidth-km >= 0")
+		}
+		if *exportBBox != "" {
+			if config.Filter.Bounds, err = parseBoundingBox(*exportBBox); err != nil {
+				fatal("Invalid --bbox", "error", err)
+			}
+		}
+		if config.Filter.TimeRange, err = parseExportTimeRange(*exportStart, *exportEnd); err != nil {
+			fatal("Invalid time range", "error", err)
+		}
+		if config.OutPath == "" {
+			if err := createOccurrenceKDETable(ctx, dbPool); err != nil {
+				fatal("Error creating KDE raster table", "error", err)
+			}
+		}
+
+		startTime := time.Now()
+		count, err := runKDE(ctx, dbPool, config)
+		if err != nil {
+			fatal("Kernel density estimation failed", "error", err)
+		}
+		if config.OutPath != "" {
+			logProgress("Kernel density written", "out", config.OutPath, "cells", count, "duration", time.Since(startTime))
+		} else {
+			logProgress("Kernel density written", "table", "occurrence_kde_raster", "raster", config.Raster, "cells", count, "duration", time.Since(startTime))
+		}
+		return
+	case "analyze-anomalies":
+		config := AnomalyConfig{GridKm: *gridKm, MinYears: *minYears, ZThreshold: *zThreshold, ReportPath: *exportOut}
+		if config.GridKm < 0 || config.MinYears < 2 || config.ZThreshold <= 0 {
+			fatal("analyze-anomalies needs --grid-km >= 0, --min-years >= 2 and --z-threshold > 0")
+		}
+		if err := createLightAnomalyTable(ctx, dbPool); err != nil {
+			fatal("Error creating anomaly table", "error", err)
+		}
+
+		startTime := time.Now()
+		count, err := runAnomalyDetection(ctx, dbPool, config)
+		if err != nil {
+			if ctx.Err() != nil {
+				slog.Warn("Anomaly detection interrupted, light_brightness_anomaly is unchanged")
+				return
+			}
+			fatal("Anomaly detection failed", "error", err)
+		}
+		logProgress("Anomaly detection completed", "rows", count, "duration", time.Since(startTime))
+		return
+	case "import-traits":
+		if *traitsFile == "" {
+			fatal("import-traits requires --traits")
+		}
+		if err := createTaxonTraitTables(ctx, dbPool); err != nil {
+			fatal("Error creating taxon trait tables", "error", err)
+		}
+
+		count, err := importTaxonTraits(ctx, dbPool, *traitsFile)
+		if err != nil {
+			if ctx.Err() != nil {
+				slog.Warn("Trait import interrupted, taxon_traits is unchanged")
+				return
+			}
+			fatal("Trait import failed", "error", err)
+		}
+		logProgress("Taxon traits imported, run migrate to apply them", "table", "taxon_traits", "rows", count, "file", *traitsFile)
+		return
+	case "aggregate-windows":
+		config := WindowReplayConfig{
+			InputPath: *lightNDJSON,
+			GridKm:    *gridKm,
+			Period:    CalendarUnit(*hotspotPeriod),
+			Window: WindowConfig{
+				Type:            TumblingWindow,
+				SizeBuckets:     *windowSize,
+				SlideBuckets:    *windowSlide,
+				WatermarkDelay:  *watermarkDelay,
+				AllowedLateness: *allowedLateness,
+			},
+		}
+		if config.InputPath == "" {
+			fatal("aggregate-windows requires --light-ndjson")
+		}
+		if !config.Period.valid() {
+			fatal("Invalid --period", "period", *hotspotPeriod)
+		}
+		if config.GridKm <= 0 || *windowSize < 1 || *windowSlide < 0 || *watermarkDelay < 0 || *allowedLateness < 0 {
+			fatal("aggregate-windows needs --grid-km > 0, --window-size >= 1 and non-negative --window-slide, --watermark-delay and --allowed-lateness")
+		}
+		if *windowSlide > 0 {
+			config.Window.Type = SlidingWindow
+		}
+		if err := createLightWindowedTable(ctx, dbPool); err != nil {
+			fatal("Error creating windowed light table", "error", err)
+		}
+
+		startTime := time.Now()
+		result, err := runWindowedAggregation(ctx, dbPool, config)
+		if err != nil {
+			if ctx.Err() != nil {
+				slog.Warn("Windowed aggregation interrupted, light_windowed_aggregated is incomplete", "points", result.Points)
+				return
+			}
+			fatal("Windowed aggregation failed", "points", result.Points, "error", err)
+		}
+		logProgress("Windowed aggregation completed", "table", "light_windowed_aggregated", "points", result.Points,
+			"windows", result.Finals, "corrections", result.Corrections, "late_applied", result.LatePointsApplied,
+			"late_dropped", result.LatePointsDropped, "duration", time.Since(startTime))
+		return
+	case "migrate":
 		// Run migration process
-		log.Println("Starting data migration to aggregated tables...")
+		slog.Info("Starting data migration to aggregated tables")
 		startTime := time.Now()
 		
-		if err := runMigration(dbPool); err != nil {
-			log.Fatalf("Migration failed: %v", err)
+		if err := runMigration(ctx, dbPool); err != nil {
+			if ctx.Err() != nil {
+				slog.Warn("Migration interrupted, the current step was rolled back")
+				return
+			}
+			fatal("Migration failed", "error", err)
 		}
 		
-		if err := migrationHealthCheck(dbPool); err != nil {
-			log.Printf("Health check completed with warnings: %v", err)
+		if err := migrationHealthCheck(ctx, dbPool); err != nil {
+			slog.Warn("Health check completed with warnings", "error", err)
 		}
 		
 		duration := time.Since(startTime)
-		log.Printf("Migration completed successfully in %v", duration)
+		logProgress("Migration completed successfully", "duration", duration)
 		return
-	} else if processBiological {
+	case "final_dataset":
 		// Create biological table
-		if err := createBiologicalTable(dbPool); err != nil {
-			log.Fatalf("Error creating biological table: %v", err)
+		if writeToDB {
+			if err := createBiologicalTable(ctx, dbPool); err != nil {
+				fatal("Error creating biological table", "error", err)
+			}
+			slog.Info("Biological table created successfully", "table", "biological_data")
+		}
+		
+		if *checklistFile != "" {
+			taxonomy, err = LoadTaxonomyBackbone(*checklistFile)
+			if err != nil {
+				fatal("Error loading checklist", "error", err)
+			}
+			slog.Info("Checklist loaded, names are resolved to accepted taxa", "file", *checklistFile)
+		} else if *unmatchedReport != "" {
+			fatal("--unmatched-report requires --checklist")
 		}
-		log.Println("Biological table created successfully")
 		
 		dataDir = "../light_taiwan/TBIA_final_dataset"
-		log.Printf("Starting biological data processing with %d workers", numWorkers)
+		slog.Info("Starting biological data processing", "workers", numWorkers, "dir", dataDir)
 		startTime := time.Now()
 		
-		if err := processBiologicalFilesConcurrently(dataDir, numWorkers); err != nil {
-			log.Fatalf("Error processing biological files: %v", err)
+		stats, err := processBiologicalFilesConcurrently(ctx, dataDir, numWorkers, sink)
+		if isInterrupted(err) {
+			slog.Warn("Import interrupted before any file was started")
+			return
+		} else if err != nil {
+			fatal("Error processing biological files", "error", err)
+		}
+		if *dryRun {
+			logDryRunReport(stats)
+		}
+		if dbSink != nil {
+			dbSink.RetryStats().LogSummary()
+		}
+		if taxonomy != nil {
+			taxonomy.LogSummary()
+			if *unmatchedReport != "" {
+				if err := taxonomy.WriteUnmatchedReport(*unmatchedReport); err != nil {
+					slog.Error("Error writing unmatched names", "error", err)
+				}
+			}
+		}
+		if *summaryFile != "" {
+			if err := writeRunSummary(*summaryFile, "final_dataset", ctx.Err() != nil, ingestMetrics); err != nil {
+				slog.Error("Error writing run summary", "error", err)
+			}
+		}
+		if ctx.Err() != nil {
+			if err := writeImportState(*stateFile, "final_dataset", stats); err != nil {
+				slog.Error("Error recording import state", "error", err)
+			}
+			return
 		}
 		
 		duration := time.Since(startTime)
-		log.Printf("Biological data import completed successfully in %v", duration)
-	} else if process2025Full {
+		logProgress("Biological data import completed successfully", "duration", duration)
+	case "2025_full":
 		// Create light data table with county
-		if err := createTable(dbPool); err != nil {
-			log.Fatalf("Error creating light table with county: %v", err)
+		if writeToDB {
+			if err := createTable(ctx, dbPool); err != nil {
+				fatal("Error creating light table with county", "error", err)
+			}
+			slog.Info("Light table with county created successfully", "table", "light_data_with_county")
 		}
-		log.Println("Light table with county created successfully")
 
 		filePath := "../light_taiwan/taiwan_light_2016_full.json"
-		log.Printf("Starting 2025 full light data processing")
+		slog.Info("Starting 2025 full light data processing", "file", filePath)
 		startTime := time.Now()
 		
-		if err := processFull2025LightData(filePath); err != nil {
-			log.Fatalf("Error processing 2025 full light data: %v", err)
+		stats := &ProcessingStats{Exclusions: NewExclusionCounts()}
+		ingestMetrics.Track(stats, 1)
+		fileStats := NewFileStats(filePath)
+		err := processFull2025LightData(ctx, filePath, sink, fileStats)
+		ingestMetrics.observeWorker(0, time.Since(startTime))
+		if err != nil && !isInterrupted(err) {
+			fatal("Error processing 2025 full light data", "error", err)
+		}
+		fileStats.Err = err
+		stats.addFile(fileStats)
+		if err == nil {
+			atomic.AddInt64(&stats.FilesProcessed, 1)
+		}
+		if *dryRun {
+			logDryRunReport(stats)
+		}
+		if dbSink != nil {
+			dbSink.RetryStats().LogSummary()
+		}
+		if *summaryFile != "" {
+			if err := writeRunSummary(*summaryFile, "2025_full", err != nil, ingestMetrics); err != nil {
+				slog.Error("Error writing run summary", "error", err)
+			}
+		}
+		if err != nil {
+			if err := writeImportState(*stateFile, "2025_full", stats); err != nil {
+				slog.Error("Error recording import state", "error", err)
+			}
+			return
 		}
 		
 		duration := time.Since(startTime)
-		log.Printf("2025 full light data import completed successfully in %v", duration)
-	} else {
+		logProgress("2025 full light data import completed successfully", "duration", duration)
+	case "light":
 		// Create light data table
-		if err := createTable(dbPool); err != nil {
-			log.Fatalf("Error creating light table: %v", err)
+		if writeToDB {
+			if err := createTable(ctx, dbPool); err != nil {
+				fatal("Error creating light table", "error", err)
+			}
+			slog.Info("Light table created successfully", "table", "light_data_with_county")
 		}
-		log.Println("Light table created successfully")
 
 		dataDir = "../light_taiwan"
-		log.Printf("Starting light data processing with %d workers", numWorkers)
+		slog.Info("Starting light data processing", "workers", numWorkers, "dir", dataDir)
 		startTime := time.Now()
 		
-		if err := processAllFilesConcurrently(dataDir, numWorkers); err != nil {
-			log.Fatalf("Error processing light files: %v", err)
+		stats, err := processAllFilesConcurrently(ctx, dataDir, numWorkers, sink)
+		if isInterrupted(err) {
+			slog.Warn("Import interrupted before any file was started")
+			return
+		} else if err != nil {
+			fatal("Error processing light files", "error", err)
+		}
+		if *dryRun {
+			logDryRunReport(stats)
+		}
+		if dbSink != nil {
+			dbSink.RetryStats().LogSummary()
+		}
+		if *summaryFile != "" {
+			if err := writeRunSummary(*summaryFile, "light", ctx.Err() != nil, ingestMetrics); err != nil {
+				slog.Error("Error writing run summary", "error", err)
+			}
+		}
+		if ctx.Err() != nil {
+			if err := writeImportState(*stateFile, "light", stats); err != nil {
+				slog.Error("Error recording import state", "error", err)
+			}
+			return
 		}
 		
 		duration := time.Since(startTime)
-		log.Printf("Light data import completed successfully in %v", duration)
+		logProgress("Light data import completed successfully", "duration", duration)
 	}
 }
 
+// printUsage lists the available modes and flags on stderr, outside the structured log
+func printUsage(flags *flag.FlagSet) {
+	out := flags.Output()
+	fmt.Fprintln(out, "Usage: go run main.go [final_dataset|migrate|2025_full|serve|export|join-exposure|analyze-correlation|analyze-trend|analyze-hotspots|analyze-kde|analyze-anomalies|import-traits|aggregate-windows] [flags]")
+	fmt.Fprintln(out, "  - No arguments: Process light pollution data")
+	fmt.Fprintln(out, "  - final_dataset: Process TBIA biological data, resolving names to accepted taxa with --checklist")
+	fmt.Fprintln(out, "  - migrate: Migrate existing biological data to aggregated tables, including sampling effort, activity periods and biodiversity indices")
+	fmt.Fprintln(out, "  - 2025_full: Process taiwan_light_2025_full.json file")
+	fmt.Fprintln(out, "  - serve: Serve the dashboard chart API described in openapi.json")
+	fmt.Fprintln(out, "  - export: Export filtered biological or light data to GeoJSON, NDJSON, CSV or GeoParquet")
+	fmt.Fprintln(out, "  - join-exposure: Attribute nearby light brightness to each occurrence in occurrence_light_exposure")
+	fmt.Fprintln(out, "  - analyze-correlation: Correlate monthly brightness with event counts per county and animal type")
+	fmt.Fprintln(out, "  - analyze-trend: Seasonal Mann-Kendall test and Sen's slope of monthly brightness per county and grid cell")
+	fmt.Fprintln(out, "  - analyze-hotspots: Getis-Ord Gi* hot and cold spots of brightness and occurrence density per grid cell and period")
+	fmt.Fprintln(out, "  - analyze-kde: Kernel density of occurrences (--bio-group, --start, --end, --bbox) into occurrence_kde_raster, or a GeoTIFF with --out")
+	fmt.Fprintln(out, "  - analyze-anomalies: Flag monthly brightness far from the same month of other years per county and grid cell, CSV report with --out")
+	fmt.Fprintln(out, "  - import-traits: Load nocturnal, diurnal and crepuscular taxa from the --traits CSV into taxon_traits")
+	fmt.Fprintln(out, "  - aggregate-windows: Replay --light-ndjson through event-time windows with a watermark, writing finals and late-data corrections to light_windowed_aggregated")
+	fmt.Fprintln(out, "Flags:")
+	flags.VisitAll(func(f *flag.Flag) {
+		fmt.Fprintf(out, "  --%s: %s\n", f.Name, f.Usage)
+	})
+}
+
 // processFull2025LightData processes the taiwan_light_2025_full.json file
-func processFull2025LightData(filePath string) error {
-	log.Printf("Processing full 2025 light data file: %s", filePath)
+func processFull2025LightData(ctx context.Context, filePath string, sink Sink, stats *FileStats) error {
+	logger := slog.With("file", filePath, "table", "light_data_with_county")
+	logger.Info("Processing full 2025 light data file")
 	
 	file, err := os.Open(filePath)
 	if err != nil {
@@ -703,103 +1403,104 @@ func processFull2025LightData(filePath string) error {
 	}
 	defer file.Close()
 	
-	// Read and preprocess JSON to handle NaN values
-	content, err := os.ReadFile(filePath)
-	if err != nil {
-		return fmt.Errorf("error reading file: %v", err)
-	}
-	
-	// Replace NaN with null so JSON parser can handle it
-	processedContent := strings.ReplaceAll(string(content), "NaN", "null")
-	
-	// Parse JSON
-	var lightData []LightDataWithCounty
-	if err := json.Unmarshal([]byte(processedContent), &lightData); err != nil {
+	// Stream the array record by record, replacing the bare NaN tokens the file contains with null
+	decoder := json.NewDecoder(newNaNReplacingReader(ingestMetrics.countReads(file)))
+	if _, err := decoder.Token(); err != nil {
 		return fmt.Errorf("error parsing JSON: %v", err)
 	}
 	
-	log.Printf("Loaded %d light data records from JSON", len(lightData))
-	
 	// Insert data in batches
 	const batchSize = 5000
-	totalRecords := len(lightData)
+	lightData := make([]LightDataWithCounty, 0, batchSize)
+	totalRecords := 0
 	
-	for i := 0; i < totalRecords; i += batchSize {
-		end := i + batchSize
-		if end > totalRecords {
-			end = totalRecords
+	writeBatch := func() error {
+		batch := parseLightWithCountyBatch(lightData, stats.Exclusions)
+		if err := sink.WriteLight(context.WithoutCancel(ctx), batch); err != nil {
+			return fmt.Errorf("error inserting batch starting at %d: %v", totalRecords, err)
 		}
+		stats.Records += int64(len(lightData))
+		stats.Written += int64(len(batch))
 		
-		batch := lightData[i:end]
-		if err := insertLightDataWithCountyBatch(dbPool, batch); err != nil {
-			return fmt.Errorf("error inserting batch starting at %d: %v", i, err)
+		logger.Debug("Wrote batch", "offset", totalRecords, "records", len(batch), "skipped", len(lightData)-len(batch))
+		totalRecords += len(lightData)
+		lightData = lightData[:0]
+		return nil
+	}
+	
+	for decoder.More() {
+		if len(lightData) == batchSize {
+			if err := ctx.Err(); err != nil {
+				return fmt.Errorf("interrupted after %d records: %w", totalRecords, err)
+			}
+			if err := writeBatch(); err != nil {
+				return err
+			}
 		}
 		
-		if (i+batchSize)%10000 == 0 || end == totalRecords {
-			log.Printf("Inserted %d/%d records", end, totalRecords)
+		var record LightDataWithCounty
+		if err := decoder.Decode(&record); err != nil {
+			return fmt.Errorf("error parsing JSON record %d: %v", totalRecords+len(lightData), err)
+		}
+		lightData = append(lightData, record)
+	}
+	if _, err := decoder.Token(); err != nil {
+		return fmt.Errorf("error parsing JSON: %v", err)
+	}
+	if len(lightData) > 0 {
+		if err := writeBatch(); err != nil {
+			return err
 		}
 	}
 	
-	log.Printf("Successfully processed all %d records from %s", totalRecords, filePath)
+	logger.Info("Inserted file", "written", stats.Written, "records", totalRecords)
+	stats.Exclusions.LogSummary("Excluded light pixels")
 	return nil
 }
 
-// insertLightDataWithCountyBatch inserts a batch of LightDataWithCounty records
-func insertLightDataWithCountyBatch(db *sql.DB, batch []LightDataWithCounty) error {
-	if len(batch) == 0 {
-		return nil
-	}
-
-	tx, err := db.Begin()
-	if err != nil {
-		return fmt.Errorf("error starting transaction: %v", err)
-	}
-	defer tx.Rollback()
-
-	// Build bulk insert query
-	valueStrings := make([]string, 0, len(batch))
-	valueArgs := make([]interface{}, 0, len(batch)*5)
-	
-	argIndex := 1
+// parseLightWithCountyBatch converts LightDataWithCounty records, counting skipped records per reason
+func parseLightWithCountyBatch(batch []LightDataWithCounty, exclusions *ExclusionCounts) []LightRecord {
+	records := make([]LightRecord, 0, len(batch))
 	for _, record := range batch {
 		// Parse time
 		parsedTime, err := time.Parse(time.RFC3339, record.Time)
 		if err != nil {
-			log.Printf("Warning: skipping record with invalid time format: %s", record.Time)
+			slog.Debug("Skipping record with invalid time format", "time", record.Time)
+			exclusions.Add(ExcludeInvalidTime, 1)
 			continue
 		}
 		
 		// Get brightness value
 		brightnessFloat, ok := record.Brightness.(float64)
 		if !ok {
+			exclusions.Add(ExcludeNaNBrightness, 1)
 			continue // Skip records with invalid brightness values
 		}
 		
 		// Skip records with NaN county (null values after preprocessing)
-		if record.County == nil {
-			continue // Ignore records with NaN county
-		}
-		
 		countyStr, ok := record.County.(string)
 		if !ok {
-			continue // Ignore records with invalid county values
+			exclusions.Add(ExcludeMissingCounty, 1)
+			continue // Ignore records with NaN or invalid county values
 		}
 		
-		valueStrings = append(valueStrings, fmt.Sprintf("($%d, $%d, $%d, $%d, $%d)", argIndex, argIndex+1, argIndex+2, argIndex+3, argIndex+4))
-		valueArgs = append(valueArgs, parsedTime, record.Longitude, record.Latitude, brightnessFloat, countyStr)
-		argIndex += 5
-	}
-	
-	if len(valueStrings) == 0 {
-		return nil
-	}
-
-	query := fmt.Sprintf("INSERT INTO light_data_with_county (time, longitude, latitude, brightness, county) VALUES %s", strings.Join(valueStrings, ","))
-	
-	_, err = tx.Exec(query, valueArgs...)
-	if err != nil {
-		return fmt.Errorf("error executing batch insert: %v", err)
+		// Optional quality layers
+		quality := optionalInt(record.Quality)
+		cloudFreeObs := optionalInt(record.CloudFreeObs)
+		if reason := lightQualityFilter.exclusion(quality, cloudFreeObs); reason != "" {
+			exclusions.Add(reason, 1)
+			continue
+		}
+		
+		records = append(records, LightRecord{
+			Time:         parsedTime,
+			Longitude:    record.Longitude,
+			Latitude:     record.Latitude,
+			Brightness:   &brightnessFloat,
+			County:       &countyStr,
+			Quality:      quality,
+			CloudFreeObs: cloudFreeObs,
+		})
 	}
-
-	return tx.Commit()
+	return records
 }
@@ -0,0 +1,453 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// batchLatencyBuckets are the upper bounds in seconds of the batch write latency histogram
+var batchLatencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// ingestMetrics collects the metrics of the running import for /metrics and the run summary
+var ingestMetrics = NewIngestMetrics()
+
+// IngestMetrics holds live metrics of an import run and is safe for concurrent use
+type IngestMetrics struct {
+	started   time.Time
+	bytesRead int64
+
+	mu         sync.Mutex
+	tables     map[string]*tableMetrics
+	workerBusy map[int]time.Duration
+	workers    int
+	stats      *ProcessingStats
+	retries    *RetryStats
+	db         *sql.DB
+}
+
+// tableMetrics counts the batches written to one table
+type tableMetrics struct {
+	rows         int64
+	batches      int64
+	failed       int64
+	latencySum   float64
+	latencyMax   float64
+	bucketCounts []int64 // per bucket of batchLatencyBuckets, not cumulative
+}
+
+// NewIngestMetrics starts the run clock
+func NewIngestMetrics() *IngestMetrics {
+	return &IngestMetrics{
+		started:    time.Now(),
+		tables:     make(map[string]*tableMetrics),
+		workerBusy: make(map[int]time.Duration),
+	}
+}
+
+// Track reports the file and reject counters of stats, processed by the given number of workers
+func (m *IngestMetrics) Track(stats *ProcessingStats, workers int) {
+	m.mu.Lock()
+	m.stats = stats
+	m.workers = workers
+	m.mu.Unlock()
+}
+
+// SetDatabase reports the connection pool statistics and batch retries of a database import
+func (m *IngestMetrics) SetDatabase(db *sql.DB, retries *RetryStats) {
+	m.mu.Lock()
+	m.db = db
+	m.retries = retries
+	m.mu.Unlock()
+}
+
+func (m *IngestMetrics) observeBatch(table string, rows int, elapsed time.Duration, err error) {
+	seconds := elapsed.Seconds()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t := m.tables[table]
+	if t == nil {
+		t = &tableMetrics{bucketCounts: make([]int64, len(batchLatencyBuckets))}
+		m.tables[table] = t
+	}
+	t.batches++
+	if err != nil {
+		t.failed++
+	} else {
+		t.rows += int64(rows)
+	}
+	t.latencySum += seconds
+	if seconds > t.latencyMax {
+		t.latencyMax = seconds
+	}
+	for i, bound := range batchLatencyBuckets {
+		if seconds <= bound {
+			t.bucketCounts[i]++
+			break
+		}
+	}
+}
+
+func (m *IngestMetrics) observeWorker(id int, busy time.Duration) {
+	m.mu.Lock()
+	m.workerBusy[id] += busy
+	m.mu.Unlock()
+}
+
+// countReads wraps r so the bytes read from it are counted
+func (m *IngestMetrics) countReads(r io.Reader) io.Reader {
+	return &countingReader{r: r, n: &m.bytesRead}
+}
+
+type countingReader struct {
+	r io.Reader
+	n *int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	atomic.AddInt64(c.n, int64(n))
+	return n, err
+}
+
+// MetricsSink times every write to the wrapped sink and counts the rows per table
+type MetricsSink struct {
+	Sink
+	metrics *IngestMetrics
+}
+
+// NewMetricsSink instruments sink with m
+func NewMetricsSink(sink Sink, m *IngestMetrics) *MetricsSink {
+	return &MetricsSink{Sink: sink, metrics: m}
+}
+
+func (s *MetricsSink) WriteLight(ctx context.Context, records []LightRecord) error {
+	start := time.Now()
+	err := s.Sink.WriteLight(ctx, records)
+	s.metrics.observeBatch("light_data_with_county", len(records), time.Since(start), err)
+	return err
+}
+
+func (s *MetricsSink) WriteBiological(ctx context.Context, records []BiologicalRecord) error {
+	start := time.Now()
+	err := s.Sink.WriteBiological(ctx, records)
+	s.metrics.observeBatch("biological_data", len(records), time.Since(start), err)
+	return err
+}
+
+// promWriter writes the Prometheus text exposition format
+type promWriter struct {
+	w io.Writer
+}
+
+var promLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func (p promWriter) header(name, kind, help string) {
+	fmt.Fprintf(p.w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// sample writes one value; labels alternate names and values
+func (p promWriter) sample(name string, value float64, labels ...string) {
+	var b strings.Builder
+	b.WriteString(name)
+	if len(labels) > 0 {
+		b.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			fmt.Fprintf(&b, `%s="%s"`, labels[i], promLabelEscaper.Replace(labels[i+1]))
+		}
+		b.WriteByte('}')
+	}
+	fmt.Fprintf(p.w, "%s %s\n", b.String(), strconv.FormatFloat(value, 'g', -1, 64))
+}
+
+func (p promWriter) metric(name, kind, help string, value float64) {
+	p.header(name, kind, help)
+	p.sample(name, value)
+}
+
+// WritePrometheus writes all metrics in the Prometheus text format
+func (m *IngestMetrics) WritePrometheus(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p := promWriter{w: w}
+	elapsed := time.Since(m.started).Seconds()
+
+	p.metric("insertdata_run_start_time_seconds", "gauge", "Unix time the import run started.", float64(m.started.UnixNano())/1e9)
+	p.metric("insertdata_bytes_read_total", "counter", "Bytes read from the input files.", float64(atomic.LoadInt64(&m.bytesRead)))
+
+	if m.stats != nil {
+		p.metric("insertdata_files_processed_total", "counter", "Input files processed successfully.", float64(atomic.LoadInt64(&m.stats.FilesProcessed)))
+		p.metric("insertdata_files_failed_total", "counter", "Input files that failed.", float64(atomic.LoadInt64(&m.stats.ErrorCount)))
+		p.metric("insertdata_records_read_total", "counter", "Records read from completed input files.", float64(atomic.LoadInt64(&m.stats.RecordsRead)))
+
+		p.header("insertdata_records_rejected_total", "counter", "Records skipped by validation or quality filters, per reason.")
+		rejects := m.stats.Exclusions.Snapshot()
+		for _, reason := range sortedKeys(rejects) {
+			p.sample("insertdata_records_rejected_total", float64(rejects[ExclusionReason(reason)]), "reason", reason)
+		}
+	}
+
+	tables := make([]string, 0, len(m.tables))
+	for table := range m.tables {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+
+	p.header("insertdata_rows_written_total", "counter", "Rows written, per table.")
+	for _, table := range tables {
+		p.sample("insertdata_rows_written_total", float64(m.tables[table].rows), "table", table)
+	}
+	p.header("insertdata_rows_per_second", "gauge", "Average rows written per second since the run started, per table.")
+	for _, table := range tables {
+		p.sample("insertdata_rows_per_second", perSecond(m.tables[table].rows, elapsed), "table", table)
+	}
+	p.header("insertdata_batches_failed_total", "counter", "Batch writes that returned an error, per table.")
+	for _, table := range tables {
+		p.sample("insertdata_batches_failed_total", float64(m.tables[table].failed), "table", table)
+	}
+	p.header("insertdata_batch_duration_seconds", "histogram", "Batch write latency including retries, per table.")
+	for _, table := range tables {
+		t := m.tables[table]
+		var cumulative int64
+		for i, bound := range batchLatencyBuckets {
+			cumulative += t.bucketCounts[i]
+			p.sample("insertdata_batch_duration_seconds_bucket", float64(cumulative), "table", table, "le", strconv.FormatFloat(bound, 'g', -1, 64))
+		}
+		p.sample("insertdata_batch_duration_seconds_bucket", float64(t.batches), "table", table, "le", "+Inf")
+		p.sample("insertdata_batch_duration_seconds_sum", t.latencySum, "table", table)
+		p.sample("insertdata_batch_duration_seconds_count", float64(t.batches), "table", table)
+	}
+
+	if m.retries != nil {
+		retried, failed, perReason := m.retries.Snapshot()
+		p.metric("insertdata_batches_retried_total", "counter", "Batches that succeeded after at least one retry.", float64(retried))
+		p.metric("insertdata_batches_abandoned_total", "counter", "Batches that failed permanently.", float64(failed))
+		p.header("insertdata_batch_retries_total", "counter", "Batch retries, per transient error class.")
+		for _, reason := range sortedKeys(perReason) {
+			p.sample("insertdata_batch_retries_total", float64(perReason[reason]), "reason", reason)
+		}
+	}
+
+	p.metric("insertdata_workers", "gauge", "Workers processing input files.", float64(m.workers))
+	p.header("insertdata_worker_busy_seconds_total", "counter", "Time each worker spent processing files.")
+	workerIDs := make([]int, 0, len(m.workerBusy))
+	for id := range m.workerBusy {
+		workerIDs = append(workerIDs, id)
+	}
+	sort.Ints(workerIDs)
+	var busy time.Duration
+	for _, id := range workerIDs {
+		busy += m.workerBusy[id]
+		p.sample("insertdata_worker_busy_seconds_total", m.workerBusy[id].Seconds(), "worker", strconv.Itoa(id))
+	}
+	p.metric("insertdata_worker_utilization", "gauge", "Fraction of worker time spent processing files since the run started.", utilization(busy, m.workers, elapsed))
+
+	if m.db != nil {
+		db := m.db.Stats()
+		p.metric("insertdata_db_max_open_connections", "gauge", "Maximum open connections of the pool.", float64(db.MaxOpenConnections))
+		p.metric("insertdata_db_open_connections", "gauge", "Open connections, in use and idle.", float64(db.OpenConnections))
+		p.metric("insertdata_db_in_use_connections", "gauge", "Connections currently in use.", float64(db.InUse))
+		p.metric("insertdata_db_idle_connections", "gauge", "Idle connections.", float64(db.Idle))
+		p.metric("insertdata_db_wait_count_total", "counter", "Connections waited for.", float64(db.WaitCount))
+		p.metric("insertdata_db_wait_duration_seconds_total", "counter", "Time spent waiting for a connection.", db.WaitDuration.Seconds())
+	}
+}
+
+func sortedKeys[K ~string, V any](m map[K]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, string(k))
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func perSecond(n int64, seconds float64) float64 {
+	if seconds <= 0 {
+		return 0
+	}
+	return float64(n) / seconds
+}
+
+func utilization(busy time.Duration, workers int, seconds float64) float64 {
+	if workers <= 0 || seconds <= 0 {
+		return 0
+	}
+	return busy.Seconds() / (float64(workers) * seconds)
+}
+
+// serveMetrics exposes /metrics on addr in the background until ctx is cancelled
+func serveMetrics(ctx context.Context, addr string, m *IngestMetrics) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		m.WritePrometheus(w)
+	})
+	server := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	go func() {
+		slog.Info("Metrics listening", "addr", addr, "path", "/metrics")
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			slog.Error("Metrics server failed", "error", err)
+		}
+	}()
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+}
+
+// RunSummary is the final JSON report of an import run
+type RunSummary struct {
+	RunID           string                  `json:"run_id"`
+	Mode            string                  `json:"mode"`
+	StartedAt       time.Time               `json:"started_at"`
+	FinishedAt      time.Time               `json:"finished_at"`
+	DurationSeconds float64                 `json:"duration_seconds"`
+	Interrupted     bool                    `json:"interrupted"`
+	FilesProcessed  int64                   `json:"files_processed"`
+	FilesFailed     int64                   `json:"files_failed"`
+	RecordsRead     int64                   `json:"records_read"`
+	BytesRead       int64                   `json:"bytes_read"`
+	Tables          map[string]TableSummary `json:"tables"`
+	Rejects         map[string]int64        `json:"rejects_by_reason"`
+	Retries         *RetrySummary           `json:"retries,omitempty"`
+	Workers         int                     `json:"workers"`
+	WorkerBusy      map[string]float64      `json:"worker_busy_seconds"`
+	Utilization     float64                 `json:"worker_utilization"`
+	DBPool          *sql.DBStats            `json:"db_pool,omitempty"`
+}
+
+// TableSummary reports the writes to one table; latency quantiles are histogram bucket upper bounds
+type TableSummary struct {
+	Rows          int64   `json:"rows"`
+	RowsPerSecond float64 `json:"rows_per_second"`
+	Batches       int64   `json:"batches"`
+	FailedBatches int64   `json:"failed_batches"`
+	LatencyMean   float64 `json:"batch_latency_mean_seconds"`
+	LatencyP50    float64 `json:"batch_latency_p50_seconds"`
+	LatencyP95    float64 `json:"batch_latency_p95_seconds"`
+	LatencyMax    float64 `json:"batch_latency_max_seconds"`
+}
+
+// RetrySummary reports the batch retries of a database import
+type RetrySummary struct {
+	Retried   int64            `json:"batches_retried"`
+	Abandoned int64            `json:"batches_failed_permanently"`
+	PerReason map[string]int64 `json:"retries_by_reason"`
+}
+
+// Summary builds the run summary as of now
+func (m *IngestMetrics) Summary(mode string, interrupted bool) RunSummary {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	elapsed := now.Sub(m.started).Seconds()
+	summary := RunSummary{
+		RunID:           runID,
+		Mode:            mode,
+		StartedAt:       m.started.UTC(),
+		FinishedAt:      now.UTC(),
+		DurationSeconds: elapsed,
+		Interrupted:     interrupted,
+		BytesRead:       atomic.LoadInt64(&m.bytesRead),
+		Tables:          make(map[string]TableSummary),
+		Rejects:         make(map[string]int64),
+		Workers:         m.workers,
+		WorkerBusy:      make(map[string]float64),
+	}
+
+	if m.stats != nil {
+		summary.FilesProcessed = atomic.LoadInt64(&m.stats.FilesProcessed)
+		summary.FilesFailed = atomic.LoadInt64(&m.stats.ErrorCount)
+		summary.RecordsRead = atomic.LoadInt64(&m.stats.RecordsRead)
+		for reason, n := range m.stats.Exclusions.Snapshot() {
+			summary.Rejects[string(reason)] = n
+		}
+	}
+
+	for table, t := range m.tables {
+		ts := TableSummary{
+			Rows:          t.rows,
+			RowsPerSecond: perSecond(t.rows, elapsed),
+			Batches:       t.batches,
+			FailedBatches: t.failed,
+			LatencyP50:    t.quantile(0.5),
+			LatencyP95:    t.quantile(0.95),
+			LatencyMax:    t.latencyMax,
+		}
+		if t.batches > 0 {
+			ts.LatencyMean = t.latencySum / float64(t.batches)
+		}
+		summary.Tables[table] = ts
+	}
+
+	if m.retries != nil {
+		retried, abandoned, perReason := m.retries.Snapshot()
+		summary.Retries = &RetrySummary{Retried: retried, Abandoned: abandoned, PerReason: perReason}
+	}
+
+	var busy time.Duration
+	for id, d := range m.workerBusy {
+		busy += d
+		summary.WorkerBusy[strconv.Itoa(id)] = d.Seconds()
+	}
+	summary.Utilization = utilization(busy, m.workers, elapsed)
+
+	if m.db != nil {
+		dbStats := m.db.Stats()
+		summary.DBPool = &dbStats
+	}
+	return summary
+}
+
+// quantile returns the upper bound of the bucket holding quantile q, capped at the largest observed latency
+func (t *tableMetrics) quantile(q float64) float64 {
+	if t.batches == 0 {
+		return 0
+	}
+	rank := int64(q * float64(t.batches))
+	if rank < 1 {
+		rank = 1
+	}
+	var cumulative int64
+	for i, bound := range batchLatencyBuckets {
+		cumulative += t.bucketCounts[i]
+		if cumulative >= rank {
+			return math.Min(bound, t.latencyMax)
+		}
+	}
+	return t.latencyMax
+}
+
+// writeRunSummary writes the run summary of mode to path as indented JSON
+func writeRunSummary(path, mode string, interrupted bool, m *IngestMetrics) error {
+	data, err := json.MarshalIndent(m.Summary(mode, interrupted), "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding run summary: %v", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("error writing run summary %s: %v", path, err)
+	}
+	logProgress("Run summary written", "path", path)
+	return nil
+}
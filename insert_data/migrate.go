@@ -1,9 +1,10 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
-	"log"
+	"log/slog"
 	"time"
 )
 
@@ -22,212 +23,398 @@ func getSeasonFromMonth(month int) int {
 }
 
 // migrateToAnimalAggregatedData migrates data from biological_data to animal_aggregated_data
-func migrateToAnimalAggregatedData(db *sql.DB) error {
-	log.Println("Starting migration to animal_aggregated_data table...")
+func migrateToAnimalAggregatedData(ctx context.Context, db *sql.DB) error {
+	slog.Info("Starting migration to animal_aggregated_data table...", "table", "animal_aggregated_data")
 
 	// First, ensure the table exists
-	if err := createAnimalAggregatedTable(db); err != nil {
+	if err := createAnimalAggregatedTable(ctx, db); err != nil {
 		return fmt.Errorf("error creating animal_aggregated_data table: %v", err)
 	}
 
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
 	// Clear existing data in case of re-migration
-	if _, err := db.Exec("DELETE FROM animal_aggregated_data"); err != nil {
-		log.Printf("Warning: could not clear existing animal_aggregated_data: %v", err)
+	if _, err := tx.ExecContext(ctx, "DELETE FROM animal_aggregated_data"); err != nil {
+		return fmt.Errorf("error clearing existing animal_aggregated_data: %v", err)
 	}
 
-	// SQL query to aggregate biological data
-	query := `
-		INSERT INTO animal_aggregated_data 
-		(county, animal_type, year, month, season, total_amount, event_count, created_at, updated_at)
-		SELECT 
-			COALESCE(county, 'Unknown') as county,
-			COALESCE(bio_group, 'Unknown') as animal_type,
-			EXTRACT(YEAR FROM event_date)::INTEGER as year,
-			EXTRACT(MONTH FROM event_date)::INTEGER as month,
-			CASE 
-				WHEN EXTRACT(MONTH FROM event_date) BETWEEN 3 AND 5 THEN 1
-				WHEN EXTRACT(MONTH FROM event_date) BETWEEN 6 AND 8 THEN 2
-				WHEN EXTRACT(MONTH FROM event_date) BETWEEN 9 AND 11 THEN 3
-				ELSE 4
-			END as season,
-			COALESCE(SUM(
-				CASE 
-					WHEN organism_quantity ~ '^[0-9]+$' THEN organism_quantity::INTEGER
-					ELSE 1
-				END
-			), 0) as total_amount,
-			COUNT(*) as event_count,
-			NOW() as created_at,
-			NOW() as updated_at
-		FROM biological_data 
-		WHERE event_date IS NOT NULL 
-			AND EXTRACT(YEAR FROM event_date) IS NOT NULL
-			AND EXTRACT(MONTH FROM event_date) BETWEEN 1 AND 12
-		GROUP BY 
-			COALESCE(county, 'Unknown'),
-			COALESCE(bio_group, 'Unknown'),
-			EXTRACT(YEAR FROM event_date),
-			EXTRACT(MONTH FROM event_date)
-		ORDER BY year, month, county, animal_type
-	`
+	// SQL query to aggregate biological data for the selected backend
+	query, err := store.MigrationQuery("animal_aggregated_data")
+	if err != nil {
+		return err
+	}
 
-	log.Println("Executing animal aggregation query...")
-	result, err := db.Exec(query)
+	slog.Info("Executing animal aggregation query...", "table", "animal_aggregated_data")
+	result, err := tx.ExecContext(ctx, query)
 	if err != nil {
 		return fmt.Errorf("error executing animal aggregation: %v", err)
 	}
 
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		log.Printf("Warning: could not get rows affected count: %v", err)
+		slog.Warn("Could not get rows affected count", "table", "animal_aggregated_data", "error", err)
 	} else {
-		log.Printf("Successfully migrated %d aggregated animal records", rowsAffected)
+		slog.Info("Successfully migrated aggregated animal records", "table", "animal_aggregated_data", "rows", rowsAffected)
 	}
 
-	return nil
+	// Normalize by the survey effort of the county and month, see migrateToSamplingEffortAggregated
+	slog.Info("Applying sampling effort rates...", "table", "animal_aggregated_data")
+	if _, err := tx.ExecContext(ctx, animalEffortRatesQuery); err != nil {
+		return fmt.Errorf("error applying sampling effort rates: %v", err)
+	}
+
+	return tx.Commit()
+}
+
+// migrateToSamplingEffortAggregated computes the effort proxies per county and month: distinct datasets,
+// observation days and localities over all groups. It runs before the animal aggregation, whose rates
+// divide by the observation days.
+func migrateToSamplingEffortAggregated(ctx context.Context, db *sql.DB) error {
+	slog.Info("Starting migration to sampling_effort_aggregated table...", "table", "sampling_effort_aggregated")
+
+	// First, ensure the table exists
+	if err := createSamplingEffortTable(ctx, db); err != nil {
+		return fmt.Errorf("error creating sampling_effort_aggregated table: %v", err)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM sampling_effort_aggregated"); err != nil {
+		return fmt.Errorf("error clearing existing sampling_effort_aggregated: %v", err)
+	}
+
+	query, err := store.MigrationQuery("sampling_effort_aggregated")
+	if err != nil {
+		return err
+	}
+
+	slog.Info("Executing sampling effort aggregation query...", "table", "sampling_effort_aggregated")
+	result, err := tx.ExecContext(ctx, query)
+	if err != nil {
+		return fmt.Errorf("error executing sampling effort aggregation: %v", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		slog.Warn("Could not get rows affected count", "table", "sampling_effort_aggregated", "error", err)
+	} else {
+		slog.Info("Successfully migrated sampling effort records", "table", "sampling_effort_aggregated", "rows", rowsAffected)
+	}
+
+	return tx.Commit()
 }
 
 // migrateToDatasetStatsAggregated migrates data from biological_data to dataset_stats_aggregated
-func migrateToDatasetStatsAggregated(db *sql.DB) error {
-	log.Println("Starting migration to dataset_stats_aggregated table...")
+func migrateToDatasetStatsAggregated(ctx context.Context, db *sql.DB) error {
+	slog.Info("Starting migration to dataset_stats_aggregated table...", "table", "dataset_stats_aggregated")
 
 	// First, ensure the table exists
-	if err := createDatasetStatsTable(db); err != nil {
+	if err := createDatasetStatsTable(ctx, db); err != nil {
 		return fmt.Errorf("error creating dataset_stats_aggregated table: %v", err)
 	}
 
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
 	// Clear existing data in case of re-migration
-	if _, err := db.Exec("DELETE FROM dataset_stats_aggregated"); err != nil {
-		log.Printf("Warning: could not clear existing dataset_stats_aggregated: %v", err)
+	if _, err := tx.ExecContext(ctx, "DELETE FROM dataset_stats_aggregated"); err != nil {
+		return fmt.Errorf("error clearing existing dataset_stats_aggregated: %v", err)
 	}
 
-	// SQL query to aggregate dataset statistics
-	query := `
-		INSERT INTO dataset_stats_aggregated 
-		(dataset, county, year, month, count, created_at, updated_at)
-		SELECT 
-			COALESCE(dataset_name, 'Unknown') as dataset,
-			COALESCE(county, 'Unknown') as county,
-			EXTRACT(YEAR FROM event_date)::INTEGER as year,
-			EXTRACT(MONTH FROM event_date)::INTEGER as month,
-			COUNT(*) as count,
-			NOW() as created_at,
-			NOW() as updated_at
-		FROM biological_data 
-		WHERE event_date IS NOT NULL 
-			AND EXTRACT(YEAR FROM event_date) IS NOT NULL
-			AND EXTRACT(MONTH FROM event_date) BETWEEN 1 AND 12
-		GROUP BY 
-			COALESCE(dataset_name, 'Unknown'),
-			COALESCE(county, 'Unknown'),
-			EXTRACT(YEAR FROM event_date),
-			EXTRACT(MONTH FROM event_date)
-		ORDER BY year, month, dataset, county
-	`
+	// SQL query to aggregate dataset statistics for the selected backend
+	query, err := store.MigrationQuery("dataset_stats_aggregated")
+	if err != nil {
+		return err
+	}
 
-	log.Println("Executing dataset stats aggregation query...")
-	result, err := db.Exec(query)
+	slog.Info("Executing dataset stats aggregation query...", "table", "dataset_stats_aggregated")
+	result, err := tx.ExecContext(ctx, query)
 	if err != nil {
 		return fmt.Errorf("error executing dataset stats aggregation: %v", err)
 	}
 
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		log.Printf("Warning: could not get rows affected count: %v", err)
+		slog.Warn("Could not get rows affected count", "table", "dataset_stats_aggregated", "error", err)
 	} else {
-		log.Printf("Successfully migrated %d aggregated dataset stats records", rowsAffected)
+		slog.Info("Successfully migrated aggregated dataset stats records", "table", "dataset_stats_aggregated", "rows", rowsAffected)
 	}
 
-	return nil
+	return tx.Commit()
 }
 
 // runMigration orchestrates the entire migration process
-func runMigration(db *sql.DB) error {
-	log.Println("=== Starting Data Migration Process ===")
+func runMigration(ctx context.Context, db *sql.DB) error {
+	logProgress("Starting data migration")
 	startTime := time.Now()
 
 	// Check if source table exists and has data
 	var count int
-	err := db.QueryRow("SELECT COUNT(*) FROM biological_data").Scan(&count)
+	err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM biological_data").Scan(&count)
 	if err != nil {
-		return fmt.Errorf("error checking source data: %v", err)
+		return fmt.Errorf("error checking source data: %w", err)
 	}
 	
 	if count == 0 {
 		return fmt.Errorf("no data found in biological_data table to migrate")
 	}
 	
-	log.Printf("Found %d records in biological_data table", count)
+	slog.Info("Found source records", "table", "biological_data", "records", count)
+
+	// Step 1: Survey effort per county and month, used by the animal rates
+	if err := migrateToSamplingEffortAggregated(ctx, db); err != nil {
+		return fmt.Errorf("sampling effort migration failed: %w", err)
+	}
+
+	// Step 2: Activity period per scientific name, joined by the animal aggregation
+	if err := migrateToTaxonActivity(ctx, db); err != nil {
+		return fmt.Errorf("taxon activity migration failed: %w", err)
+	}
+
+	// Step 3: Migrate to animal_aggregated_data
+	if err := migrateToAnimalAggregatedData(ctx, db); err != nil {
+		return fmt.Errorf("animal aggregation migration failed: %w", err)
+	}
 
-	// Step 1: Migrate to animal_aggregated_data
-	if err := migrateToAnimalAggregatedData(db); err != nil {
-		return fmt.Errorf("animal aggregation migration failed: %v", err)
+	// Step 4: Migrate to dataset_stats_aggregated
+	if err := migrateToDatasetStatsAggregated(ctx, db); err != nil {
+		return fmt.Errorf("dataset stats migration failed: %w", err)
 	}
 
-	// Step 2: Migrate to dataset_stats_aggregated
-	if err := migrateToDatasetStatsAggregated(db); err != nil {
-		return fmt.Errorf("dataset stats migration failed: %v", err)
+	// Step 5: Compute diversity indices into biodiversity_aggregated_data
+	if err := migrateToBiodiversityAggregated(ctx, db); err != nil {
+		return fmt.Errorf("biodiversity migration failed: %w", err)
+	}
+
+	// Step 6: Monthly light cells of the low-zoom light tiles in light_grid_aggregated
+	if err := migrateLightTileGrids(ctx, db); err != nil {
+		return fmt.Errorf("light tile grid migration failed: %w", err)
 	}
 
 	// Verify migrations
-	var animalCount, datasetCount int
-	db.QueryRow("SELECT COUNT(*) FROM animal_aggregated_data").Scan(&animalCount)
-	db.QueryRow("SELECT COUNT(*) FROM dataset_stats_aggregated").Scan(&datasetCount)
+	var animalCount, nocturnalCount, datasetCount, biodiversityCount, effortCount, tileCellCount int
+	db.QueryRowContext(ctx, "SELECT COUNT(*) FROM animal_aggregated_data").Scan(&animalCount)
+	db.QueryRowContext(ctx, "SELECT COUNT(*) FROM animal_aggregated_data WHERE activity_period = 'nocturnal'").Scan(&nocturnalCount)
+	db.QueryRowContext(ctx, "SELECT COUNT(*) FROM dataset_stats_aggregated").Scan(&datasetCount)
+	db.QueryRowContext(ctx, "SELECT COUNT(*) FROM biodiversity_aggregated_data").Scan(&biodiversityCount)
+	db.QueryRowContext(ctx, "SELECT COUNT(*) FROM sampling_effort_aggregated").Scan(&effortCount)
+	db.QueryRowContext(ctx, "SELECT COUNT(*) FROM light_grid_aggregated").Scan(&tileCellCount)
 
 	duration := time.Since(startTime)
-	log.Printf("=== Migration Completed Successfully ===")
-	log.Printf("Duration: %v", duration)
-	log.Printf("Animal aggregated records: %d", animalCount)
-	log.Printf("Dataset stats records: %d", datasetCount)
-	log.Printf("Source biological records: %d", count)
+	logProgress("Migrated aggregated tables", "duration", duration, "source_records", count)
+	logProgress("Migrated table", "table", "sampling_effort_aggregated", "rows", effortCount)
+	logProgress("Migrated table", "table", "animal_aggregated_data", "rows", animalCount, "nocturnal", nocturnalCount)
+	logProgress("Migrated table", "table", "dataset_stats_aggregated", "rows", datasetCount)
+	logProgress("Migrated table", "table", "biodiversity_aggregated_data", "rows", biodiversityCount)
+	logProgress("Migrated table", "table", "light_grid_aggregated", "rows", tileCellCount)
 
 	return nil
 }
 
 // migrationHealthCheck performs basic validation on migrated data
-func migrationHealthCheck(db *sql.DB) error {
-	log.Println("Running migration health check...")
+func migrationHealthCheck(ctx context.Context, db *sql.DB) error {
+	slog.Info("Running migration health check...")
 
 	// Check for any NULL values in critical fields
 	queries := []struct {
 		name  string
+		table string
 		query string
 	}{
 		{
 			"Animal data with NULL county",
+			"animal_aggregated_data",
 			"SELECT COUNT(*) FROM animal_aggregated_data WHERE county IS NULL",
 		},
 		{
 			"Animal data with invalid months",
+			"animal_aggregated_data",
 			"SELECT COUNT(*) FROM animal_aggregated_data WHERE month < 1 OR month > 12",
 		},
 		{
 			"Animal data with invalid seasons",
+			"animal_aggregated_data",
 			"SELECT COUNT(*) FROM animal_aggregated_data WHERE season < 1 OR season > 4",
 		},
 		{
 			"Dataset stats with NULL dataset",
+			"dataset_stats_aggregated",
 			"SELECT COUNT(*) FROM dataset_stats_aggregated WHERE dataset IS NULL",
 		},
 		{
 			"Dataset stats with invalid months",
+			"dataset_stats_aggregated",
 			"SELECT COUNT(*) FROM dataset_stats_aggregated WHERE month < 1 OR month > 12",
 		},
+		{
+			"Animal data without sampling effort",
+			"animal_aggregated_data",
+			"SELECT COUNT(*) FROM animal_aggregated_data WHERE effort_days IS NULL",
+		},
+		{
+			"Scientific names without an activity period",
+			"taxon_activity",
+			"SELECT COUNT(*) FROM taxon_activity WHERE activity_period = 'unknown'",
+		},
+		{
+			"Biodiversity data with evenness outside [0, 1]",
+			"biodiversity_aggregated_data",
+			"SELECT COUNT(*) FROM biodiversity_aggregated_data WHERE evenness < 0 OR evenness > 1.000001",
+		},
+		{
+			"Biodiversity months without a month",
+			"biodiversity_aggregated_data",
+			"SELECT COUNT(*) FROM biodiversity_aggregated_data WHERE period = 'month' AND month IS NULL",
+		},
 	}
 
 	for _, check := range queries {
 		var count int
-		err := db.QueryRow(check.query).Scan(&count)
+		err := db.QueryRowContext(ctx, check.query).Scan(&count)
 		if err != nil {
-			log.Printf("Warning: health check failed for %s: %v", check.name, err)
+			slog.Warn("Health check failed", "check", check.name, "table", check.table, "error", err)
 			continue
 		}
 		if count > 0 {
-			log.Printf("Warning: %s found %d problematic records", check.name, count)
+			slog.Warn("Health check found problematic records", "check", check.name, "table", check.table, "records", count)
 		} else {
-			log.Printf("✓ %s: OK", check.name)
+			slog.Info("Health check passed", "check", check.name, "table", check.table)
 		}
 	}
 
 	return nil
-}
\ No newline at end of file
+}
+
+// animalEffortRatesQuery fills the effort columns of animal_aggregated_data from sampling_effort_aggregated;
+// it runs unchanged on both backends
+const animalEffortRatesQuery = `
+	UPDATE animal_aggregated_data SET
+		effort_days = (
+			SELECT e.observation_days FROM sampling_effort_aggregated e
+			WHERE e.county = animal_aggregated_data.county
+				AND e.year = animal_aggregated_data.year
+				AND e.month = animal_aggregated_data.month
+		),
+		event_rate = CAST(event_count AS DOUBLE PRECISION) / NULLIF((
+			SELECT e.observation_days FROM sampling_effort_aggregated e
+			WHERE e.county = animal_aggregated_data.county
+				AND e.year = animal_aggregated_data.year
+				AND e.month = animal_aggregated_data.month
+		), 0),
+		amount_rate = CAST(total_amount AS DOUBLE PRECISION) / NULLIF((
+			SELECT e.observation_days FROM sampling_effort_aggregated e
+			WHERE e.county = animal_aggregated_data.county
+				AND e.year = animal_aggregated_data.year
+				AND e.month = animal_aggregated_data.month
+		), 0)
+`
+
+// PostgreSQL aggregation queries, grouped by calendar month in Taiwan time whatever the session TimeZone;
+// see storage.go for the SQLite versions
+const (
+	postgresAnimalAggregationQuery = `
+		INSERT INTO animal_aggregated_data 
+		(county, animal_type, activity_period, year, month, season, total_amount, event_count, created_at, updated_at)
+		SELECT 
+			COALESCE(county, 'Unknown') as county,
+			COALESCE(bio_group, 'Unknown') as animal_type,
+			COALESCE(ta.activity_period, 'unknown') as activity_period,
+			EXTRACT(YEAR FROM event_date AT TIME ZONE 'Asia/Taipei')::INTEGER as year,
+			EXTRACT(MONTH FROM event_date AT TIME ZONE 'Asia/Taipei')::INTEGER as month,
+			CASE 
+				WHEN EXTRACT(MONTH FROM event_date AT TIME ZONE 'Asia/Taipei') BETWEEN 3 AND 5 THEN 1
+				WHEN EXTRACT(MONTH FROM event_date AT TIME ZONE 'Asia/Taipei') BETWEEN 6 AND 8 THEN 2
+				WHEN EXTRACT(MONTH FROM event_date AT TIME ZONE 'Asia/Taipei') BETWEEN 9 AND 11 THEN 3
+				ELSE 4
+			END as season,
+			COALESCE(SUM(
+				CASE 
+					WHEN organism_quantity ~ '^[0-9]+$' THEN organism_quantity::INTEGER
+					ELSE 1
+				END
+			), 0) as total_amount,
+			COUNT(*) as event_count,
+			NOW() as created_at,
+			NOW() as updated_at
+		FROM biological_data
+		LEFT JOIN taxon_activity ta ON ta.scientific_name = COALESCE(biological_data.accepted_name, biological_data.scientific_name)
+		WHERE event_date IS NOT NULL 
+			AND EXTRACT(YEAR FROM event_date AT TIME ZONE 'Asia/Taipei') IS NOT NULL
+			AND EXTRACT(MONTH FROM event_date AT TIME ZONE 'Asia/Taipei') BETWEEN 1 AND 12
+		GROUP BY 
+			COALESCE(county, 'Unknown'),
+			COALESCE(bio_group, 'Unknown'),
+			COALESCE(ta.activity_period, 'unknown'),
+			EXTRACT(YEAR FROM event_date AT TIME ZONE 'Asia/Taipei'),
+			EXTRACT(MONTH FROM event_date AT TIME ZONE 'Asia/Taipei')
+		ORDER BY year, month, county, animal_type, activity_period
+	`
+
+	postgresDatasetStatsAggregationQuery = `
+		INSERT INTO dataset_stats_aggregated 
+		(dataset, county, year, month, count, created_at, updated_at)
+		SELECT 
+			COALESCE(dataset_name, 'Unknown') as dataset,
+			COALESCE(county, 'Unknown') as county,
+			EXTRACT(YEAR FROM event_date AT TIME ZONE 'Asia/Taipei')::INTEGER as year,
+			EXTRACT(MONTH FROM event_date AT TIME ZONE 'Asia/Taipei')::INTEGER as month,
+			COUNT(*) as count,
+			NOW() as created_at,
+			NOW() as updated_at
+		FROM biological_data 
+		WHERE event_date IS NOT NULL 
+			AND EXTRACT(YEAR FROM event_date AT TIME ZONE 'Asia/Taipei') IS NOT NULL
+			AND EXTRACT(MONTH FROM event_date AT TIME ZONE 'Asia/Taipei') BETWEEN 1 AND 12
+		GROUP BY 
+			COALESCE(dataset_name, 'Unknown'),
+			COALESCE(county, 'Unknown'),
+			EXTRACT(YEAR FROM event_date AT TIME ZONE 'Asia/Taipei'),
+			EXTRACT(MONTH FROM event_date AT TIME ZONE 'Asia/Taipei')
+		ORDER BY year, month, dataset, county
+	`
+
+	postgresSamplingEffortAggregationQuery = `
+		INSERT INTO sampling_effort_aggregated
+		(county, year, month, season, dataset_count, observation_days, locality_count, event_count, created_at, updated_at)
+		SELECT
+			COALESCE(county, 'Unknown') as county,
+			EXTRACT(YEAR FROM event_date AT TIME ZONE 'Asia/Taipei')::INTEGER as year,
+			EXTRACT(MONTH FROM event_date AT TIME ZONE 'Asia/Taipei')::INTEGER as month,
+			CASE
+				WHEN EXTRACT(MONTH FROM event_date AT TIME ZONE 'Asia/Taipei') BETWEEN 3 AND 5 THEN 1
+				WHEN EXTRACT(MONTH FROM event_date AT TIME ZONE 'Asia/Taipei') BETWEEN 6 AND 8 THEN 2
+				WHEN EXTRACT(MONTH FROM event_date AT TIME ZONE 'Asia/Taipei') BETWEEN 9 AND 11 THEN 3
+				ELSE 4
+			END as season,
+			COUNT(DISTINCT dataset_name) as dataset_count,
+			COUNT(DISTINCT (event_date AT TIME ZONE 'Asia/Taipei')::DATE) as observation_days,
+			-- A locality is its name, or its coordinates to about 100 m when unnamed
+			COUNT(DISTINCT COALESCE(
+				NULLIF(TRIM(locality), ''),
+				ROUND(standard_longitude::NUMERIC, 3)::TEXT || ',' || ROUND(standard_latitude::NUMERIC, 3)::TEXT
+			)) as locality_count,
+			COUNT(*) as event_count,
+			NOW() as created_at,
+			NOW() as updated_at
+		FROM biological_data
+		WHERE event_date IS NOT NULL
+			AND EXTRACT(YEAR FROM event_date AT TIME ZONE 'Asia/Taipei') IS NOT NULL
+			AND EXTRACT(MONTH FROM event_date AT TIME ZONE 'Asia/Taipei') BETWEEN 1 AND 12
+		GROUP BY
+			COALESCE(county, 'Unknown'),
+			EXTRACT(YEAR FROM event_date AT TIME ZONE 'Asia/Taipei'),
+			EXTRACT(MONTH FROM event_date AT TIME ZONE 'Asia/Taipei')
+		ORDER BY year, month, county
+	`
+)
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"math"
+	"sort"
+)
+
+// Minimal Mapbox Vector Tile 2.1 encoder, see https://github.com/mapbox/vector-tile-spec
+
+const (
+	mvtExtent = 4096
+
+	mvtGeomPoint   = 1
+	mvtGeomPolygon = 3
+
+	mvtCmdMoveTo    = 1
+	mvtCmdLineTo    = 2
+	mvtCmdClosePath = 7
+)
+
+// mvtFeature is an encoded feature waiting to be written into its layer
+type mvtFeature struct {
+	id       uint64
+	geomType uint32
+	tags     []uint32
+	geometry []uint32
+}
+
+// mvtLayer collects features and deduplicates property keys and values
+type mvtLayer struct {
+	name       string
+	features   []mvtFeature
+	keys       []string
+	keyIndex   map[string]uint32
+	values     []interface{}
+	valueIndex map[interface{}]uint32
+}
+
+func newMVTLayer(name string) *mvtLayer {
+	return &mvtLayer{
+		name:       name,
+		keyIndex:   make(map[string]uint32),
+		valueIndex: make(map[interface{}]uint32),
+	}
+}
+
+// addPoint adds a point feature at tile coordinates
+func (l *mvtLayer) addPoint(id uint64, x, y int32, props map[string]interface{}) {
+	geometry := []uint32{mvtCommand(mvtCmdMoveTo, 1), zigzag(x), zigzag(y)}
+	l.addFeature(id, mvtGeomPoint, geometry, props)
+}
+
+// addRectangle adds a polygon feature for the tile-coordinate rectangle [x0,x1]×[y0,y1]
+func (l *mvtLayer) addRectangle(id uint64, x0, y0, x1, y1 int32, props map[string]interface{}) {
+	if x1 <= x0 {
+		x1 = x0 + 1
+	}
+	if y1 <= y0 {
+		y1 = y0 + 1
+	}
+
+	// Exterior rings must be clockwise in tile coordinates, where y points down
+	width, height := x1-x0, y1-y0
+	geometry := []uint32{
+		mvtCommand(mvtCmdMoveTo, 1), zigzag(x0), zigzag(y0),
+		mvtCommand(mvtCmdLineTo, 3),
+		zigzag(width), zigzag(0),
+		zigzag(0), zigzag(height),
+		zigzag(-width), zigzag(0),
+		mvtCommand(mvtCmdClosePath, 1),
+	}
+	l.addFeature(id, mvtGeomPolygon, geometry, props)
+}
+
+func (l *mvtLayer) addFeature(id uint64, geomType uint32, geometry []uint32, props map[string]interface{}) {
+	names := make([]string, 0, len(props))
+	for name := range props {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	tags := make([]uint32, 0, len(props)*2)
+	for _, name := range names {
+		value := normalizeMVTValue(props[name])
+		if value == nil {
+			continue
+		}
+		tags = append(tags, l.key(name), l.value(value))
+	}
+
+	l.features = append(l.features, mvtFeature{id: id, geomType: geomType, tags: tags, geometry: geometry})
+}
+
+func (l *mvtLayer) key(name string) uint32 {
+	if i, ok := l.keyIndex[name]; ok {
+		return i
+	}
+	i := uint32(len(l.keys))
+	l.keys = append(l.keys, name)
+	l.keyIndex[name] = i
+	return i
+}
+
+func (l *mvtLayer) value(v interface{}) uint32 {
+	if i, ok := l.valueIndex[v]; ok {
+		return i
+	}
+	i := uint32(len(l.values))
+	l.values = append(l.values, v)
+	l.valueIndex[v] = i
+	return i
+}
+
+// normalizeMVTValue maps property values onto the types the encoder supports, nil drops the property
+func normalizeMVTValue(v interface{}) interface{} {
+	switch value := v.(type) {
+	case string:
+		return value
+	case float64:
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			return nil
+		}
+		return value
+	case int:
+		return int64(value)
+	case int64:
+		return value
+	case bool:
+		return value
+	}
+	return nil
+}
+
+// encodeMVT serializes layers into a vector tile; empty layers are omitted
+func encodeMVT(layers ...*mvtLayer) []byte {
+	var tile []byte
+	for _, layer := range layers {
+		if len(layer.features) == 0 {
+			continue
+		}
+		tile = appendBytesField(tile, 3, layer.encode())
+	}
+	return tile
+}
+
+func (l *mvtLayer) encode() []byte {
+	var buf []byte
+	buf = appendVarintField(buf, 15, 2) // version
+	buf = appendBytesField(buf, 1, []byte(l.name))
+
+	for _, feature := range l.features {
+		var f []byte
+		if feature.id != 0 {
+			f = appendVarintField(f, 1, feature.id)
+		}
+		if len(feature.tags) > 0 {
+			f = appendPackedField(f, 2, feature.tags)
+		}
+		f = appendVarintField(f, 3, uint64(feature.geomType))
+		f = appendPackedField(f, 4, feature.geometry)
+		buf = appendBytesField(buf, 2, f)
+	}
+
+	for _, key := range l.keys {
+		buf = appendBytesField(buf, 3, []byte(key))
+	}
+
+	for _, value := range l.values {
+		var v []byte
+		switch typed := value.(type) {
+		case string:
+			v = appendBytesField(v, 1, []byte(typed))
+		case float64:
+			v = appendTag(v, 3, 1)
+			bits := math.Float64bits(typed)
+			for i := 0; i < 8; i++ {
+				v = append(v, byte(bits>>(8*i)))
+			}
+		case int64:
+			v = appendVarintField(v, 6, uint64((typed<<1)^(typed>>63)))
+		case bool:
+			b := uint64(0)
+			if typed {
+				b = 1
+			}
+			v = appendVarintField(v, 7, b)
+		}
+		buf = appendBytesField(buf, 4, v)
+	}
+
+	buf = appendVarintField(buf, 5, mvtExtent)
+	return buf
+}
+
+func mvtCommand(id, count uint32) uint32 {
+	return (id & 0x7) | (count << 3)
+}
+
+func zigzag(n int32) uint32 {
+	return uint32((n << 1) ^ (n >> 31))
+}
+
+func appendVarint(buf []byte, v uint64) []byte {
+	for v >= 0x80 {
+		buf = append(buf, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(buf, byte(v))
+}
+
+func appendTag(buf []byte, field, wireType uint64) []byte {
+	return appendVarint(buf, field<<3|wireType)
+}
+
+func appendVarintField(buf []byte, field, v uint64) []byte {
+	return appendVarint(appendTag(buf, field, 0), v)
+}
+
+func appendBytesField(buf []byte, field uint64, data []byte) []byte {
+	buf = appendVarint(appendTag(buf, field, 2), uint64(len(data)))
+	return append(buf, data...)
+}
+
+func appendPackedField(buf []byte, field uint64, values []uint32) []byte {
+	var packed []byte
+	for _, v := range values {
+		packed = appendVarint(packed, uint64(v))
+	}
+	return appendBytesField(buf, field, packed)
+}
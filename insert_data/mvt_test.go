@@ -0,0 +1,241 @@
+package main
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+// pbField is one decoded protocol buffer field: a varint, a fixed64 or a length-delimited payload
+type pbField struct {
+	number uint64
+	varint uint64
+	bytes  []byte
+}
+
+// decodePB splits a protocol buffer message into its fields, failing the test on malformed input
+func decodePB(t *testing.T, buf []byte) []pbField {
+	t.Helper()
+	var fields []pbField
+	for len(buf) > 0 {
+		tag, n := binary.Uvarint(buf)
+		if n <= 0 {
+			t.Fatalf("bad tag varint in % x", buf)
+		}
+		buf = buf[n:]
+		field := pbField{number: tag >> 3}
+		switch tag & 7 {
+		case 0:
+			field.varint, n = binary.Uvarint(buf)
+			if n <= 0 {
+				t.Fatalf("bad varint in field %d", field.number)
+			}
+			buf = buf[n:]
+		case 1:
+			if len(buf) < 8 {
+				t.Fatalf("short fixed64 in field %d", field.number)
+			}
+			field.varint = binary.LittleEndian.Uint64(buf)
+			buf = buf[8:]
+		case 2:
+			length, n := binary.Uvarint(buf)
+			if n <= 0 || uint64(len(buf)-n) < length {
+				t.Fatalf("bad length in field %d", field.number)
+			}
+			field.bytes = buf[n : n+int(length)]
+			buf = buf[n+int(length):]
+		default:
+			t.Fatalf("unexpected wire type %d in field %d", tag&7, field.number)
+		}
+		fields = append(fields, field)
+	}
+	return fields
+}
+
+// decodePacked reads a packed repeated uint32 field
+func decodePacked(t *testing.T, buf []byte) []uint32 {
+	t.Helper()
+	var values []uint32
+	for len(buf) > 0 {
+		v, n := binary.Uvarint(buf)
+		if n <= 0 {
+			t.Fatalf("bad packed varint in % x", buf)
+		}
+		values = append(values, uint32(v))
+		buf = buf[n:]
+	}
+	return values
+}
+
+func unzigzag(v uint32) int32 {
+	return int32(v>>1) ^ -int32(v&1)
+}
+
+// decodedLayer is the content of an encoded layer, with feature properties resolved through keys and values
+type decodedLayer struct {
+	name     string
+	version  uint64
+	extent   uint64
+	features []decodedFeature
+}
+
+type decodedFeature struct {
+	id       uint64
+	geomType uint64
+	geometry []uint32
+	props    map[string]interface{}
+}
+
+func decodeLayer(t *testing.T, buf []byte) decodedLayer {
+	t.Helper()
+	var layer decodedLayer
+	var keys []string
+	var values []interface{}
+	var rawFeatures [][]byte
+	for _, field := range decodePB(t, buf) {
+		switch field.number {
+		case 15:
+			layer.version = field.varint
+		case 1:
+			layer.name = string(field.bytes)
+		case 2:
+			rawFeatures = append(rawFeatures, field.bytes)
+		case 3:
+			keys = append(keys, string(field.bytes))
+		case 4:
+			value := decodePB(t, field.bytes)
+			if len(value) != 1 {
+				t.Fatalf("value with %d fields", len(value))
+			}
+			switch v := value[0]; v.number {
+			case 1:
+				values = append(values, string(v.bytes))
+			case 3:
+				values = append(values, math.Float64frombits(v.varint))
+			case 6:
+				values = append(values, int64(v.varint>>1)^-int64(v.varint&1))
+			case 7:
+				values = append(values, v.varint == 1)
+			default:
+				t.Fatalf("unexpected value type %d", v.number)
+			}
+		case 5:
+			layer.extent = field.varint
+		}
+	}
+
+	for _, raw := range rawFeatures {
+		feature := decodedFeature{props: make(map[string]interface{})}
+		for _, field := range decodePB(t, raw) {
+			switch field.number {
+			case 1:
+				feature.id = field.varint
+			case 2:
+				tags := decodePacked(t, field.bytes)
+				if len(tags)%2 != 0 {
+					t.Fatalf("odd number of tags %v", tags)
+				}
+				for i := 0; i < len(tags); i += 2 {
+					if int(tags[i]) >= len(keys) || int(tags[i+1]) >= len(values) {
+						t.Fatalf("tag %v out of range", tags[i:i+2])
+					}
+					feature.props[keys[tags[i]]] = values[tags[i+1]]
+				}
+			case 3:
+				feature.geomType = field.varint
+			case 4:
+				feature.geometry = decodePacked(t, field.bytes)
+			}
+		}
+		layer.features = append(layer.features, feature)
+	}
+	return layer
+}
+
+func TestMVTPrimitives(t *testing.T) {
+	for _, n := range []int32{0, -1, 1, -2, 2, 4095, -4096, math.MaxInt32, math.MinInt32} {
+		if got := unzigzag(zigzag(n)); got != n {
+			t.Errorf("zigzag(%d) does not round-trip: %d", n, got)
+		}
+	}
+	if zigzag(-1) != 1 || zigzag(1) != 2 {
+		t.Errorf("zigzag(-1), zigzag(1) = %d, %d, want 1, 2", zigzag(-1), zigzag(1))
+	}
+	if got := mvtCommand(mvtCmdLineTo, 3); got != 26 {
+		t.Errorf("LineTo(3) = %d, want 26", got)
+	}
+	if got := appendVarint(nil, 300); len(got) != 2 || got[0] != 0xac || got[1] != 0x02 {
+		t.Errorf("varint 300 = % x, want ac 02", got)
+	}
+}
+
+func TestEncodeMVT(t *testing.T) {
+	light := newMVTLayer("light")
+	light.addRectangle(7, 10, 20, 110, 70, map[string]interface{}{"brightness": 12.5, "count": 3, "county": "臺北市"})
+	light.addRectangle(8, 5, 5, 5, 5, map[string]interface{}{"brightness": math.NaN(), "county": "臺北市", "ok": true})
+	occurrences := newMVTLayer("occurrences")
+	empty := newMVTLayer("empty")
+	occurrences.addPoint(0, -3, 4100, map[string]interface{}{"count": int64(-2), "ignored": []int{1}})
+
+	tile := decodePB(t, encodeMVT(light, empty, occurrences))
+	if len(tile) != 2 {
+		t.Fatalf("tile has %d layers, want 2 without the empty one", len(tile))
+	}
+	for _, field := range tile {
+		if field.number != 3 {
+			t.Fatalf("tile field %d, want only layers (3)", field.number)
+		}
+	}
+
+	layer := decodeLayer(t, tile[0].bytes)
+	if layer.name != "light" || layer.version != 2 || layer.extent != mvtExtent || len(layer.features) != 2 {
+		t.Fatalf("light layer = %+v", layer)
+	}
+
+	rect := layer.features[0]
+	if rect.id != 7 || rect.geomType != mvtGeomPolygon {
+		t.Errorf("rectangle id %d type %d, want 7 and a polygon", rect.id, rect.geomType)
+	}
+	// MoveTo(10,20), LineTo +100,0 0,+50 -100,0, ClosePath: clockwise with y pointing down
+	want := []uint32{
+		mvtCommand(mvtCmdMoveTo, 1), zigzag(10), zigzag(20),
+		mvtCommand(mvtCmdLineTo, 3), zigzag(100), 0, 0, zigzag(50), zigzag(-100), 0,
+		mvtCommand(mvtCmdClosePath, 1),
+	}
+	if len(rect.geometry) != len(want) {
+		t.Fatalf("rectangle geometry %v, want %v", rect.geometry, want)
+	}
+	for i := range want {
+		if rect.geometry[i] != want[i] {
+			t.Fatalf("rectangle geometry %v, want %v", rect.geometry, want)
+		}
+	}
+	if rect.props["brightness"] != 12.5 || rect.props["count"] != int64(3) || rect.props["county"] != "臺北市" {
+		t.Errorf("rectangle properties %v", rect.props)
+	}
+
+	// A degenerate rectangle still gets an area, NaN is dropped and the repeated county shares its value
+	degenerate := layer.features[1]
+	if dx, dy := unzigzag(degenerate.geometry[4]), unzigzag(degenerate.geometry[7]); dx != 1 || dy != 1 {
+		t.Errorf("degenerate rectangle is %d×%d, want 1×1", dx, dy)
+	}
+	if _, ok := degenerate.props["brightness"]; ok || degenerate.props["ok"] != true || degenerate.props["county"] != "臺北市" {
+		t.Errorf("degenerate rectangle properties %v", degenerate.props)
+	}
+	if len(light.values) != 4 {
+		t.Errorf("light layer stores %d values, want 4 distinct ones", len(light.values))
+	}
+
+	layer = decodeLayer(t, tile[1].bytes)
+	if layer.name != "occurrences" || len(layer.features) != 1 {
+		t.Fatalf("occurrences layer = %+v", layer)
+	}
+	point := layer.features[0]
+	if point.id != 0 || point.geomType != mvtGeomPoint || len(point.geometry) != 3 ||
+		point.geometry[0] != mvtCommand(mvtCmdMoveTo, 1) || unzigzag(point.geometry[1]) != -3 || unzigzag(point.geometry[2]) != 4100 {
+		t.Errorf("point feature %+v", point)
+	}
+	if len(point.props) != 1 || point.props["count"] != int64(-2) {
+		t.Errorf("point properties %v, want only count -2", point.props)
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"runtime"
+	"sync"
+)
+
+// ParallelAggregator aggregates a LightDataSource across goroutines.
+// Mapper goroutines pre-combine each chunk into partial accumulators, which are routed by grid cell
+// to shard goroutines that own disjoint parts of the result, so no locking is needed while merging.
+type ParallelAggregator struct {
+	aggregator *DataAggregator
+	mappers    int
+	shards     int
+	chunkSize  int
+}
+
+// NewParallelAggregator creates a parallel aggregator; workers <= 0 uses one mapper and one shard per CPU
+func NewParallelAggregator(config *AggregationConfig, workers int) (*ParallelAggregator, error) {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	aggregator, err := NewDataAggregator(config)
+	if err != nil {
+		return nil, err
+	}
+	return &ParallelAggregator{
+		aggregator: aggregator,
+		mappers:    workers,
+		shards:     workers,
+		chunkSize:  10000,
+	}, nil
+}
+
+// partialAggregates holds the accumulators of one chunk destined for one shard
+type partialAggregates map[aggregationKey]*AggregationAccumulator
+
+// shardFor routes a key to a shard by grid cell, so every time bucket of a cell lands on the same shard
+func (pa *ParallelAggregator) shardFor(key aggregationKey) int {
+	h := math.Float64bits(key.GridLongitude)*0x9E3779B97F4A7C15 ^ math.Float64bits(key.GridLatitude)
+	h ^= h >> 33
+	h *= 0xFF51AFD7ED558CCD
+	h ^= h >> 33
+	return int(h % uint64(pa.shards))
+}
+
+// Aggregate reads the source to the end and returns the merged aggregates.
+// Only the aggregates and a few in-flight chunks are held in memory.
+func (pa *ParallelAggregator) Aggregate(ctx context.Context, source LightDataSource) ([]AggregatedLightData, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		errOnce  sync.Once
+		firstErr error
+	)
+	fail := func(err error) {
+		errOnce.Do(func() {
+			firstErr = err
+			cancel()
+		})
+	}
+
+	chunks := make(chan []LightData, pa.mappers)
+	shardChans := make([]chan partialAggregates, pa.shards)
+	shardResults := make([]partialAggregates, pa.shards)
+
+	// Shard reducers merge partial accumulators for the cells they own
+	var shardWg sync.WaitGroup
+	for i := range shardChans {
+		shardChans[i] = make(chan partialAggregates, pa.mappers)
+		shardResults[i] = make(partialAggregates)
+		shardWg.Add(1)
+		go func(shard int) {
+			defer shardWg.Done()
+			owned := shardResults[shard]
+			for partial := range shardChans[shard] {
+				for key, acc := range partial {
+					if existing, ok := owned[key]; ok {
+						existing.Merge(acc)
+					} else {
+						owned[key] = acc
+					}
+				}
+			}
+		}(i)
+	}
+
+	// Mappers filter, snap and pre-combine each chunk
+	var mapperWg sync.WaitGroup
+	for i := 0; i < pa.mappers; i++ {
+		mapperWg.Add(1)
+		go func() {
+			defer mapperWg.Done()
+			for chunk := range chunks {
+				partials := make([]partialAggregates, pa.shards)
+				excluded := make(map[ExclusionReason]int64)
+				for _, point := range chunk {
+					// Count exclusions per chunk to keep the shared counters off the hot path
+					if reason := pa.aggregator.exclusionReason(point); reason != "" {
+						excluded[reason]++
+						continue
+					}
+					key := pa.aggregator.keyFor(point)
+					shard := pa.shardFor(key)
+					if partials[shard] == nil {
+						partials[shard] = make(partialAggregates)
+					}
+					acc, ok := partials[shard][key]
+					if !ok {
+						acc = &AggregationAccumulator{}
+						partials[shard][key] = acc
+					}
+					acc.Add(point.Brightness)
+				}
+				pa.aggregator.exclusions.Merge(excluded)
+
+				for shard, partial := range partials {
+					if partial == nil {
+						continue
+					}
+					select {
+					case shardChans[shard] <- partial:
+					case <-ctx.Done():
+						return
+					}
+				}
+			}
+		}()
+	}
+
+	// Sources are not safe for concurrent use, so a single reader feeds the mappers
+	go func() {
+		defer close(chunks)
+		for {
+			chunk := make([]LightData, pa.chunkSize)
+			n, err := source.Read(chunk)
+			if n > 0 {
+				select {
+				case chunks <- chunk[:n]:
+				case <-ctx.Done():
+					return
+				}
+			}
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				fail(fmt.Errorf("error reading light data source: %v", err))
+				return
+			}
+		}
+	}()
+
+	mapperWg.Wait()
+	for _, ch := range shardChans {
+		close(ch)
+	}
+	shardWg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	total := 0
+	for _, owned := range shardResults {
+		total += len(owned)
+	}
+	results := make([]AggregatedLightData, 0, total)
+	for _, owned := range shardResults {
+		for key, acc := range owned {
+			results = append(results, pa.aggregator.resultFor(key, acc))
+		}
+	}
+	return results, nil
+}
+
+// Exclusions returns the number of points filtered out per reason so far
+func (pa *ParallelAggregator) Exclusions() map[ExclusionReason]int64 {
+	return pa.aggregator.Exclusions()
+}
@@ -0,0 +1,450 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// Minimal streaming GeoParquet writer: uncompressed, PLAIN-encoded data pages, one page per column
+// chunk, WKB point geometries. See https://parquet.apache.org/docs/file-format/ and https://geoparquet.org
+
+const (
+	parquetMagic         = "PAR1"
+	parquetRowGroupSize  = 50000
+	parquetCreatedBy     = "insertdata export"
+	parquetGeometryField = "geometry"
+)
+
+// parquet physical types
+const (
+	parquetInt64     = 2
+	parquetDouble    = 5
+	parquetByteArray = 6
+)
+
+// parquet converted types
+const (
+	parquetConvertedUTF8            = 0
+	parquetConvertedTimestampMicros = 10
+)
+
+// ParquetColumnKind is the logical type of an exported column
+type ParquetColumnKind int
+
+const (
+	ParquetString ParquetColumnKind = iota
+	ParquetFloat
+	ParquetInt
+	ParquetTimestamp
+	parquetGeometry
+)
+
+// ParquetColumn describes one optional column of a GeoParquet file
+type ParquetColumn struct {
+	Name string
+	Kind ParquetColumnKind
+}
+
+func (c ParquetColumn) physicalType() int32 {
+	switch c.Kind {
+	case ParquetFloat:
+		return parquetDouble
+	case ParquetInt, ParquetTimestamp:
+		return parquetInt64
+	}
+	return parquetByteArray
+}
+
+// parquetColumnBuffer accumulates one row group of a column
+type parquetColumnBuffer struct {
+	defLevels []bool
+	values    []byte
+}
+
+// GeoParquetWriter streams rows into row groups and writes the footer on Close
+type GeoParquetWriter struct {
+	out       *bufio.Writer
+	offset    int64
+	columns   []ParquetColumn
+	buffers   []parquetColumnBuffer
+	pending   int
+	numRows   int64
+	rowGroups [][]parquetChunkMeta
+	groupRows []int64
+	bbox      [4]float64
+	hasBBox   bool
+}
+
+type parquetChunkMeta struct {
+	offset int64
+	size   int64
+	values int64
+}
+
+// NewGeoParquetWriter writes a GeoParquet file with the given attribute columns and a point geometry column
+func NewGeoParquetWriter(w io.Writer, columns []ParquetColumn) (*GeoParquetWriter, error) {
+	all := append(append([]ParquetColumn{}, columns...), ParquetColumn{Name: parquetGeometryField, Kind: parquetGeometry})
+	pw := &GeoParquetWriter{
+		out:     bufio.NewWriterSize(w, 1<<20),
+		columns: all,
+		buffers: make([]parquetColumnBuffer, len(all)),
+	}
+	if err := pw.write([]byte(parquetMagic)); err != nil {
+		return nil, err
+	}
+	return pw, nil
+}
+
+func (pw *GeoParquetWriter) write(data []byte) error {
+	n, err := pw.out.Write(data)
+	pw.offset += int64(n)
+	return err
+}
+
+// WriteRow appends one row; values follow the column order and nil marks a null.
+// Strings are string, floats float64, ints int64 and timestamps time.Time.
+func (pw *GeoParquetWriter) WriteRow(values []interface{}, longitude, latitude *float64) error {
+	if len(values) != len(pw.columns)-1 {
+		return fmt.Errorf("expected %d values, got %d", len(pw.columns)-1, len(values))
+	}
+
+	for i, value := range values {
+		if err := pw.buffers[i].append(pw.columns[i].Kind, value); err != nil {
+			return fmt.Errorf("column %s: %v", pw.columns[i].Name, err)
+		}
+	}
+
+	geometry := &pw.buffers[len(pw.buffers)-1]
+	if longitude != nil && latitude != nil {
+		geometry.append(parquetGeometry, wkbPoint(*longitude, *latitude))
+		pw.extendBBox(*longitude, *latitude)
+	} else {
+		geometry.append(parquetGeometry, nil)
+	}
+
+	pw.pending++
+	if pw.pending >= parquetRowGroupSize {
+		return pw.flushRowGroup()
+	}
+	return nil
+}
+
+func (pw *GeoParquetWriter) extendBBox(longitude, latitude float64) {
+	if !pw.hasBBox {
+		pw.bbox = [4]float64{longitude, latitude, longitude, latitude}
+		pw.hasBBox = true
+		return
+	}
+	pw.bbox[0] = math.Min(pw.bbox[0], longitude)
+	pw.bbox[1] = math.Min(pw.bbox[1], latitude)
+	pw.bbox[2] = math.Max(pw.bbox[2], longitude)
+	pw.bbox[3] = math.Max(pw.bbox[3], latitude)
+}
+
+func (b *parquetColumnBuffer) append(kind ParquetColumnKind, value interface{}) error {
+	if value == nil {
+		b.defLevels = append(b.defLevels, false)
+		return nil
+	}
+
+	switch kind {
+	case ParquetString:
+		s, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("expected string, got %T", value)
+		}
+		b.values = binary.LittleEndian.AppendUint32(b.values, uint32(len(s)))
+		b.values = append(b.values, s...)
+	case parquetGeometry:
+		wkb := value.([]byte)
+		b.values = binary.LittleEndian.AppendUint32(b.values, uint32(len(wkb)))
+		b.values = append(b.values, wkb...)
+	case ParquetFloat:
+		f, ok := value.(float64)
+		if !ok {
+			return fmt.Errorf("expected float64, got %T", value)
+		}
+		b.values = binary.LittleEndian.AppendUint64(b.values, math.Float64bits(f))
+	case ParquetInt:
+		i, ok := value.(int64)
+		if !ok {
+			return fmt.Errorf("expected int64, got %T", value)
+		}
+		b.values = binary.LittleEndian.AppendUint64(b.values, uint64(i))
+	case ParquetTimestamp:
+		t, ok := value.(time.Time)
+		if !ok {
+			return fmt.Errorf("expected time.Time, got %T", value)
+		}
+		b.values = binary.LittleEndian.AppendUint64(b.values, uint64(t.UnixMicro()))
+	}
+	b.defLevels = append(b.defLevels, true)
+	return nil
+}
+
+// wkbPoint encodes a little-endian WKB point
+func wkbPoint(longitude, latitude float64) []byte {
+	wkb := make([]byte, 0, 21)
+	wkb = append(wkb, 1)
+	wkb = binary.LittleEndian.AppendUint32(wkb, 1)
+	wkb = binary.LittleEndian.AppendUint64(wkb, math.Float64bits(longitude))
+	wkb = binary.LittleEndian.AppendUint64(wkb, math.Float64bits(latitude))
+	return wkb
+}
+
+// encodeDefinitionLevels writes bit-width-1 levels as RLE runs prefixed with their byte length
+func encodeDefinitionLevels(levels []bool) []byte {
+	var runs []byte
+	for i := 0; i < len(levels); {
+		j := i
+		for j < len(levels) && levels[j] == levels[i] {
+			j++
+		}
+		runs = appendVarint(runs, uint64(j-i)<<1)
+		if levels[i] {
+			runs = append(runs, 1)
+		} else {
+			runs = append(runs, 0)
+		}
+		i = j
+	}
+	return append(binary.LittleEndian.AppendUint32(nil, uint32(len(runs))), runs...)
+}
+
+// flushRowGroup writes the buffered rows as one row group
+func (pw *GeoParquetWriter) flushRowGroup() error {
+	if pw.pending == 0 {
+		return nil
+	}
+
+	chunks := make([]parquetChunkMeta, len(pw.columns))
+	for i := range pw.columns {
+		buffer := &pw.buffers[i]
+		page := append(encodeDefinitionLevels(buffer.defLevels), buffer.values...)
+
+		var header thriftWriter
+		header.fieldI32(1, 0) // DATA_PAGE
+		header.fieldI32(2, int32(len(page)))
+		header.fieldI32(3, int32(len(page)))
+		header.fieldStructBegin(5)
+		header.fieldI32(1, int32(len(buffer.defLevels)))
+		header.fieldI32(2, 0) // PLAIN
+		header.fieldI32(3, 3) // RLE
+		header.fieldI32(4, 3) // RLE
+		header.structEnd()
+		header.structEnd()
+
+		start := pw.offset
+		if err := pw.write(header.buf); err != nil {
+			return err
+		}
+		if err := pw.write(page); err != nil {
+			return err
+		}
+		chunks[i] = parquetChunkMeta{offset: start, size: pw.offset - start, values: int64(len(buffer.defLevels))}
+
+		buffer.defLevels = buffer.defLevels[:0]
+		buffer.values = buffer.values[:0]
+	}
+
+	pw.rowGroups = append(pw.rowGroups, chunks)
+	pw.groupRows = append(pw.groupRows, int64(pw.pending))
+	pw.numRows += int64(pw.pending)
+	pw.pending = 0
+	return nil
+}
+
+// geoMetadata builds the GeoParquet "geo" file metadata
+func (pw *GeoParquetWriter) geoMetadata() (string, error) {
+	column := map[string]interface{}{
+		"encoding":       "WKB",
+		"geometry_types": []string{"Point"},
+	}
+	if pw.hasBBox {
+		column["bbox"] = pw.bbox[:]
+	}
+	geo := map[string]interface{}{
+		"version":        "1.0.0",
+		"primary_column": parquetGeometryField,
+		"columns":        map[string]interface{}{parquetGeometryField: column},
+	}
+	data, err := json.Marshal(geo)
+	return string(data), err
+}
+
+// Close flushes the last row group and writes the footer
+func (pw *GeoParquetWriter) Close() error {
+	if err := pw.flushRowGroup(); err != nil {
+		return err
+	}
+
+	geo, err := pw.geoMetadata()
+	if err != nil {
+		return fmt.Errorf("error encoding geo metadata: %v", err)
+	}
+
+	var meta thriftWriter
+	meta.fieldI32(1, 1) // version
+
+	// Schema: a root group followed by one optional leaf per column
+	meta.fieldListBegin(2, thriftStruct, len(pw.columns)+1)
+	meta.structBegin()
+	meta.fieldString(4, "schema")
+	meta.fieldI32(5, int32(len(pw.columns)))
+	meta.structEnd()
+	for _, column := range pw.columns {
+		meta.structBegin()
+		meta.fieldI32(1, column.physicalType())
+		meta.fieldI32(3, 1) // OPTIONAL
+		meta.fieldString(4, column.Name)
+		switch column.Kind {
+		case ParquetString:
+			meta.fieldI32(6, parquetConvertedUTF8)
+		case ParquetTimestamp:
+			meta.fieldI32(6, parquetConvertedTimestampMicros)
+		}
+		meta.structEnd()
+	}
+
+	meta.fieldI64(3, pw.numRows)
+
+	meta.fieldListBegin(4, thriftStruct, len(pw.rowGroups))
+	for g, chunks := range pw.rowGroups {
+		var totalSize int64
+		meta.structBegin()
+		meta.fieldListBegin(1, thriftStruct, len(chunks))
+		for i, chunk := range chunks {
+			totalSize += chunk.size
+			meta.structBegin()
+			meta.fieldI64(2, chunk.offset)
+			meta.fieldStructBegin(3)
+			meta.fieldI32(1, pw.columns[i].physicalType())
+			meta.fieldListBegin(2, thriftI32, 2)
+			meta.writeI32(0) // PLAIN
+			meta.writeI32(3) // RLE
+			meta.fieldListBegin(3, thriftBinary, 1)
+			meta.writeString(pw.columns[i].Name)
+			meta.fieldI32(4, 0) // UNCOMPRESSED
+			meta.fieldI64(5, chunk.values)
+			meta.fieldI64(6, chunk.size)
+			meta.fieldI64(7, chunk.size)
+			meta.fieldI64(9, chunk.offset)
+			meta.structEnd()
+			meta.structEnd()
+		}
+		meta.fieldI64(2, totalSize)
+		meta.fieldI64(3, pw.groupRows[g])
+		meta.structEnd()
+	}
+
+	meta.fieldListBegin(5, thriftStruct, 1)
+	meta.structBegin()
+	meta.fieldString(1, "geo")
+	meta.fieldString(2, geo)
+	meta.structEnd()
+
+	meta.fieldString(6, parquetCreatedBy)
+	meta.structEnd()
+
+	if err := pw.write(meta.buf); err != nil {
+		return err
+	}
+	if err := pw.write(binary.LittleEndian.AppendUint32(nil, uint32(len(meta.buf)))); err != nil {
+		return err
+	}
+	if err := pw.write([]byte(parquetMagic)); err != nil {
+		return err
+	}
+	return pw.out.Flush()
+}
+
+// thrift compact protocol types
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// thriftWriter encodes the subset of the Thrift compact protocol used by Parquet metadata
+type thriftWriter struct {
+	buf       []byte
+	lastField []int16
+	current   int16
+}
+
+func (t *thriftWriter) fieldHeader(id int16, fieldType byte) {
+	delta := id - t.current
+	if delta > 0 && delta <= 15 {
+		t.buf = append(t.buf, byte(delta)<<4|fieldType)
+	} else {
+		t.buf = append(t.buf, fieldType)
+		t.buf = appendVarint(t.buf, uint64(zigzag(int32(id))))
+	}
+	t.current = id
+}
+
+func (t *thriftWriter) writeI32(v int32) {
+	t.buf = appendVarint(t.buf, uint64(zigzag(v)))
+}
+
+func (t *thriftWriter) writeI64(v int64) {
+	t.buf = appendVarint(t.buf, uint64((v<<1)^(v>>63)))
+}
+
+func (t *thriftWriter) writeString(s string) {
+	t.buf = appendVarint(t.buf, uint64(len(s)))
+	t.buf = append(t.buf, s...)
+}
+
+func (t *thriftWriter) fieldI32(id int16, v int32) {
+	t.fieldHeader(id, thriftI32)
+	t.writeI32(v)
+}
+
+func (t *thriftWriter) fieldI64(id int16, v int64) {
+	t.fieldHeader(id, thriftI64)
+	t.writeI64(v)
+}
+
+func (t *thriftWriter) fieldString(id int16, s string) {
+	t.fieldHeader(id, thriftBinary)
+	t.writeString(s)
+}
+
+func (t *thriftWriter) fieldListBegin(id int16, elemType byte, size int) {
+	t.fieldHeader(id, thriftList)
+	if size < 15 {
+		t.buf = append(t.buf, byte(size)<<4|elemType)
+	} else {
+		t.buf = append(t.buf, 0xF0|elemType)
+		t.buf = appendVarint(t.buf, uint64(size))
+	}
+}
+
+// fieldStructBegin starts a struct-typed field
+func (t *thriftWriter) fieldStructBegin(id int16) {
+	t.fieldHeader(id, thriftStruct)
+	t.structBegin()
+}
+
+// structBegin starts a struct value, e.g. a list element
+func (t *thriftWriter) structBegin() {
+	t.lastField = append(t.lastField, t.current)
+	t.current = 0
+}
+
+// structEnd writes the stop byte; the outermost struct has no matching structBegin
+func (t *thriftWriter) structEnd() {
+	t.buf = append(t.buf, 0)
+	if n := len(t.lastField); n > 0 {
+		t.current = t.lastField[n-1]
+		t.lastField = t.lastField[:n-1]
+	}
+}
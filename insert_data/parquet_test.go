@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/deprecated"
+)
+
+// readParquetRows reads every row of every row group with an independent Parquet reader
+func readParquetRows(t *testing.T, file *parquet.File) []parquet.Row {
+	t.Helper()
+	var all []parquet.Row
+	for _, group := range file.RowGroups() {
+		rows := group.Rows()
+		buf := make([]parquet.Row, 1000)
+		for {
+			n, err := rows.ReadRows(buf)
+			for _, row := range buf[:n] {
+				all = append(all, row.Clone())
+			}
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		rows.Close()
+	}
+	return all
+}
+
+func TestGeoParquetRoundTrip(t *testing.T) {
+	columns := []ParquetColumn{
+		{"id", ParquetInt},
+		{"name", ParquetString},
+		{"brightness", ParquetFloat},
+		{"event_date", ParquetTimestamp},
+	}
+	var out bytes.Buffer
+	writer, err := NewGeoParquetWriter(&out, columns)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// More rows than one row group holds, with nulls in every column including the geometry
+	const rowCount = parquetRowGroupSize + 10
+	eventDate := time.Date(2024, 3, 1, 12, 30, 0, 123000, time.UTC)
+	for i := 0; i < rowCount; i++ {
+		values := []interface{}{int64(i), "麻雀", float64(i) / 2, eventDate}
+		lon, lat := 120+float64(i%100)/100, 22+float64(i%50)/50
+		longitude, latitude := &lon, &lat
+		if i%7 == 3 {
+			values = []interface{}{int64(i), nil, nil, nil}
+			longitude, latitude = nil, nil
+		}
+		if err := writer.WriteRow(values, longitude, latitude); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := parquet.OpenFile(bytes.NewReader(out.Bytes()), int64(out.Len()))
+	if err != nil {
+		t.Fatalf("Parquet reader rejected the file: %v", err)
+	}
+	if file.NumRows() != rowCount || len(file.RowGroups()) != 2 {
+		t.Fatalf("file has %d rows in %d row groups, want %d in 2", file.NumRows(), len(file.RowGroups()), rowCount)
+	}
+
+	// Every column is optional, with the logical types readers map to strings and timestamps
+	fields := file.Schema().Fields()
+	wantNames := []string{"id", "name", "brightness", "event_date", "geometry"}
+	if len(fields) != len(wantNames) {
+		t.Fatalf("schema has %d fields, want %d", len(fields), len(wantNames))
+	}
+	for i, field := range fields {
+		if field.Name() != wantNames[i] || !field.Optional() {
+			t.Errorf("field %d is %s optional=%v, want optional %s", i, field.Name(), field.Optional(), wantNames[i])
+		}
+	}
+	elements := file.Metadata().Schema
+	if elements[2].ConvertedType == nil || *elements[2].ConvertedType != deprecated.UTF8 {
+		t.Error("name is not annotated as UTF8")
+	}
+	if elements[4].ConvertedType == nil || *elements[4].ConvertedType != deprecated.TimestampMicros {
+		t.Error("event_date is not annotated as TIMESTAMP_MICROS")
+	}
+
+	geoJSON, ok := file.Lookup("geo")
+	if !ok {
+		t.Fatal("geo metadata is missing")
+	}
+	var geo struct {
+		Version       string `json:"version"`
+		PrimaryColumn string `json:"primary_column"`
+		Columns       map[string]struct {
+			Encoding      string     `json:"encoding"`
+			GeometryTypes []string   `json:"geometry_types"`
+			BBox          [4]float64 `json:"bbox"`
+		} `json:"columns"`
+	}
+	if err := json.Unmarshal([]byte(geoJSON), &geo); err != nil {
+		t.Fatalf("geo metadata is not JSON: %v", err)
+	}
+	geometry, ok := geo.Columns[geo.PrimaryColumn]
+	if geo.Version != "1.0.0" || geo.PrimaryColumn != "geometry" || !ok || geometry.Encoding != "WKB" ||
+		len(geometry.GeometryTypes) != 1 || geometry.GeometryTypes[0] != "Point" {
+		t.Errorf("geo metadata = %s", geoJSON)
+	}
+	if geometry.BBox != [4]float64{120, 22, 120.99, 22.98} {
+		t.Errorf("geo bbox = %v", geometry.BBox)
+	}
+
+	rows := readParquetRows(t, file)
+	if len(rows) != rowCount {
+		t.Fatalf("read %d rows, want %d", len(rows), rowCount)
+	}
+	for i, row := range rows {
+		if len(row) != 5 {
+			t.Fatalf("row %d has %d values", i, len(row))
+		}
+		if row[0].Int64() != int64(i) {
+			t.Fatalf("row %d has id %d", i, row[0].Int64())
+		}
+		if i%7 == 3 {
+			for c, value := range row[1:] {
+				if !value.IsNull() {
+					t.Fatalf("row %d column %s = %v, want null", i, wantNames[c+1], value)
+				}
+			}
+			continue
+		}
+		if row[1].String() != "麻雀" || row[2].Double() != float64(i)/2 || row[3].Int64() != eventDate.UnixMicro() {
+			t.Fatalf("row %d = %v", i, row)
+		}
+		lon, lat := 120+float64(i%100)/100, 22+float64(i%50)/50
+		if !bytes.Equal(row[4].ByteArray(), wkbPoint(lon, lat)) {
+			t.Fatalf("row %d geometry = % x", i, row[4].ByteArray())
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ExclusionReason names why a light pixel or biological record was not ingested or aggregated
+type ExclusionReason string
+
+const (
+	ExcludeMalformedRecord   ExclusionReason = "malformed_record"
+	ExcludeInvalidTime       ExclusionReason = "invalid_time"
+	ExcludeNaNBrightness     ExclusionReason = "nan_brightness"
+	ExcludeMissingCounty     ExclusionReason = "missing_county"
+	ExcludeOutOfBounds       ExclusionReason = "out_of_bounds"
+	ExcludeOutOfTimeRange    ExclusionReason = "out_of_time_range"
+	ExcludeMissingQuality    ExclusionReason = "missing_quality"
+	ExcludeBadQualityFlag    ExclusionReason = "bad_quality_flag"
+	ExcludeLowCloudFreeCount ExclusionReason = "low_cloud_free_count"
+	ExcludeBadDate           ExclusionReason = "bad_date"
+	ExcludeBadCoordinates    ExclusionReason = "bad_coordinates"
+	ExcludeUnknownBioGroup   ExclusionReason = "unknown_bio_group"
+)
+
+// QualityFilter defines which VIIRS pixels are trusted based on the quality and cloud-free coverage layers
+type QualityFilter struct {
+	MinCloudFreeObs     int   `json:"min_cloud_free_obs"`              // pixels with fewer cloud-free observations are excluded
+	AllowedQualityFlags []int `json:"allowed_quality_flags,omitempty"` // when set, only these flags pass
+	RequireQuality      bool  `json:"require_quality"`                 // exclude pixels without quality layers
+}
+
+// exclusion returns the reason a pixel fails the filter, or "" if it passes
+func (qf *QualityFilter) exclusion(quality, cloudFreeObs *int) ExclusionReason {
+	if qf == nil {
+		return ""
+	}
+
+	if quality == nil && cloudFreeObs == nil {
+		if qf.RequireQuality {
+			return ExcludeMissingQuality
+		}
+		return ""
+	}
+
+	if len(qf.AllowedQualityFlags) > 0 {
+		if quality == nil {
+			if qf.RequireQuality {
+				return ExcludeMissingQuality
+			}
+		} else if !containsInt(qf.AllowedQualityFlags, *quality) {
+			return ExcludeBadQualityFlag
+		}
+	}
+
+	if qf.MinCloudFreeObs > 0 {
+		if cloudFreeObs == nil {
+			if qf.RequireQuality {
+				return ExcludeMissingQuality
+			}
+		} else if *cloudFreeObs < qf.MinCloudFreeObs {
+			return ExcludeLowCloudFreeCount
+		}
+	}
+
+	return ""
+}
+
+// sqlCondition renders the filter as a condition on the quality_flag and cloud_free_obs columns of
+// light_data_with_county that keeps the same pixels as exclusion. The flags are integers parsed by
+// newQualityFilter, so they are written inline.
+func (qf *QualityFilter) sqlCondition() string {
+	if qf == nil {
+		return "1 = 1"
+	}
+
+	conditions := []string{}
+	if qf.RequireQuality {
+		conditions = append(conditions, "(quality_flag IS NOT NULL OR cloud_free_obs IS NOT NULL)")
+	}
+	missing := func(column string) string {
+		if qf.RequireQuality {
+			return ""
+		}
+		return " OR " + column + " IS NULL"
+	}
+	if len(qf.AllowedQualityFlags) > 0 {
+		flags := make([]string, len(qf.AllowedQualityFlags))
+		for i, flag := range qf.AllowedQualityFlags {
+			flags[i] = strconv.Itoa(flag)
+		}
+		conditions = append(conditions, fmt.Sprintf("(quality_flag IN (%s)%s)", strings.Join(flags, ", "), missing("quality_flag")))
+	}
+	if qf.MinCloudFreeObs > 0 {
+		conditions = append(conditions, fmt.Sprintf("(cloud_free_obs >= %d%s)", qf.MinCloudFreeObs, missing("cloud_free_obs")))
+	}
+	if len(conditions) == 0 {
+		return "1 = 1"
+	}
+	return strings.Join(conditions, " AND ")
+}
+
+// newQualityFilter builds a filter from command line options, returning nil when no option is set
+func newQualityFilter(minCloudFreeObs int, qualityFlags string, requireQuality bool) (*QualityFilter, error) {
+	if minCloudFreeObs <= 0 && qualityFlags == "" && !requireQuality {
+		return nil, nil
+	}
+
+	filter := &QualityFilter{
+		MinCloudFreeObs: minCloudFreeObs,
+		RequireQuality:  requireQuality,
+	}
+	for _, part := range strings.Split(qualityFlags, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		flag, err := strconv.Atoi(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid quality flag %q: %v", part, err)
+		}
+		filter.AllowedQualityFlags = append(filter.AllowedQualityFlags, flag)
+	}
+	return filter, nil
+}
+
+func containsInt(values []int, v int) bool {
+	for _, candidate := range values {
+		if candidate == v {
+			return true
+		}
+	}
+	return false
+}
+
+// optionalInt converts a decoded JSON number (nil after NaN preprocessing) into an optional int
+func optionalInt(v interface{}) *int {
+	f, ok := v.(float64)
+	if !ok || math.IsNaN(f) {
+		return nil
+	}
+	i := int(f)
+	return &i
+}
+
+// optionalFloatInt converts a float layer value where NaN marks a missing value
+func optionalFloatInt(f float64) *int {
+	if math.IsNaN(f) {
+		return nil
+	}
+	i := int(f)
+	return &i
+}
+
+// ExclusionCounts counts excluded records per reason and is safe for concurrent use
+type ExclusionCounts struct {
+	mu     sync.Mutex
+	counts map[ExclusionReason]int64
+}
+
+// NewExclusionCounts creates an empty counter set
+func NewExclusionCounts() *ExclusionCounts {
+	return &ExclusionCounts{counts: make(map[ExclusionReason]int64)}
+}
+
+// Add records n excluded records for a reason; a nil receiver ignores the call
+func (ec *ExclusionCounts) Add(reason ExclusionReason, n int64) {
+	if ec == nil || n == 0 {
+		return
+	}
+	ec.mu.Lock()
+	ec.counts[reason] += n
+	ec.mu.Unlock()
+}
+
+// Merge adds all counts from another counter set
+func (ec *ExclusionCounts) Merge(other map[ExclusionReason]int64) {
+	for reason, n := range other {
+		ec.Add(reason, n)
+	}
+}
+
+// Snapshot returns a copy of the current counts
+func (ec *ExclusionCounts) Snapshot() map[ExclusionReason]int64 {
+	snapshot := make(map[ExclusionReason]int64)
+	if ec == nil {
+		return snapshot
+	}
+	ec.mu.Lock()
+	defer ec.mu.Unlock()
+	for reason, n := range ec.counts {
+		snapshot[reason] = n
+	}
+	return snapshot
+}
+
+// Total returns the number of excluded records over all reasons
+func (ec *ExclusionCounts) Total() int64 {
+	var total int64
+	for _, n := range ec.Snapshot() {
+		total += n
+	}
+	return total
+}
+
+// LogSummary logs the total and the counts per reason in a stable order
+func (ec *ExclusionCounts) LogSummary(label string) {
+	snapshot := ec.Snapshot()
+
+	reasons := make([]string, 0, len(snapshot))
+	for reason := range snapshot {
+		reasons = append(reasons, string(reason))
+	}
+	sort.Strings(reasons)
+
+	attrs := make([]any, 0, len(reasons))
+	for _, reason := range reasons {
+		attrs = append(attrs, slog.Int64(reason, snapshot[ExclusionReason(reason)]))
+	}
+	logProgress(label, "total", ec.Total(), slog.Group("reasons", attrs...))
+}
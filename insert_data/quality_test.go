@@ -0,0 +1,117 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func intPtr(v int) *int {
+	return &v
+}
+
+func TestQualityFilterExclusion(t *testing.T) {
+	flags := &QualityFilter{AllowedQualityFlags: []int{0, 1}}
+	cloudFree := &QualityFilter{MinCloudFreeObs: 3}
+	strict := &QualityFilter{AllowedQualityFlags: []int{0}, MinCloudFreeObs: 3, RequireQuality: true}
+
+	tests := []struct {
+		name         string
+		filter       *QualityFilter
+		quality      *int
+		cloudFreeObs *int
+		want         ExclusionReason
+	}{
+		{"nil filter keeps everything", nil, intPtr(9), intPtr(0), ""},
+		{"allowed flag", flags, intPtr(1), nil, ""},
+		{"disallowed flag", flags, intPtr(2), intPtr(10), ExcludeBadQualityFlag},
+		{"missing layers pass by default", flags, nil, nil, ""},
+		{"missing flag passes by default", flags, nil, intPtr(10), ""},
+		{"enough cloud-free observations", cloudFree, nil, intPtr(3), ""},
+		{"too few cloud-free observations", cloudFree, intPtr(0), intPtr(2), ExcludeLowCloudFreeCount},
+		{"required layers missing", strict, nil, nil, ExcludeMissingQuality},
+		{"required flag missing", strict, nil, intPtr(5), ExcludeMissingQuality},
+		{"required count missing", strict, intPtr(0), nil, ExcludeMissingQuality},
+		{"flag checked before count", strict, intPtr(1), intPtr(0), ExcludeBadQualityFlag},
+		{"strict pass", strict, intPtr(0), intPtr(3), ""},
+	}
+	for _, tt := range tests {
+		if got := tt.filter.exclusion(tt.quality, tt.cloudFreeObs); got != tt.want {
+			t.Errorf("%s: exclusion = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestNewQualityFilter(t *testing.T) {
+	filter, err := newQualityFilter(0, "", false)
+	if err != nil || filter != nil {
+		t.Errorf("newQualityFilter without options = %+v, %v, want nil", filter, err)
+	}
+
+	filter, err = newQualityFilter(2, " 0, 1 ,", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filter.MinCloudFreeObs != 2 || !filter.RequireQuality || len(filter.AllowedQualityFlags) != 2 ||
+		filter.AllowedQualityFlags[0] != 0 || filter.AllowedQualityFlags[1] != 1 {
+		t.Errorf("newQualityFilter = %+v", filter)
+	}
+
+	if _, err := newQualityFilter(0, "0,high", false); err == nil {
+		t.Error("newQualityFilter accepted a non-numeric quality flag")
+	}
+}
+
+func TestQualityFilterSQLCondition(t *testing.T) {
+	tests := []struct {
+		filter *QualityFilter
+		want   string
+	}{
+		{nil, "1 = 1"},
+		{&QualityFilter{}, "1 = 1"},
+		{&QualityFilter{AllowedQualityFlags: []int{0, 1}, MinCloudFreeObs: 3},
+			"(quality_flag IN (0, 1) OR quality_flag IS NULL) AND (cloud_free_obs >= 3 OR cloud_free_obs IS NULL)"},
+		{&QualityFilter{AllowedQualityFlags: []int{0}, RequireQuality: true},
+			"(quality_flag IS NOT NULL OR cloud_free_obs IS NOT NULL) AND (quality_flag IN (0))"},
+		{&QualityFilter{RequireQuality: true}, "(quality_flag IS NOT NULL OR cloud_free_obs IS NOT NULL)"},
+	}
+	for _, tt := range tests {
+		if got := tt.filter.sqlCondition(); got != tt.want {
+			t.Errorf("sqlCondition(%+v) = %q, want %q", tt.filter, got, tt.want)
+		}
+	}
+}
+
+func TestJSONFileLightSourceCountsSkippedRecords(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "taiwan_light_2025_full.json")
+	content := `[
+		{"time": "2025-01-01T00:00:00Z", "longitude": 121.5, "latitude": 25.0, "brightness": 12.5, "county": "臺北市"},
+		{"time": "2025-01-01T00:00:00Z", "longitude": 121.6, "latitude": 25.0, "brightness": NaN, "county": "臺北市"},
+		{"time": "2025-01", "longitude": 121.7, "latitude": 25.0, "brightness": 3, "county": "臺北市"},
+		{"time": "2025-02-01T00:00:00Z", "longitude": 121.8, "latitude": 25.0, "brightness": 4, "county": "臺北市"}
+	]`
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	exclusions := NewExclusionCounts()
+	source, err := NewJSONFileLightSource(path, exclusions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer source.Close()
+
+	batch := make([]LightData, 10)
+	n, err := source.Read(batch)
+	if err != nil || n != 2 || batch[0].Brightness != 12.5 || batch[1].Brightness != 4 {
+		t.Fatalf("Read = %d, %v, %+v", n, err, batch[:n])
+	}
+	if _, err := source.Read(batch); err != io.EOF {
+		t.Errorf("second Read error = %v, want io.EOF", err)
+	}
+	counts := exclusions.Snapshot()
+	if counts[ExcludeNaNBrightness] != 1 || counts[ExcludeInvalidTime] != 1 || exclusions.Total() != 2 {
+		t.Errorf("exclusions = %v, want one NaN brightness and one invalid time", counts)
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// RetryPolicy controls how often and how long a failed batch is retried
+type RetryPolicy struct {
+	MaxAttempts int           // total attempts per batch, including the first
+	BaseDelay   time.Duration // delay before the first retry, doubled on every further retry
+	MaxDelay    time.Duration // upper bound of a single delay
+}
+
+// DefaultRetryPolicy retries a batch up to four times, waiting a few seconds in total
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 5,
+	BaseDelay:   500 * time.Millisecond,
+	MaxDelay:    15 * time.Second,
+}
+
+// backoff returns the delay before retry n (1-based): exponential growth capped at MaxDelay, with the
+// upper half randomised so workers that failed together do not retry together
+func (p RetryPolicy) backoff(n int) time.Duration {
+	delay := p.MaxDelay
+	if shift := n - 1; shift < 30 {
+		if d := p.BaseDelay << shift; d > 0 && d < p.MaxDelay {
+			delay = d
+		}
+	}
+	return delay/2 + rand.N(delay/2+1)
+}
+
+// commitOutcomeError is a commit that failed on the connection. The server may have committed the
+// transaction before the connection dropped, so repeating a plain INSERT could store its rows twice.
+type commitOutcomeError struct {
+	err error
+}
+
+func (e *commitOutcomeError) Error() string {
+	return fmt.Sprintf("commit outcome unknown, not retried to avoid duplicate rows: %v", e.err)
+}
+
+func (e *commitOutcomeError) Unwrap() error { return e.err }
+
+// commitTx commits tx and reports a connection failure during the commit as a commitOutcomeError.
+// Other commit errors, e.g. a serialization failure, leave nothing behind and stay retryable.
+func commitTx(tx *sql.Tx) error {
+	err := tx.Commit()
+	if err != nil && transientReason(err) == "connection" {
+		return &commitOutcomeError{err: err}
+	}
+	return err
+}
+
+// transientReason classifies err as a failure worth retrying and returns the reason,
+// or "" when retrying would fail the same way or could duplicate a committed write
+func transientReason(err error) string {
+	var commitErr *commitOutcomeError
+	if errors.As(err, &commitErr) {
+		return ""
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch {
+		case pqErr.Code == "40001":
+			return "serialization_failure"
+		case pqErr.Code == "40P01":
+			return "deadlock"
+		case pqErr.Code == "53300":
+			return "too_many_connections"
+		case pqErr.Code.Class() == "08", pqErr.Code == "57P01", pqErr.Code == "57P02", pqErr.Code == "57P03":
+			// connection_exception, or the server is shutting down or still starting
+			return "connection"
+		}
+		return ""
+	}
+
+	switch {
+	case errors.Is(err, driver.ErrBadConn),
+		errors.Is(err, io.EOF),
+		errors.Is(err, io.ErrUnexpectedEOF),
+		errors.Is(err, syscall.ECONNRESET),
+		errors.Is(err, syscall.ECONNREFUSED),
+		errors.Is(err, syscall.EPIPE):
+		return "connection"
+	case strings.Contains(err.Error(), "database is locked"):
+		// SQLite writer contention, the embedded equivalent of a lock timeout
+		return "database_locked"
+	}
+	return ""
+}
+
+// RetryStats counts retried and permanently failed batches and is safe for concurrent use
+type RetryStats struct {
+	mu        sync.Mutex
+	retried   int64            // batches that succeeded after at least one retry
+	failed    int64            // batches given up on
+	attempts  int64            // retries across all batches
+	perReason map[string]int64 // retries per transient reason
+}
+
+// NewRetryStats creates empty retry statistics
+func NewRetryStats() *RetryStats {
+	return &RetryStats{perReason: make(map[string]int64)}
+}
+
+func (rs *RetryStats) addRetry(reason string) {
+	rs.mu.Lock()
+	rs.attempts++
+	rs.perReason[reason]++
+	rs.mu.Unlock()
+}
+
+func (rs *RetryStats) addOutcome(retries int, err error) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	if err != nil {
+		rs.failed++
+	} else if retries > 0 {
+		rs.retried++
+	}
+}
+
+// LogSummary logs how many batches needed retries and how many failed for good
+func (rs *RetryStats) LogSummary() {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	reasons := make([]string, 0, len(rs.perReason))
+	for reason := range rs.perReason {
+		reasons = append(reasons, reason)
+	}
+	sort.Strings(reasons)
+
+	attrs := make([]any, 0, len(reasons))
+	for _, reason := range reasons {
+		attrs = append(attrs, slog.Int64(reason, rs.perReason[reason]))
+	}
+	logProgress("Batch retries", "retried_batches", rs.retried, "failed_batches", rs.failed,
+		"retries", rs.attempts, slog.Group("reasons", attrs...))
+}
+
+// withRetry runs write until it succeeds, fails with a permanent error or runs out of attempts.
+// write must be safe to repeat, i.e. a failed attempt leaves nothing behind; writes that end in a
+// commit return commitTx's error so a commit of unknown outcome is not repeated.
+func withRetry(ctx context.Context, policy RetryPolicy, stats *RetryStats, label string, write func() error) error {
+	retries := 0
+	for {
+		err := write()
+		if err == nil {
+			stats.addOutcome(retries, nil)
+			return nil
+		}
+
+		reason := transientReason(err)
+		if reason == "" || retries+1 >= policy.MaxAttempts {
+			stats.addOutcome(retries, err)
+			if reason != "" {
+				return fmt.Errorf("%s failed after %d attempts: %w", label, retries+1, err)
+			}
+			return err
+		}
+
+		retries++
+		stats.addRetry(reason)
+		delay := policy.backoff(retries)
+		loggerFrom(ctx).Warn("Retrying batch", "batch", label, "delay", delay.Round(time.Millisecond), "reason", reason,
+			"attempt", retries+1, "max_attempts", policy.MaxAttempts, "error", err)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			stats.addOutcome(retries, ctx.Err())
+			return fmt.Errorf("%s abandoned while waiting to retry: %w", label, ctx.Err())
+		}
+	}
+}
+
+// Snapshot returns the retried and permanently failed batch counts and the retries per reason
+func (rs *RetryStats) Snapshot() (retried, failed int64, perReason map[string]int64) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	perReason = make(map[string]int64, len(rs.perReason))
+	for reason, n := range rs.perReason {
+		perReason[reason] = n
+	}
+	return rs.retried, rs.failed, perReason
+}
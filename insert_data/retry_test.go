@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+func TestTransientReason(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{&pq.Error{Code: "40001"}, "serialization_failure"},
+		{&pq.Error{Code: "08006"}, "connection"},
+		{&pq.Error{Code: "23505"}, ""},
+		{fmt.Errorf("error executing batch insert: %w", driver.ErrBadConn), "connection"},
+		{errors.New("database is locked (5) (SQLITE_BUSY)"), "database_locked"},
+		{&commitOutcomeError{err: driver.ErrBadConn}, ""},
+		{fmt.Errorf("light batch: %w", &commitOutcomeError{err: &pq.Error{Code: "08006"}}), ""},
+	}
+	for _, tt := range tests {
+		if got := transientReason(tt.err); got != tt.want {
+			t.Errorf("transientReason(%v) = %q, want %q", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestWithRetryDoesNotRepeatUnknownCommits(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}
+
+	// A connection error before the commit is retried until the write succeeds
+	stats := NewRetryStats()
+	attempts := 0
+	err := withRetry(context.Background(), policy, stats, "batch", func() error {
+		attempts++
+		if attempts == 1 {
+			return driver.ErrBadConn
+		}
+		return nil
+	})
+	if err != nil || attempts != 2 {
+		t.Errorf("withRetry = %v after %d attempts, want success after 2", err, attempts)
+	}
+
+	// A commit that may have gone through is reported at once
+	attempts = 0
+	err = withRetry(context.Background(), policy, stats, "batch", func() error {
+		attempts++
+		return &commitOutcomeError{err: driver.ErrBadConn}
+	})
+	var commitErr *commitOutcomeError
+	if !errors.As(err, &commitErr) || attempts != 1 {
+		t.Errorf("withRetry = %v after %d attempts, want the commit error after 1", err, attempts)
+	}
+
+	retried, failed, perReason := stats.Snapshot()
+	if retried != 1 || failed != 1 || perReason["connection"] != 1 {
+		t.Errorf("stats = %d retried, %d failed, %v", retried, failed, perReason)
+	}
+}
@@ -1,7 +0,0 @@
-package main
-
-var connectionString = "postgresql://postgres:0mh43pDrXy37Y3HGx9DRloOSI323R0uvhhQTSCLHUCIzMzcRBtAHaPqtqCulWGkV1Tptl7bNubLPt0CLitD8vXD2XdY3ZsC4ImwHrqUKGOwoZuxNDZfbtEpQGNV777nQ@100.77.58.81:5432/postgres?sslmode=disable"
-
-func main() {
-	
-}
\ No newline at end of file
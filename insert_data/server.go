@@ -0,0 +1,909 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// countyToRegion maps counties to the four Taiwan regions used by the source-ratio chart
+var countyToRegion = map[string]string{
+	// 北區 (Northern Region)
+	"台北市": "北區", "臺北市": "北區",
+	"新北市": "北區",
+	"基隆市": "北區",
+	"桃園市": "北區",
+	"新竹市": "北區",
+	"新竹縣": "北區",
+
+	// 中區 (Central Region)
+	"苗栗縣": "中區",
+	"台中市": "中區", "臺中市": "中區",
+	"彰化縣": "中區",
+	"南投縣": "中區",
+	"雲林縣": "中區",
+
+	// 南區 (Southern Region)
+	"嘉義市": "南區",
+	"嘉義縣": "南區",
+	"台南市": "南區", "臺南市": "南區",
+	"高雄市": "南區",
+	"屏東縣": "南區",
+
+	// 東區 (Eastern Region)
+	"宜蘭縣": "東區",
+	"花蓮縣": "東區",
+	"台東縣": "東區", "臺東縣": "東區",
+	"澎湖縣": "東區",
+	"金門縣": "東區",
+	"連江縣": "東區",
+}
+
+// AnimalAmount is one animal type within a county in chart responses
+type AnimalAmount struct {
+	AnimalType  string   `json:"animal_type"`
+	TotalAmount int      `json:"total_amount"`
+	EventCount  int      `json:"event_count"`
+	EventRate   *float64 `json:"event_rate,omitempty"`  // events per observation day of the county
+	AmountRate  *float64 `json:"amount_rate,omitempty"` // individuals per observation day of the county
+}
+
+// CountyAnimalData groups animal amounts by county
+type CountyAnimalData struct {
+	County     string         `json:"county"`
+	EffortDays *int           `json:"effort_days,omitempty"` // distinct observation days over the range
+	Animals    []AnimalAmount `json:"animals"`
+}
+
+// MonthlyLightAverage is the rounded average brightness for one month
+type MonthlyLightAverage struct {
+	Month                 int     `json:"month"`
+	LightPollutionAverage float64 `json:"light_pollution_average"`
+}
+
+// CountyLightData groups monthly light averages by county
+type CountyLightData struct {
+	County string                `json:"county"`
+	Data   []MonthlyLightAverage `json:"data"`
+}
+
+// apiTimeRange echoes the requested time range
+type apiTimeRange struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+// APIServer serves the dashboard chart endpoints from the tables created by this module
+type APIServer struct {
+	db    *sql.DB
+	tiles *tileCache
+}
+
+// NewAPIServer creates an API server backed by the given database
+func NewAPIServer(db *sql.DB) *APIServer {
+	return &APIServer{
+		db:    db,
+		tiles: newTileCache(2048, 15*time.Minute),
+	}
+}
+
+// Handler returns the HTTP handler with every chart route from openapi.json and the vector tile routes
+func (s *APIServer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/charts/night-animals/area-amount", s.handleAreaAnimals)
+	mux.HandleFunc("GET /api/charts/night-animals/area-ratio", s.handleAreaAnimals)
+	mux.HandleFunc("GET /api/charts/night-animals/county-total", s.handleCountyTotal)
+	mux.HandleFunc("GET /api/charts/night-animals/dataset-stats", s.handleDatasetStats)
+	mux.HandleFunc("GET /api/charts/night-animals/species-timeline", s.handleSpeciesTimeline)
+	mux.HandleFunc("GET /api/charts/season/animal-amount", s.handleSeasonAnimals)
+	mux.HandleFunc("GET /api/charts/season/animal-ratio", s.handleSeasonAnimals)
+	mux.HandleFunc("GET /api/charts/light-pollution/distribution", s.handleLightDistribution)
+	mux.HandleFunc("GET /api/charts/light-pollution/source-ratio", s.handleLightSourceRatio)
+	mux.HandleFunc("GET /api/charts/light-pollution/timeline", s.handleLightTimeline)
+	mux.HandleFunc("GET /api/tiles/light/{z}/{x}/{y}", s.handleLightTile)
+	mux.HandleFunc("GET /api/tiles/occurrences/{z}/{x}/{y}", s.handleOccurrenceTile)
+	mux.HandleFunc("GET /api/analysis/light-correlation", s.handleLightCorrelation)
+	mux.HandleFunc("GET /api/analysis/light-trend", s.handleLightTrend)
+	mux.HandleFunc("GET /api/analysis/hotspots", s.handleHotspots)
+	return mux
+}
+
+// writeJSON writes a JSON response with the given status code
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		slog.Error("Error encoding response", "error", err)
+	}
+}
+
+// writeError writes an error response in the {"error": "..."} shape used by the Next.js routes
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
+
+// writeDatabaseError logs a query failure and hides the details from the client
+func writeDatabaseError(w http.ResponseWriter, err error) {
+	slog.Error("Database error", "error", err)
+	writeError(w, http.StatusInternalServerError, "Internal server error")
+}
+
+// parseTimeRangeParams validates start_time and end_time the same way the Next.js routes do
+func parseTimeRangeParams(w http.ResponseWriter, r *http.Request) (time.Time, time.Time, bool) {
+	startTime := r.URL.Query().Get("start_time")
+	endTime := r.URL.Query().Get("end_time")
+
+	if startTime == "" || endTime == "" {
+		writeError(w, http.StatusBadRequest, "start_time and end_time parameters are required")
+		return time.Time{}, time.Time{}, false
+	}
+
+	startDate, startErr := parseAPITime(startTime)
+	endDate, endErr := parseAPITime(endTime)
+	if startErr != nil || endErr != nil {
+		writeError(w, http.StatusBadRequest, "Invalid date format. Use ISO 8601 format (e.g., 2024-01-01T00:00:00Z)")
+		return time.Time{}, time.Time{}, false
+	}
+
+	if !startDate.Before(endDate) {
+		writeError(w, http.StatusBadRequest, "start_time must be before end_time")
+		return time.Time{}, time.Time{}, false
+	}
+
+	return startDate, endDate, true
+}
+
+// parseAPITime accepts full ISO 8601 timestamps or plain dates
+func parseAPITime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.UTC(), nil
+	}
+	t, err := time.Parse("2006-01-02", value)
+	return t.UTC(), err
+}
+
+// formatAPITime formats times like JavaScript's Date.toISOString
+func formatAPITime(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05.000Z")
+}
+
+// roundBrightness rounds to two decimal places like the chart routes
+func roundBrightness(value float64) float64 {
+	return math.Round(value*100) / 100
+}
+
+// groupAnimalsByCounty turns aggregated rows ordered by county into the nested chart shape
+func groupAnimalsByCounty(rows []AnimalAggregatedData) []CountyAnimalData {
+	data := []CountyAnimalData{}
+	for _, row := range rows {
+		if len(data) == 0 || data[len(data)-1].County != row.County {
+			data = append(data, CountyAnimalData{County: row.County, Animals: []AnimalAmount{}})
+		}
+		current := &data[len(data)-1]
+		current.Animals = append(current.Animals, AnimalAmount{
+			AnimalType:  row.AnimalType,
+			TotalAmount: row.TotalAmount,
+			EventCount:  row.EventCount,
+		})
+	}
+	return data
+}
+
+// activityCondition appends the optional activity query parameter (nocturnal, diurnal, crepuscular or
+// unknown) to a where clause over animal_aggregated_data. It writes a 400 and returns false when invalid.
+func activityCondition(w http.ResponseWriter, r *http.Request, where string, args []interface{}) (string, []interface{}, bool) {
+	activity := r.URL.Query().Get("activity")
+	if activity == "" || activity == "all" {
+		return where, args, true
+	}
+	if period := ActivityPeriod(activity); !period.valid() && period != ActivityUnknown {
+		writeError(w, http.StatusBadRequest, "activity must be nocturnal, diurnal, crepuscular, unknown or all")
+		return "", nil, false
+	}
+	args = append(args, activity)
+	return fmt.Sprintf("(%s) AND activity_period = $%d", where, len(args)), args, true
+}
+
+// queryAnimalTotals runs a county/animal_type aggregation over animal_aggregated_data
+func (s *APIServer) queryAnimalTotals(ctx context.Context, where string, args ...interface{}) ([]AnimalAggregatedData, error) {
+	query := `
+		SELECT
+			county,
+			animal_type,
+			SUM(total_amount) as total_amount,
+			SUM(event_count) as event_count
+		FROM animal_aggregated_data
+		WHERE ` + where + `
+		GROUP BY county, animal_type
+		ORDER BY county, animal_type
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []AnimalAggregatedData{}
+	for rows.Next() {
+		var row AnimalAggregatedData
+		if err := rows.Scan(&row.County, &row.AnimalType, &row.TotalAmount, &row.EventCount); err != nil {
+			return nil, err
+		}
+		results = append(results, row)
+	}
+	return results, rows.Err()
+}
+
+// queryCountyEffort sums the observation days of sampling_effort_aggregated per county
+func (s *APIServer) queryCountyEffort(ctx context.Context, where string, args ...interface{}) (map[string]int, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT county, SUM(observation_days)
+		FROM sampling_effort_aggregated
+		WHERE `+where+`
+		GROUP BY county
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	effort := make(map[string]int)
+	for rows.Next() {
+		var county string
+		var days int
+		if err := rows.Scan(&county, &days); err != nil {
+			return nil, err
+		}
+		effort[county] = days
+	}
+	return effort, rows.Err()
+}
+
+// applyEffortRates divides the county totals by the county's observation days, so counties surveyed on
+// more days do not dominate the ratio chart
+func applyEffortRates(data []CountyAnimalData, effort map[string]int) {
+	for i := range data {
+		days, ok := effort[data[i].County]
+		if !ok || days == 0 {
+			continue
+		}
+		data[i].EffortDays = &days
+		for j := range data[i].Animals {
+			animal := &data[i].Animals[j]
+			animal.EventRate = floatPtr(float64(animal.EventCount) / float64(days))
+			animal.AmountRate = floatPtr(float64(animal.TotalAmount) / float64(days))
+		}
+	}
+}
+
+// handleAreaAnimals serves night-animals/area-amount and area-ratio, which share their query and shape
+func (s *APIServer) handleAreaAnimals(w http.ResponseWriter, r *http.Request) {
+	startDate, endDate, ok := parseTimeRangeParams(w, r)
+	if !ok {
+		return
+	}
+
+	monthRange := `
+			(year > $1 OR (year = $1 AND month >= $2))
+			AND (year < $3 OR (year = $3 AND month <= $4))`
+	args := []interface{}{startDate.Year(), int(startDate.Month()), endDate.Year(), int(endDate.Month())}
+	where, animalArgs, ok := activityCondition(w, r, monthRange, args)
+	if !ok {
+		return
+	}
+	rows, err := s.queryAnimalTotals(r.Context(), where, animalArgs...)
+	if err != nil {
+		writeDatabaseError(w, err)
+		return
+	}
+	effort, err := s.queryCountyEffort(r.Context(), monthRange, args...)
+	if err != nil {
+		writeDatabaseError(w, err)
+		return
+	}
+
+	data := groupAnimalsByCounty(rows)
+	applyEffortRates(data, effort)
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"data": data,
+		"time_range": apiTimeRange{
+			Start: formatAPITime(startDate),
+			End:   formatAPITime(endDate),
+		},
+	})
+}
+
+// handleCountyTotal serves night-animals/county-total
+func (s *APIServer) handleCountyTotal(w http.ResponseWriter, r *http.Request) {
+	year := r.URL.Query().Get("year")
+	if year == "" {
+		writeError(w, http.StatusBadRequest, "year parameter is required")
+		return
+	}
+
+	yearNum, err := strconv.Atoi(year)
+	if err != nil || yearNum < 2012 || yearNum > 2025 {
+		writeError(w, http.StatusBadRequest, "year must be a valid number between 2012 and 2025")
+		return
+	}
+
+	where, args, ok := activityCondition(w, r, "year = $1", []interface{}{yearNum})
+	if !ok {
+		return
+	}
+	rows, err := s.db.QueryContext(r.Context(), `
+		SELECT
+			county,
+			SUM(total_amount) as total_amount
+		FROM animal_aggregated_data
+		WHERE `+where+`
+		GROUP BY county
+		ORDER BY total_amount DESC
+	`, args...)
+	if err != nil {
+		writeDatabaseError(w, err)
+		return
+	}
+	defer rows.Close()
+
+	type countyTotal struct {
+		County      string `json:"county"`
+		TotalAmount int    `json:"total_amount"`
+	}
+	data := []countyTotal{}
+	for rows.Next() {
+		var row AnimalAggregatedData
+		if err := rows.Scan(&row.County, &row.TotalAmount); err != nil {
+			writeDatabaseError(w, err)
+			return
+		}
+		data = append(data, countyTotal{County: row.County, TotalAmount: row.TotalAmount})
+	}
+	if err := rows.Err(); err != nil {
+		writeDatabaseError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"data": data,
+		"year": yearNum,
+	})
+}
+
+// handleDatasetStats serves night-animals/dataset-stats
+func (s *APIServer) handleDatasetStats(w http.ResponseWriter, r *http.Request) {
+	county := r.URL.Query().Get("county")
+
+	query := `
+		SELECT
+			dataset,
+			SUM(count) as count
+		FROM dataset_stats_aggregated
+		GROUP BY dataset
+		ORDER BY count DESC
+	`
+	var args []interface{}
+	if county != "" && county != "all" {
+		query = `
+			SELECT
+				dataset,
+				SUM(count) as count
+			FROM dataset_stats_aggregated
+			WHERE county = $1
+			GROUP BY dataset
+			ORDER BY count DESC
+		`
+		args = append(args, county)
+	}
+
+	rows, err := s.db.QueryContext(r.Context(), query, args...)
+	if err != nil {
+		writeDatabaseError(w, err)
+		return
+	}
+	defer rows.Close()
+
+	type datasetCount struct {
+		Dataset string `json:"dataset"`
+		Count   int    `json:"count"`
+	}
+	data := []datasetCount{}
+	for rows.Next() {
+		var row DatasetStatsAggregated
+		if err := rows.Scan(&row.Dataset, &row.Count); err != nil {
+			writeDatabaseError(w, err)
+			return
+		}
+		data = append(data, datasetCount{Dataset: row.Dataset, Count: row.Count})
+	}
+	if err := rows.Err(); err != nil {
+		writeDatabaseError(w, err)
+		return
+	}
+
+	if county == "" {
+		county = "all"
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"data":   data,
+		"county": county,
+	})
+}
+
+// handleSpeciesTimeline serves night-animals/species-timeline, filling months without records with zero
+func (s *APIServer) handleSpeciesTimeline(w http.ResponseWriter, r *http.Request) {
+	animalType := r.URL.Query().Get("animal_type")
+	year := r.URL.Query().Get("year")
+
+	if animalType == "" {
+		writeError(w, http.StatusBadRequest, "animal_type parameter is required")
+		return
+	}
+	if year == "" {
+		writeError(w, http.StatusBadRequest, "year parameter is required")
+		return
+	}
+
+	yearNum, err := strconv.Atoi(year)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "year must be a valid number")
+		return
+	}
+
+	rows, err := s.db.QueryContext(r.Context(), `
+		SELECT
+			month,
+			SUM(event_count) as event_count
+		FROM animal_aggregated_data
+		WHERE animal_type = $1 AND year = $2
+		GROUP BY month
+		ORDER BY month
+	`, animalType, yearNum)
+	if err != nil {
+		writeDatabaseError(w, err)
+		return
+	}
+	defer rows.Close()
+
+	eventCounts := make(map[int]int)
+	for rows.Next() {
+		var row AnimalAggregatedData
+		if err := rows.Scan(&row.Month, &row.EventCount); err != nil {
+			writeDatabaseError(w, err)
+			return
+		}
+		eventCounts[row.Month] = row.EventCount
+	}
+	if err := rows.Err(); err != nil {
+		writeDatabaseError(w, err)
+		return
+	}
+
+	type monthlyEvents struct {
+		Month      int `json:"month"`
+		EventCount int `json:"event_count"`
+	}
+	data := make([]monthlyEvents, 0, 12)
+	for month := 1; month <= 12; month++ {
+		data = append(data, monthlyEvents{Month: month, EventCount: eventCounts[month]})
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"data":        data,
+		"animal_type": animalType,
+		"year":        yearNum,
+	})
+}
+
+// handleSeasonAnimals serves season/animal-amount and animal-ratio, which share their query and shape
+func (s *APIServer) handleSeasonAnimals(w http.ResponseWriter, r *http.Request) {
+	year := r.URL.Query().Get("year")
+	season := r.URL.Query().Get("season")
+	county := r.URL.Query().Get("county")
+
+	if year == "" {
+		writeError(w, http.StatusBadRequest, "year parameter is required")
+		return
+	}
+	if season == "" {
+		writeError(w, http.StatusBadRequest, "season parameter is required")
+		return
+	}
+
+	yearNum, err := strconv.Atoi(year)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "year must be a valid number")
+		return
+	}
+	seasonNum, err := strconv.Atoi(season)
+	if err != nil || seasonNum < 1 || seasonNum > 4 {
+		writeError(w, http.StatusBadRequest, "season must be a valid number between 1 and 4")
+		return
+	}
+
+	where, args := "year = $1 AND season = $2", []interface{}{yearNum, seasonNum}
+	if county != "" && county != "all" {
+		where, args = "year = $1 AND season = $2 AND county = $3", append(args, county)
+	}
+	where, args, ok := activityCondition(w, r, where, args)
+	if !ok {
+		return
+	}
+	rows, err := s.queryAnimalTotals(r.Context(), where, args...)
+	if err != nil {
+		writeDatabaseError(w, err)
+		return
+	}
+
+	if county == "" {
+		county = "all"
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"data":   groupAnimalsByCounty(rows),
+		"year":   yearNum,
+		"season": seasonNum,
+		"county": county,
+	})
+}
+
+// handleLightDistribution serves light-pollution/distribution
+func (s *APIServer) handleLightDistribution(w http.ResponseWriter, r *http.Request) {
+	startDate, endDate, ok := parseTimeRangeParams(w, r)
+	if !ok {
+		return
+	}
+
+	query, err := store.AnalysisQuery("county_brightness_by_month")
+	if err != nil {
+		writeDatabaseError(w, err)
+		return
+	}
+	rows, err := s.db.QueryContext(r.Context(), query, startDate, endDate)
+	if err != nil {
+		writeDatabaseError(w, err)
+		return
+	}
+	defer rows.Close()
+
+	data := []CountyLightData{}
+	for rows.Next() {
+		var county string
+		var month int
+		var avgBrightness float64
+		if err := rows.Scan(&county, &month, &avgBrightness); err != nil {
+			writeDatabaseError(w, err)
+			return
+		}
+
+		if len(data) == 0 || data[len(data)-1].County != county {
+			data = append(data, CountyLightData{County: county, Data: []MonthlyLightAverage{}})
+		}
+		current := &data[len(data)-1]
+		current.Data = append(current.Data, MonthlyLightAverage{
+			Month:                 month,
+			LightPollutionAverage: roundBrightness(avgBrightness),
+		})
+	}
+	if err := rows.Err(); err != nil {
+		writeDatabaseError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"data": data,
+		"time_range": apiTimeRange{
+			Start: formatAPITime(startDate),
+			End:   formatAPITime(endDate),
+		},
+	})
+}
+
+// handleLightSourceRatio serves light-pollution/source-ratio, averaging county means per region
+func (s *APIServer) handleLightSourceRatio(w http.ResponseWriter, r *http.Request) {
+	month := r.URL.Query().Get("month")
+	if month == "" {
+		writeError(w, http.StatusBadRequest, "month parameter is required")
+		return
+	}
+
+	monthNum, err := strconv.Atoi(month)
+	if err != nil || monthNum < 1 || monthNum > 12 {
+		writeError(w, http.StatusBadRequest, "Invalid month format. Must be a number between 1 and 12")
+		return
+	}
+
+	var yearNum *int
+	if year := r.URL.Query().Get("year"); year != "" {
+		parsed, err := strconv.Atoi(year)
+		if err != nil || parsed < 1900 || parsed > 2100 {
+			writeError(w, http.StatusBadRequest, "Invalid year format. Must be a valid year between 1900 and 2100")
+			return
+		}
+		yearNum = &parsed
+	}
+
+	name, args := "county_brightness_in_month", []interface{}{monthNum}
+	if yearNum != nil {
+		name, args = "county_brightness_in_year_month", append(args, *yearNum)
+	}
+	query, err := store.AnalysisQuery(name)
+	if err != nil {
+		writeDatabaseError(w, err)
+		return
+	}
+	rows, err := s.db.QueryContext(r.Context(), query, args...)
+	if err != nil {
+		writeDatabaseError(w, err)
+		return
+	}
+	defer rows.Close()
+
+	type regionTotal struct {
+		total float64
+		count int
+	}
+	regions := make(map[string]*regionTotal)
+	for rows.Next() {
+		var county string
+		var avgBrightness float64
+		if err := rows.Scan(&county, &avgBrightness); err != nil {
+			writeDatabaseError(w, err)
+			return
+		}
+
+		region, ok := countyToRegion[county]
+		if !ok {
+			region = "其他" // Default to "其他" for unknown counties
+		}
+		if regions[region] == nil {
+			regions[region] = &regionTotal{}
+		}
+		regions[region].total += avgBrightness
+		regions[region].count++
+	}
+	if err := rows.Err(); err != nil {
+		writeDatabaseError(w, err)
+		return
+	}
+
+	type areaLight struct {
+		Area                  string  `json:"area"`
+		LightPollutionAverage float64 `json:"light_pollution_average"`
+	}
+	data := []areaLight{}
+	for area, totals := range regions {
+		data = append(data, areaLight{
+			Area:                  area,
+			LightPollutionAverage: roundBrightness(totals.total / float64(totals.count)),
+		})
+	}
+	// Sort by region name for consistent output
+	sort.Slice(data, func(i, j int) bool { return data[i].Area < data[j].Area })
+
+	response := map[string]interface{}{
+		"data":          data,
+		"month":         monthNum,
+		"total_regions": len(data),
+	}
+	if yearNum != nil {
+		response["year"] = *yearNum
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// handleLightTimeline serves light-pollution/timeline
+func (s *APIServer) handleLightTimeline(w http.ResponseWriter, r *http.Request) {
+	county := r.URL.Query().Get("county")
+	year := r.URL.Query().Get("year")
+
+	if county == "" {
+		writeError(w, http.StatusBadRequest, "county parameter is required")
+		return
+	}
+	if year == "" {
+		writeError(w, http.StatusBadRequest, "year parameter is required")
+		return
+	}
+
+	yearNum, err := strconv.Atoi(year)
+	if err != nil || yearNum < 1900 || yearNum > 2100 {
+		writeError(w, http.StatusBadRequest, "Invalid year format. Must be a valid year between 1900 and 2100")
+		return
+	}
+
+	query, err := store.AnalysisQuery("county_brightness_timeline")
+	if err != nil {
+		writeDatabaseError(w, err)
+		return
+	}
+	rows, err := s.db.QueryContext(r.Context(), query, yearNum, county)
+	if err != nil {
+		writeDatabaseError(w, err)
+		return
+	}
+	defer rows.Close()
+
+	data := []MonthlyLightAverage{}
+	for rows.Next() {
+		var month int
+		var avgBrightness float64
+		if err := rows.Scan(&month, &avgBrightness); err != nil {
+			writeDatabaseError(w, err)
+			return
+		}
+		data = append(data, MonthlyLightAverage{
+			Month:                 month,
+			LightPollutionAverage: roundBrightness(avgBrightness),
+		})
+	}
+	if err := rows.Err(); err != nil {
+		writeDatabaseError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"county":       county,
+		"data":         data,
+		"year":         yearNum,
+		"total_months": len(data),
+	})
+}
+
+// handleLightCorrelation serves light_occurrence_correlation, optionally filtered by county and animal_type
+func (s *APIServer) handleLightCorrelation(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	results, err := queryCorrelationResults(r.Context(), s.db, query.Get("county"), query.Get("animal_type"))
+	if err != nil {
+		writeDatabaseError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"data":       results,
+		"confidence": correlationConfidence,
+	})
+}
+
+// handleLightTrend serves light_brightness_trend, optionally filtered by scope, county and trend
+func (s *APIServer) handleLightTrend(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	results, err := queryTrendResults(r.Context(), s.db, query.Get("scope"), query.Get("county"), query.Get("trend"))
+	if err != nil {
+		writeDatabaseError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"data": results,
+	})
+}
+
+// handleHotspots serves grid_hotspots for one variable, optionally filtered by period_start and classification
+func (s *APIServer) handleHotspots(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	variable := query.Get("variable")
+	if variable == "" {
+		variable = HotspotBrightness
+	}
+	if variable != HotspotBrightness && variable != HotspotOccurrenceDensity {
+		writeError(w, http.StatusBadRequest, "variable must be brightness or occurrence_density")
+		return
+	}
+
+	var periodStart *time.Time
+	if value := query.Get("period_start"); value != "" {
+		t, err := parseAPITime(value)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid period_start. Use ISO 8601 format (e.g., 2024-01-01)")
+			return
+		}
+		periodStart = &t
+	}
+
+	results, err := queryHotspotResults(r.Context(), s.db, variable, periodStart, query.Get("classification"))
+	if err != nil {
+		writeDatabaseError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"variable": variable,
+		"data":     results,
+	})
+}
+
+// runServer starts the API server and blocks until it fails or ctx is cancelled, in which case
+// in-flight requests get a few seconds to finish
+func runServer(ctx context.Context, db *sql.DB, addr string) error {
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           NewAPIServer(db).Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		logProgress("API server listening", "addr", addr)
+		errs <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+
+	slog.Info("Shutting down API server")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("error shutting down API server: %v", err)
+	}
+	return nil
+}
+
+// Light queries of the API handlers grouped by calendar month in Taiwan time, see storage.go for SQLite
+const (
+	postgresCountyBrightnessByMonthQuery = `
+		SELECT
+			county,
+			EXTRACT(MONTH FROM time AT TIME ZONE 'Asia/Taipei')::INTEGER as month,
+			AVG(brightness) as avg_brightness
+		FROM light_data_with_county
+		WHERE
+			time >= $1
+			AND time <= $2
+			AND county IS NOT NULL
+			AND brightness IS NOT NULL
+		GROUP BY county, EXTRACT(MONTH FROM time AT TIME ZONE 'Asia/Taipei')
+		ORDER BY county, month
+	`
+
+	postgresCountyBrightnessInMonthQuery = `
+		SELECT
+			county,
+			AVG(brightness) as avg_brightness
+		FROM light_data_with_county
+		WHERE
+			EXTRACT(MONTH FROM time AT TIME ZONE 'Asia/Taipei') = $1
+			AND county IS NOT NULL
+			AND brightness IS NOT NULL
+		GROUP BY county
+		ORDER BY county
+	`
+
+	postgresCountyBrightnessInYearMonthQuery = `
+		SELECT
+			county,
+			AVG(brightness) as avg_brightness
+		FROM light_data_with_county
+		WHERE
+			EXTRACT(MONTH FROM time AT TIME ZONE 'Asia/Taipei') = $1
+			AND EXTRACT(YEAR FROM time AT TIME ZONE 'Asia/Taipei') = $2
+			AND county IS NOT NULL
+			AND brightness IS NOT NULL
+		GROUP BY county
+		ORDER BY county
+	`
+
+	postgresCountyBrightnessTimelineQuery = `
+		SELECT
+			EXTRACT(MONTH FROM time AT TIME ZONE 'Asia/Taipei')::INTEGER as month,
+			AVG(brightness) as avg_brightness
+		FROM light_data_with_county
+		WHERE
+			EXTRACT(YEAR FROM time AT TIME ZONE 'Asia/Taipei') = $1
+			AND county = $2
+			AND brightness IS NOT NULL
+		GROUP BY EXTRACT(MONTH FROM time AT TIME ZONE 'Asia/Taipei')
+		ORDER BY month
+	`
+)
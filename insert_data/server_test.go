@@ -0,0 +1,32 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestGroupAnimalsByCountyEncodesEmptyAsArray(t *testing.T) {
+	for _, rows := range [][]AnimalAggregatedData{nil, {}} {
+		body, err := json.Marshal(groupAnimalsByCounty(rows))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(body) != "[]" {
+			t.Errorf("groupAnimalsByCounty(%v) encodes as %s, want []", rows, body)
+		}
+	}
+}
+
+func TestGroupAnimalsByCounty(t *testing.T) {
+	data := groupAnimalsByCounty([]AnimalAggregatedData{
+		{County: "臺北市", AnimalType: "bird", TotalAmount: 3, EventCount: 2},
+		{County: "臺北市", AnimalType: "insect", TotalAmount: 5, EventCount: 1},
+		{County: "花蓮縣", AnimalType: "bird", TotalAmount: 1, EventCount: 1},
+	})
+	if len(data) != 2 || data[0].County != "臺北市" || data[1].County != "花蓮縣" {
+		t.Fatalf("counties = %+v, want 臺北市 then 花蓮縣", data)
+	}
+	if len(data[0].Animals) != 2 || data[0].Animals[1].AnimalType != "insect" || data[0].Animals[1].TotalAmount != 5 {
+		t.Errorf("臺北市 animals = %+v", data[0].Animals)
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sort"
+	"syscall"
+	"time"
+)
+
+// withShutdownSignals returns a context cancelled by the first SIGINT or SIGTERM. Loaders stop taking new
+// files and batches but finish the batch they are writing; a second signal exits immediately.
+func withShutdownSignals(parent context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(parent)
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		select {
+		case sig := <-signals:
+			slog.Warn("Received signal, finishing current batches (send again to abort)", "signal", sig.String())
+			cancel()
+		case <-ctx.Done():
+			signal.Stop(signals)
+			return
+		}
+
+		sig := <-signals
+		slog.Error("Received signal again, aborting", "signal", sig.String())
+		os.Exit(130)
+	}()
+
+	return ctx, func() {
+		signal.Stop(signals)
+		cancel()
+	}
+}
+
+// isInterrupted reports whether err comes from a cancelled context
+func isInterrupted(err error) bool {
+	return errors.Is(err, context.Canceled)
+}
+
+// partialFile is an input file whose import stopped part way through
+type partialFile struct {
+	Path    string `json:"path"`
+	Records int64  `json:"records_read"`
+	Written int64  `json:"records_written"`
+}
+
+// importState records how far an interrupted import got
+type importState struct {
+	RunID         string        `json:"run_id"`
+	Mode          string        `json:"mode"`
+	InterruptedAt time.Time     `json:"interrupted_at"`
+	Completed     []string      `json:"completed_files"`
+	Partial       []partialFile `json:"partial_files"`
+	Failed        []string      `json:"failed_files"`
+	Pending       []string      `json:"pending_files"`
+}
+
+// writeImportState writes the per-file progress of an interrupted import to path
+func writeImportState(path, mode string, stats *ProcessingStats) error {
+	state := importState{
+		RunID:         runID,
+		Mode:          mode,
+		InterruptedAt: time.Now().UTC(),
+		Completed:     []string{},
+		Partial:       []partialFile{},
+		Failed:        []string{},
+	}
+
+	stats.filesMu.Lock()
+	for _, file := range stats.Files {
+		switch {
+		case file.Err == nil:
+			state.Completed = append(state.Completed, file.Path)
+		case isInterrupted(file.Err):
+			state.Partial = append(state.Partial, partialFile{Path: file.Path, Records: file.Records, Written: file.Written})
+		default:
+			state.Failed = append(state.Failed, file.Path)
+		}
+	}
+	state.Pending = append([]string{}, stats.Pending...)
+	stats.filesMu.Unlock()
+
+	sort.Strings(state.Completed)
+	sort.Slice(state.Partial, func(i, j int) bool { return state.Partial[i].Path < state.Partial[j].Path })
+	sort.Strings(state.Failed)
+	sort.Strings(state.Pending)
+
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding import state: %v", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("error writing import state %s: %v", path, err)
+	}
+
+	logProgress("Import interrupted", "completed", len(state.Completed), "partial", len(state.Partial),
+		"failed", len(state.Failed), "not_started", len(state.Pending), "state_file", path)
+	return nil
+}
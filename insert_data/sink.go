@@ -0,0 +1,268 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// LightRecord is a parsed light pixel ready to be written, matching a light_data_with_county row
+type LightRecord struct {
+	Time         time.Time `json:"time"`
+	Longitude    float64   `json:"longitude"`
+	Latitude     float64   `json:"latitude"`
+	Brightness   *float64  `json:"brightness"` // nil for NaN brightness
+	County       *string   `json:"county"`     // nil when the source has no county
+	Quality      *int      `json:"quality_flag"`
+	CloudFreeObs *int      `json:"cloud_free_obs"`
+}
+
+// BiologicalRecord is a parsed occurrence ready to be written, matching a biological_data row
+type BiologicalRecord struct {
+	SourceScientificName string     `json:"source_scientific_name"`
+	ScientificName       string     `json:"scientific_name"`
+	CommonNameC          string     `json:"common_name_c"`
+	BioGroup             string     `json:"bio_group"`
+	EventDate            *time.Time `json:"event_date"`
+	Created              *time.Time `json:"created"`
+	DatasetName          string     `json:"dataset_name"`
+	BasisOfRecord        string     `json:"basis_of_record"`
+	StandardLatitude     *float64   `json:"standard_latitude"`
+	StandardLongitude    *float64   `json:"standard_longitude"`
+	County               string     `json:"county"`
+	Municipality         string     `json:"municipality"`
+	Locality             string     `json:"locality"`
+	OrganismQuantity     string     `json:"organism_quantity"`
+	TaxonID              string     `json:"taxon_id"`
+	CatalogNumber        string     `json:"catalog_number"`
+	RecordNumber         string     `json:"record_number"`
+
+	// Filled by the taxonomy backbone, see TaxonomyBackbone.Resolve
+	NameMatch           string `json:"name_match,omitempty"`
+	AcceptedName        string `json:"accepted_name,omitempty"`
+	AcceptedTaxonID     string `json:"accepted_taxon_id,omitempty"`
+	AcceptedCommonNameC string `json:"accepted_common_name_c,omitempty"`
+	TaxonRank           string `json:"taxon_rank,omitempty"`
+	TaxonKingdom        string `json:"taxon_kingdom,omitempty"`
+	TaxonPhylum         string `json:"taxon_phylum,omitempty"`
+	TaxonClass          string `json:"taxon_class,omitempty"`
+	TaxonOrder          string `json:"taxon_order,omitempty"`
+	TaxonFamily         string `json:"taxon_family,omitempty"`
+	TaxonGenus          string `json:"taxon_genus,omitempty"`
+	TaxonSpecies        string `json:"taxon_species,omitempty"`
+}
+
+// Sink receives parsed records from the workers. Implementations must be safe for concurrent use;
+// ctx bounds each write.
+type Sink interface {
+	WriteLight(ctx context.Context, records []LightRecord) error
+	WriteBiological(ctx context.Context, records []BiologicalRecord) error
+	Flush() error
+	Close() error
+}
+
+// DBSink writes records into the light_data_with_county and biological_data tables of the selected storage.
+// Batches failing with a transient error are retried according to Retry.
+type DBSink struct {
+	db    *sql.DB
+	Retry RetryPolicy
+	stats *RetryStats
+}
+
+// NewDBSink writes to db with DefaultRetryPolicy; the tables must already exist
+func NewDBSink(db *sql.DB) *DBSink {
+	return &DBSink{db: db, Retry: DefaultRetryPolicy, stats: NewRetryStats()}
+}
+
+// RetryStats returns the retry statistics of all batches written so far
+func (s *DBSink) RetryStats() *RetryStats {
+	return s.stats
+}
+
+// WriteLight inserts the records in multi-row INSERTs, one transaction per batch, retrying transient failures
+func (s *DBSink) WriteLight(ctx context.Context, records []LightRecord) error {
+	batchSize := maxBatchRows(len(records), 7)
+	for i := 0; i < len(records); i += batchSize {
+		end := i + batchSize
+		if end > len(records) {
+			end = len(records)
+		}
+		batch := records[i:end]
+		err := withRetry(ctx, s.Retry, s.stats, "light batch", func() error {
+			return insertLightBatch(ctx, s.db, batch)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteBiological inserts the records in multi-row INSERTs, one transaction per batch, retrying transient failures
+func (s *DBSink) WriteBiological(ctx context.Context, records []BiologicalRecord) error {
+	batchSize := maxBatchRows(len(records), len(biologicalColumns))
+	for i := 0; i < len(records); i += batchSize {
+		end := i + batchSize
+		if end > len(records) {
+			end = len(records)
+		}
+		batch := records[i:end]
+		err := withRetry(ctx, s.Retry, s.stats, "biological batch", func() error {
+			return insertBiologicalBatch(ctx, s.db, batch)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Flush is a no-op, every write is committed before it returns
+func (s *DBSink) Flush() error { return nil }
+
+// Close leaves the shared connection pool open
+func (s *DBSink) Close() error { return nil }
+
+// CountingSink discards records and only counts them, for dry runs and tests
+type CountingSink struct {
+	lightRecords      int64
+	biologicalRecords int64
+}
+
+func NewCountingSink() *CountingSink {
+	return &CountingSink{}
+}
+
+func (s *CountingSink) WriteLight(ctx context.Context, records []LightRecord) error {
+	atomic.AddInt64(&s.lightRecords, int64(len(records)))
+	return nil
+}
+
+func (s *CountingSink) WriteBiological(ctx context.Context, records []BiologicalRecord) error {
+	atomic.AddInt64(&s.biologicalRecords, int64(len(records)))
+	return nil
+}
+
+func (s *CountingSink) Flush() error { return nil }
+
+func (s *CountingSink) Close() error { return nil }
+
+// Counts returns the number of light and biological records written so far
+func (s *CountingSink) Counts() (light, biological int64) {
+	return atomic.LoadInt64(&s.lightRecords), atomic.LoadInt64(&s.biologicalRecords)
+}
+
+// FileSink writes records as newline-delimited JSON to light.ndjson and biological.ndjson in a directory
+type FileSink struct {
+	dir        string
+	mu         sync.Mutex
+	light      *ndjsonFile
+	biological *ndjsonFile
+}
+
+type ndjsonFile struct {
+	file    *os.File
+	out     *bufio.Writer
+	encoder *json.Encoder
+}
+
+// NewFileSink creates dir if needed; the files are created on first write
+func NewFileSink(dir string) (*FileSink, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("error creating output directory %s: %v", dir, err)
+	}
+	return &FileSink{dir: dir}, nil
+}
+
+func (s *FileSink) open(name string) (*ndjsonFile, error) {
+	path := filepath.Join(s.dir, name)
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("error creating %s: %v", path, err)
+	}
+	out := bufio.NewWriterSize(file, 1<<20)
+	return &ndjsonFile{file: file, out: out, encoder: json.NewEncoder(out)}, nil
+}
+
+func (s *FileSink) WriteLight(ctx context.Context, records []LightRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.light == nil {
+		f, err := s.open("light.ndjson")
+		if err != nil {
+			return err
+		}
+		s.light = f
+	}
+	for _, record := range records {
+		if err := s.light.encoder.Encode(record); err != nil {
+			return fmt.Errorf("error writing light record: %v", err)
+		}
+	}
+	return nil
+}
+
+func (s *FileSink) WriteBiological(ctx context.Context, records []BiologicalRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.biological == nil {
+		f, err := s.open("biological.ndjson")
+		if err != nil {
+			return err
+		}
+		s.biological = f
+	}
+	for _, record := range records {
+		if err := s.biological.encoder.Encode(record); err != nil {
+			return fmt.Errorf("error writing biological record: %v", err)
+		}
+	}
+	return nil
+}
+
+// Flush writes buffered records to the files
+func (s *FileSink) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, f := range []*ndjsonFile{s.light, s.biological} {
+		if f == nil {
+			continue
+		}
+		if err := f.out.Flush(); err != nil {
+			return fmt.Errorf("error flushing %s: %v", f.file.Name(), err)
+		}
+	}
+	return nil
+}
+
+// Close flushes and closes the files
+func (s *FileSink) Close() error {
+	if err := s.Flush(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var firstErr error
+	for _, f := range []*ndjsonFile{s.light, s.biological} {
+		if f == nil {
+			continue
+		}
+		if err := f.file.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	s.light, s.biological = nil, nil
+	return firstErr
+}
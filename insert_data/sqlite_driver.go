@@ -0,0 +1,6 @@
+//go:build sqlite
+
+package main
+
+// Pure Go SQLite driver (no cgo) registered as "sqlite", compiled in with go build -tags sqlite
+import _ "github.com/glebarez/go-sqlite"
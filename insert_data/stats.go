@@ -0,0 +1,340 @@
+package main
+
+import (
+	"math"
+	"sort"
+)
+
+// mean returns the arithmetic mean, NaN for an empty slice
+func mean(v []float64) float64 {
+	if len(v) == 0 {
+		return math.NaN()
+	}
+	var sum float64
+	for _, x := range v {
+		sum += x
+	}
+	return sum / float64(len(v))
+}
+
+// standardDeviation returns the sample standard deviation, NaN with fewer than two values
+func standardDeviation(v []float64) float64 {
+	if len(v) < 2 {
+		return math.NaN()
+	}
+	m := mean(v)
+	var ss float64
+	for _, x := range v {
+		ss += (x - m) * (x - m)
+	}
+	return math.Sqrt(ss / float64(len(v)-1))
+}
+
+// pearson returns the Pearson correlation of x and y, NaN when either is constant
+func pearson(x, y []float64) float64 {
+	mx, my := mean(x), mean(y)
+	var sxy, sxx, syy float64
+	for i := range x {
+		dx, dy := x[i]-mx, y[i]-my
+		sxy += dx * dy
+		sxx += dx * dx
+		syy += dy * dy
+	}
+	if sxx == 0 || syy == 0 {
+		return math.NaN()
+	}
+	return sxy / math.Sqrt(sxx*syy)
+}
+
+// ranks returns the 1-based ranks of v, ties sharing their average rank
+func ranks(v []float64) []float64 {
+	order := make([]int, len(v))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return v[order[a]] < v[order[b]] })
+
+	result := make([]float64, len(v))
+	for i := 0; i < len(order); {
+		j := i
+		for j+1 < len(order) && v[order[j+1]] == v[order[i]] {
+			j++
+		}
+		rank := float64(i+j)/2 + 1
+		for k := i; k <= j; k++ {
+			result[order[k]] = rank
+		}
+		i = j + 1
+	}
+	return result
+}
+
+// spearman returns the Spearman rank correlation of x and y
+func spearman(x, y []float64) float64 {
+	return pearson(ranks(x), ranks(y))
+}
+
+// linearFit is an ordinary least squares fit of y = Intercept + Slope*x
+type linearFit struct {
+	Slope     float64
+	Intercept float64
+	SlopeSE   float64 // standard error of the slope, NaN with fewer than three points
+}
+
+// fitLine fits y against x by ordinary least squares; the slope is NaN when x is constant
+func fitLine(x, y []float64) linearFit {
+	n := float64(len(x))
+	mx, my := mean(x), mean(y)
+	var sxy, sxx float64
+	for i := range x {
+		sxy += (x[i] - mx) * (y[i] - my)
+		sxx += (x[i] - mx) * (x[i] - mx)
+	}
+	if sxx == 0 {
+		return linearFit{Slope: math.NaN(), Intercept: math.NaN(), SlopeSE: math.NaN()}
+	}
+
+	fit := linearFit{Slope: sxy / sxx}
+	fit.Intercept = my - fit.Slope*mx
+	fit.SlopeSE = math.NaN()
+	if n > 2 {
+		var sse float64
+		for i := range x {
+			residual := y[i] - fit.Intercept - fit.Slope*x[i]
+			sse += residual * residual
+		}
+		fit.SlopeSE = math.Sqrt(sse / (n - 2) / sxx)
+	}
+	return fit
+}
+
+// fisherInterval returns the confidence interval of a correlation r through the Fisher z transform,
+// where se is the standard error of z
+func fisherInterval(r, se, confidence float64) (float64, float64) {
+	if math.IsNaN(r) || math.IsNaN(se) {
+		return math.NaN(), math.NaN()
+	}
+	z := math.Atanh(math.Max(-0.999999999, math.Min(0.999999999, r)))
+	half := normalQuantile(0.5+confidence/2) * se
+	return math.Tanh(z - half), math.Tanh(z + half)
+}
+
+// correlationPValue is the two-sided p-value of r over n pairs under the t approximation
+func correlationPValue(r float64, n int) float64 {
+	if math.IsNaN(r) || n < 3 {
+		return math.NaN()
+	}
+	if math.Abs(r) >= 1 {
+		return 0
+	}
+	df := float64(n - 2)
+	t := r * math.Sqrt(df/(1-r*r))
+	return 2 * (1 - studentTCDF(math.Abs(t), df))
+}
+
+// normalCDF is the standard normal cumulative distribution function
+func normalCDF(z float64) float64 {
+	return 0.5 * math.Erfc(-z/math.Sqrt2)
+}
+
+// normalQuantile is the inverse of normalCDF
+func normalQuantile(p float64) float64 {
+	return math.Sqrt2 * math.Erfinv(2*p-1)
+}
+
+// studentTCDF is the cumulative distribution function of Student's t with df degrees of freedom
+func studentTCDF(t, df float64) float64 {
+	x := df / (df + t*t)
+	tail := 0.5 * regularizedIncompleteBeta(df/2, 0.5, x)
+	if t >= 0 {
+		return 1 - tail
+	}
+	return tail
+}
+
+// studentTQuantile inverts studentTCDF by bisection
+func studentTQuantile(p, df float64) float64 {
+	if p == 0.5 {
+		return 0
+	}
+	lo, hi := -1e3, 1e3
+	for i := 0; i < 200 && hi-lo > 1e-12; i++ {
+		mid := (lo + hi) / 2
+		if studentTCDF(mid, df) < p {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return (lo + hi) / 2
+}
+
+// regularizedIncompleteBeta is I_x(a, b), evaluated by its continued fraction (modified Lentz)
+func regularizedIncompleteBeta(a, b, x float64) float64 {
+	if x <= 0 {
+		return 0
+	}
+	if x >= 1 {
+		return 1
+	}
+	// The continued fraction converges quickly only below the mean of the distribution
+	if x > (a+1)/(a+b+2) {
+		return 1 - regularizedIncompleteBeta(b, a, 1-x)
+	}
+
+	lgab, _ := math.Lgamma(a + b)
+	lga, _ := math.Lgamma(a)
+	lgb, _ := math.Lgamma(b)
+	front := math.Exp(lgab-lga-lgb+a*math.Log(x)+b*math.Log(1-x)) / a
+
+	const tiny = 1e-300
+	f, c, d := 1.0, 1.0, 0.0
+	for i := 0; i <= 300; i++ {
+		m := float64(i / 2)
+		var numerator float64
+		switch {
+		case i == 0:
+			numerator = 1
+		case i%2 == 0:
+			numerator = m * (b - m) * x / ((a + 2*m - 1) * (a + 2*m))
+		default:
+			numerator = -(a + m) * (a + b + m) * x / ((a + 2*m) * (a + 2*m + 1))
+		}
+
+		d = 1 + numerator*d
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		d = 1 / d
+		c = 1 + numerator/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		cd := c * d
+		f *= cd
+		if math.Abs(1-cd) < 1e-14 {
+			break
+		}
+	}
+	return front * (f - 1)
+}
+
+// finitePtr returns nil for NaN and infinities, for nullable result columns
+func finitePtr(v float64) *float64 {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return nil
+	}
+	return &v
+}
+
+// shannonIndex is the Shannon diversity H' = -Σ p ln p of the abundances, NaN when they sum to zero
+func shannonIndex(abundances []float64) float64 {
+	var total float64
+	for _, a := range abundances {
+		total += a
+	}
+	if total <= 0 {
+		return math.NaN()
+	}
+	var h float64
+	for _, a := range abundances {
+		if a > 0 {
+			p := a / total
+			h -= p * math.Log(p)
+		}
+	}
+	return h
+}
+
+// simpsonIndex is the Gini-Simpson diversity 1 - Σ p², the chance two draws with replacement differ in species
+func simpsonIndex(abundances []float64) float64 {
+	var total float64
+	for _, a := range abundances {
+		total += a
+	}
+	if total <= 0 {
+		return math.NaN()
+	}
+	var d float64
+	for _, a := range abundances {
+		p := a / total
+		d += p * p
+	}
+	return 1 - d
+}
+
+// pielouEvenness is Pielou's J = H' / ln S over richness species, NaN below two species
+func pielouEvenness(shannon float64, richness int) float64 {
+	if richness < 2 {
+		return math.NaN()
+	}
+	return shannon / math.Log(float64(richness))
+}
+
+// median returns the median of v without reordering it, NaN for an empty slice
+func median(v []float64) float64 {
+	if len(v) == 0 {
+		return math.NaN()
+	}
+	sorted := append([]float64(nil), v...)
+	sort.Float64s(sorted)
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 1 {
+		return sorted[mid]
+	}
+	return (sorted[mid-1] + sorted[mid]) / 2
+}
+
+// mannKendall returns the Mann-Kendall statistic S of a time-ordered series and its variance under
+// no trend, corrected for tied values
+func mannKendall(v []float64) (s, variance float64) {
+	n := len(v)
+	for i := 0; i < n; i++ {
+		for j := i + 1; j < n; j++ {
+			switch {
+			case v[j] > v[i]:
+				s++
+			case v[j] < v[i]:
+				s--
+			}
+		}
+	}
+
+	ties := make(map[float64]int)
+	for _, x := range v {
+		ties[x]++
+	}
+	nf := float64(n)
+	variance = nf * (nf - 1) * (2*nf + 5)
+	for _, t := range ties {
+		tf := float64(t)
+		variance -= tf * (tf - 1) * (2*tf + 5)
+	}
+	return s, variance / 18
+}
+
+// mannKendallZ is the continuity-corrected normal score of S, NaN when the variance is zero
+func mannKendallZ(s, variance float64) float64 {
+	if variance <= 0 {
+		return math.NaN()
+	}
+	switch {
+	case s > 0:
+		return (s - 1) / math.Sqrt(variance)
+	case s < 0:
+		return (s + 1) / math.Sqrt(variance)
+	}
+	return 0
+}
+
+// pairwiseSlopes appends the slopes between every pair of points with distinct x, the terms of Sen's slope
+func pairwiseSlopes(slopes, x, y []float64) []float64 {
+	for i := range x {
+		for j := i + 1; j < len(x); j++ {
+			if x[j] != x[i] {
+				slopes = append(slopes, (y[j]-y[i])/(x[j]-x[i]))
+			}
+		}
+	}
+	return slopes
+}
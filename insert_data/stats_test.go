@@ -0,0 +1,91 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func closeTo(got, want, tolerance float64) bool {
+	return math.Abs(got-want) <= tolerance
+}
+
+func TestRegularizedIncompleteBeta(t *testing.T) {
+	tests := []struct {
+		a, b, x, want float64
+	}{
+		{1, 1, 0.3, 0.3},             // uniform distribution
+		{2, 3, 0.4, 0.5248},          // binomial sum over 4 trials
+		{0.5, 0.5, 0.5, 0.5},         // symmetric arcsine distribution
+		{5, 0.5, 0.9, 0.31664291500}, // past the mean, through the symmetry relation
+		{2, 2, 0, 0},
+		{2, 2, 1, 1},
+	}
+	for _, tt := range tests {
+		if got := regularizedIncompleteBeta(tt.a, tt.b, tt.x); !closeTo(got, tt.want, 1e-9) {
+			t.Errorf("I_%g(%g, %g) = %.12f, want %.12f", tt.x, tt.a, tt.b, got, tt.want)
+		}
+	}
+
+	// I_x(a, b) = 1 - I_{1-x}(b, a)
+	for _, x := range []float64{0.05, 0.3, 0.7, 0.95} {
+		if sum := regularizedIncompleteBeta(3, 7, x) + regularizedIncompleteBeta(7, 3, 1-x); !closeTo(sum, 1, 1e-12) {
+			t.Errorf("I_%g(3, 7) + I_%g(7, 3) = %.15f, want 1", x, 1-x, sum)
+		}
+	}
+}
+
+func TestStudentTQuantile(t *testing.T) {
+	tests := []struct {
+		p, df, want float64
+	}{
+		{0.975, 1, 12.706204736174698}, // Cauchy, tan(0.475π)
+		{0.975, 10, 2.2281388519649385},
+		{0.95, 5, 2.015048372669157},
+		{0.025, 10, -2.2281388519649385},
+		{0.5, 3, 0},
+		{0.975, 1e6, 1.9599664}, // close to the normal quantile
+	}
+	for _, tt := range tests {
+		if got := studentTQuantile(tt.p, tt.df); !closeTo(got, tt.want, 1e-6) {
+			t.Errorf("studentTQuantile(%g, %g) = %.10f, want %.10f", tt.p, tt.df, got, tt.want)
+		}
+	}
+
+	// The quantile inverts the distribution function
+	for _, p := range []float64{0.01, 0.2, 0.8, 0.999} {
+		if got := studentTCDF(studentTQuantile(p, 7), 7); !closeTo(got, p, 1e-9) {
+			t.Errorf("studentTCDF(studentTQuantile(%g, 7), 7) = %.12f", p, got)
+		}
+	}
+}
+
+func TestMannKendall(t *testing.T) {
+	tests := []struct {
+		name     string
+		series   []float64
+		s, v     float64
+		positive bool
+	}{
+		{"increasing", []float64{1, 2, 3, 4}, 6, 4 * 3 * 13 / 18.0, true},
+		{"decreasing", []float64{4, 3, 2, 1}, -6, 4 * 3 * 13 / 18.0, false},
+		{"tied pair", []float64{1, 1, 2}, 2, (3*2*11 - 2*1*9) / 18.0, true},
+		{"mixed", []float64{1, 3, 2, 5, 4}, 6, 5 * 4 * 15 / 18.0, true},
+	}
+	for _, tt := range tests {
+		s, v := mannKendall(tt.series)
+		if s != tt.s || !closeTo(v, tt.v, 1e-12) {
+			t.Errorf("%s: mannKendall = (%g, %g), want (%g, %g)", tt.name, s, v, tt.s, tt.v)
+		}
+		if z := mannKendallZ(s, v); (z > 0) != tt.positive {
+			t.Errorf("%s: mannKendallZ = %g has the wrong sign", tt.name, z)
+		}
+	}
+
+	// The continuity correction moves S one step towards zero
+	if z := mannKendallZ(6, 9); !closeTo(z, 5.0/3, 1e-12) {
+		t.Errorf("mannKendallZ(6, 9) = %g, want 5/3", z)
+	}
+	if z := mannKendallZ(0, 0); !math.IsNaN(z) {
+		t.Errorf("mannKendallZ of a constant series = %g, want NaN", z)
+	}
+}
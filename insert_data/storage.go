@@ -0,0 +1,443 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Storage captures the SQL differences between the backends the insert and migrate functions run against
+type Storage interface {
+	// Name is the database/sql driver name of the backend
+	Name() string
+	// SchemaDDL adapts PostgreSQL table DDL to the backend
+	SchemaDDL(ddl string) string
+	// MigrationQuery returns the INSERT ... SELECT filling an aggregate table from biological_data
+	MigrationQuery(table string) (string, error)
+	// AnalysisQuery returns a SELECT read by the analysis commands, the migration steps computed in Go
+	// and the API handlers that needs backend-specific date functions
+	AnalysisQuery(name string) (string, error)
+	// MaxParams is the most bind parameters a single statement may use
+	MaxParams() int
+}
+
+// store is the backend selected by the --db DSN, PostgreSQL unless a sqlite DSN is given
+var store Storage = postgresStorage{}
+
+// openStorage opens the backend selected by the DSN scheme: postgres:// or postgresql:// for PostgreSQL,
+// sqlite://path, sqlite:path or file:path for an embedded SQLite file
+func openStorage(ctx context.Context, dsn string) (*sql.DB, Storage, error) {
+	switch {
+	case strings.HasPrefix(dsn, "sqlite://"):
+		return openSQLite(ctx, strings.TrimPrefix(dsn, "sqlite://"))
+	case strings.HasPrefix(dsn, "sqlite:"):
+		return openSQLite(ctx, strings.TrimPrefix(dsn, "sqlite:"))
+	case strings.HasPrefix(dsn, "file:"):
+		return openSQLite(ctx, dsn)
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Configure connection pool for better performance
+	db.SetMaxOpenConns(25)
+	db.SetMaxIdleConns(10)
+	db.SetConnMaxLifetime(5 * time.Minute)
+	return db, postgresStorage{}, nil
+}
+
+// openSQLite opens an embedded SQLite database file. The driver is linked in with -tags sqlite.
+func openSQLite(ctx context.Context, path string) (*sql.DB, Storage, error) {
+	if path == "" {
+		return nil, nil, fmt.Errorf("sqlite DSN has no database path")
+	}
+
+	registered := false
+	for _, driver := range sql.Drivers() {
+		if driver == "sqlite" {
+			registered = true
+		}
+	}
+	if !registered {
+		return nil, nil, fmt.Errorf("sqlite support is not compiled in, rebuild with -tags sqlite")
+	}
+
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// SQLite allows a single writer; one connection keeps the pragmas and avoids "database is locked"
+	db.SetMaxOpenConns(1)
+	for _, pragma := range []string{"PRAGMA journal_mode = WAL", "PRAGMA synchronous = NORMAL", "PRAGMA busy_timeout = 5000"} {
+		if _, err := db.ExecContext(ctx, pragma); err != nil {
+			db.Close()
+			return nil, nil, fmt.Errorf("error configuring sqlite (%s): %v", pragma, err)
+		}
+	}
+	return db, sqliteStorage{}, nil
+}
+
+// maxBatchRows caps a batch size so one multi-row INSERT stays within the backend's parameter limit
+func maxBatchRows(batchSize, paramsPerRow int) int {
+	if limit := store.MaxParams() / paramsPerRow; limit < batchSize {
+		return limit
+	}
+	return batchSize
+}
+
+// rowValues is implemented by the pointer of a result struct listing its values in the order of the
+// table's columns slice, e.g. *TrendResult and trendColumns
+type rowValues[T any] interface {
+	*T
+	values() []interface{}
+}
+
+// insertRows writes rows into the columns of table in multi-row INSERTs within tx
+func insertRows[T any, P rowValues[T]](ctx context.Context, tx *sql.Tx, table string, columns []string, rows []T) error {
+	return upsertRows[T, P](ctx, tx, table, columns, rows, "")
+}
+
+// upsertRows is insertRows with an ON CONFLICT clause appended to every INSERT, e.g. to merge rows into
+// existing ones. A single INSERT may not touch the same row twice, so rows must have distinct keys.
+func upsertRows[T any, P rowValues[T]](ctx context.Context, tx *sql.Tx, table string, columns []string, rows []T, onConflict string) error {
+	batchSize := maxBatchRows(1000, len(columns))
+	for i := 0; i < len(rows); i += batchSize {
+		end := min(i+batchSize, len(rows))
+
+		valueStrings := make([]string, 0, end-i)
+		valueArgs := make([]interface{}, 0, (end-i)*len(columns))
+		for j := i; j < end; j++ {
+			placeholders := make([]string, len(columns))
+			for k := range placeholders {
+				placeholders[k] = fmt.Sprintf("$%d", len(valueArgs)+k+1)
+			}
+			valueStrings = append(valueStrings, "("+strings.Join(placeholders, ", ")+")")
+			valueArgs = append(valueArgs, P(&rows[j]).values()...)
+		}
+
+		query := fmt.Sprintf("INSERT INTO %s (%s) VALUES %s %s",
+			table, strings.Join(columns, ", "), strings.Join(valueStrings, ","), onConflict)
+		if _, err := tx.ExecContext(ctx, query, valueArgs...); err != nil {
+			return fmt.Errorf("error inserting into %s: %v", table, err)
+		}
+	}
+	return nil
+}
+
+// replaceRows clears table and writes rows in its place within tx, so a failed run keeps the previous
+// contents once tx is rolled back
+func replaceRows[T any, P rowValues[T]](ctx context.Context, tx *sql.Tx, table string, columns []string, rows []T) error {
+	if _, err := tx.ExecContext(ctx, "DELETE FROM "+table); err != nil {
+		return fmt.Errorf("error clearing %s: %v", table, err)
+	}
+	return insertRows[T, P](ctx, tx, table, columns, rows)
+}
+
+// replaceTable swaps the contents of table for rows in one transaction, keeping the previous contents if
+// the write fails or ctx is cancelled
+func replaceTable[T any, P rowValues[T]](ctx context.Context, db *sql.DB, table string, columns []string, rows []T) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if err := replaceRows[T, P](ctx, tx, table, columns, rows); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// postgresStorage is the PostgreSQL server backend the DDL and queries are written for
+type postgresStorage struct{}
+
+func (postgresStorage) Name() string { return "postgres" }
+
+func (postgresStorage) SchemaDDL(ddl string) string { return ddl }
+
+func (postgresStorage) MigrationQuery(table string) (string, error) {
+	switch table {
+	case "animal_aggregated_data":
+		return postgresAnimalAggregationQuery, nil
+	case "dataset_stats_aggregated":
+		return postgresDatasetStatsAggregationQuery, nil
+	case "sampling_effort_aggregated":
+		return postgresSamplingEffortAggregationQuery, nil
+	}
+	return "", fmt.Errorf("no migration query for %s", table)
+}
+
+func (postgresStorage) AnalysisQuery(name string) (string, error) {
+	switch name {
+	case "county_monthly_brightness":
+		return postgresCountyMonthlyBrightnessQuery, nil
+	case "county_monthly_species_abundance":
+		return postgresSpeciesAbundanceQuery, nil
+	case "county_brightness_by_month":
+		return postgresCountyBrightnessByMonthQuery, nil
+	case "county_brightness_in_month":
+		return postgresCountyBrightnessInMonthQuery, nil
+	case "county_brightness_in_year_month":
+		return postgresCountyBrightnessInYearMonthQuery, nil
+	case "county_brightness_timeline":
+		return postgresCountyBrightnessTimelineQuery, nil
+	}
+	return "", fmt.Errorf("no analysis query %s", name)
+}
+
+func (postgresStorage) MaxParams() int { return 65535 }
+
+// sqliteStorage is an embedded SQLite file producing the same tables and aggregates for offline analysis
+type sqliteStorage struct{}
+
+var (
+	sqliteDDLReplacer = strings.NewReplacer(
+		"SERIAL PRIMARY KEY", "INTEGER PRIMARY KEY AUTOINCREMENT",
+		"TIMESTAMPTZ", "TIMESTAMP",
+		"DEFAULT NOW()", "DEFAULT CURRENT_TIMESTAMP",
+	)
+	// SQLite has no ADD COLUMN IF NOT EXISTS; embedded databases are always created with every column
+	sqliteAddColumnPattern = regexp.MustCompile(`(?m)^\s*ALTER TABLE \w+ ADD COLUMN IF NOT EXISTS [^;]*;\s*$`)
+)
+
+func (sqliteStorage) Name() string { return "sqlite" }
+
+func (sqliteStorage) SchemaDDL(ddl string) string {
+	return sqliteDDLReplacer.Replace(sqliteAddColumnPattern.ReplaceAllString(ddl, ""))
+}
+
+func (sqliteStorage) MigrationQuery(table string) (string, error) {
+	switch table {
+	case "animal_aggregated_data":
+		return sqliteAnimalAggregationQuery, nil
+	case "dataset_stats_aggregated":
+		return sqliteDatasetStatsAggregationQuery, nil
+	case "sampling_effort_aggregated":
+		return sqliteSamplingEffortAggregationQuery, nil
+	}
+	return "", fmt.Errorf("no migration query for %s", table)
+}
+
+func (sqliteStorage) AnalysisQuery(name string) (string, error) {
+	switch name {
+	case "county_monthly_brightness":
+		return sqliteCountyMonthlyBrightnessQuery, nil
+	case "county_monthly_species_abundance":
+		return sqliteSpeciesAbundanceQuery, nil
+	case "county_brightness_by_month":
+		return sqliteCountyBrightnessByMonthQuery, nil
+	case "county_brightness_in_month":
+		return sqliteCountyBrightnessInMonthQuery, nil
+	case "county_brightness_in_year_month":
+		return sqliteCountyBrightnessInYearMonthQuery, nil
+	case "county_brightness_timeline":
+		return sqliteCountyBrightnessTimelineQuery, nil
+	}
+	return "", fmt.Errorf("no analysis query %s", name)
+}
+
+// MaxParams stays at the pre-3.32 SQLITE_MAX_VARIABLE_NUMBER rather than the 32766 SQLite allows:
+// the driver resolves every bind parameter by scanning all of them, so binding grows quadratically
+// with the parameter count and a few hundred rows per INSERT is faster than thousands
+func (sqliteStorage) MaxParams() int { return 999 }
+
+// SQLite versions of the aggregation queries in migrate.go. Timestamps are stored as text with their
+// offset, which strftime normalizes to UTC; the '+8 hours' modifier groups them by calendar month in
+// Taiwan time like the PostgreSQL queries and TaiwanLocation.
+const (
+	sqliteAnimalAggregationQuery = `
+		INSERT INTO animal_aggregated_data
+		(county, animal_type, activity_period, year, month, season, total_amount, event_count, created_at, updated_at)
+		SELECT
+			COALESCE(county, 'Unknown') as county,
+			COALESCE(bio_group, 'Unknown') as animal_type,
+			COALESCE(ta.activity_period, 'unknown') as activity_period,
+			CAST(strftime('%Y', event_date, '+8 hours') AS INTEGER) as year,
+			CAST(strftime('%m', event_date, '+8 hours') AS INTEGER) as month,
+			CASE
+				WHEN CAST(strftime('%m', event_date, '+8 hours') AS INTEGER) BETWEEN 3 AND 5 THEN 1
+				WHEN CAST(strftime('%m', event_date, '+8 hours') AS INTEGER) BETWEEN 6 AND 8 THEN 2
+				WHEN CAST(strftime('%m', event_date, '+8 hours') AS INTEGER) BETWEEN 9 AND 11 THEN 3
+				ELSE 4
+			END as season,
+			COALESCE(SUM(
+				CASE
+					WHEN organism_quantity <> '' AND organism_quantity NOT GLOB '*[^0-9]*' THEN CAST(organism_quantity AS INTEGER)
+					ELSE 1
+				END
+			), 0) as total_amount,
+			COUNT(*) as event_count,
+			CURRENT_TIMESTAMP as created_at,
+			CURRENT_TIMESTAMP as updated_at
+		FROM biological_data
+		LEFT JOIN taxon_activity ta ON ta.scientific_name = COALESCE(biological_data.accepted_name, biological_data.scientific_name)
+		WHERE event_date IS NOT NULL
+			AND strftime('%Y', event_date, '+8 hours') IS NOT NULL
+			AND CAST(strftime('%m', event_date, '+8 hours') AS INTEGER) BETWEEN 1 AND 12
+		GROUP BY
+			COALESCE(county, 'Unknown'),
+			COALESCE(bio_group, 'Unknown'),
+			COALESCE(ta.activity_period, 'unknown'),
+			strftime('%Y', event_date, '+8 hours'),
+			strftime('%m', event_date, '+8 hours')
+		ORDER BY year, month, county, animal_type, activity_period
+	`
+
+	sqliteDatasetStatsAggregationQuery = `
+		INSERT INTO dataset_stats_aggregated
+		(dataset, county, year, month, count, created_at, updated_at)
+		SELECT
+			COALESCE(dataset_name, 'Unknown') as dataset,
+			COALESCE(county, 'Unknown') as county,
+			CAST(strftime('%Y', event_date, '+8 hours') AS INTEGER) as year,
+			CAST(strftime('%m', event_date, '+8 hours') AS INTEGER) as month,
+			COUNT(*) as count,
+			CURRENT_TIMESTAMP as created_at,
+			CURRENT_TIMESTAMP as updated_at
+		FROM biological_data
+		WHERE event_date IS NOT NULL
+			AND strftime('%Y', event_date, '+8 hours') IS NOT NULL
+			AND CAST(strftime('%m', event_date, '+8 hours') AS INTEGER) BETWEEN 1 AND 12
+		GROUP BY
+			COALESCE(dataset_name, 'Unknown'),
+			COALESCE(county, 'Unknown'),
+			strftime('%Y', event_date, '+8 hours'),
+			strftime('%m', event_date, '+8 hours')
+		ORDER BY year, month, dataset, county
+	`
+
+	sqliteSamplingEffortAggregationQuery = `
+		INSERT INTO sampling_effort_aggregated
+		(county, year, month, season, dataset_count, observation_days, locality_count, event_count, created_at, updated_at)
+		SELECT
+			COALESCE(county, 'Unknown') as county,
+			CAST(strftime('%Y', event_date, '+8 hours') AS INTEGER) as year,
+			CAST(strftime('%m', event_date, '+8 hours') AS INTEGER) as month,
+			CASE
+				WHEN CAST(strftime('%m', event_date, '+8 hours') AS INTEGER) BETWEEN 3 AND 5 THEN 1
+				WHEN CAST(strftime('%m', event_date, '+8 hours') AS INTEGER) BETWEEN 6 AND 8 THEN 2
+				WHEN CAST(strftime('%m', event_date, '+8 hours') AS INTEGER) BETWEEN 9 AND 11 THEN 3
+				ELSE 4
+			END as season,
+			COUNT(DISTINCT dataset_name) as dataset_count,
+			COUNT(DISTINCT date(event_date, '+8 hours')) as observation_days,
+			COUNT(DISTINCT COALESCE(
+				NULLIF(TRIM(locality), ''),
+				printf('%.3f,%.3f', standard_longitude, standard_latitude)
+			)) as locality_count,
+			COUNT(*) as event_count,
+			CURRENT_TIMESTAMP as created_at,
+			CURRENT_TIMESTAMP as updated_at
+		FROM biological_data
+		WHERE event_date IS NOT NULL
+			AND strftime('%Y', event_date, '+8 hours') IS NOT NULL
+			AND CAST(strftime('%m', event_date, '+8 hours') AS INTEGER) BETWEEN 1 AND 12
+		GROUP BY
+			COALESCE(county, 'Unknown'),
+			strftime('%Y', event_date, '+8 hours'),
+			strftime('%m', event_date, '+8 hours')
+		ORDER BY year, month, county
+	`
+)
+
+// SQLite versions of the analysis queries
+const (
+	sqliteCountyMonthlyBrightnessQuery = `
+		SELECT
+			county,
+			CAST(strftime('%Y', time, '+8 hours') AS INTEGER) as year,
+			CAST(strftime('%m', time, '+8 hours') AS INTEGER) as month,
+			AVG(brightness) as mean_brightness,
+			COUNT(*) as pixel_count
+		FROM trusted_light
+		WHERE county IS NOT NULL AND brightness IS NOT NULL
+		GROUP BY county, strftime('%Y', time, '+8 hours'), strftime('%m', time, '+8 hours')
+	`
+
+	sqliteSpeciesAbundanceQuery = `
+		SELECT
+			COALESCE(county, 'Unknown') as county,
+			CAST(strftime('%Y', event_date, '+8 hours') AS INTEGER) as year,
+			CAST(strftime('%m', event_date, '+8 hours') AS INTEGER) as month,
+			COALESCE(accepted_name, scientific_name) as scientific_name,
+			COALESCE(SUM(
+				CASE
+					WHEN organism_quantity <> '' AND organism_quantity NOT GLOB '*[^0-9]*' THEN CAST(organism_quantity AS INTEGER)
+					ELSE 1
+				END
+			), 0) as total_amount,
+			COUNT(*) as event_count
+		FROM biological_data
+		WHERE event_date IS NOT NULL
+			AND TRIM(COALESCE(accepted_name, scientific_name)) <> ''
+			AND strftime('%Y', event_date, '+8 hours') IS NOT NULL
+			AND CAST(strftime('%m', event_date, '+8 hours') AS INTEGER) BETWEEN 1 AND 12
+		GROUP BY
+			COALESCE(county, 'Unknown'),
+			strftime('%Y', event_date, '+8 hours'),
+			strftime('%m', event_date, '+8 hours'),
+			COALESCE(accepted_name, scientific_name)
+		ORDER BY county, year, month
+	`
+
+	sqliteCountyBrightnessByMonthQuery = `
+		SELECT
+			county,
+			CAST(strftime('%m', time, '+8 hours') AS INTEGER) as month,
+			AVG(brightness) as avg_brightness
+		FROM light_data_with_county
+		WHERE
+			time >= $1
+			AND time <= $2
+			AND county IS NOT NULL
+			AND brightness IS NOT NULL
+		GROUP BY county, strftime('%m', time, '+8 hours')
+		ORDER BY county, month
+	`
+
+	sqliteCountyBrightnessInMonthQuery = `
+		SELECT
+			county,
+			AVG(brightness) as avg_brightness
+		FROM light_data_with_county
+		WHERE
+			CAST(strftime('%m', time, '+8 hours') AS INTEGER) = $1
+			AND county IS NOT NULL
+			AND brightness IS NOT NULL
+		GROUP BY county
+		ORDER BY county
+	`
+
+	sqliteCountyBrightnessInYearMonthQuery = `
+		SELECT
+			county,
+			AVG(brightness) as avg_brightness
+		FROM light_data_with_county
+		WHERE
+			CAST(strftime('%m', time, '+8 hours') AS INTEGER) = $1
+			AND CAST(strftime('%Y', time, '+8 hours') AS INTEGER) = $2
+			AND county IS NOT NULL
+			AND brightness IS NOT NULL
+		GROUP BY county
+		ORDER BY county
+	`
+
+	sqliteCountyBrightnessTimelineQuery = `
+		SELECT
+			CAST(strftime('%m', time, '+8 hours') AS INTEGER) as month,
+			AVG(brightness) as avg_brightness
+		FROM light_data_with_county
+		WHERE
+			CAST(strftime('%Y', time, '+8 hours') AS INTEGER) = $1
+			AND county = $2
+			AND brightness IS NOT NULL
+		GROUP BY strftime('%m', time, '+8 hours')
+		ORDER BY month
+	`
+)
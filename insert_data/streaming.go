@@ -0,0 +1,304 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// OverflowPolicy controls what happens when the output channel cannot accept a batch
+type OverflowPolicy int
+
+const (
+	// OverflowBlock makes the flushing caller wait until the consumer catches up
+	OverflowBlock OverflowPolicy = iota
+	// OverflowSpill writes batches to disk and replays them in order once the consumer catches up
+	OverflowSpill
+)
+
+// StreamingAggregator aggregates light points in bounded batches without ever dropping results: a full
+// output channel blocks the caller or spills to disk according to the overflow policy. It flushes on data
+// time instead of wall-clock time and is safe for concurrent AddPoint calls from the ingest workers.
+type StreamingAggregator struct {
+	mu         sync.Mutex
+	aggregator *DataAggregator
+	buffer     []LightData
+	bufferSize int
+	windowSize time.Duration
+	outputChan chan []AggregatedLightData
+	policy     OverflowPolicy
+	closed     bool
+
+	// earliest event time currently held in the buffer
+	windowStart time.Time
+
+	// spill state, only used with OverflowSpill
+	spillDir    string
+	spillMu     sync.Mutex
+	spillQueue  []string
+	spillSeq    int64
+	spillSignal chan struct{}
+	drainDone   chan struct{}
+	drainErr    error
+	drainCancel context.CancelFunc
+}
+
+// NewStreamingAggregator creates a streaming aggregator; a windowSize of 0 only flushes on a full buffer.
+// spillDir is only used with OverflowSpill; an empty value uses the system temp directory.
+func NewStreamingAggregator(config *AggregationConfig, bufferSize int, windowSize time.Duration, policy OverflowPolicy, spillDir string) (*StreamingAggregator, error) {
+	aggregator, err := NewDataAggregator(config)
+	if err != nil {
+		return nil, err
+	}
+	sa := &StreamingAggregator{
+		aggregator: aggregator,
+		buffer:     make([]LightData, 0, bufferSize),
+		bufferSize: bufferSize,
+		windowSize: windowSize,
+		outputChan: make(chan []AggregatedLightData, 10),
+		policy:     policy,
+	}
+
+	if policy == OverflowSpill {
+		if spillDir != "" {
+			if err := os.MkdirAll(spillDir, 0755); err != nil {
+				return nil, fmt.Errorf("error creating spill directory: %v", err)
+			}
+		}
+		dir, err := os.MkdirTemp(spillDir, "light-agg-spill-")
+		if err != nil {
+			return nil, fmt.Errorf("error creating spill directory: %v", err)
+		}
+		sa.spillDir = dir
+		sa.spillSignal = make(chan struct{}, 1)
+		sa.drainDone = make(chan struct{})
+
+		drainCtx, cancel := context.WithCancel(context.Background())
+		sa.drainCancel = cancel
+		go sa.drainSpills(drainCtx)
+	}
+
+	return sa, nil
+}
+
+// AddPoint adds a data point, flushing when the buffer is full or the buffered data spans the window.
+// It blocks under backpressure and returns ctx.Err() if the context is cancelled while waiting.
+func (sa *StreamingAggregator) AddPoint(ctx context.Context, data LightData) error {
+	sa.mu.Lock()
+	defer sa.mu.Unlock()
+
+	if sa.closed {
+		return fmt.Errorf("streaming aggregator is closed")
+	}
+
+	// Flush on data time: a point beyond the current window closes it before being buffered
+	if len(sa.buffer) > 0 && sa.windowSize > 0 && data.Time.Sub(sa.windowStart) >= sa.windowSize {
+		if err := sa.flushLocked(ctx); err != nil {
+			return err
+		}
+	}
+
+	if len(sa.buffer) == 0 || data.Time.Before(sa.windowStart) {
+		sa.windowStart = data.Time
+	}
+	sa.buffer = append(sa.buffer, data)
+
+	if len(sa.buffer) >= sa.bufferSize {
+		return sa.flushLocked(ctx)
+	}
+	return nil
+}
+
+// Flush forces the current buffer out
+func (sa *StreamingAggregator) Flush(ctx context.Context) error {
+	sa.mu.Lock()
+	defer sa.mu.Unlock()
+	return sa.flushLocked(ctx)
+}
+
+// flushLocked aggregates the buffer and hands the batch to the output; the caller must hold sa.mu.
+// The buffer is only cleared once the batch has been delivered or spilled.
+func (sa *StreamingAggregator) flushLocked(ctx context.Context) error {
+	if len(sa.buffer) == 0 {
+		return nil
+	}
+
+	results := sa.aggregator.AggregateData(sa.buffer)
+	if err := sa.emit(ctx, results); err != nil {
+		return err
+	}
+
+	sa.buffer = sa.buffer[:0]
+	return nil
+}
+
+// emit delivers a batch according to the overflow policy
+func (sa *StreamingAggregator) emit(ctx context.Context, results []AggregatedLightData) error {
+	if sa.policy != OverflowSpill {
+		select {
+		case sa.outputChan <- results:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	sa.spillMu.Lock()
+	defer sa.spillMu.Unlock()
+
+	if sa.drainErr != nil {
+		return sa.drainErr
+	}
+
+	// Only bypass the disk when nothing is queued, otherwise batches would be reordered
+	if len(sa.spillQueue) == 0 {
+		select {
+		case sa.outputChan <- results:
+			return nil
+		default:
+		}
+	}
+
+	path, err := sa.writeSpill(results)
+	if err != nil {
+		return err
+	}
+	sa.spillQueue = append(sa.spillQueue, path)
+
+	select {
+	case sa.spillSignal <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// writeSpill stores a batch on disk and returns its path; the caller must hold sa.spillMu
+func (sa *StreamingAggregator) writeSpill(results []AggregatedLightData) (string, error) {
+	sa.spillSeq++
+	path := filepath.Join(sa.spillDir, fmt.Sprintf("batch_%012d.json", sa.spillSeq))
+
+	file, err := os.Create(path)
+	if err != nil {
+		return "", fmt.Errorf("error creating spill file %s: %v", path, err)
+	}
+	defer file.Close()
+
+	if err := json.NewEncoder(file).Encode(results); err != nil {
+		return "", fmt.Errorf("error writing spill file %s: %v", path, err)
+	}
+	return path, nil
+}
+
+// drainSpills replays spilled batches to the output channel in the order they were written
+func (sa *StreamingAggregator) drainSpills(ctx context.Context) {
+	defer close(sa.drainDone)
+
+	for {
+		sa.spillMu.Lock()
+		if len(sa.spillQueue) == 0 {
+			sa.spillMu.Unlock()
+			select {
+			case _, ok := <-sa.spillSignal:
+				if !ok {
+					return
+				}
+				continue
+			case <-ctx.Done():
+				return
+			}
+		}
+		path := sa.spillQueue[0]
+		sa.spillMu.Unlock()
+
+		results, err := readSpill(path)
+		if err != nil {
+			sa.spillMu.Lock()
+			sa.drainErr = err
+			sa.spillMu.Unlock()
+			return
+		}
+
+		select {
+		case sa.outputChan <- results:
+		case <-ctx.Done():
+			return
+		}
+
+		os.Remove(path)
+		sa.spillMu.Lock()
+		sa.spillQueue = sa.spillQueue[1:]
+		sa.spillMu.Unlock()
+	}
+}
+
+// readSpill loads a spilled batch from disk
+func readSpill(path string) ([]AggregatedLightData, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening spill file %s: %v", path, err)
+	}
+	defer file.Close()
+
+	var results []AggregatedLightData
+	if err := json.NewDecoder(file).Decode(&results); err != nil {
+		return nil, fmt.Errorf("error reading spill file %s: %v", path, err)
+	}
+	return results, nil
+}
+
+// GetOutputChannel returns the channel for receiving aggregated results
+func (sa *StreamingAggregator) GetOutputChannel() <-chan []AggregatedLightData {
+	return sa.outputChan
+}
+
+// Close flushes remaining points, waits for spilled batches to be delivered and closes the output channel.
+// If ctx is cancelled first, undelivered spill files are left in the spill directory and reported in the error.
+func (sa *StreamingAggregator) Close(ctx context.Context) error {
+	sa.mu.Lock()
+	defer sa.mu.Unlock()
+
+	if sa.closed {
+		return nil
+	}
+	sa.closed = true
+
+	err := sa.flushLocked(ctx)
+
+	if sa.policy == OverflowSpill {
+		// Closing the signal lets the drainer exit once the queue is empty
+		sa.spillMu.Lock()
+		close(sa.spillSignal)
+		sa.spillMu.Unlock()
+
+		select {
+		case <-sa.drainDone:
+		case <-ctx.Done():
+			sa.drainCancel()
+			<-sa.drainDone
+		}
+		sa.drainCancel()
+
+		sa.spillMu.Lock()
+		pending := len(sa.spillQueue)
+		if err == nil {
+			err = sa.drainErr
+		}
+		sa.spillMu.Unlock()
+
+		if pending > 0 {
+			if err == nil {
+				err = ctx.Err()
+			}
+			err = fmt.Errorf("%d spilled batches left undelivered in %s: %v", pending, sa.spillDir, err)
+		} else {
+			os.RemoveAll(sa.spillDir)
+		}
+	}
+
+	close(sa.outputChan)
+	return err
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+var streamingTestConfig = &AggregationConfig{
+	SpatialResolutionKm: 1,
+	TemporalInterval:    time.Hour,
+	AggregationMethod:   "average",
+}
+
+// hourPoint returns a point in its own hourly bucket, so every flushed batch holds exactly one cell
+func hourPoint(hour int) LightData {
+	return LightData{
+		Time:       time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC).Add(time.Duration(hour) * time.Hour),
+		Longitude:  121.5,
+		Latitude:   25.0,
+		Brightness: float64(hour),
+	}
+}
+
+// collect reads batches until the output channel is closed and returns them in arrival order
+func collect(sa *StreamingAggregator) <-chan []AggregatedLightData {
+	done := make(chan []AggregatedLightData, 1)
+	go func() {
+		var cells []AggregatedLightData
+		for batch := range sa.GetOutputChannel() {
+			cells = append(cells, batch...)
+		}
+		done <- cells
+	}()
+	return done
+}
+
+func countPoints(cells []AggregatedLightData) int {
+	total := 0
+	for _, cell := range cells {
+		total += cell.Count
+	}
+	return total
+}
+
+func TestStreamingAggregatorBlockWaitsForConsumer(t *testing.T) {
+	sa, err := NewStreamingAggregator(streamingTestConfig, 1, 0, OverflowBlock, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The output channel holds 10 batches; the 11th flush has to wait for the consumer
+	added := make(chan error, 1)
+	go func() {
+		for hour := 0; hour < 15; hour++ {
+			if err := sa.AddPoint(context.Background(), hourPoint(hour)); err != nil {
+				added <- err
+				return
+			}
+		}
+		added <- nil
+	}()
+
+	select {
+	case err := <-added:
+		t.Fatalf("AddPoint returned %v while the output channel was full", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	cells := collect(sa)
+	if err := <-added; err != nil {
+		t.Fatal(err)
+	}
+	if err := sa.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := countPoints(<-cells); got != 15 {
+		t.Errorf("delivered %d points, want 15", got)
+	}
+}
+
+func TestStreamingAggregatorSpillDrainsInOrder(t *testing.T) {
+	sa, err := NewStreamingAggregator(streamingTestConfig, 1, 0, OverflowSpill, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Nobody reads yet, so everything past the channel capacity goes to disk without blocking
+	for hour := 0; hour < 25; hour++ {
+		if err := sa.AddPoint(context.Background(), hourPoint(hour)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	spilled, err := os.ReadDir(sa.spillDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(spilled) == 0 {
+		t.Fatal("no batches were spilled while the output channel was full")
+	}
+
+	cells := collect(sa)
+	if err := sa.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	delivered := <-cells
+	if len(delivered) != 25 {
+		t.Fatalf("delivered %d batches, want 25", len(delivered))
+	}
+	for i, cell := range delivered {
+		if want := hourPoint(i).Time; !cell.TimeBucket.Equal(want) {
+			t.Fatalf("batch %d has bucket %v, want %v", i, cell.TimeBucket, want)
+		}
+	}
+	if _, err := os.Stat(sa.spillDir); !os.IsNotExist(err) {
+		t.Errorf("spill directory %s was not removed after a complete drain", sa.spillDir)
+	}
+}
+
+func TestStreamingAggregatorCancelledWhileBlocked(t *testing.T) {
+	sa, err := NewStreamingAggregator(streamingTestConfig, 1, 0, OverflowBlock, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for hour := 0; hour < 10; hour++ {
+		if err := sa.AddPoint(context.Background(), hourPoint(hour)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := sa.AddPoint(ctx, hourPoint(10)); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("AddPoint returned %v, want context.DeadlineExceeded", err)
+	}
+
+	// The point of the cancelled flush stays buffered and is delivered by Close
+	cells := collect(sa)
+	if err := sa.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := countPoints(<-cells); got != 11 {
+		t.Errorf("delivered %d points, want 11", got)
+	}
+}
+
+func TestStreamingAggregatorCloseCancelledKeepsSpills(t *testing.T) {
+	sa, err := NewStreamingAggregator(streamingTestConfig, 1, 0, OverflowSpill, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for hour := 0; hour < 15; hour++ {
+		if err := sa.AddPoint(context.Background(), hourPoint(hour)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := sa.Close(ctx); err == nil {
+		t.Fatal("Close with a cancelled context and no consumer returned nil")
+	}
+	spilled, err := os.ReadDir(sa.spillDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(spilled) == 0 {
+		t.Error("undelivered spill files were removed")
+	}
+	if err := sa.AddPoint(context.Background(), hourPoint(15)); err == nil {
+		t.Error("AddPoint after Close returned nil")
+	}
+}
+
+func TestStreamingAggregatorConcurrentAddPoint(t *testing.T) {
+	const workers, points = 8, 1000
+
+	sa, err := NewStreamingAggregator(streamingTestConfig, 100, 0, OverflowBlock, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cells := collect(sa)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < points; i++ {
+				if err := sa.AddPoint(context.Background(), hourPoint((w*points+i)%48)); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	if err := sa.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := countPoints(<-cells); got != workers*points {
+		t.Errorf("delivered %d points, want %d", got, workers*points)
+	}
+}
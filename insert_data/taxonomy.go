@@ -0,0 +1,457 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// taxonomy resolves biological records to the accepted taxa of a checklist at ingest time, nil keeps
+// the names as delivered
+var taxonomy *TaxonomyBackbone
+
+// NameMatch records how a biological record was resolved against the checklist
+type NameMatch string
+
+const (
+	MatchTaxonID   NameMatch = "taxon_id"  // the record's taxon_id is an accepted taxon
+	MatchAccepted  NameMatch = "accepted"  // the name is an accepted name
+	MatchSynonym   NameMatch = "synonym"   // the name is a synonym or misapplied name of an accepted taxon
+	MatchFuzzy     NameMatch = "fuzzy"     // a single accepted name or synonym within maxNameEdits, usually a typo
+	MatchUnmatched NameMatch = "unmatched" // kept as delivered
+)
+
+// taxonRanks are the ranks of the hierarchy stored per record, from kingdom to species
+var taxonRanks = []string{"kingdom", "phylum", "class", "order", "family", "genus", "species"}
+
+// Taxon is an accepted taxon of the checklist
+type Taxon struct {
+	TaxonID     string
+	Name        string // accepted name as in the checklist, the simple_name of TaiCOL exports
+	Rank        string // lower case, e.g. species or subspecies
+	CommonNameC string
+	Hierarchy   [7]string // names at taxonRanks, empty when the checklist lacks the rank
+}
+
+// nameEntry is a normalized name of the checklist. taxon is nil when the name is a synonym of several
+// accepted taxa and cannot be resolved.
+type nameEntry struct {
+	taxon    *Taxon
+	accepted bool
+}
+
+// nameResolution is the cached outcome for one combination of taxon_id and names, and for unmatched
+// combinations the number of records reported
+type nameResolution struct {
+	taxon   *Taxon
+	match   NameMatch
+	records int
+}
+
+// TaxonomyBackbone is a loaded checklist. Resolve is safe for concurrent use by the import workers.
+type TaxonomyBackbone struct {
+	byID     map[string]*Taxon
+	names    map[string]nameEntry
+	byLetter map[byte][]string // normalized names by first letter, the fuzzy match candidates
+
+	mu          sync.Mutex
+	resolutions map[[3]string]*nameResolution
+	matches     map[NameMatch]int
+}
+
+// normalizeName reduces a scientific name to its lower case canonical form without authorship, year or
+// qualifiers: the genus, the epithets and the botanical var. and f. markers. Zoological trinomials carry no
+// marker, so subsp. is dropped; "sp." and "spp." reduce the name to the genus.
+func normalizeName(name string) string {
+	fields := strings.Fields(name)
+	if len(fields) == 0 {
+		return ""
+	}
+	parts := []string{strings.ToLower(strings.Trim(fields[0], "\"'"))}
+	for _, field := range fields[1:] {
+		lower := strings.ToLower(field)
+		switch lower {
+		case "sp.", "spp.", "sp", "spp", "cf.", "aff.":
+			return strings.Join(parts, " ")
+		case "subsp.", "ssp.":
+			continue
+		case "var.", "f.", "subvar.":
+			parts = append(parts, lower)
+			continue
+		}
+		if r := []rune(field)[0]; !unicode.IsLower(r) && r != '×' {
+			break // authorship starts with a capital, a parenthesis or a year
+		}
+		parts = append(parts, lower)
+	}
+	return strings.Join(parts, " ")
+}
+
+// checklistColumn returns the index of the first header name present, or -1
+func checklistColumn(columns map[string]int, names ...string) int {
+	for _, name := range names {
+		if i, ok := columns[name]; ok {
+			return i
+		}
+	}
+	return -1
+}
+
+// LoadTaxonomyBackbone reads a checklist CSV such as a TaiCOL export. Each row is a name with its
+// taxon_id; rows whose usage_status (or taxon_status) is not accepted or valid are synonyms of the
+// accepted row with the same taxon_id. The optional synonyms and misapplied columns list further names
+// of an accepted row, separated by commas or semicolons. Rank, common_name_c and the kingdom to genus
+// columns fill the hierarchy.
+func LoadTaxonomyBackbone(path string) (*TaxonomyBackbone, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening %s: %v", path, err)
+	}
+	defer file.Close()
+
+	backbone, err := readTaxonomyBackbone(file)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %v", path, err)
+	}
+	return backbone, nil
+}
+
+func readTaxonomyBackbone(r io.Reader) (*TaxonomyBackbone, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("error reading header: %v", err)
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+	nameColumn := checklistColumn(columns, "simple_name", "scientific_name", "name")
+	idColumn := checklistColumn(columns, "taxon_id", "taxonid")
+	if nameColumn < 0 || idColumn < 0 {
+		return nil, fmt.Errorf("header needs a taxon_id and a simple_name or scientific_name column")
+	}
+	statusColumn := checklistColumn(columns, "usage_status", "taxon_status", "status")
+	rankColumn := checklistColumn(columns, "rank", "taxon_rank")
+	commonColumn := checklistColumn(columns, "common_name_c")
+	synonymColumns := []int{checklistColumn(columns, "synonyms"), checklistColumn(columns, "misapplied")}
+	var rankColumns [6]int
+	for i, rank := range taxonRanks[:6] {
+		rankColumns[i] = checklistColumn(columns, rank)
+	}
+
+	backbone := &TaxonomyBackbone{
+		byID:        make(map[string]*Taxon),
+		names:       make(map[string]nameEntry),
+		byLetter:    make(map[byte][]string),
+		resolutions: make(map[[3]string]*nameResolution),
+		matches:     make(map[NameMatch]int),
+	}
+	field := func(record []string, column int) string {
+		if column < 0 || column >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[column])
+	}
+
+	// Synonym rows may precede their accepted row, so names are linked once every taxon is known
+	type synonym struct{ name, taxonID string }
+	var synonyms []synonym
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		name, taxonID := strings.Join(strings.Fields(field(record, nameColumn)), " "), field(record, idColumn)
+		if name == "" || taxonID == "" {
+			continue
+		}
+		switch strings.ToLower(field(record, statusColumn)) {
+		case "", "accepted", "valid":
+		default:
+			synonyms = append(synonyms, synonym{name, taxonID})
+			continue
+		}
+
+		taxon := &Taxon{
+			TaxonID:     taxonID,
+			Name:        name,
+			Rank:        strings.ToLower(field(record, rankColumn)),
+			CommonNameC: field(record, commonColumn),
+		}
+		for i, column := range rankColumns {
+			taxon.Hierarchy[i] = field(record, column)
+		}
+		canonical := strings.Fields(normalizeName(name))
+		if taxon.Rank == "genus" && taxon.Hierarchy[5] == "" {
+			taxon.Hierarchy[5] = name
+		}
+		if isSpeciesOrBelow(taxon.Rank) && len(canonical) >= 2 {
+			genus := strings.Fields(name)[0]
+			taxon.Hierarchy[6] = genus + " " + canonical[1]
+			if taxon.Hierarchy[5] == "" {
+				taxon.Hierarchy[5] = genus
+			}
+		}
+		backbone.byID[taxonID] = taxon
+		for _, column := range synonymColumns {
+			for _, other := range strings.FieldsFunc(field(record, column), func(r rune) bool { return r == ',' || r == ';' }) {
+				synonyms = append(synonyms, synonym{strings.TrimSpace(other), taxonID})
+			}
+		}
+	}
+
+	// Accepted names take precedence over a synonym spelled the same
+	for _, taxon := range backbone.byID {
+		backbone.addName(normalizeName(taxon.Name), taxon, true)
+	}
+	for _, s := range synonyms {
+		if taxon, ok := backbone.byID[s.taxonID]; ok {
+			backbone.addName(normalizeName(s.name), taxon, false)
+		}
+	}
+	for key := range backbone.names {
+		backbone.byLetter[key[0]] = append(backbone.byLetter[key[0]], key)
+	}
+	return backbone, nil
+}
+
+func isSpeciesOrBelow(rank string) bool {
+	switch rank {
+	case "species", "subspecies", "variety", "form", "subvariety", "subform":
+		return true
+	}
+	return false
+}
+
+func (b *TaxonomyBackbone) addName(key string, taxon *Taxon, accepted bool) {
+	// Authors and years split off a comma-separated synonym list are not names
+	if key == "" || !unicode.IsLetter(rune(key[0])) {
+		return
+	}
+	existing, ok := b.names[key]
+	switch {
+	case !ok:
+		b.names[key] = nameEntry{taxon: taxon, accepted: accepted}
+	case existing.accepted || existing.taxon == taxon:
+	case accepted:
+		b.names[key] = nameEntry{taxon: taxon, accepted: true}
+	default:
+		b.names[key] = nameEntry{} // a synonym of several taxa
+	}
+}
+
+// maxNameEdits is the largest edit distance of a fuzzy match: one for short names, two from 12 characters
+func maxNameEdits(key string) int {
+	if len(key) < 12 {
+		return 1
+	}
+	return 2
+}
+
+// lookupName resolves a name exactly, then by the nearest checklist name when exactly one is within
+// maxNameEdits
+func (b *TaxonomyBackbone) lookupName(name string) (*Taxon, NameMatch) {
+	key := normalizeName(name)
+	if key == "" {
+		return nil, MatchUnmatched
+	}
+	if entry, ok := b.names[key]; ok {
+		if entry.taxon == nil {
+			return nil, MatchUnmatched
+		}
+		if entry.accepted {
+			return entry.taxon, MatchAccepted
+		}
+		return entry.taxon, MatchSynonym
+	}
+
+	limit := maxNameEdits(key)
+	var best *Taxon
+	bestDistance, ties := limit+1, 0
+	for _, candidate := range b.byLetter[key[0]] {
+		if absInt(len(candidate)-len(key)) > limit {
+			continue
+		}
+		distance := editDistance(key, candidate, limit)
+		if distance < bestDistance {
+			best, bestDistance, ties = b.names[candidate].taxon, distance, 1
+		} else if distance == bestDistance && b.names[candidate].taxon != best {
+			ties++
+		}
+	}
+	if best == nil || ties > 1 {
+		return nil, MatchUnmatched
+	}
+	return best, MatchFuzzy
+}
+
+func absInt(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// editDistance is the Levenshtein distance of a and b, or limit+1 once it is certain to exceed limit
+func editDistance(a, b string, limit int) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		rowMin := current[0]
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+			rowMin = min(rowMin, current[j])
+		}
+		if rowMin > limit {
+			return limit + 1
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
+
+// Resolve fills the accepted name, taxon_id and Chinese common name of record's accepted taxon and its rank
+// hierarchy, keeping the delivered names. The taxon_id is tried first, then scientific_name and
+// source_scientific_name. Unmatched records are counted for UnmatchedNames. A nil backbone leaves the
+// record unchanged.
+func (b *TaxonomyBackbone) Resolve(record *BiologicalRecord) {
+	if b == nil {
+		return
+	}
+	key := [3]string{record.TaxonID, record.ScientificName, record.SourceScientificName}
+
+	b.mu.Lock()
+	resolution, ok := b.resolutions[key]
+	b.mu.Unlock()
+	if !ok {
+		// The checklist is read-only after loading, so the fuzzy scan runs without holding the lock
+		resolution = &nameResolution{match: MatchUnmatched}
+		if taxon, found := b.byID[record.TaxonID]; found {
+			resolution.taxon, resolution.match = taxon, MatchTaxonID
+		} else if taxon, match := b.lookupName(record.ScientificName); taxon != nil {
+			resolution.taxon, resolution.match = taxon, match
+		} else if taxon, match := b.lookupName(record.SourceScientificName); taxon != nil {
+			resolution.taxon, resolution.match = taxon, match
+		}
+	}
+
+	b.mu.Lock()
+	if cached, ok := b.resolutions[key]; ok {
+		resolution = cached // another worker resolved the same names meanwhile
+	} else {
+		b.resolutions[key] = resolution
+	}
+	b.matches[resolution.match]++
+	if resolution.taxon == nil {
+		resolution.records++
+	}
+	b.mu.Unlock()
+
+	record.NameMatch = string(resolution.match)
+	taxon := resolution.taxon
+	if taxon == nil {
+		return
+	}
+	record.AcceptedName = taxon.Name
+	record.AcceptedTaxonID = taxon.TaxonID
+	record.AcceptedCommonNameC = taxon.CommonNameC
+	record.TaxonRank = taxon.Rank
+	record.TaxonKingdom, record.TaxonPhylum, record.TaxonClass = taxon.Hierarchy[0], taxon.Hierarchy[1], taxon.Hierarchy[2]
+	record.TaxonOrder, record.TaxonFamily, record.TaxonGenus = taxon.Hierarchy[3], taxon.Hierarchy[4], taxon.Hierarchy[5]
+	record.TaxonSpecies = taxon.Hierarchy[6]
+}
+
+// UnmatchedName is a combination of taxon_id and names that no checklist taxon matched
+type UnmatchedName struct {
+	TaxonID              string `json:"taxon_id"`
+	ScientificName       string `json:"scientific_name"`
+	SourceScientificName string `json:"source_scientific_name"`
+	Records              int    `json:"records"`
+}
+
+// UnmatchedNames returns the unresolved names seen by Resolve, most records first
+func (b *TaxonomyBackbone) UnmatchedNames() []UnmatchedName {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var names []UnmatchedName
+	for key, resolution := range b.resolutions {
+		if resolution.taxon == nil && resolution.records > 0 {
+			names = append(names, UnmatchedName{TaxonID: key[0], ScientificName: key[1], SourceScientificName: key[2], Records: resolution.records})
+		}
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if names[i].Records != names[j].Records {
+			return names[i].Records > names[j].Records
+		}
+		return names[i].ScientificName < names[j].ScientificName
+	})
+	return names
+}
+
+// LogSummary logs the records per match type and the most frequent unmatched names
+func (b *TaxonomyBackbone) LogSummary() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	args := []interface{}{"taxa", len(b.byID), "names", len(b.names)}
+	for _, match := range []NameMatch{MatchTaxonID, MatchAccepted, MatchSynonym, MatchFuzzy, MatchUnmatched} {
+		args = append(args, string(match), b.matches[match])
+	}
+	b.mu.Unlock()
+	slog.Info("Taxonomy resolution", args...)
+
+	unmatched := b.UnmatchedNames()
+	for i, name := range unmatched {
+		if i >= 10 { // Show only the 10 most frequent names
+			break
+		}
+		slog.Warn("Unmatched name", "scientific_name", name.ScientificName, "source_scientific_name", name.SourceScientificName,
+			"taxon_id", name.TaxonID, "records", name.Records)
+	}
+	if len(unmatched) > 10 {
+		slog.Warn("More unmatched names not shown", "names", len(unmatched)-10)
+	}
+}
+
+// WriteUnmatchedReport writes the unmatched names as CSV, most records first
+func (b *TaxonomyBackbone) WriteUnmatchedReport(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("error creating %s: %v", path, err)
+	}
+	defer file.Close()
+
+	out := csv.NewWriter(file)
+	out.Write([]string{"scientific_name", "source_scientific_name", "taxon_id", "records"})
+	for _, name := range b.UnmatchedNames() {
+		out.Write([]string{name.ScientificName, name.SourceScientificName, name.TaxonID, strconv.Itoa(name.Records)})
+	}
+	out.Flush()
+	if err := out.Error(); err != nil {
+		return fmt.Errorf("error writing %s: %v", path, err)
+	}
+	return file.Close()
+}
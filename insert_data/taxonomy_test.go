@@ -0,0 +1,96 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNormalizeName(t *testing.T) {
+	tests := []struct {
+		name, want string
+	}{
+		{"Passer montanus (Linnaeus, 1758)", "passer montanus"},
+		{"  Passer   montanus  ", "passer montanus"},
+		{"Pycnonotus sinensis formosae Hartert, 1910", "pycnonotus sinensis formosae"},
+		{"Pycnonotus sinensis subsp. formosae", "pycnonotus sinensis formosae"},
+		{"Ficus pumila var. awkeotsang (Makino) Corner", "ficus pumila var. awkeotsang"},
+		{"Rattus sp.", "rattus"},
+		{"Rattus cf. losea", "rattus"},
+		{"\"Hyla\" chinensis", "hyla chinensis"},
+		{"Mentha × piperita L.", "mentha × piperita"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := normalizeName(tt.name); got != tt.want {
+			t.Errorf("normalizeName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b  string
+		limit int
+		want  int
+	}{
+		{"passer", "passer", 2, 0},
+		{"passer", "paser", 2, 1},
+		{"passer", "pasesr", 2, 2},
+		{"kitten", "sitting", 3, 3},
+		{"kitten", "sitting", 1, 2}, // limit+1 once the distance is certain to exceed the limit
+		{"", "abc", 5, 3},
+	}
+	for _, tt := range tests {
+		if got := editDistance(tt.a, tt.b, tt.limit); got != tt.want {
+			t.Errorf("editDistance(%q, %q, %d) = %d, want %d", tt.a, tt.b, tt.limit, got, tt.want)
+		}
+	}
+}
+
+const testChecklist = `taxon_id,simple_name,usage_status,rank,common_name_c,family,synonyms
+t0001,Passer montanus,accepted,species,麻雀,Passeridae,
+t0002,Pycnonotus sinensis,accepted,species,白頭翁,Pycnonotidae,Ixos sinensis
+t0003,Rattus losea,accepted,species,小黃腹鼠,Muridae,
+t0004,Rattus rattus,accepted,species,家鼠,Muridae,
+t0003,Rattus formosanus,not-accepted,species,,,
+t0004,Rattus formosanus,not-accepted,species,,,
+t0005,Zosterops simplex,accepted,species,綠繡眼,Zosteropidae,
+t0005,Zosterops japonicus,misapplied,species,,,
+t0006,Rattus losex,accepted,species,,Muridae,
+`
+
+func TestLookupName(t *testing.T) {
+	backbone, err := readTaxonomyBackbone(strings.NewReader(testChecklist))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		taxonID string
+		match   NameMatch
+	}{
+		{"Passer montanus (Linnaeus, 1758)", "t0001", MatchAccepted},
+		{"Ixos sinensis", "t0002", MatchSynonym},
+		{"Zosterops japonicus", "t0005", MatchSynonym},
+		{"Paser montanus", "t0001", MatchFuzzy},
+		{"Pycnonotus sinesis", "t0002", MatchFuzzy},
+		{"Rattus formosanus", "", MatchUnmatched}, // a synonym of two accepted taxa
+		{"Rattus losa", "t0003", MatchFuzzy},
+		{"Rattus lossa", "t0003", MatchFuzzy},
+		{"Rattus ratus", "t0004", MatchFuzzy},
+		{"Rattus losez", "", MatchUnmatched}, // one edit from both Rattus losea and Rattus losex
+		{"Corvus macrorhynchos", "", MatchUnmatched},
+		{"", "", MatchUnmatched},
+	}
+	for _, tt := range tests {
+		taxon, match := backbone.lookupName(tt.name)
+		got := ""
+		if taxon != nil {
+			got = taxon.TaxonID
+		}
+		if got != tt.taxonID || match != tt.match {
+			t.Errorf("lookupName(%q) = %q %s, want %q %s", tt.name, got, match, tt.taxonID, tt.match)
+		}
+	}
+}
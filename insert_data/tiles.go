@@ -0,0 +1,452 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// tileBufferRatio extends the queried area so features crossing tile edges render seamlessly
+	tileBufferRatio = 1.0 / 16
+	// tileCellsAcross is the target number of aggregated cells across one tile
+	tileCellsAcross = 64
+	// minTileResolutionKm matches the native resolution of the light rasters
+	minTileResolutionKm = 0.5
+	// occurrencePointZoom is the zoom from which individual occurrences are returned instead of cells
+	occurrencePointZoom = 12
+	// maxTileFeatures caps the number of features encoded into one tile
+	maxTileFeatures = 50000
+	// maxPrecomputedTileZoom is the highest zoom whose light tiles read the monthly cells migrate stores in
+	// light_grid_aggregated; deeper tiles cover few pixels and aggregate them on request
+	maxPrecomputedTileZoom = 8
+)
+
+// tileCoord identifies a web mercator tile
+type tileCoord struct {
+	Z, X, Y int
+}
+
+// bounds returns the geographic bounds of the tile extended by the given ratio of its size
+func (t tileCoord) bounds(buffer float64) BoundingBox {
+	n := math.Exp2(float64(t.Z))
+	x0, x1 := float64(t.X)-buffer, float64(t.X+1)+buffer
+	y0, y1 := float64(t.Y)-buffer, float64(t.Y+1)+buffer
+
+	return BoundingBox{
+		MinLongitude: x0/n*360 - 180,
+		MaxLongitude: x1/n*360 - 180,
+		MinLatitude:  tileYToLatitude(y1, n),
+		MaxLatitude:  tileYToLatitude(y0, n),
+	}
+}
+
+func tileYToLatitude(y, n float64) float64 {
+	return math.Atan(math.Sinh(math.Pi*(1-2*y/n))) * 180 / math.Pi
+}
+
+// project converts a coordinate into the tile's integer coordinate space
+func (t tileCoord) project(longitude, latitude float64) (int32, int32) {
+	n := math.Exp2(float64(t.Z))
+	latRad := latitude * math.Pi / 180
+	x := (longitude + 180) / 360 * n
+	y := (1 - math.Log(math.Tan(latRad)+1/math.Cos(latRad))/math.Pi) / 2 * n
+	return int32(math.Round((x - float64(t.X)) * mvtExtent)), int32(math.Round((y - float64(t.Y)) * mvtExtent))
+}
+
+// resolutionKm picks the aggregation grid size for the tile's zoom level
+func (t tileCoord) resolutionKm() float64 {
+	const earthCircumferenceKm = 40075.0
+	resolution := earthCircumferenceKm / math.Exp2(float64(t.Z)) / tileCellsAcross
+	return math.Max(resolution, minTileResolutionKm)
+}
+
+// lightTileResolutions returns the grid sizes of the zooms up to maxPrecomputedTileZoom
+func lightTileResolutions() []float64 {
+	resolutions := make([]float64, 0, maxPrecomputedTileZoom+1)
+	for z := 0; z <= maxPrecomputedTileZoom; z++ {
+		resolutions = append(resolutions, tileCoord{Z: z}.resolutionKm())
+	}
+	return resolutions
+}
+
+// parseTileCoord reads z/x/y path values, accepting an optional .mvt or .pbf suffix on y
+func parseTileCoord(r *http.Request) (tileCoord, error) {
+	z, errZ := strconv.Atoi(r.PathValue("z"))
+	x, errX := strconv.Atoi(r.PathValue("x"))
+	yValue := strings.TrimSuffix(strings.TrimSuffix(r.PathValue("y"), ".mvt"), ".pbf")
+	y, errY := strconv.Atoi(yValue)
+	if errZ != nil || errX != nil || errY != nil {
+		return tileCoord{}, fmt.Errorf("tile coordinates must be integers")
+	}
+
+	if z < 0 || z > 22 {
+		return tileCoord{}, fmt.Errorf("zoom must be between 0 and 22")
+	}
+	n := 1 << z
+	if x < 0 || x >= n || y < 0 || y >= n {
+		return tileCoord{}, fmt.Errorf("tile %d/%d/%d is out of range", z, x, y)
+	}
+	return tileCoord{Z: z, X: x, Y: y}, nil
+}
+
+// parseOptionalTimeRange reads start_time and end_time; both absent means no time filter
+func parseOptionalTimeRange(r *http.Request) (*TimeRange, error) {
+	startTime := r.URL.Query().Get("start_time")
+	endTime := r.URL.Query().Get("end_time")
+	if startTime == "" && endTime == "" {
+		return nil, nil
+	}
+	if startTime == "" || endTime == "" {
+		return nil, fmt.Errorf("start_time and end_time must be given together")
+	}
+
+	start, startErr := parseAPITime(startTime)
+	end, endErr := parseAPITime(endTime)
+	if startErr != nil || endErr != nil {
+		return nil, fmt.Errorf("Invalid date format. Use ISO 8601 format (e.g., 2024-01-01T00:00:00Z)")
+	}
+	if !start.Before(end) {
+		return nil, fmt.Errorf("start_time must be before end_time")
+	}
+	return &TimeRange{Start: start, End: end}, nil
+}
+
+// tileCache is a small LRU cache of encoded tiles with a time-to-live
+type tileCache struct {
+	mu         sync.Mutex
+	ttl        time.Duration
+	maxEntries int
+	order      *list.List
+	entries    map[string]*list.Element
+}
+
+type tileCacheEntry struct {
+	key     string
+	data    []byte
+	created time.Time
+}
+
+func newTileCache(maxEntries int, ttl time.Duration) *tileCache {
+	return &tileCache{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		order:      list.New(),
+		entries:    make(map[string]*list.Element),
+	}
+}
+
+func (c *tileCache) get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := element.Value.(*tileCacheEntry)
+	if time.Since(entry.created) > c.ttl {
+		c.order.Remove(element)
+		delete(c.entries, key)
+		return nil, false
+	}
+	c.order.MoveToFront(element)
+	return entry.data, true
+}
+
+func (c *tileCache) put(key string, data []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		element.Value = &tileCacheEntry{key: key, data: data, created: time.Now()}
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&tileCacheEntry{key: key, data: data, created: time.Now()})
+	for c.order.Len() > c.maxEntries {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*tileCacheEntry).key)
+	}
+}
+
+// serveTile answers from the cache or renders the tile and caches it
+func (s *APIServer) serveTile(w http.ResponseWriter, r *http.Request, layer string, render func(tileCoord) ([]byte, error)) {
+	tile, err := parseTileCoord(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	key := fmt.Sprintf("%s/%d/%d/%d?%s", layer, tile.Z, tile.X, tile.Y, r.URL.Query().Encode())
+	data, ok := s.tiles.get(key)
+	if !ok {
+		data, err = render(tile)
+		if err != nil {
+			writeDatabaseError(w, err)
+			return
+		}
+		s.tiles.put(key, data)
+	}
+
+	w.Header().Set("Content-Type", "application/vnd.mapbox-vector-tile")
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	if len(data) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.Write(data)
+}
+
+// handleLightTile serves light brightness cells aggregated to the tile's zoom. A time range is required,
+// so a tile never averages the whole archive.
+func (s *APIServer) handleLightTile(w http.ResponseWriter, r *http.Request) {
+	timeRange, err := parseOptionalTimeRange(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if timeRange == nil {
+		writeError(w, http.StatusBadRequest, "start_time and end_time parameters are required")
+		return
+	}
+
+	s.serveTile(w, r, "light", func(tile tileCoord) ([]byte, error) {
+		return renderLightTile(r.Context(), s.db, tile, *timeRange)
+	})
+}
+
+// renderLightTile encodes the light cells of the tile as polygons, read from light_grid_aggregated up to
+// maxPrecomputedTileZoom and aggregated from the pixels beyond it
+func renderLightTile(ctx context.Context, db *sql.DB, tile tileCoord, timeRange TimeRange) ([]byte, error) {
+	var cells []AggregatedLightData
+	var err error
+	if tile.Z <= maxPrecomputedTileZoom {
+		cells, err = queryLightTileCells(ctx, db, tile, timeRange)
+	} else {
+		cells, err = aggregateLightTileCells(ctx, db, tile, timeRange)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	spatialAgg := NewSpatialAggregator(&AggregationConfig{SpatialResolutionKm: tile.resolutionKm()})
+	layer := newMVTLayer("light")
+	for i, cell := range cells {
+		if i >= maxTileFeatures {
+			slog.Warn("Light tile truncated", "table", "light_data_with_county", "z", tile.Z, "x", tile.X, "y", tile.Y, "cells", maxTileFeatures)
+			break
+		}
+
+		lonSize, latSize := spatialAgg.calculateGridSize(cell.GridLatitude)
+		x0, y0 := tile.project(cell.GridLongitude-lonSize/2, cell.GridLatitude+latSize/2)
+		x1, y1 := tile.project(cell.GridLongitude+lonSize/2, cell.GridLatitude-latSize/2)
+
+		layer.addRectangle(uint64(i+1), x0, y0, x1, y1, map[string]interface{}{
+			"avg_brightness": cell.AvgBrightness,
+			"min_brightness": cell.MinBrightness,
+			"max_brightness": cell.MaxBrightness,
+			"count":          cell.Count,
+		})
+	}
+
+	return encodeMVT(layer), nil
+}
+
+// queryLightTileCells sums the monthly cells of the tile's resolution in light_grid_aggregated over the
+// calendar months in Taiwan time from the one holding start_time up to, not including, the one holding
+// end_time. A range within a single month selects that month.
+func queryLightTileCells(ctx context.Context, db *sql.DB, tile tileCoord, timeRange TimeRange) ([]AggregatedLightData, error) {
+	bounds := tile.bounds(tileBufferRatio)
+	resolution := tile.resolutionKm()
+	months := NewTemporalAggregator(lightGridConfig(resolution))
+	start, end := months.snapToBucket(timeRange.Start), months.snapToBucket(timeRange.End)
+	if !end.After(start) {
+		end = months.bucketStart(months.bucketIndex(start) + 1)
+	}
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT grid_longitude, grid_latitude,
+			SUM(brightness_sum) / SUM(point_count), MIN(min_brightness), MAX(max_brightness), SUM(point_count)
+		FROM light_grid_aggregated
+		WHERE resolution_km = $1
+			AND grid_longitude BETWEEN $2 AND $3
+			AND grid_latitude BETWEEN $4 AND $5
+			AND time_bucket >= $6 AND time_bucket < $7
+		GROUP BY grid_longitude, grid_latitude
+		ORDER BY grid_latitude, grid_longitude`,
+		resolution, bounds.MinLongitude, bounds.MaxLongitude, bounds.MinLatitude, bounds.MaxLatitude, start.UTC(), end.UTC())
+	if err != nil {
+		return nil, fmt.Errorf("error querying light tile cells: %v", err)
+	}
+	defer rows.Close()
+
+	var cells []AggregatedLightData
+	for rows.Next() {
+		var cell AggregatedLightData
+		if err := rows.Scan(&cell.GridLongitude, &cell.GridLatitude, &cell.AvgBrightness, &cell.MinBrightness, &cell.MaxBrightness, &cell.Count); err != nil {
+			return nil, fmt.Errorf("error scanning light tile cells: %v", err)
+		}
+		cells = append(cells, cell)
+	}
+	return cells, rows.Err()
+}
+
+// aggregateLightTileCells averages the pixels of the tile within the time range into one bucket per cell
+func aggregateLightTileCells(ctx context.Context, db *sql.DB, tile tileCoord, timeRange TimeRange) ([]AggregatedLightData, error) {
+	bounds := tile.bounds(tileBufferRatio)
+
+	// One bucket from start_time that still holds the pixels at end_time
+	config := &AggregationConfig{
+		SpatialResolutionKm: tile.resolutionKm(),
+		TemporalInterval:    timeRange.End.Sub(timeRange.Start) + time.Nanosecond,
+		Origin:              timeRange.Start,
+		AggregationMethod:   "average",
+		FilterBounds:        &bounds,
+		TimeRange:           &timeRange,
+	}
+
+	source, err := NewDBLightSource(ctx, db, &bounds, &timeRange)
+	if err != nil {
+		return nil, err
+	}
+	defer source.Close()
+
+	aggregator, err := NewParallelAggregator(config, 0)
+	if err != nil {
+		return nil, err
+	}
+	return aggregator.Aggregate(ctx, source)
+}
+
+// handleOccurrenceTile serves occurrence points, clustered into grid cells below occurrencePointZoom
+func (s *APIServer) handleOccurrenceTile(w http.ResponseWriter, r *http.Request) {
+	timeRange, err := parseOptionalTimeRange(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	bioGroup := r.URL.Query().Get("bio_group")
+
+	s.serveTile(w, r, "occurrences", func(tile tileCoord) ([]byte, error) {
+		return renderOccurrenceTile(r.Context(), s.db, tile, timeRange, bioGroup)
+	})
+}
+
+// occurrenceCell counts occurrences snapped to one grid cell
+type occurrenceCell struct {
+	count     int
+	bioGroups map[string]int
+}
+
+// renderOccurrenceTile encodes biological_data records within the tile
+func renderOccurrenceTile(ctx context.Context, db *sql.DB, tile tileCoord, timeRange *TimeRange, bioGroup string) ([]byte, error) {
+	bounds := tile.bounds(tileBufferRatio)
+
+	conditions := []string{
+		"standard_longitude BETWEEN $1 AND $2",
+		"standard_latitude BETWEEN $3 AND $4",
+	}
+	args := []interface{}{bounds.MinLongitude, bounds.MaxLongitude, bounds.MinLatitude, bounds.MaxLatitude}
+	if timeRange != nil {
+		conditions = append(conditions, fmt.Sprintf("event_date BETWEEN $%d AND $%d", len(args)+1, len(args)+2))
+		args = append(args, timeRange.Start, timeRange.End)
+	}
+	if bioGroup != "" && bioGroup != "all" {
+		conditions = append(conditions, fmt.Sprintf("bio_group = $%d", len(args)+1))
+		args = append(args, bioGroup)
+	}
+
+	query := fmt.Sprintf(`
+		SELECT id, standard_longitude, standard_latitude,
+			COALESCE(bio_group, ''), COALESCE(scientific_name, ''), COALESCE(common_name_c, ''), event_date
+		FROM biological_data
+		WHERE %s`, strings.Join(conditions, " AND "))
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	layer := newMVTLayer("occurrences")
+	clustered := tile.Z < occurrencePointZoom
+	spatialAgg := NewSpatialAggregator(&AggregationConfig{SpatialResolutionKm: tile.resolutionKm()})
+	cells := make(map[GridCoordinate]*occurrenceCell)
+
+	for rows.Next() {
+		var id int64
+		var longitude, latitude float64
+		var group, scientificName, commonName string
+		var eventDate sql.NullTime
+		if err := rows.Scan(&id, &longitude, &latitude, &group, &scientificName, &commonName, &eventDate); err != nil {
+			return nil, err
+		}
+
+		if clustered {
+			coord := spatialAgg.snapToGrid(longitude, latitude)
+			cell, ok := cells[coord]
+			if !ok {
+				cell = &occurrenceCell{bioGroups: make(map[string]int)}
+				cells[coord] = cell
+			}
+			cell.count++
+			cell.bioGroups[group]++
+			continue
+		}
+
+		if len(layer.features) >= maxTileFeatures {
+			slog.Warn("Occurrence tile truncated", "table", "biological_data", "z", tile.Z, "x", tile.X, "y", tile.Y, "points", maxTileFeatures)
+			break
+		}
+
+		props := map[string]interface{}{
+			"bio_group":       group,
+			"scientific_name": scientificName,
+			"common_name_c":   commonName,
+		}
+		if eventDate.Valid {
+			props["event_date"] = eventDate.Time.UTC().Format(time.RFC3339)
+		}
+		x, y := tile.project(longitude, latitude)
+		layer.addPoint(uint64(id), x, y, props)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var featureID uint64
+	for coord, cell := range cells {
+		featureID++
+		if featureID > maxTileFeatures {
+			slog.Warn("Occurrence tile truncated", "table", "biological_data", "z", tile.Z, "x", tile.X, "y", tile.Y, "cells", maxTileFeatures)
+			break
+		}
+
+		// Report the dominant group so clusters can be coloured like single points
+		dominant, dominantCount := "", 0
+		for group, count := range cell.bioGroups {
+			if count > dominantCount || (count == dominantCount && group < dominant) {
+				dominant, dominantCount = group, count
+			}
+		}
+
+		x, y := tile.project(coord.Longitude, coord.Latitude)
+		layer.addPoint(featureID, x, y, map[string]interface{}{
+			"count":     cell.count,
+			"bio_group": dominant,
+		})
+	}
+
+	return encodeMVT(layer), nil
+}
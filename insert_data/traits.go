@@ -0,0 +1,320 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+)
+
+// ActivityPeriod is the time of day a taxon is active
+type ActivityPeriod string
+
+const (
+	ActivityNocturnal   ActivityPeriod = "nocturnal"
+	ActivityDiurnal     ActivityPeriod = "diurnal"
+	ActivityCrepuscular ActivityPeriod = "crepuscular"
+	ActivityUnknown     ActivityPeriod = "unknown" // no trait and too few timed records
+)
+
+func (a ActivityPeriod) valid() bool {
+	switch a {
+	case ActivityNocturnal, ActivityDiurnal, ActivityCrepuscular:
+		return true
+	}
+	return false
+}
+
+// Time-of-day heuristic for taxa without a trait. Hours are Taiwan local time; night runs from 19:00 to
+// 05:00 and twilight covers the two hours around sunrise and sunset.
+const (
+	minTimedRecords     = 10  // fewest records with a time of day before the heuristic decides
+	activityMajority    = 0.6 // share of night or day records classifying a taxon as nocturnal or diurnal
+	crepuscularMajority = 0.4 // share of twilight records classifying a taxon as crepuscular
+)
+
+// TaxonTrait is an imported activity period, a row of taxon_traits. A single-word scientific name applies
+// to the whole genus.
+type TaxonTrait struct {
+	ScientificName string         `json:"scientific_name"`
+	ActivityPeriod ActivityPeriod `json:"activity_period"`
+	Source         string         `json:"source"`
+}
+
+// TaxonActivity is the resolved activity period of a scientific name, a row of taxon_activity
+type TaxonActivity struct {
+	ScientificName string         `json:"scientific_name"`
+	ActivityPeriod ActivityPeriod `json:"activity_period"`
+	Basis          string         `json:"basis"` // species, genus, time_of_day or none
+	TimedRecords   int            `json:"timed_records"`
+	NightShare     *float64       `json:"night_share"`
+}
+
+// taxonActivityColumns are the taxon_activity columns in TaxonActivity field order
+var taxonActivityColumns = []string{"scientific_name", "activity_period", "basis", "timed_records", "night_share"}
+
+func (a *TaxonActivity) values() []interface{} {
+	return []interface{}{a.ScientificName, string(a.ActivityPeriod), a.Basis, a.TimedRecords, a.NightShare}
+}
+
+// readTaxonTraits parses a CSV with the columns scientific_name and activity_period and an optional source
+func readTaxonTraits(r io.Reader) ([]TaxonTrait, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("error reading header: %v", err)
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+	nameColumn, hasName := columns["scientific_name"]
+	periodColumn, hasPeriod := columns["activity_period"]
+	if !hasName || !hasPeriod {
+		return nil, fmt.Errorf("header needs scientific_name and activity_period columns")
+	}
+	sourceColumn, hasSource := columns["source"]
+
+	var traits []TaxonTrait
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		trait := TaxonTrait{
+			ScientificName: strings.Join(strings.Fields(record[nameColumn]), " "),
+			ActivityPeriod: ActivityPeriod(strings.ToLower(strings.TrimSpace(record[periodColumn]))),
+		}
+		if hasSource {
+			trait.Source = strings.TrimSpace(record[sourceColumn])
+		}
+		if trait.ScientificName == "" {
+			continue
+		}
+		if !trait.ActivityPeriod.valid() {
+			return nil, fmt.Errorf("line %d: activity_period %q is not nocturnal, diurnal or crepuscular", line, trait.ActivityPeriod)
+		}
+		traits = append(traits, trait)
+	}
+	return traits, nil
+}
+
+// importTaxonTraits reads the traits CSV at path and upserts it into taxon_traits, returning the rows written
+func importTaxonTraits(ctx context.Context, db *sql.DB, path string) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, fmt.Errorf("error opening %s: %v", path, err)
+	}
+	defer file.Close()
+
+	traits, err := readTaxonTraits(file)
+	if err != nil {
+		return 0, fmt.Errorf("error reading %s: %v", path, err)
+	}
+
+	// The last row of a repeated name wins, as it would in the upsert
+	unique := make(map[string]TaxonTrait, len(traits))
+	for _, trait := range traits {
+		unique[trait.ScientificName] = trait
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	batchSize := maxBatchRows(1000, 3)
+	valueStrings := make([]string, 0, batchSize)
+	valueArgs := make([]interface{}, 0, batchSize*3)
+	flush := func() error {
+		if len(valueStrings) == 0 {
+			return nil
+		}
+		query := fmt.Sprintf(`
+			INSERT INTO taxon_traits (scientific_name, activity_period, source)
+			VALUES %s
+			ON CONFLICT (scientific_name) DO UPDATE SET
+				activity_period = EXCLUDED.activity_period,
+				source = EXCLUDED.source,
+				updated_at = CURRENT_TIMESTAMP`, strings.Join(valueStrings, ","))
+		if _, err := tx.ExecContext(ctx, query, valueArgs...); err != nil {
+			return fmt.Errorf("error upserting taxon traits: %v", err)
+		}
+		valueStrings, valueArgs = valueStrings[:0], valueArgs[:0]
+		return nil
+	}
+
+	for _, trait := range unique {
+		n := len(valueArgs)
+		valueStrings = append(valueStrings, fmt.Sprintf("($%d, $%d, $%d)", n+1, n+2, n+3))
+		var source interface{}
+		if trait.Source != "" {
+			source = trait.Source
+		}
+		valueArgs = append(valueArgs, trait.ScientificName, string(trait.ActivityPeriod), source)
+		if len(valueStrings) == batchSize {
+			if err := flush(); err != nil {
+				return 0, err
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return 0, err
+	}
+	return len(unique), tx.Commit()
+}
+
+// hourCounts tallies the records of a taxon by time of day
+type hourCounts struct {
+	night, twilight, day int
+}
+
+func (h *hourCounts) add(hour int) {
+	switch {
+	case hour >= 19 || hour < 5:
+		h.night++
+	case hour < 7 || hour >= 17:
+		h.twilight++
+	default:
+		h.day++
+	}
+}
+
+func (h hourCounts) total() int { return h.night + h.twilight + h.day }
+
+// classify applies the time-of-day heuristic, returning ActivityUnknown for too few or mixed records
+func (h hourCounts) classify() ActivityPeriod {
+	total := float64(h.total())
+	switch {
+	case h.total() < minTimedRecords:
+		return ActivityUnknown
+	case float64(h.night)/total >= activityMajority:
+		return ActivityNocturnal
+	case float64(h.day)/total >= activityMajority:
+		return ActivityDiurnal
+	case float64(h.twilight)/total >= crepuscularMajority:
+		return ActivityCrepuscular
+	}
+	return ActivityUnknown
+}
+
+// genusOf returns the first word of a scientific name
+func genusOf(name string) string {
+	if i := strings.IndexByte(name, ' '); i >= 0 {
+		return name[:i]
+	}
+	return name
+}
+
+// resolveTaxonActivity classifies every scientific name of biological_data, the accepted name where the
+// checklist resolved one, by, in order, its own trait, the trait of its genus and the time of day of its
+// records. Records at exactly local midnight are taken as date-only and do not count as timed.
+func resolveTaxonActivity(ctx context.Context, db *sql.DB) ([]TaxonActivity, error) {
+	traits := make(map[string]ActivityPeriod)
+	rows, err := db.QueryContext(ctx, "SELECT scientific_name, activity_period FROM taxon_traits")
+	if err != nil {
+		return nil, fmt.Errorf("error querying taxon traits: %v", err)
+	}
+	for rows.Next() {
+		var name, period string
+		if err := rows.Scan(&name, &period); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("error scanning taxon trait: %v", err)
+		}
+		traits[name] = ActivityPeriod(period)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = db.QueryContext(ctx, `
+		SELECT COALESCE(accepted_name, scientific_name), event_date
+		FROM biological_data
+		WHERE COALESCE(accepted_name, scientific_name) <> ''`)
+	if err != nil {
+		return nil, fmt.Errorf("error querying occurrences: %v", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[string]*hourCounts)
+	for rows.Next() {
+		var name string
+		var eventDate sql.NullTime
+		if err := rows.Scan(&name, &eventDate); err != nil {
+			return nil, fmt.Errorf("error scanning occurrence: %v", err)
+		}
+		if counts[name] == nil {
+			counts[name] = &hourCounts{}
+		}
+		if !eventDate.Valid {
+			continue
+		}
+		local := eventDate.Time.In(TaiwanLocation)
+		if local.Hour() == 0 && local.Minute() == 0 && local.Second() == 0 {
+			continue
+		}
+		counts[name].add(local.Hour())
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	activities := make([]TaxonActivity, 0, len(counts))
+	for name, hours := range counts {
+		activity := TaxonActivity{ScientificName: name, TimedRecords: hours.total(), Basis: "none", ActivityPeriod: ActivityUnknown}
+		if hours.total() > 0 {
+			activity.NightShare = floatPtr(float64(hours.night) / float64(hours.total()))
+		}
+		if period, ok := traits[name]; ok {
+			activity.ActivityPeriod, activity.Basis = period, "species"
+		} else if period, ok := traits[genusOf(name)]; ok {
+			activity.ActivityPeriod, activity.Basis = period, "genus"
+		} else if period := hours.classify(); period != ActivityUnknown {
+			activity.ActivityPeriod, activity.Basis = period, "time_of_day"
+		}
+		activities = append(activities, activity)
+	}
+	return activities, nil
+}
+
+// migrateToTaxonActivity rebuilds taxon_activity, which the animal aggregation joins to split its counts
+// by activity period
+func migrateToTaxonActivity(ctx context.Context, db *sql.DB) error {
+	slog.Info("Starting migration to taxon_activity table...", "table", "taxon_activity")
+
+	if err := createTaxonTraitTables(ctx, db); err != nil {
+		return fmt.Errorf("error creating taxon trait tables: %v", err)
+	}
+
+	start := time.Now()
+	activities, err := resolveTaxonActivity(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	if err := replaceTable(ctx, db, "taxon_activity", taxonActivityColumns, activities); err != nil {
+		return err
+	}
+
+	bases := make(map[string]int)
+	for _, a := range activities {
+		bases[a.Basis]++
+	}
+
+	slog.Info("Resolved activity periods", "table", "taxon_activity", "names", len(activities),
+		"duration", time.Since(start).Round(time.Millisecond), "species_trait", bases["species"], "genus_trait", bases["genus"],
+		"time_of_day", bases["time_of_day"], "unresolved", bases["none"])
+	return nil
+}
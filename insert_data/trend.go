@@ -0,0 +1,297 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// TrendConfig controls analyze-trend
+type TrendConfig struct {
+	GridKm   float64 // SpatialAggregator resolution of the grid cell series, 0 skips the grid
+	MinYears int     // fewest distinct years a series needs
+	Alpha    float64 // significance level of the increasing and decreasing classifications
+}
+
+// TrendResult is the seasonal Mann-Kendall test and seasonal Sen's slope of the monthly mean brightness
+// of one county or grid cell, a row of light_brightness_trend. Statistics that are undefined are nil.
+type TrendResult struct {
+	Scope          string   `json:"scope"` // county or grid
+	County         *string  `json:"county"`
+	GridLongitude  *float64 `json:"grid_longitude"`
+	GridLatitude   *float64 `json:"grid_latitude"`
+	ResolutionKm   *float64 `json:"resolution_km"`
+	Months         int      `json:"months"`
+	Years          int      `json:"years"`
+	FirstYear      int      `json:"first_year"`
+	LastYear       int      `json:"last_year"`
+	MeanBrightness *float64 `json:"mean_brightness"`
+	MannKendallS   float64  `json:"mann_kendall_s"`
+	Variance       *float64 `json:"variance"`
+	Z              *float64 `json:"z"`
+	PValue         *float64 `json:"p_value"`
+	SenSlope       *float64 `json:"sen_slope"` // brightness per year
+	Trend          string   `json:"trend"`     // increasing, decreasing or none
+}
+
+// trendColumns are the light_brightness_trend columns in TrendResult field order
+var trendColumns = []string{
+	"scope", "county", "grid_longitude", "grid_latitude", "resolution_km",
+	"months", "years", "first_year", "last_year", "mean_brightness",
+	"mann_kendall_s", "variance", "z", "p_value", "sen_slope", "trend",
+}
+
+func (t *TrendResult) values() []interface{} {
+	return []interface{}{
+		t.Scope, t.County, t.GridLongitude, t.GridLatitude, t.ResolutionKm,
+		t.Months, t.Years, t.FirstYear, t.LastYear, t.MeanBrightness,
+		t.MannKendallS, t.Variance, t.Z, t.PValue, t.SenSlope, t.Trend,
+	}
+}
+
+func (t *TrendResult) scanTargets() []interface{} {
+	return []interface{}{
+		&t.Scope, &t.County, &t.GridLongitude, &t.GridLatitude, &t.ResolutionKm,
+		&t.Months, &t.Years, &t.FirstYear, &t.LastYear, &t.MeanBrightness,
+		&t.MannKendallS, &t.Variance, &t.Z, &t.PValue, &t.SenSlope, &t.Trend,
+	}
+}
+
+// monthlySeries maps year*12 + month-1 to the mean brightness of that month
+type monthlySeries map[int]float64
+
+// seasonalTrend runs the seasonal Mann-Kendall test of Hirsch and Slack, treating each calendar month as a
+// season so the annual cycle does not read as a trend, and the seasonal Sen's slope over the same pairs
+func seasonalTrend(series monthlySeries, alpha float64) TrendResult {
+	bySeason := make([][]int, 12)
+	years := make(map[int]bool)
+	values := make([]float64, 0, len(series))
+	for index, value := range series {
+		bySeason[index%12] = append(bySeason[index%12], index)
+		years[index/12] = true
+		values = append(values, value)
+	}
+
+	result := TrendResult{Months: len(series), Years: len(years), Trend: "none", MeanBrightness: finitePtr(mean(values))}
+	result.FirstYear, result.LastYear = math.MaxInt, math.MinInt
+	for year := range years {
+		result.FirstYear, result.LastYear = min(result.FirstYear, year), max(result.LastYear, year)
+	}
+
+	var variance float64
+	var slopes []float64
+	for _, indices := range bySeason {
+		sort.Ints(indices)
+		x := make([]float64, len(indices))
+		y := make([]float64, len(indices))
+		for i, index := range indices {
+			x[i], y[i] = float64(index/12), series[index]
+		}
+		s, v := mannKendall(y)
+		result.MannKendallS += s
+		variance += v
+		slopes = pairwiseSlopes(slopes, x, y)
+	}
+
+	z := mannKendallZ(result.MannKendallS, variance)
+	p := 2 * (1 - normalCDF(math.Abs(z)))
+	result.Variance, result.Z, result.PValue = finitePtr(variance), finitePtr(z), finitePtr(p)
+	result.SenSlope = finitePtr(median(slopes))
+	if p < alpha {
+		switch {
+		case result.MannKendallS > 0:
+			result.Trend = "increasing"
+		case result.MannKendallS < 0:
+			result.Trend = "decreasing"
+		}
+	}
+	return result
+}
+
+// loadCountyTrendSeries returns the monthly mean brightness series of every county
+func loadCountyTrendSeries(ctx context.Context, db *sql.DB) (map[string]monthlySeries, error) {
+	brightness, err := loadCountyMonthlyBrightness(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	series := make(map[string]monthlySeries)
+	for key, value := range brightness {
+		if series[key.county] == nil {
+			series[key.county] = make(monthlySeries)
+		}
+		series[key.county][key.year*12+key.month-1] = value
+	}
+	return series, nil
+}
+
+// aggregateLightGrid streams light_data_with_county through aggregator and returns the accumulated
+// brightness per grid cell and time bucket
+func aggregateLightGrid(ctx context.Context, db *sql.DB, aggregator *DataAggregator) (map[aggregationKey]*AggregationAccumulator, error) {
+	source, err := NewDBLightSource(ctx, db, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer source.Close()
+
+	accumulators := make(map[aggregationKey]*AggregationAccumulator)
+	batch := make([]LightData, 10000)
+	for {
+		n, err := source.Read(batch)
+		for _, point := range batch[:n] {
+			if !aggregator.shouldIncludePoint(point) {
+				continue
+			}
+			key := aggregator.keyFor(point)
+			if accumulators[key] == nil {
+				accumulators[key] = &AggregationAccumulator{}
+			}
+			accumulators[key].Add(point.Brightness)
+		}
+		if err == io.EOF {
+			return accumulators, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// loadGridTrendSeries returns the monthly mean brightness series of every grid cell, applying lightQualityFilter
+func loadGridTrendSeries(ctx context.Context, db *sql.DB, resolutionKm float64) (map[GridCoordinate]monthlySeries, *DataAggregator, error) {
+	aggregator, err := NewDataAggregator(&AggregationConfig{
+		SpatialResolutionKm: resolutionKm,
+		CalendarUnit:        CalendarMonth,
+		AggregationMethod:   "average",
+		Quality:             lightQualityFilter,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	accumulators, err := aggregateLightGrid(ctx, db, aggregator)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	series := make(map[GridCoordinate]monthlySeries)
+	for key, acc := range accumulators {
+		cell := GridCoordinate{Longitude: key.GridLongitude, Latitude: key.GridLatitude}
+		if series[cell] == nil {
+			series[cell] = make(monthlySeries)
+		}
+		month := time.Unix(key.TimeBucket, 0).UTC()
+		series[cell][month.Year()*12+int(month.Month())-1] = acc.Average()
+	}
+	return series, aggregator, nil
+}
+
+// runTrendAnalysis rebuilds light_brightness_trend for every county and, unless config.GridKm is 0,
+// every grid cell of that resolution
+func runTrendAnalysis(ctx context.Context, db *sql.DB, config TrendConfig) (int, error) {
+	var results []TrendResult
+	skipped := 0
+
+	counties, err := loadCountyTrendSeries(ctx, db)
+	if err != nil {
+		return 0, err
+	}
+	for county, series := range counties {
+		result := seasonalTrend(series, config.Alpha)
+		if result.Years < config.MinYears {
+			skipped++
+			continue
+		}
+		result.Scope, result.County = "county", &county
+		results = append(results, result)
+	}
+	slog.Info("County brightness trends computed", "counties", len(counties))
+
+	if config.GridKm > 0 {
+		cells, aggregator, err := loadGridTrendSeries(ctx, db, config.GridKm)
+		if err != nil {
+			return 0, err
+		}
+		for cell, series := range cells {
+			result := seasonalTrend(series, config.Alpha)
+			if result.Years < config.MinYears {
+				skipped++
+				continue
+			}
+			result.Scope = "grid"
+			result.GridLongitude, result.GridLatitude = floatPtr(cell.Longitude), floatPtr(cell.Latitude)
+			result.ResolutionKm = floatPtr(config.GridKm)
+			results = append(results, result)
+		}
+		slog.Info("Grid brightness trends computed", "cells", len(cells), "resolution_km", config.GridKm)
+		aggregator.exclusions.LogSummary("Light pixels skipped by the trend grid")
+	}
+
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if a.Scope != b.Scope {
+			return a.Scope < b.Scope
+		}
+		if a.County != nil && b.County != nil {
+			return *a.County < *b.County
+		}
+		if a.GridLatitude != nil && b.GridLatitude != nil && *a.GridLatitude != *b.GridLatitude {
+			return *a.GridLatitude < *b.GridLatitude
+		}
+		return a.GridLongitude != nil && b.GridLongitude != nil && *a.GridLongitude < *b.GridLongitude
+	})
+
+	if err := replaceTable(ctx, db, "light_brightness_trend", trendColumns, results); err != nil {
+		return 0, err
+	}
+
+	trends := make(map[string]int)
+	for _, result := range results {
+		trends[result.Trend]++
+	}
+	logProgress("Trend analysis written", "table", "light_brightness_trend", "rows", len(results),
+		"increasing", trends["increasing"], "decreasing", trends["decreasing"], "none", trends["none"],
+		"skipped_short_series", skipped, "min_years", config.MinYears, "alpha", config.Alpha)
+	return len(results), nil
+}
+
+// queryTrendResults reads light_brightness_trend, optionally filtered by scope, county and trend
+func queryTrendResults(ctx context.Context, db *sql.DB, scope, county, trend string) ([]TrendResult, error) {
+	var conditions []string
+	var args []interface{}
+	for _, filter := range []struct{ column, value string }{{"scope", scope}, {"county", county}, {"trend", trend}} {
+		if filter.value != "" {
+			args = append(args, filter.value)
+			conditions = append(conditions, fmt.Sprintf("%s = $%d", filter.column, len(args)))
+		}
+	}
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	rows, err := db.QueryContext(ctx, fmt.Sprintf("SELECT %s FROM light_brightness_trend %s ORDER BY scope, county, grid_latitude, grid_longitude",
+		strings.Join(trendColumns, ", "), where), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []TrendResult{}
+	for rows.Next() {
+		var result TrendResult
+		if err := rows.Scan(result.scanTargets()...); err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+	return results, rows.Err()
+}
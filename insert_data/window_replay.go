@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// lightWindowColumns are the light_windowed_aggregated columns written per window, in the order of lightWindowRow.values
+var lightWindowColumns = []string{
+	"resolution_km", "grid_longitude", "grid_latitude", "window_start", "window_end",
+	"avg_brightness", "min_brightness", "max_brightness", "point_count", "revision",
+}
+
+// lightWindowReplace lets a correction overwrite the earlier emission of the same cell and window
+const lightWindowReplace = `ON CONFLICT (resolution_km, grid_longitude, grid_latitude, window_start, window_end) DO UPDATE SET
+	avg_brightness = excluded.avg_brightness,
+	min_brightness = excluded.min_brightness,
+	max_brightness = excluded.max_brightness,
+	point_count = excluded.point_count,
+	revision = excluded.revision,
+	updated_at = CURRENT_TIMESTAMP`
+
+// lightWindowRow is one emitted window of a grid cell at a grid resolution
+type lightWindowRow struct {
+	ResolutionKm float64
+	WindowedLightData
+}
+
+func (r *lightWindowRow) values() []interface{} {
+	return []interface{}{
+		r.ResolutionKm, r.GridLongitude, r.GridLatitude, r.TimeBucket.UTC(), r.WindowEnd.UTC(),
+		r.AvgBrightness, r.MinBrightness, r.MaxBrightness, r.Count, r.Revision,
+	}
+}
+
+// WindowReplayConfig configures aggregate-windows
+type WindowReplayConfig struct {
+	InputPath string       // light.ndjson written by an import with --ndjson-dir
+	GridKm    float64      // grid cell size
+	Period    CalendarUnit // bucket the window size and slide are counted in
+	Window    WindowConfig
+}
+
+// WindowReplayResult summarises an aggregate-windows run
+type WindowReplayResult struct {
+	Points      int64 // records with a brightness passed to the aggregator
+	Finals      int64
+	Corrections int64
+	WindowStats
+}
+
+// runWindowedAggregation replays light records in file order through an EventTimeAggregator, so the watermark
+// follows the order the pixels arrived in, and writes every final and corrected window to
+// light_windowed_aggregated. The table is cleared first and holds the windows of the last run.
+func runWindowedAggregation(ctx context.Context, db *sql.DB, config WindowReplayConfig) (WindowReplayResult, error) {
+	var result WindowReplayResult
+
+	aggregator, err := NewEventTimeAggregator(&AggregationConfig{
+		SpatialResolutionKm: config.GridKm,
+		CalendarUnit:        config.Period,
+		Location:            TaiwanLocation,
+		AggregationMethod:   "average",
+		Quality:             lightQualityFilter,
+	}, config.Window)
+	if err != nil {
+		return result, err
+	}
+
+	file, err := os.Open(config.InputPath)
+	if err != nil {
+		return result, fmt.Errorf("error opening light records: %w", err)
+	}
+	defer file.Close()
+
+	if _, err := db.ExecContext(ctx, "DELETE FROM light_windowed_aggregated"); err != nil {
+		return result, fmt.Errorf("error clearing light_windowed_aggregated: %w", err)
+	}
+
+	// After an error the writer keeps draining the channel so AddPoint and Close never block on it
+	written := make(chan error, 1)
+	go func() {
+		var err error
+		for batch := range aggregator.GetOutputChannel() {
+			if err != nil {
+				continue
+			}
+			rows := make([]lightWindowRow, len(batch))
+			for i, window := range batch {
+				rows[i] = lightWindowRow{ResolutionKm: config.GridKm, WindowedLightData: window}
+				if window.Kind == WindowCorrection {
+					result.Corrections++
+				} else {
+					result.Finals++
+				}
+			}
+			err = mergeLightWindows(ctx, db, rows)
+		}
+		written <- err
+	}()
+
+	readErr := replayLightRecords(ctx, file, aggregator, &result.Points)
+	closeErr := aggregator.Close(ctx)
+	writeErr := <-written
+	result.WindowStats = aggregator.Stats()
+
+	for _, err := range []error{readErr, writeErr, closeErr} {
+		if err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// replayLightRecords feeds every record with a brightness to the aggregator and counts them in points
+func replayLightRecords(ctx context.Context, r io.Reader, aggregator *EventTimeAggregator, points *int64) error {
+	decoder := json.NewDecoder(bufio.NewReader(r))
+	for n := 1; ; n++ {
+		var record LightRecord
+		if err := decoder.Decode(&record); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("error decoding light record %d: %w", n, err)
+		}
+		if record.Brightness == nil {
+			continue
+		}
+		if err := aggregator.AddPoint(ctx, lightDataFromRecord(record)); err != nil {
+			return err
+		}
+		*points++
+	}
+}
+
+// mergeLightWindows writes one batch of emitted windows in one transaction
+func mergeLightWindows(ctx context.Context, db *sql.DB, rows []lightWindowRow) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := upsertRows(ctx, tx, "light_windowed_aggregated", lightWindowColumns, rows, lightWindowReplace); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
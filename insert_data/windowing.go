@@ -0,0 +1,346 @@
+package main
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// WindowType selects how event-time windows are laid over temporal buckets
+type WindowType int
+
+const (
+	// TumblingWindow assigns every point to exactly one window
+	TumblingWindow WindowType = iota
+	// SlidingWindow assigns every point to all overlapping windows
+	SlidingWindow
+)
+
+// WindowConfig defines event-time windowing in units of TemporalAggregator buckets
+type WindowConfig struct {
+	Type            WindowType    `json:"type"`
+	SizeBuckets     int64         `json:"size_buckets"`     // window length, defaults to 1
+	SlideBuckets    int64         `json:"slide_buckets"`    // distance between sliding window starts, defaults to 1
+	WatermarkDelay  time.Duration `json:"watermark_delay"`  // how far the watermark trails the newest event
+	AllowedLateness time.Duration `json:"allowed_lateness"` // how long closed windows accept corrections
+}
+
+// WindowResultKind tells consumers whether a result is the first or an updated emission
+type WindowResultKind int
+
+const (
+	// WindowFinal is emitted once when the watermark passes the window end
+	WindowFinal WindowResultKind = iota
+	// WindowCorrection replaces an earlier emission for the same cell and window after late data
+	WindowCorrection
+)
+
+// WindowedLightData is a complete aggregate for one grid cell and event-time window
+type WindowedLightData struct {
+	AggregatedLightData
+	WindowEnd time.Time        `json:"window_end"`
+	Kind      WindowResultKind `json:"kind"`
+	Revision  int              `json:"revision"` // 0 for the final result, incremented per correction
+}
+
+// WindowStats counts points that did not go through a normal window. Each point counts once, however many
+// sliding windows contain it.
+type WindowStats struct {
+	LatePointsApplied int64 `json:"late_points_applied"` // points that corrected at least one fired window
+	LatePointsDropped int64 `json:"late_points_dropped"` // points whose windows had all expired
+}
+
+// windowKey identifies one grid cell in one window
+type windowKey struct {
+	GridLongitude float64
+	GridLatitude  float64
+	StartIndex    int64
+}
+
+// windowState tracks a window until it is purged after the allowed lateness
+type windowState struct {
+	key      windowKey
+	acc      AggregationAccumulator
+	end      time.Time
+	fired    bool
+	dirty    bool
+	revision int
+}
+
+// windowHeap orders windows by end, so the watermark only visits the windows it closes or expires
+type windowHeap []*windowState
+
+func (h windowHeap) Len() int           { return len(h) }
+func (h windowHeap) Less(i, j int) bool { return h[i].end.Before(h[j].end) }
+func (h windowHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *windowHeap) Push(x any)        { *h = append(*h, x.(*windowState)) }
+func (h *windowHeap) Pop() any {
+	old := *h
+	state := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return state
+}
+
+// closesBy reports whether the earliest window ends at or before t
+func (h windowHeap) closesBy(t time.Time, lateness time.Duration) bool {
+	return len(h) > 0 && !h[0].end.Add(lateness).After(t)
+}
+
+// EventTimeAggregator aggregates light points into event-time windows closed by a watermark.
+// Each cell and window is emitted once as a complete aggregate; late points within the allowed
+// lateness produce corrections instead of additional partial aggregates.
+type EventTimeAggregator struct {
+	mu         sync.Mutex
+	aggregator *DataAggregator
+	window     WindowConfig
+	windows    map[windowKey]*windowState
+	open       windowHeap     // windows not fired yet
+	fired      windowHeap     // fired windows still accepting corrections
+	dirty      []*windowState // fired windows with late points since their last emission
+	maxEvent   time.Time
+	watermark  time.Time
+	outputChan chan []WindowedLightData
+	stats      WindowStats
+	closed     bool
+}
+
+// NewEventTimeAggregator creates an event-time windowed aggregator
+func NewEventTimeAggregator(config *AggregationConfig, window WindowConfig) (*EventTimeAggregator, error) {
+	if window.SizeBuckets <= 0 {
+		window.SizeBuckets = 1
+	}
+	if window.SlideBuckets <= 0 {
+		window.SlideBuckets = 1
+	}
+	if window.Type == TumblingWindow {
+		window.SlideBuckets = window.SizeBuckets
+	}
+	if window.SlideBuckets > window.SizeBuckets {
+		return nil, fmt.Errorf("window slide (%d buckets) must not exceed window size (%d buckets)", window.SlideBuckets, window.SizeBuckets)
+	}
+
+	aggregator, err := NewDataAggregator(config)
+	if err != nil {
+		return nil, err
+	}
+	return &EventTimeAggregator{
+		aggregator: aggregator,
+		window:     window,
+		windows:    make(map[windowKey]*windowState),
+		outputChan: make(chan []WindowedLightData, 10),
+	}, nil
+}
+
+// windowStarts returns the bucket indexes of every window containing the given bucket
+func (ea *EventTimeAggregator) windowStarts(bucket int64) []int64 {
+	size, slide := ea.window.SizeBuckets, ea.window.SlideBuckets
+
+	// Latest window start aligned to the slide that is not after the bucket
+	last := bucket - floorMod(bucket, slide)
+
+	var starts []int64
+	for start := last; start > bucket-size; start -= slide {
+		starts = append(starts, start)
+	}
+	return starts
+}
+
+// floorMod returns a mod b with the sign of b
+func floorMod(a, b int64) int64 {
+	m := a % b
+	if m < 0 {
+		m += b
+	}
+	return m
+}
+
+// AddPoint assigns a point to its windows and advances the watermark.
+// It blocks while the consumer is behind and returns ctx.Err() if cancelled while waiting.
+func (ea *EventTimeAggregator) AddPoint(ctx context.Context, data LightData) error {
+	ea.mu.Lock()
+	defer ea.mu.Unlock()
+
+	if ea.closed {
+		return fmt.Errorf("event-time aggregator is closed")
+	}
+	if !ea.aggregator.shouldIncludePoint(data) {
+		return nil
+	}
+
+	temporalAgg := ea.aggregator.temporalAgg
+	gridCoord := ea.aggregator.spatialAgg.snapToGrid(data.Longitude, data.Latitude)
+	bucket := temporalAgg.bucketIndex(data.Time)
+
+	applied, accepted := false, false
+	for _, start := range ea.windowStarts(bucket) {
+		end := temporalAgg.bucketStart(start + ea.window.SizeBuckets)
+
+		key := windowKey{
+			GridLongitude: gridCoord.Longitude,
+			GridLatitude:  gridCoord.Latitude,
+			StartIndex:    start,
+		}
+
+		state, exists := ea.windows[key]
+		if !exists {
+			// A missing window whose lateness has expired was already purged
+			if !ea.watermark.IsZero() && !end.Add(ea.window.AllowedLateness).After(ea.watermark) {
+				continue
+			}
+			state = &windowState{key: key, end: end}
+			ea.windows[key] = state
+			heap.Push(&ea.open, state)
+		}
+
+		state.acc.Add(data.Brightness)
+		accepted = true
+		if state.fired {
+			if !state.dirty {
+				state.dirty = true
+				ea.dirty = append(ea.dirty, state)
+			}
+			applied = true
+		}
+	}
+	if applied {
+		ea.stats.LatePointsApplied++
+	} else if !accepted {
+		ea.stats.LatePointsDropped++
+	}
+
+	if data.Time.After(ea.maxEvent) {
+		ea.maxEvent = data.Time
+	}
+	return ea.advanceLocked(ctx, ea.maxEvent.Add(-ea.window.WatermarkDelay))
+}
+
+// AdvanceWatermark moves the watermark forward explicitly, e.g. when a source is known to be complete up to a time
+func (ea *EventTimeAggregator) AdvanceWatermark(ctx context.Context, watermark time.Time) error {
+	ea.mu.Lock()
+	defer ea.mu.Unlock()
+	return ea.advanceLocked(ctx, watermark)
+}
+
+// advanceLocked emits corrections, fires closed windows and purges expired state; the caller must hold ea.mu.
+// Only the corrected windows and the windows the watermark closes or expires are visited.
+func (ea *EventTimeAggregator) advanceLocked(ctx context.Context, watermark time.Time) error {
+	if watermark.After(ea.watermark) {
+		ea.watermark = watermark
+	}
+
+	var results []WindowedLightData
+	for _, state := range ea.dirty {
+		state.dirty = false
+		state.revision++
+		results = append(results, ea.windowResult(state, WindowCorrection))
+	}
+	ea.dirty = ea.dirty[:0]
+
+	for ea.open.closesBy(ea.watermark, 0) {
+		state := heap.Pop(&ea.open).(*windowState)
+		state.fired = true
+		results = append(results, ea.windowResult(state, WindowFinal))
+		heap.Push(&ea.fired, state)
+	}
+	for ea.fired.closesBy(ea.watermark, ea.window.AllowedLateness) {
+		state := heap.Pop(&ea.fired).(*windowState)
+		delete(ea.windows, state.key)
+	}
+
+	return ea.emit(ctx, results)
+}
+
+// windowResult converts window state into an output record
+func (ea *EventTimeAggregator) windowResult(state *windowState, kind WindowResultKind) WindowedLightData {
+	key := state.key
+	return WindowedLightData{
+		AggregatedLightData: AggregatedLightData{
+			GridLongitude: key.GridLongitude,
+			GridLatitude:  key.GridLatitude,
+			TimeBucket:    ea.aggregator.temporalAgg.bucketStart(key.StartIndex),
+			AvgBrightness: state.acc.Average(),
+			MinBrightness: state.acc.Min,
+			MaxBrightness: state.acc.Max,
+			Count:         state.acc.Count,
+		},
+		WindowEnd: state.end,
+		Kind:      kind,
+		Revision:  state.revision,
+	}
+}
+
+// emit sends results in window order, blocking until the consumer accepts them
+func (ea *EventTimeAggregator) emit(ctx context.Context, results []WindowedLightData) error {
+	if len(results) == 0 {
+		return nil
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if !a.TimeBucket.Equal(b.TimeBucket) {
+			return a.TimeBucket.Before(b.TimeBucket)
+		}
+		if a.GridLongitude != b.GridLongitude {
+			return a.GridLongitude < b.GridLongitude
+		}
+		return a.GridLatitude < b.GridLatitude
+	})
+
+	select {
+	case ea.outputChan <- results:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Watermark returns the current watermark
+func (ea *EventTimeAggregator) Watermark() time.Time {
+	ea.mu.Lock()
+	defer ea.mu.Unlock()
+	return ea.watermark
+}
+
+// Stats returns counts of late points applied as corrections and dropped past the allowed lateness
+func (ea *EventTimeAggregator) Stats() WindowStats {
+	ea.mu.Lock()
+	defer ea.mu.Unlock()
+	return ea.stats
+}
+
+// GetOutputChannel returns the channel for receiving windowed results
+func (ea *EventTimeAggregator) GetOutputChannel() <-chan []WindowedLightData {
+	return ea.outputChan
+}
+
+// Close treats the input as complete, fires every open window and closes the output channel
+func (ea *EventTimeAggregator) Close(ctx context.Context) error {
+	ea.mu.Lock()
+	defer ea.mu.Unlock()
+
+	if ea.closed {
+		return nil
+	}
+	ea.closed = true
+
+	var results []WindowedLightData
+	for _, state := range ea.windows {
+		switch {
+		case !state.fired:
+			results = append(results, ea.windowResult(state, WindowFinal))
+		case state.dirty:
+			state.revision++
+			results = append(results, ea.windowResult(state, WindowCorrection))
+		}
+	}
+	ea.windows = make(map[windowKey]*windowState)
+	ea.open, ea.fired, ea.dirty = nil, nil, nil
+
+	err := ea.emit(ctx, results)
+	close(ea.outputChan)
+	return err
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+var windowingTestConfig = &AggregationConfig{
+	SpatialResolutionKm: 1,
+	TemporalInterval:    time.Hour,
+	AggregationMethod:   "average",
+}
+
+var windowingStart = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func newTestWindows(t *testing.T, window WindowConfig) *EventTimeAggregator {
+	t.Helper()
+	ea, err := NewEventTimeAggregator(windowingTestConfig, window)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ea
+}
+
+// addAt adds a point of brightness 1 at the given hour, all in the same grid cell
+func addAt(t *testing.T, ea *EventTimeAggregator, hour int) {
+	t.Helper()
+	point := LightData{
+		Time:       windowingStart.Add(time.Duration(hour) * time.Hour),
+		Longitude:  121.5,
+		Latitude:   25.0,
+		Brightness: 1,
+	}
+	if err := ea.AddPoint(context.Background(), point); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// emitted returns the results waiting in the output channel without blocking
+func emitted(ea *EventTimeAggregator) []WindowedLightData {
+	var results []WindowedLightData
+	for {
+		select {
+		case batch := <-ea.GetOutputChannel():
+			results = append(results, batch...)
+		default:
+			return results
+		}
+	}
+}
+
+// closeWindows closes the aggregator and returns the results it emitted on close
+func closeWindows(t *testing.T, ea *EventTimeAggregator) []WindowedLightData {
+	t.Helper()
+	if err := ea.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	var results []WindowedLightData
+	for batch := range ea.GetOutputChannel() {
+		results = append(results, batch...)
+	}
+	return results
+}
+
+func hoursAfterStart(tm time.Time) int {
+	return int(tm.Sub(windowingStart) / time.Hour)
+}
+
+func TestEventTimeTumblingWindows(t *testing.T) {
+	ea := newTestWindows(t, WindowConfig{Type: TumblingWindow, SizeBuckets: 2})
+	for hour := 0; hour < 4; hour++ {
+		addAt(t, ea, hour)
+	}
+
+	// The point at hour 2 moved the watermark to the end of [0, 2)
+	results := emitted(ea)
+	if len(results) != 1 {
+		t.Fatalf("emitted %d windows before close, want 1", len(results))
+	}
+	if got := results[0]; got.Kind != WindowFinal || hoursAfterStart(got.TimeBucket) != 0 || hoursAfterStart(got.WindowEnd) != 2 || got.Count != 2 {
+		t.Errorf("first window = %+v, want a final [0h, 2h) with 2 points", got)
+	}
+
+	results = closeWindows(t, ea)
+	if len(results) != 1 || hoursAfterStart(results[0].TimeBucket) != 2 || results[0].Count != 2 {
+		t.Errorf("close emitted %+v, want the final [2h, 4h) with 2 points", results)
+	}
+}
+
+func TestEventTimeSlidingWindows(t *testing.T) {
+	ea := newTestWindows(t, WindowConfig{Type: SlidingWindow, SizeBuckets: 3, SlideBuckets: 1})
+	for hour := 0; hour < 5; hour++ {
+		addAt(t, ea, hour)
+	}
+	results := append(emitted(ea), closeWindows(t, ea)...)
+
+	// Windows start at every hour from -2 to 4, each covering the points of its three hours
+	want := map[int]int{-2: 1, -1: 2, 0: 3, 1: 3, 2: 3, 3: 2, 4: 1}
+	if len(results) != len(want) {
+		t.Fatalf("emitted %d windows, want %d", len(results), len(want))
+	}
+	for _, result := range results {
+		start := hoursAfterStart(result.TimeBucket)
+		if result.Kind != WindowFinal {
+			t.Errorf("window at %dh was emitted as %v, want a final", start, result.Kind)
+		}
+		if hoursAfterStart(result.WindowEnd) != start+3 {
+			t.Errorf("window at %dh ends at %v", start, result.WindowEnd)
+		}
+		if result.Count != want[start] {
+			t.Errorf("window at %dh has %d points, want %d", start, result.Count, want[start])
+		}
+	}
+}
+
+func TestEventTimeAllowedLateness(t *testing.T) {
+	ea := newTestWindows(t, WindowConfig{Type: TumblingWindow, SizeBuckets: 1, AllowedLateness: 2 * time.Hour})
+	addAt(t, ea, 0)
+	addAt(t, ea, 2)
+	if results := emitted(ea); len(results) != 1 || results[0].Kind != WindowFinal || results[0].Count != 1 {
+		t.Fatalf("emitted %+v, want the final of hour 0 with 1 point", results)
+	}
+
+	// The watermark is at 2h, within the lateness of hour 0, so the point corrects the fired window
+	addAt(t, ea, 0)
+	results := emitted(ea)
+	if len(results) != 1 {
+		t.Fatalf("emitted %d results for the late point, want 1", len(results))
+	}
+	if got := results[0]; got.Kind != WindowCorrection || got.Revision != 1 || got.Count != 2 || hoursAfterStart(got.TimeBucket) != 0 {
+		t.Errorf("correction = %+v, want revision 1 of hour 0 with 2 points", got)
+	}
+	if stats := ea.Stats(); stats.LatePointsApplied != 1 || stats.LatePointsDropped != 0 {
+		t.Errorf("stats = %+v, want 1 applied and 0 dropped", stats)
+	}
+
+	// At 3h the window of hour 0 expires and its state is purged
+	addAt(t, ea, 3)
+	emitted(ea)
+	if _, ok := ea.windows[windowKey{GridLongitude: 121.5, GridLatitude: 25.0, StartIndex: 0}]; ok {
+		t.Error("window of hour 0 was kept past its allowed lateness")
+	}
+	closeWindows(t, ea)
+}
+
+func TestEventTimeCorrectionEmittedOnce(t *testing.T) {
+	ea := newTestWindows(t, WindowConfig{Type: TumblingWindow, SizeBuckets: 1, AllowedLateness: 24 * time.Hour})
+	addAt(t, ea, 0)
+	addAt(t, ea, 5)
+	addAt(t, ea, 0)
+	for hour := 5; hour < 10; hour++ {
+		addAt(t, ea, hour)
+	}
+	results := append(emitted(ea), closeWindows(t, ea)...)
+
+	corrections := 0
+	for _, result := range results {
+		if result.Kind == WindowCorrection {
+			corrections++
+			if hoursAfterStart(result.TimeBucket) != 0 || result.Revision != 1 {
+				t.Errorf("unexpected correction %+v", result)
+			}
+		}
+	}
+	if corrections != 1 {
+		t.Errorf("emitted %d corrections for one late point, want 1", corrections)
+	}
+}
+
+func TestEventTimeDroppedLateCountsOncePerPoint(t *testing.T) {
+	ea := newTestWindows(t, WindowConfig{Type: SlidingWindow, SizeBuckets: 2, SlideBuckets: 1})
+	addAt(t, ea, 0)
+	addAt(t, ea, 10)
+	emitted(ea)
+
+	// Both windows containing hour 1 expired without allowed lateness
+	addAt(t, ea, 1)
+	if results := emitted(ea); len(results) != 0 {
+		t.Errorf("a dropped point emitted %+v", results)
+	}
+	if stats := ea.Stats(); stats.LatePointsDropped != 1 || stats.LatePointsApplied != 0 {
+		t.Errorf("stats = %+v, want 1 dropped and 0 applied", stats)
+	}
+	closeWindows(t, ea)
+}
+
+func TestEventTimeWatermarkDelay(t *testing.T) {
+	ea := newTestWindows(t, WindowConfig{Type: TumblingWindow, SizeBuckets: 1, WatermarkDelay: 2 * time.Hour})
+	addAt(t, ea, 0)
+	addAt(t, ea, 2)
+	if results := emitted(ea); len(results) != 0 {
+		t.Fatalf("emitted %+v before the delayed watermark passed hour 0", results)
+	}
+
+	// The delay keeps the window open, so the out-of-order point is part of the final instead of a correction
+	addAt(t, ea, 0)
+	addAt(t, ea, 3)
+	results := emitted(ea)
+	if len(results) != 1 || results[0].Kind != WindowFinal || results[0].Count != 2 {
+		t.Errorf("emitted %+v, want the final of hour 0 with 2 points", results)
+	}
+	closeWindows(t, ea)
+}
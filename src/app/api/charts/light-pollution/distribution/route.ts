@@ -35,7 +35,7 @@ export async function GET(request: NextRequest) {
     const queryText = `
       SELECT 
         county,
-        EXTRACT(MONTH FROM time) as month,
+        EXTRACT(MONTH FROM time AT TIME ZONE 'Asia/Taipei') as month,
         AVG(brightness) as avg_brightness
       FROM light_data_with_county 
       WHERE 
@@ -43,7 +43,7 @@ export async function GET(request: NextRequest) {
         AND time <= $2
         AND county IS NOT NULL
         AND brightness IS NOT NULL
-      GROUP BY county, EXTRACT(MONTH FROM time)
+      GROUP BY county, EXTRACT(MONTH FROM time AT TIME ZONE 'Asia/Taipei')
       ORDER BY county, month
     `;
 
@@ -75,7 +75,7 @@ export async function GET(request: NextRequest) {
         AVG(brightness) as avg_brightness
       FROM light_data_with_county 
       WHERE 
-        EXTRACT(MONTH FROM time) = $1
+        EXTRACT(MONTH FROM time AT TIME ZONE 'Asia/Taipei') = $1
         AND county IS NOT NULL
         AND brightness IS NOT NULL
     `;
@@ -83,7 +83,7 @@ export async function GET(request: NextRequest) {
     const queryParams: (number | string)[] = [monthNum];
 
     if (yearNum) {
-      queryText += ` AND EXTRACT(YEAR FROM time) = $2`;
+      queryText += ` AND EXTRACT(YEAR FROM time AT TIME ZONE 'Asia/Taipei') = $2`;
       queryParams.push(yearNum);
     }
 
@@ -33,14 +33,14 @@ export async function GET(request: NextRequest) {
     const queryText = `
       SELECT 
         county,
-        EXTRACT(MONTH FROM time) as month,
+        EXTRACT(MONTH FROM time AT TIME ZONE 'Asia/Taipei') as month,
         AVG(brightness) as avg_brightness
       FROM light_data_with_county 
       WHERE 
-        EXTRACT(YEAR FROM time) = $1
+        EXTRACT(YEAR FROM time AT TIME ZONE 'Asia/Taipei') = $1
         AND county = $2
         AND brightness IS NOT NULL
-      GROUP BY county, EXTRACT(MONTH FROM time)
+      GROUP BY county, EXTRACT(MONTH FROM time AT TIME ZONE 'Asia/Taipei')
       ORDER BY month
     `;
 
@@ -1,6 +1,7 @@
 import { NextRequest, NextResponse } from 'next/server';
-import { query } from '@/lib/db';
 import { AnimalAggregatedRow } from '@/lib/types/database';
+import { activityCondition, ACTIVITY_ERROR, queryByActivity } from '@/lib/utils/activity';
+import { applyEffortRates, queryCountyEffort } from '@/lib/utils/effort';
 
 export async function GET(request: NextRequest) {
   try {
@@ -37,21 +38,28 @@ export async function GET(request: NextRequest) {
     const startMonth = startDate.getMonth() + 1;
     const endMonth = endDate.getMonth() + 1;
 
-    const queryText = `
+    const monthRange = '(year > $1 OR (year = $1 AND month >= $2)) AND (year < $3 OR (year = $3 AND month <= $4))';
+    const monthParams = [startYear, startMonth, endYear, endMonth];
+    const filter = activityCondition(searchParams.get('activity'), monthRange, monthParams);
+    if (!filter) {
+      return NextResponse.json(
+        { error: ACTIVITY_ERROR },
+        { status: 400 }
+      );
+    }
+
+    const result = await queryByActivity((condition) => `
       SELECT 
         county,
         animal_type,
         SUM(total_amount) as total_amount,
         SUM(event_count) as event_count
       FROM animal_aggregated_data 
-      WHERE 
-        (year > $1 OR (year = $1 AND month >= $2))
-        AND (year < $3 OR (year = $3 AND month <= $4))
+      WHERE ${condition}
       GROUP BY county, animal_type
       ORDER BY county, animal_type
-    `;
-
-    const result = await query(queryText, [startYear, startMonth, endYear, endMonth]);
+    `, filter, monthRange, monthParams);
+    const effort = await queryCountyEffort(monthRange, monthParams);
 
     const countyMap = new Map();
     
@@ -71,6 +79,7 @@ export async function GET(request: NextRequest) {
     });
 
     const data = Array.from(countyMap.values());
+    applyEffortRates(data, effort);
 
     return NextResponse.json({
       data,
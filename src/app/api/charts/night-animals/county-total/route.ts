@@ -1,5 +1,5 @@
 import { NextRequest, NextResponse } from 'next/server';
-import { query } from '@/lib/db';
+import { activityCondition, ACTIVITY_ERROR, queryByActivity } from '@/lib/utils/activity';
 
 export async function GET(request: NextRequest) {
   try {
@@ -21,17 +21,23 @@ export async function GET(request: NextRequest) {
       );
     }
 
-    const queryText = `
+    const filter = activityCondition(searchParams.get('activity'), 'year = $1', [yearNum]);
+    if (!filter) {
+      return NextResponse.json(
+        { error: ACTIVITY_ERROR },
+        { status: 400 }
+      );
+    }
+
+    const result = await queryByActivity((condition) => `
       SELECT 
         county,
         SUM(total_amount) as total_amount
       FROM animal_aggregated_data 
-      WHERE year = $1
+      WHERE ${condition}
       GROUP BY county
       ORDER BY total_amount DESC
-    `;
-
-    const result = await query(queryText, [yearNum]);
+    `, filter, 'year = $1', [yearNum]);
 
     const data = result.rows.map((row: { county: string; total_amount: string }) => ({
       county: row.county,
@@ -1,6 +1,6 @@
 import { NextRequest, NextResponse } from 'next/server';
-import { query } from '@/lib/db';
 import { AnimalAggregatedRow, DatabaseParams } from '@/lib/types/database';
+import { activityCondition, ACTIVITY_ERROR, queryByActivity } from '@/lib/utils/activity';
 
 export async function GET(request: NextRequest) {
   try {
@@ -40,38 +40,28 @@ export async function GET(request: NextRequest) {
       );
     }
 
-    let queryText: string;
-    let queryParams: DatabaseParams;
-
-    if (county && county !== 'all') {
-      queryText = `
-        SELECT 
-          county,
-          animal_type,
-          SUM(total_amount) as total_amount,
-          SUM(event_count) as event_count
-        FROM animal_aggregated_data 
-        WHERE year = $1 AND season = $2 AND county = $3
-        GROUP BY county, animal_type
-        ORDER BY county, animal_type
-      `;
-      queryParams = [yearNum, seasonNum, county];
-    } else {
-      queryText = `
-        SELECT 
-          county,
-          animal_type,
-          SUM(total_amount) as total_amount,
-          SUM(event_count) as event_count
-        FROM animal_aggregated_data 
-        WHERE year = $1 AND season = $2
-        GROUP BY county, animal_type
-        ORDER BY county, animal_type
-      `;
-      queryParams = [yearNum, seasonNum];
+    const [where, params]: [string, DatabaseParams] = county && county !== 'all'
+      ? ['year = $1 AND season = $2 AND county = $3', [yearNum, seasonNum, county]]
+      : ['year = $1 AND season = $2', [yearNum, seasonNum]];
+    const filter = activityCondition(searchParams.get('activity'), where, params);
+    if (!filter) {
+      return NextResponse.json(
+        { error: ACTIVITY_ERROR },
+        { status: 400 }
+      );
     }
 
-    const result = await query(queryText, queryParams);
+    const result = await queryByActivity((condition) => `
+      SELECT 
+        county,
+        animal_type,
+        SUM(total_amount) as total_amount,
+        SUM(event_count) as event_count
+      FROM animal_aggregated_data 
+      WHERE ${condition}
+      GROUP BY county, animal_type
+      ORDER BY county, animal_type
+    `, filter, where, params);
 
     const countyMap = new Map();
     
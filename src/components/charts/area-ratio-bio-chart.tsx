@@ -99,6 +99,13 @@ const COUNTY_TO_REGION = {
   連江縣: "東部",
 };
 
+// Raw totals, or totals per observation day from the sampling effort so heavily surveyed counties
+// do not dominate their region
+const MEASURES = [
+  { value: "raw", label: "原始數量" },
+  { value: "normalized", label: "每觀測日" },
+];
+
 export function AreaRatioBioChart() {
   const defaultDate = getDefaultDate();
   const [selectedYear, setSelectedYear] = useState(
@@ -106,6 +113,7 @@ export function AreaRatioBioChart() {
   );
   const [selectedArea, setSelectedArea] = useState("北部");
   const [isAreaChanging, setIsAreaChanging] = useState(false);
+  const [selectedMeasure, setSelectedMeasure] = useState("raw");
 
   const availableYears = useMemo(() => getAvailableYears(), []);
   const availableAreas = ["北部", "中部", "南部", "東部"];
@@ -133,47 +141,71 @@ export function AreaRatioBioChart() {
     setSelectedArea(newArea);
   };
 
-  const chartData = useMemo(() => {
-    if (!data?.data) return [];
+  const { chartData, effortDays, normalized } = useMemo(() => {
+    if (!data?.data) return { chartData: [], effortDays: 0, normalized: false };
+
+    const counties = data.data.filter(
+      (county) =>
+        COUNTY_TO_REGION[county.county as keyof typeof COUNTY_TO_REGION] ===
+        selectedArea
+    );
+
+    // Normalize only when the API returned sampling effort for the area, otherwise keep raw totals
+    const effortDays = counties.reduce(
+      (sum, county) => sum + (county.effort_days ?? 0),
+      0
+    );
+    const normalized = selectedMeasure === "normalized" && effortDays > 0;
 
-    // Initialize animal counts for selected area
-    const animalCounts: Record<string, number> = {};
+    // Initialize animal values for selected area
+    const animalValues: Record<string, { value: number; events: number }> =
+      {};
     BIO_GROUPS.forEach((bioGroup) => {
-      animalCounts[bioGroup] = 0;
+      animalValues[bioGroup] = { value: 0, events: 0 };
     });
 
-    // Aggregate data for counties in the selected area
-    data.data.forEach((county) => {
-      const region =
-        COUNTY_TO_REGION[county.county as keyof typeof COUNTY_TO_REGION];
-      if (region === selectedArea) {
-        county.animals.forEach((animal) => {
-          if (animalCounts[animal.animal_type] !== undefined) {
-            animalCounts[animal.animal_type] += animal.total_amount;
-          }
-        });
-      }
+    // Aggregate data for counties in the selected area. Normalized values weight each county's
+    // rates by its observation days, giving the area's amount and events per observation day.
+    counties.forEach((county) => {
+      const days = county.effort_days ?? 0;
+      if (normalized && days === 0) return;
+      county.animals.forEach((animal) => {
+        const entry = animalValues[animal.animal_type];
+        if (entry === undefined) return;
+        if (normalized) {
+          entry.value += ((animal.amount_rate ?? 0) * days) / effortDays;
+          entry.events += ((animal.event_rate ?? 0) * days) / effortDays;
+        } else {
+          entry.value += animal.total_amount;
+          entry.events += animal.event_count;
+        }
+      });
     });
 
     // Convert to chart format
-    const total = Object.values(animalCounts).reduce(
-      (sum, amount) => sum + amount,
+    const total = Object.values(animalValues).reduce(
+      (sum, entry) => sum + entry.value,
       0
     );
 
-    if (total > 0) {
-      return Object.entries(animalCounts)
-        .filter(([, amount]) => amount > 0)
-        .map(([animalType, amount]) => ({
-          animal_type: animalType,
-          total_amount: amount,
-          percentage: (amount / total) * 100,
-          fill: COLORS[animalType as keyof typeof COLORS] || COLORS.鳥類,
-        }));
-    } else {
-      return [];
-    }
-  }, [data, selectedArea]);
+    if (total <= 0) return { chartData: [], effortDays, normalized };
+
+    const chartData = Object.entries(animalValues)
+      .filter(([, entry]) => entry.value > 0)
+      .map(([animalType, entry]) => ({
+        animal_type: animalType,
+        value: entry.value,
+        events: entry.events,
+        percentage: (entry.value / total) * 100,
+        fill: COLORS[animalType as keyof typeof COLORS] || COLORS.鳥類,
+      }));
+    return { chartData, effortDays, normalized };
+  }, [data, selectedArea, selectedMeasure]);
+
+  const unit = normalized ? " 隻/觀測日" : " 隻";
+  const eventUnit = normalized ? " 筆/觀測日" : " 筆";
+  const formatValue = (value: number) =>
+    normalized ? value.toFixed(2) : value.toLocaleString();
 
   // Skeleton component for the chart
   const ChartSkeleton = () => (
@@ -248,6 +280,18 @@ export function AreaRatioBioChart() {
               ))}
             </SelectContent>
           </Select>
+          <Select value={selectedMeasure} onValueChange={setSelectedMeasure}>
+            <SelectTrigger className="w-[120px]">
+              <SelectValue placeholder="選擇數值" />
+            </SelectTrigger>
+            <SelectContent>
+              {MEASURES.map((measure) => (
+                <SelectItem key={measure.value} value={measure.value}>
+                  {measure.label}
+                </SelectItem>
+              ))}
+            </SelectContent>
+          </Select>
         </div>
       </CardHeader>
       <CardContent>
@@ -260,7 +304,16 @@ export function AreaRatioBioChart() {
               <h4 className="text-xl font-semibold">
                 {selectedArea} - {selectedYear} 年
               </h4>
-              <p className="text-muted-foreground">七類生物分佈比例</p>
+              <p className="text-muted-foreground">
+                {normalized
+                  ? `七類生物每觀測日數量比例（觀測 ${effortDays.toLocaleString()} 天）`
+                  : "七類生物分佈比例"}
+              </p>
+              {selectedMeasure === "normalized" && !normalized && (
+                <p className="text-sm text-muted-foreground">
+                  此區域沒有採樣努力量資料，顯示原始數量
+                </p>
+              )}
             </div>
 
             {chartData.length === 0 ? (
@@ -293,23 +346,20 @@ export function AreaRatioBioChart() {
                       content={
                         <ChartTooltipContent
                           nameKey="animal_type"
-                          formatter={(value) => [
-                            `${Number(value).toLocaleString()} (${(
-                              ((value as number) /
-                                chartData.reduce(
-                                  (sum, item) => sum + item.total_amount,
-                                  0
-                                )) *
-                              100
-                            ).toFixed(1)}%)`,
-                            " 隻",
+                          formatter={(value, _name, item) => [
+                            `${formatValue(Number(value))} (${(
+                              item.payload.percentage as number
+                            ).toFixed(1)}%), ${formatValue(
+                              item.payload.events as number
+                            )}${eventUnit}`,
+                            unit,
                           ]}
                         />
                       }
                     />
                     <Pie
                       data={chartData}
-                      dataKey="total_amount"
+                      dataKey="value"
                       nameKey="animal_type"
                       cx="50%"
                       cy="50%"
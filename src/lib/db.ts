@@ -24,4 +24,14 @@ export async function query(text: string, params?: DatabaseParams) {
   } finally {
     client.release();
   }
-}
\ No newline at end of file
+}
+// Postgres error codes of a table or column the Go migration has not created yet
+const UNDEFINED_TABLE = '42P01';
+const UNDEFINED_COLUMN = '42703';
+
+const errorCode = (error: unknown) =>
+  typeof error === 'object' && error !== null && 'code' in error ? (error as { code?: string }).code : undefined;
+
+export const isUndefinedTable = (error: unknown) => errorCode(error) === UNDEFINED_TABLE;
+
+export const isUndefinedColumn = (error: unknown) => errorCode(error) === UNDEFINED_COLUMN;
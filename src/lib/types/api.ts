@@ -93,10 +93,13 @@ export interface AreaAnimalParams {
 
 export interface AreaAnimalData {
   county: string;
+  effort_days?: number; // observation days over the time range, absent without sampling effort
   animals: Array<{
     animal_type: string;
     total_amount: number;
     event_count: number;
+    event_rate?: number; // event_count per observation day
+    amount_rate?: number; // total_amount per observation day
   }>;
 }
 
@@ -110,14 +113,8 @@ export interface AreaRatioParams {
   end_time: string;
 }
 
-export interface AreaRatioData {
-  county: string;
-  animals: Array<{
-    animal_type: string;
-    total_amount: number;
-    event_count: number;
-  }>;
-}
+// The ratio chart reads the same county totals and effort rates as the amount chart
+export type AreaRatioData = AreaAnimalData;
 
 export interface AreaRatioResponse {
   data: AreaRatioData[];
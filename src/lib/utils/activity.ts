@@ -0,0 +1,44 @@
+import { isUndefinedColumn, query } from '@/lib/db';
+import { DatabaseParams } from '@/lib/types/database';
+
+// Activity periods of animal_aggregated_data, resolved by the Go migration into taxon_activity
+export const ACTIVITY_PERIODS = ['nocturnal', 'diurnal', 'crepuscular', 'unknown'];
+
+export const ACTIVITY_ERROR = 'activity must be nocturnal, diurnal, crepuscular, unknown or all';
+
+// Narrows a where clause over animal_aggregated_data to the activity query parameter, like
+// activityCondition in insert_data/server.go. Returns null when the parameter is invalid.
+export const activityCondition = (
+  activity: string | null,
+  where: string,
+  params: DatabaseParams
+): { where: string; params: DatabaseParams } | null => {
+  if (!activity || activity === 'all') {
+    return { where, params };
+  }
+  if (!ACTIVITY_PERIODS.includes(activity)) {
+    return null;
+  }
+  const next = [...params, activity];
+  return { where: `(${where}) AND activity_period = $${next.length}`, params: next };
+};
+
+// Runs a query built around the activity filter. When animal_aggregated_data predates the
+// activity_period column it warns and reruns the query over the unfiltered where clause, so the
+// charts show raw counts over all periods instead of failing.
+export const queryByActivity = async (
+  buildQuery: (where: string) => string,
+  filter: { where: string; params: DatabaseParams },
+  where: string,
+  params: DatabaseParams
+) => {
+  try {
+    return await query(buildQuery(filter.where), filter.params);
+  } catch (error) {
+    if (filter.where === where || !isUndefinedColumn(error)) {
+      throw error;
+    }
+    console.warn('animal_aggregated_data has no activity_period column, returning raw counts over all periods');
+    return query(buildQuery(where), params);
+  }
+};
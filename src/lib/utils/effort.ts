@@ -0,0 +1,46 @@
+import { isUndefinedTable, query } from '@/lib/db';
+import { DatabaseParams } from '@/lib/types/database';
+import { AreaAnimalData } from '@/lib/types/api';
+
+// Observation days per county from sampling_effort_aggregated, filled by the Go migration, like
+// queryCountyEffort in insert_data/server.go. Before that migration has run the map is empty, so
+// every county keeps its raw counts.
+export const queryCountyEffort = async (where: string, params: DatabaseParams) => {
+  const effort = new Map<string, number>();
+  let result;
+  try {
+    result = await query(`
+      SELECT county, SUM(observation_days) as observation_days
+      FROM sampling_effort_aggregated
+      WHERE ${where}
+      GROUP BY county
+    `, params);
+  } catch (error) {
+    if (!isUndefinedTable(error)) {
+      throw error;
+    }
+    console.warn('sampling_effort_aggregated is missing, returning raw counts');
+    return effort;
+  }
+
+  result.rows.forEach((row: { county: string; observation_days: string }) => {
+    effort.set(row.county, parseInt(row.observation_days));
+  });
+  return effort;
+};
+
+// Divides the county totals by the county's observation days, so counties surveyed on more days do not
+// dominate the ratio chart. Counties without effort keep only their totals.
+export const applyEffortRates = (data: AreaAnimalData[], effort: Map<string, number>) => {
+  data.forEach((county) => {
+    const days = effort.get(county.county);
+    if (!days) {
+      return;
+    }
+    county.effort_days = days;
+    county.animals.forEach((animal) => {
+      animal.event_rate = animal.event_count / days;
+      animal.amount_rate = animal.total_amount / days;
+    });
+  });
+};